@@ -0,0 +1,144 @@
+// Copyright 2021-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect_test
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	connect "connectrpc.com/connect"
+	"connectrpc.com/connect/internal/assert"
+	pingv1 "connectrpc.com/connect/internal/gen/connect/ping/v1"
+	"connectrpc.com/connect/internal/memhttp/memhttptest"
+)
+
+// TestStreamBackpressure checks that Send applies backpressure: it returns
+// only once HTTP/2 flow control has accepted the message, so a producer
+// facing a slow consumer stalls instead of buffering without bound.
+func TestStreamBackpressure(t *testing.T) {
+	t.Parallel()
+	const (
+		uploadProcedure   = "/connect.ping.v1.PingService/Upload"
+		downloadProcedure = "/connect.ping.v1.PingService/Download"
+		messages          = 1024
+		// The producer tries to send 64MiB, far more than the flow control
+		// windows (a few MiB) allow in flight.
+		messageSize = 64 * 1024
+		maxInFlight = 16 * 1024 * 1024
+	)
+	// Random data doesn't compress, so the payload's size on the wire is
+	// about the same with or without gzip.
+	random := make([]byte, messageSize*3/4)
+	_, err := rand.Read(random)
+	assert.Nil(t, err)
+	payload := base64.StdEncoding.EncodeToString(random)
+	// waitForStall waits until the producer makes no progress, which it does
+	// once every buffer between it and the consumer is full.
+	waitForStall := func(progress *atomic.Int64) int64 {
+		last := int64(-1)
+		for {
+			time.Sleep(100 * time.Millisecond)
+			current := progress.Load()
+			if current == last {
+				return current
+			}
+			last = current
+		}
+	}
+	uploadRelease := make(chan struct{})
+	var uploaded, downloaded atomic.Int64
+	mux := http.NewServeMux()
+	mux.Handle(uploadProcedure, connect.NewClientStreamHandler(
+		uploadProcedure,
+		func(_ context.Context, stream *connect.ClientStream[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+			// A slow consumer: don't read until the test says so.
+			<-uploadRelease
+			var count int64
+			for stream.Receive() {
+				count++
+			}
+			if err := stream.Err(); err != nil {
+				return nil, err
+			}
+			return connect.NewResponse(&pingv1.PingResponse{Number: count}), nil
+		},
+	))
+	mux.Handle(downloadProcedure, connect.NewServerStreamHandler(
+		downloadProcedure,
+		func(_ context.Context, _ *connect.Request[pingv1.PingRequest], stream *connect.ServerStream[pingv1.PingResponse]) error {
+			for range messages {
+				if err := stream.Send(&pingv1.PingResponse{Text: payload}); err != nil {
+					return err
+				}
+				downloaded.Add(1)
+			}
+			return nil
+		},
+	))
+	server := memhttptest.NewServer(t, mux)
+
+	t.Run("client_send", func(t *testing.T) {
+		t.Parallel()
+		client := connect.NewClient[pingv1.PingRequest, pingv1.PingResponse](
+			server.Client(),
+			server.URL()+uploadProcedure,
+		)
+		stream := client.CallClientStream(context.Background())
+		done := make(chan error, 1)
+		go func() {
+			for range messages {
+				if err := stream.Send(&pingv1.PingRequest{Text: payload}); err != nil {
+					done <- err
+					return
+				}
+				uploaded.Add(1)
+			}
+			done <- nil
+		}()
+		sent := waitForStall(&uploaded)
+		assert.True(t, sent < messages, assert.Sprintf("sent all %d messages to a stalled handler", sent))
+		assert.True(t, sent*messageSize <= maxInFlight, assert.Sprintf("%d messages in flight", sent))
+		close(uploadRelease)
+		assert.Nil(t, <-done)
+		response, err := stream.CloseAndReceive()
+		assert.Nil(t, err)
+		assert.Equal(t, response.Msg.GetNumber(), int64(messages))
+	})
+	t.Run("handler_send", func(t *testing.T) {
+		t.Parallel()
+		client := connect.NewClient[pingv1.PingRequest, pingv1.PingResponse](
+			server.Client(),
+			server.URL()+downloadProcedure,
+		)
+		stream, err := client.CallServerStream(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+		assert.Nil(t, err)
+		// A slow consumer: don't read until the handler stalls.
+		sent := waitForStall(&downloaded)
+		assert.True(t, sent < messages, assert.Sprintf("sent all %d messages to a stalled client", sent))
+		assert.True(t, sent*messageSize <= maxInFlight, assert.Sprintf("%d messages in flight", sent))
+		var received int64
+		for stream.Receive() {
+			received++
+		}
+		assert.Nil(t, stream.Err())
+		assert.Nil(t, stream.Close())
+		assert.Equal(t, received, int64(messages))
+	})
+}
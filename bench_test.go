@@ -23,6 +23,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
 	"testing"
 
 	connect "connectrpc.com/connect"
@@ -187,6 +188,43 @@ func BenchmarkConnect(b *testing.B) {
 	}
 }
 
+func BenchmarkBufferPool(b *testing.B) {
+	// Services that create a client per request (for example, to forward
+	// credentials) start each client with an empty buffer pool, unless they
+	// share one.
+	shared := &sync.Pool{}
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(&ExamplePingServer{}, connect.WithBufferPool(shared)))
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	b.Cleanup(server.Close)
+	httpClient := server.Client()
+
+	text := strings.Repeat("a", 64*1024)
+	for _, benchmark := range []struct {
+		name string
+		opts []connect.ClientOption
+	}{
+		{name: "per_client"},
+		{name: "shared", opts: []connect.ClientOption{connect.WithBufferPool(shared)}},
+	} {
+		b.Run(benchmark.name, func(b *testing.B) {
+			b.ReportAllocs()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					client := pingv1connect.NewPingServiceClient(httpClient, server.URL, benchmark.opts...)
+					if _, err := client.Ping(
+						context.Background(), connect.NewRequest(&pingv1.PingRequest{Text: text}),
+					); err != nil {
+						b.Error(err)
+					}
+				}
+			})
+		})
+	}
+}
+
 type ping struct {
 	Text string `json:"text"`
 }
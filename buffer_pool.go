@@ -25,12 +25,12 @@ const (
 )
 
 type bufferPool struct {
-	sync.Pool
+	pool *sync.Pool
 }
 
 func newBufferPool() *bufferPool {
 	return &bufferPool{
-		Pool: sync.Pool{
+		pool: &sync.Pool{
 			New: func() any {
 				return bytes.NewBuffer(make([]byte, 0, initialBufferSize))
 			},
@@ -38,10 +38,17 @@ func newBufferPool() *bufferPool {
 	}
 }
 
+// newSharedBufferPool borrows buffers from a caller-supplied pool, which may
+// also be used by other clients and handlers.
+func newSharedBufferPool(pool *sync.Pool) *bufferPool {
+	return &bufferPool{pool: pool}
+}
+
 func (b *bufferPool) Get() *bytes.Buffer {
-	if buf, ok := b.Pool.Get().(*bytes.Buffer); ok {
+	if buf, ok := b.pool.Get().(*bytes.Buffer); ok {
 		return buf
 	}
+	// Shared pools may be empty, without a New function, or hold other types.
 	return bytes.NewBuffer(make([]byte, 0, initialBufferSize))
 }
 
@@ -50,5 +57,5 @@ func (b *bufferPool) Put(buffer *bytes.Buffer) {
 		return
 	}
 	buffer.Reset()
-	b.Pool.Put(buffer)
+	b.pool.Put(buffer)
 }
@@ -0,0 +1,129 @@
+// Copyright 2021-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	connect "connectrpc.com/connect"
+	"connectrpc.com/connect/internal/assert"
+	pingv1 "connectrpc.com/connect/internal/gen/connect/ping/v1"
+	"connectrpc.com/connect/internal/gen/connect/ping/v1/pingv1connect"
+	"connectrpc.com/connect/internal/memhttp/memhttptest"
+)
+
+func TestWithBufferPool(t *testing.T) {
+	t.Parallel()
+	var allocated atomic.Int64
+	pool := &sync.Pool{
+		New: func() any {
+			allocated.Add(1)
+			return new(bytes.Buffer)
+		},
+	}
+	t.Cleanup(func() {
+		// Clients and handlers borrowed buffers from the shared pool.
+		assert.NotZero(t, allocated.Load())
+	})
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(
+		&pluggablePingServer{
+			ping: func(_ context.Context, request *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+				return connect.NewResponse(&pingv1.PingResponse{
+					Number: request.Msg.GetNumber(),
+					Text:   request.Msg.GetText(),
+				}), nil
+			},
+			countUp: func(_ context.Context, request *connect.Request[pingv1.CountUpRequest], stream *connect.ServerStream[pingv1.CountUpResponse]) error {
+				for i := int64(1); i <= request.Msg.GetNumber(); i++ {
+					if err := stream.Send(&pingv1.CountUpResponse{Number: i}); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		connect.WithBufferPool(pool),
+		connect.WithReadMaxBytes(1024),
+	))
+	server := memhttptest.NewServer(t, mux)
+	for _, protocol := range []struct {
+		name string
+		opts []connect.ClientOption
+	}{
+		{name: "connect"},
+		{name: "connect_json", opts: []connect.ClientOption{connect.WithProtoJSON()}},
+		{name: "grpc", opts: []connect.ClientOption{connect.WithGRPC()}},
+		{name: "grpcweb", opts: []connect.ClientOption{connect.WithGRPCWeb()}},
+	} {
+		t.Run(protocol.name, func(t *testing.T) {
+			t.Parallel()
+			client := pingv1connect.NewPingServiceClient(
+				server.Client(),
+				server.URL(),
+				append([]connect.ClientOption{connect.WithBufferPool(pool), connect.WithSendGzip()}, protocol.opts...)...,
+			)
+			// Concurrent calls share the pool. Every response must hold its own
+			// data, even after the buffer it was read from has been reused.
+			var wg sync.WaitGroup
+			responses := make([]*pingv1.PingResponse, 20)
+			for i := range responses {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					response, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{
+						Number: int64(i),
+						Text:   strings.Repeat(fmt.Sprint(i%10), 100),
+					}))
+					assert.Nil(t, err)
+					responses[i] = response.Msg
+				}()
+			}
+			wg.Wait()
+			for i, response := range responses {
+				assert.Equal(t, response.GetNumber(), int64(i))
+				assert.Equal(t, response.GetText(), strings.Repeat(fmt.Sprint(i%10), 100))
+			}
+
+			stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{Number: 5}))
+			assert.Nil(t, err)
+			var received []*pingv1.CountUpResponse
+			for stream.Receive() {
+				received = append(received, stream.Msg())
+			}
+			assert.Nil(t, stream.Err())
+			assert.Nil(t, stream.Close())
+			for i, msg := range received {
+				assert.Equal(t, msg.GetNumber(), int64(i+1))
+			}
+
+			// Failed calls don't break the pool for later ones.
+			_, err = client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{
+				Text: strings.Repeat("too big ", 1000),
+			}))
+			assert.Equal(t, connect.CodeOf(err), connect.CodeResourceExhausted)
+			response, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Number: 42}))
+			assert.Nil(t, err)
+			assert.Equal(t, response.Msg.GetNumber(), 42)
+		})
+	}
+}
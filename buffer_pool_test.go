@@ -0,0 +1,71 @@
+// Copyright 2021-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+
+	"connectrpc.com/connect/internal/assert"
+)
+
+func TestSharedBufferPool(t *testing.T) {
+	t.Parallel()
+	t.Run("no_new", func(t *testing.T) {
+		t.Parallel()
+		pool := newSharedBufferPool(&sync.Pool{})
+		buffer := pool.Get()
+		assert.NotNil(t, buffer)
+		assert.Zero(t, buffer.Len())
+	})
+	t.Run("foreign_values", func(t *testing.T) {
+		t.Parallel()
+		pool := newSharedBufferPool(&sync.Pool{New: func() any { return "not a buffer" }})
+		assert.NotNil(t, pool.Get())
+	})
+	t.Run("reset", func(t *testing.T) {
+		t.Parallel()
+		shared := &sync.Pool{}
+		pool := newSharedBufferPool(shared)
+		buffer := pool.Get()
+		buffer.WriteString("leftover")
+		pool.Put(buffer)
+		// sync.Pool may drop values at any time, so only check what we get back.
+		if value, ok := shared.Get().(*bytes.Buffer); ok {
+			assert.Zero(t, value.Len())
+		}
+	})
+	t.Run("options", func(t *testing.T) {
+		t.Parallel()
+		shared := &sync.Pool{}
+		clientConfig, err := newClientConfig("http://localhost/connect.ping.v1.PingService/Ping", []ClientOption{
+			WithBufferPool(shared),
+		})
+		assert.Nil(t, err)
+		assert.True(t, clientConfig.BufferPool.pool == shared)
+		handlerConfig := newHandlerConfig("/connect.ping.v1.PingService/Ping", StreamTypeUnary, []HandlerOption{
+			WithBufferPool(shared),
+		})
+		assert.True(t, handlerConfig.BufferPool.pool == shared)
+		// nil leaves the default pool in place.
+		clientConfig, err = newClientConfig("http://localhost/connect.ping.v1.PingService/Ping", []ClientOption{
+			WithBufferPool(nil),
+		})
+		assert.Nil(t, err)
+		assert.NotNil(t, clientConfig.BufferPool.pool)
+		assert.False(t, clientConfig.BufferPool.pool == shared)
+	})
+}
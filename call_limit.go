@@ -0,0 +1,167 @@
+// Copyright 2021-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// errTooManyCalls is the error returned for calls shed by the client.
+var errTooManyCalls = errors.New("too many concurrent calls")
+
+// callLimitInterceptor bounds the number of calls a client has in flight. The
+// semaphore is created with the option, so every client built from the same
+// option (for example, all the methods of a generated service client) shares
+// one limit.
+type callLimitInterceptor struct {
+	slots chan struct{}
+	wait  time.Duration
+}
+
+func newCallLimitInterceptor(limit int, wait time.Duration) *callLimitInterceptor {
+	if limit < 1 {
+		limit = 1
+	}
+	return &callLimitInterceptor{
+		slots: make(chan struct{}, limit),
+		wait:  wait,
+	}
+}
+
+func (i *callLimitInterceptor) WrapUnary(next UnaryFunc) UnaryFunc {
+	return func(ctx context.Context, request AnyRequest) (AnyResponse, error) {
+		if !request.Spec().IsClient {
+			return next(ctx, request)
+		}
+		if err := i.acquire(ctx); err != nil {
+			return nil, err
+		}
+		defer i.release()
+		return next(ctx, request)
+	}
+}
+
+func (i *callLimitInterceptor) WrapStreamingClient(next StreamingClientFunc) StreamingClientFunc {
+	return func(ctx context.Context, spec Spec) StreamingClientConn {
+		if err := i.acquire(ctx); err != nil {
+			return &rejectedStreamingClientConn{
+				spec:          spec,
+				requestHeader: make(http.Header),
+				err:           err,
+			}
+		}
+		return &callLimitStreamingClientConn{
+			StreamingClientConn: next(ctx, spec),
+			release:             sync.OnceFunc(i.release),
+		}
+	}
+}
+
+func (i *callLimitInterceptor) WrapStreamingHandler(next StreamingHandlerFunc) StreamingHandlerFunc {
+	return next
+}
+
+// acquire takes a slot, waiting up to the configured duration for one to
+// free up.
+func (i *callLimitInterceptor) acquire(ctx context.Context) error {
+	select {
+	case i.slots <- struct{}{}:
+		return nil
+	default:
+	}
+	if i.wait <= 0 {
+		return NewError(CodeResourceExhausted, errTooManyCalls)
+	}
+	timer := time.NewTimer(i.wait)
+	defer timer.Stop()
+	select {
+	case i.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return wrapIfContextError(ctx.Err())
+	case <-timer.C:
+		return NewError(CodeResourceExhausted, errTooManyCalls)
+	}
+}
+
+func (i *callLimitInterceptor) release() {
+	<-i.slots
+}
+
+// callLimitStreamingClientConn gives its slot back when the stream is closed.
+type callLimitStreamingClientConn struct {
+	StreamingClientConn
+
+	release func()
+}
+
+func (c *callLimitStreamingClientConn) CloseResponse() error {
+	defer c.release()
+	return c.StreamingClientConn.CloseResponse()
+}
+
+func (c *callLimitStreamingClientConn) Unwrap() StreamingClientConn {
+	return c.StreamingClientConn
+}
+
+// rejectedStreamingClientConn fails a stream that never got a slot, without
+// making an HTTP request.
+type rejectedStreamingClientConn struct {
+	messageCounts
+
+	spec          Spec
+	requestHeader http.Header
+	err           error
+}
+
+func (c *rejectedStreamingClientConn) Spec() Spec {
+	return c.spec
+}
+
+func (c *rejectedStreamingClientConn) Peer() Peer {
+	return Peer{}
+}
+
+func (c *rejectedStreamingClientConn) Send(any) error {
+	return c.err
+}
+
+func (c *rejectedStreamingClientConn) RequestHeader() http.Header {
+	return c.requestHeader
+}
+
+func (c *rejectedStreamingClientConn) CloseRequest() error {
+	return nil
+}
+
+func (c *rejectedStreamingClientConn) Receive(any) error {
+	return c.err
+}
+
+func (c *rejectedStreamingClientConn) ResponseHeader() http.Header {
+	return make(http.Header)
+}
+
+func (c *rejectedStreamingClientConn) ResponseTrailer() http.Header {
+	return make(http.Header)
+}
+
+func (c *rejectedStreamingClientConn) CloseResponse() error {
+	return nil
+}
@@ -0,0 +1,206 @@
+// Copyright 2021-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	connect "connectrpc.com/connect"
+	"connectrpc.com/connect/internal/assert"
+	pingv1 "connectrpc.com/connect/internal/gen/connect/ping/v1"
+	"connectrpc.com/connect/internal/gen/connect/ping/v1/pingv1connect"
+	"connectrpc.com/connect/internal/memhttp/memhttptest"
+)
+
+// gatedPingServer holds Pings with a non-zero number, and CountUp streams
+// after their first message, until the gate opens.
+type gatedPingServer struct {
+	pingv1connect.UnimplementedPingServiceHandler
+
+	started chan struct{}
+	gate    chan struct{}
+}
+
+func newGatedPingServer() *gatedPingServer {
+	return &gatedPingServer{
+		started: make(chan struct{}, 16),
+		gate:    make(chan struct{}),
+	}
+}
+
+func (s *gatedPingServer) Ping(
+	ctx context.Context,
+	request *connect.Request[pingv1.PingRequest],
+) (*connect.Response[pingv1.PingResponse], error) {
+	if request.Msg.GetNumber() != 0 {
+		s.started <- struct{}{}
+		select {
+		case <-s.gate:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return connect.NewResponse(&pingv1.PingResponse{Number: request.Msg.GetNumber()}), nil
+}
+
+func (s *gatedPingServer) CountUp(
+	ctx context.Context,
+	_ *connect.Request[pingv1.CountUpRequest],
+	stream *connect.ServerStream[pingv1.CountUpResponse],
+) error {
+	if err := stream.Send(&pingv1.CountUpResponse{Number: 1}); err != nil {
+		return err
+	}
+	select {
+	case <-s.gate:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func TestWithMaxConcurrentCalls(t *testing.T) {
+	t.Parallel()
+	const limit = 2
+	newClient := func(t *testing.T, server *gatedPingServer, opt connect.ClientOption) pingv1connect.PingServiceClient {
+		t.Helper()
+		mux := http.NewServeMux()
+		mux.Handle(pingv1connect.NewPingServiceHandler(server))
+		httpServer := memhttptest.NewServer(t, mux)
+		return pingv1connect.NewPingServiceClient(httpServer.Client(), httpServer.URL(), opt)
+	}
+	// saturate starts limit blocked Pings and waits for them to reach the
+	// server. The returned channel delivers their errors.
+	saturate := func(t *testing.T, client pingv1connect.PingServiceClient, server *gatedPingServer) <-chan error {
+		t.Helper()
+		errs := make(chan error, limit)
+		for range limit {
+			go func() {
+				_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Number: 1}))
+				errs <- err
+			}()
+		}
+		for range limit {
+			<-server.started
+		}
+		return errs
+	}
+	ping := func(ctx context.Context, client pingv1connect.PingServiceClient) error {
+		_, err := client.Ping(ctx, connect.NewRequest(&pingv1.PingRequest{}))
+		return err
+	}
+	t.Run("reject", func(t *testing.T) {
+		t.Parallel()
+		server := newGatedPingServer()
+		client := newClient(t, server, connect.WithMaxConcurrentCalls(limit))
+		errs := saturate(t, client, server)
+		err := ping(context.Background(), client)
+		assert.Equal(t, connect.CodeOf(err), connect.CodeResourceExhausted)
+		// Streams count against the same limit.
+		_, err = client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{}))
+		assert.Equal(t, connect.CodeOf(err), connect.CodeResourceExhausted)
+		bidi := client.CumSum(context.Background())
+		err = bidi.Send(&pingv1.CumSumRequest{})
+		assert.Equal(t, connect.CodeOf(err), connect.CodeResourceExhausted)
+		_, err = bidi.Receive()
+		assert.Equal(t, connect.CodeOf(err), connect.CodeResourceExhausted)
+		assert.Nil(t, bidi.CloseRequest())
+		assert.Nil(t, bidi.CloseResponse())
+
+		close(server.gate)
+		for range limit {
+			assert.Nil(t, <-errs)
+		}
+		// Every slot is free again.
+		for range limit + 1 {
+			assert.Nil(t, ping(context.Background(), client))
+		}
+	})
+	t.Run("streams_hold_slots", func(t *testing.T) {
+		t.Parallel()
+		server := newGatedPingServer()
+		client := newClient(t, server, connect.WithMaxConcurrentCalls(limit))
+		streams := make([]*connect.ServerStreamForClient[pingv1.CountUpResponse], limit)
+		for i := range streams {
+			var err error
+			streams[i], err = client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{}))
+			assert.Nil(t, err)
+			assert.True(t, streams[i].Receive())
+		}
+		err := ping(context.Background(), client)
+		assert.Equal(t, connect.CodeOf(err), connect.CodeResourceExhausted)
+		// Closing a stream early, which cancels it, frees its slot.
+		assert.Nil(t, streams[0].Close())
+		assert.Nil(t, ping(context.Background(), client))
+		// So does a stream that runs to completion.
+		close(server.gate)
+		assert.False(t, streams[1].Receive())
+		assert.Nil(t, streams[1].Err())
+		assert.Nil(t, streams[1].Close())
+		for i := range streams {
+			streams[i], err = client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{}))
+			assert.Nil(t, err)
+			assert.True(t, streams[i].Receive())
+			assert.False(t, streams[i].Receive())
+			assert.Nil(t, streams[i].Err())
+		}
+		for _, stream := range streams {
+			assert.Nil(t, stream.Close())
+		}
+	})
+	t.Run("block", func(t *testing.T) {
+		t.Parallel()
+		server := newGatedPingServer()
+		client := newClient(t, server, connect.WithMaxConcurrentCallsWait(limit, 10*time.Second))
+		errs := saturate(t, client, server)
+		waiting := make(chan error, 1)
+		go func() {
+			waiting <- ping(context.Background(), client)
+		}()
+		select {
+		case err := <-waiting:
+			t.Fatalf("call didn't wait for a free slot: %v", err)
+		case <-time.After(50 * time.Millisecond):
+		}
+		close(server.gate)
+		assert.Nil(t, <-waiting)
+		for range limit {
+			assert.Nil(t, <-errs)
+		}
+	})
+	t.Run("block_timeout", func(t *testing.T) {
+		t.Parallel()
+		server := newGatedPingServer()
+		client := newClient(t, server, connect.WithMaxConcurrentCallsWait(limit, 20*time.Millisecond))
+		errs := saturate(t, client, server)
+		err := ping(context.Background(), client)
+		assert.Equal(t, connect.CodeOf(err), connect.CodeResourceExhausted)
+		// The caller's deadline wins if it's sooner.
+		client = newClient(t, server, connect.WithMaxConcurrentCallsWait(limit, 10*time.Second))
+		otherErrs := saturate(t, client, server)
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		err = ping(ctx, client)
+		assert.Equal(t, connect.CodeOf(err), connect.CodeDeadlineExceeded)
+		close(server.gate)
+		for range limit {
+			assert.Nil(t, <-errs)
+			assert.Nil(t, <-otherErrs)
+		}
+	})
+}
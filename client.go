@@ -22,6 +22,10 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/protobuf/proto"
 )
 
 // Client is a reusable, concurrency-safe client for a single procedure.
@@ -35,7 +39,15 @@ type Client[Req, Res any] struct {
 	config         *clientConfig
 	callUnary      func(context.Context, *Request[Req]) (*Response[Res], error)
 	protocolClient protocolClient
-	err            error
+	// uncompressedClient sends requests without compression once the server
+	// has rejected the configured send compression.
+	uncompressedClient protocolClient
+	// compressionRejected is set once the server rejects the configured send
+	// compression. It's per client, so other clients built from the same
+	// options still try compressing.
+	compressionRejected atomic.Bool
+	httpClient          HTTPClient
+	err                 error
 }
 
 // NewClient constructs a new Client.
@@ -47,36 +59,56 @@ func NewClient[Req, Res any](httpClient HTTPClient, url string, options ...Clien
 		return client
 	}
 	client.config = config
-	protocolClient, protocolErr := client.config.Protocol.NewClient(
-		&protocolClientParams{
-			CompressionName: config.RequestCompressionName,
-			CompressionPools: newReadOnlyCompressionPools(
-				config.CompressionPools,
-				config.CompressionNames,
-			),
-			Codec:            config.Codec,
-			Protobuf:         config.protobuf(),
-			CompressMinBytes: config.CompressMinBytes,
-			HTTPClient:       httpClient,
-			URL:              config.URL,
-			BufferPool:       config.BufferPool,
-			ReadMaxBytes:     config.ReadMaxBytes,
-			SendMaxBytes:     config.SendMaxBytes,
-			EnableGet:        config.EnableGet,
-			GetURLMaxBytes:   config.GetURLMaxBytes,
-			GetUseFallback:   config.GetUseFallback,
-		},
-	)
+	client.httpClient = httpClient
+	params := &protocolClientParams{
+		CompressionName: config.RequestCompressionName,
+		CompressionPools: newReadOnlyCompressionPools(
+			config.CompressionPools,
+			config.CompressionNames,
+		),
+		Codec:                config.Codec,
+		Protobuf:             config.protobuf(),
+		CompressMinBytes:     config.CompressMinBytes,
+		CompressionHeuristic: config.CompressionHeuristic,
+		HTTPClient:           httpClient,
+		URL:                  config.URL,
+		BufferPool:           config.BufferPool,
+		ReadMaxBytes:         config.ReadMaxBytes,
+		SendMaxBytes:         config.SendMaxBytes,
+		EnableGet:            config.EnableGet,
+		GetURLMaxBytes:       config.GetURLMaxBytes,
+		GetUseFallback:       config.GetUseFallback,
+		WireStats:            config.WireStats,
+		GRPCWebTrailers:      config.GRPCWebTrailers,
+		RequestSigner:        config.RequestSigner,
+		RequestMutator:       config.RequestMutator,
+		DisableKeepAlives:    config.DisableKeepAlives,
+		UserAgent:            config.UserAgent,
+		UserAgentAppend:      config.UserAgentAppendDefault,
+		Clock:                config.Clock,
+		KeepaliveInterval:    config.KeepaliveInterval,
+		KeepaliveTimeout:     config.KeepaliveTimeout,
+	}
+	var protocolErr error
+	client.protocolClient, protocolErr = client.config.Protocol.NewClient(params)
 	if protocolErr != nil {
 		client.err = protocolErr
 		return client
 	}
-	client.protocolClient = protocolClient
+	if config.RequestCompressionName != "" && config.RequestCompressionName != compressionIdentity {
+		uncompressedParams := *params
+		uncompressedParams.CompressionName = compressionIdentity
+		client.uncompressedClient, protocolErr = client.config.Protocol.NewClient(&uncompressedParams)
+		if protocolErr != nil {
+			client.err = protocolErr
+			return client
+		}
+	}
 	// Rather than applying unary interceptors along the hot path, we can do it
 	// once at client creation.
 	unarySpec := config.newSpec(StreamTypeUnary)
-	unaryFunc := UnaryFunc(func(ctx context.Context, request AnyRequest) (AnyResponse, error) {
-		conn := client.protocolClient.NewConn(ctx, unarySpec, request.Header())
+	sendUnary := func(ctx context.Context, target protocolClient, request AnyRequest) (AnyResponse, error) {
+		conn := target.NewConn(ctx, unarySpec, request.Header())
 		conn.onRequestSend(func(r *http.Request) {
 			request.setRequestMethod(r.Method)
 		})
@@ -93,12 +125,30 @@ func NewClient[Req, Res any](httpClient HTTPClient, url string, options ...Clien
 			return nil, err
 		}
 		response, err := receiveUnaryResponse[Res](conn, config.Initializer)
+		// The response headers fill in the rest of the peer.
+		request.setPeer(conn.Peer())
 		if err != nil {
 			_ = conn.CloseResponse()
 			return nil, err
 		}
 		return response, conn.CloseResponse()
+	}
+	unaryFunc := UnaryFunc(func(ctx context.Context, request AnyRequest) (AnyResponse, error) {
+		target := client.currentProtocolClient()
+		response, err := sendUnary(ctx, target, request)
+		if err != nil && client.uncompressedClient != nil && target != client.uncompressedClient &&
+			isCompressionRejected(err, config.RequestCompressionName) {
+			// The server can't decompress our requests. Replay this one
+			// uncompressed, and don't compress any more.
+			client.compressionRejected.Store(true)
+			deleteRequestCompression(request.Header())
+			request.setPeer(client.uncompressedClient.Peer())
+			client.uncompressedClient.WriteRequestHeader(StreamTypeUnary, request.Header())
+			return sendUnary(ctx, client.uncompressedClient, request)
+		}
+		return response, err
 	})
+	unaryFunc = newResponseCacheFunc[Res](config, unarySpec, unaryFunc)
 	if interceptor := config.Interceptor; interceptor != nil {
 		unaryFunc = interceptor.WrapUnary(unaryFunc)
 	}
@@ -107,8 +157,9 @@ func NewClient[Req, Res any](httpClient HTTPClient, url string, options ...Clien
 		// interceptor chain (as though they were supplied by the caller), we'll
 		// add them here.
 		request.spec = unarySpec
-		request.peer = client.protocolClient.Peer()
-		protocolClient.WriteRequestHeader(StreamTypeUnary, request.Header())
+		target := client.currentProtocolClient()
+		request.peer = target.Peer()
+		target.WriteRequestHeader(StreamTypeUnary, request.Header())
 		response, err := unaryFunc(ctx, request)
 		if err != nil {
 			return nil, err
@@ -151,6 +202,10 @@ func (c *Client[Req, Res]) CallServerStream(ctx context.Context, request *Reques
 	})
 	request.spec = conn.Spec()
 	request.peer = conn.Peer()
+	if getHeaderCanonical(request.header, headerUserAgent) != "" {
+		// As with unary calls, the request's User-Agent replaces the client's.
+		delHeaderCanonical(conn.RequestHeader(), headerUserAgent)
+	}
 	mergeHeaders(conn.RequestHeader(), request.header)
 	// Send always returns an io.EOF unless the error is from the client-side.
 	// We want the user to continue to call Receive in those cases to get the
@@ -180,11 +235,62 @@ func (c *Client[Req, Res]) CallBidiStream(ctx context.Context) *BidiStreamForCli
 	}
 }
 
+// Warmup prepares the client's connection to the server before the first call,
+// so that the call doesn't pay for dialing and the TLS and HTTP/2 handshakes.
+// It sends a single OPTIONS request to the procedure's URL over the same
+// HTTPClient as real calls and discards the response, leaving the connection
+// in the HTTPClient's pool. Handlers aren't invoked and interceptors don't
+// run, and any HTTP status counts as success: Warmup only returns an error if
+// the server can't be reached. The request is sent as-is, without the
+// changes made by [WithRequestMutator] or the signature from
+// [WithRequestSigner], so servers that require either may reject it (which
+// still warms the connection).
+//
+// How long the warmed connection stays open is up to the HTTPClient. With
+// [http.Transport], HTTP/1.1 connections are reused until they've been idle
+// for IdleConnTimeout.
+func (c *Client[Req, Res]) Warmup(ctx context.Context) error {
+	if c.err != nil {
+		return c.err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodOptions, c.config.URL.String(), http.NoBody)
+	if err != nil {
+		return errorf(CodeInternal, "construct warmup request: %w", err)
+	}
+	response, err := c.httpClient.Do(request)
+	if err != nil {
+		err = wrapIfContextError(err)
+		if _, ok := asError(err); !ok {
+			err = NewError(CodeUnavailable, err)
+		}
+		return err
+	}
+	// Drain the body, so HTTP/1.1 connections go back to the pool, but don't
+	// read forever if the server sends a large one.
+	_, _ = discard(response.Body)
+	_ = response.Body.Close()
+	return nil
+}
+
+// CompressionNames returns the names of the compression algorithms the client
+// accepts in responses, most preferred first. The client advertises them
+// to servers in this order. It's useful for checking configuration at
+// startup: for example, after registering a compressor with [WithCompression].
+//
+// If the client couldn't be constructed, CompressionNames returns nil.
+func (c *Client[Req, Res]) CompressionNames() []string {
+	if c.err != nil {
+		return nil
+	}
+	return preferredCompressionNames(c.config.CompressionNames)
+}
+
 func (c *Client[Req, Res]) newConn(ctx context.Context, streamType StreamType, onRequestSend func(r *http.Request)) StreamingClientConn {
 	newConn := func(ctx context.Context, spec Spec) StreamingClientConn {
 		header := make(http.Header, 8) // arbitrary power of two, prevent immediate resizing
-		c.protocolClient.WriteRequestHeader(streamType, header)
-		conn := c.protocolClient.NewConn(ctx, spec, header)
+		protocolClient := c.currentProtocolClient()
+		protocolClient.WriteRequestHeader(streamType, header)
+		conn := protocolClient.NewConn(ctx, spec, header)
 		conn.onRequestSend(onRequestSend)
 		return conn
 	}
@@ -194,6 +300,15 @@ func (c *Client[Req, Res]) newConn(ctx context.Context, streamType StreamType, o
 	return newConn(ctx, c.config.newSpec(streamType))
 }
 
+// currentProtocolClient returns the protocol client for new calls, which
+// stops compressing requests once the server has rejected the compression.
+func (c *Client[Req, Res]) currentProtocolClient() protocolClient {
+	if c.uncompressedClient != nil && c.compressionRejected.Load() {
+		return c.uncompressedClient
+	}
+	return c.protocolClient
+}
+
 type clientConfig struct {
 	URL                    *url.URL
 	Protocol               protocol
@@ -201,6 +316,7 @@ type clientConfig struct {
 	Schema                 any
 	Initializer            maybeInitializer
 	CompressMinBytes       int
+	CompressionHeuristic   compressionHeuristic
 	Interceptor            Interceptor
 	CompressionPools       map[string]*compressionPool
 	CompressionNames       []string
@@ -209,10 +325,29 @@ type clientConfig struct {
 	BufferPool             *bufferPool
 	ReadMaxBytes           int
 	SendMaxBytes           int
+	MaxHeaderBytes         int
 	EnableGet              bool
 	GetURLMaxBytes         int
 	GetUseFallback         bool
 	IdempotencyLevel       IdempotencyLevel
+	WireStats              func(WireStats)
+	GRPCWebTrailers        GRPCWebTrailerMode
+	GRPCWebTrailersSet     bool
+	HTTP3                  bool
+	ResponseCache          Cache
+	ProtoMarshalOptions    *proto.MarshalOptions
+	ProtoUnmarshalOptions  *proto.UnmarshalOptions
+	JSONInt64Encoding      JSONInt64Encoding
+	EmitDefaultJSONValues  bool
+	RequestSigner          *requestSigner
+	RequestMutator         func(*http.Request) error
+	DisableKeepAlives      bool
+	UserAgent              string
+	UserAgentAppendDefault bool
+	Clock                  Clock
+	KeepaliveInterval      time.Duration
+	KeepaliveTimeout       time.Duration
+	OptionErr              *Error
 }
 
 func newClientConfig(rawURL string, options []ClientOption) (*clientConfig, *Error) {
@@ -227,12 +362,40 @@ func newClientConfig(rawURL string, options []ClientOption) (*clientConfig, *Err
 		Procedure:        protoPath,
 		CompressionPools: make(map[string]*compressionPool),
 		BufferPool:       newBufferPool(),
+		GetURLMaxBytes:   defaultGetURLMaxBytes,
+		GetUseFallback:   true,
+		Clock:            realClock{},
 	}
 	withProtoBinaryCodec().applyToClient(&config)
 	withGzip().applyToClient(&config)
 	for _, opt := range options {
 		opt.applyToClient(&config)
 	}
+	if codec, ok := config.Codec.(*protoBinaryCodec); ok {
+		tuned := *codec
+		if config.ProtoMarshalOptions != nil {
+			tuned.marshalOptions = *config.ProtoMarshalOptions
+		}
+		if config.ProtoUnmarshalOptions != nil {
+			tuned.unmarshalOptions = *config.ProtoUnmarshalOptions
+		}
+		config.Codec = &tuned
+	}
+	config.Codec = tuneJSONCodec(config.Codec, jsonCodecTuning{
+		int64Encoding: config.JSONInt64Encoding,
+		emitDefaults:  config.EmitDefaultJSONValues,
+	})
+	if config.MaxHeaderBytes > 0 {
+		// Check metadata inside the other interceptors, so they only see
+		// responses within the limit.
+		config.Interceptor = newChain([]Interceptor{
+			config.Interceptor,
+			&maxHeaderBytesInterceptor{limit: config.MaxHeaderBytes},
+		})
+	}
+	if config.HTTP3 && !config.GRPCWebTrailersSet {
+		config.GRPCWebTrailers = GRPCWebTrailersBody
+	}
 	if err := config.validate(); err != nil {
 		return nil, err
 	}
@@ -240,6 +403,9 @@ func newClientConfig(rawURL string, options []ClientOption) (*clientConfig, *Err
 }
 
 func (c *clientConfig) validate() *Error {
+	if c.OptionErr != nil {
+		return c.OptionErr
+	}
 	if c.Codec == nil || c.Codec.Name() == "" {
 		return errorf(CodeUnknown, "no codec configured")
 	}
@@ -18,13 +18,17 @@ import (
 	"bytes"
 	"context"
 	"crypto/rand"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/http/httptrace"
 	"runtime"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -227,6 +231,384 @@ func TestGetNoContentHeaders(t *testing.T) {
 	assert.Equal(t, http.MethodGet, unaryReq.HTTPMethod())
 }
 
+func TestErrorHTTPStatus(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}))
+	server := memhttptest.NewServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Simulate a proxy in front of the server.
+		if status := r.Header.Get("X-Proxy-Status"); status != "" {
+			code, err := strconv.Atoi(status)
+			assert.Nil(t, err)
+			http.Error(w, http.StatusText(code), code)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	protocols := []struct {
+		name string
+		opts []connect.ClientOption
+		// status of the HTTP response carrying an error from the handler
+		handlerErrorStatus int
+	}{
+		{name: "connect", handlerErrorStatus: http.StatusBadRequest},
+		{name: "grpc", opts: []connect.ClientOption{connect.WithGRPC()}},
+		{name: "grpcweb", opts: []connect.ClientOption{connect.WithGRPCWeb()}},
+	}
+	for _, protocol := range protocols {
+		t.Run(protocol.name, func(t *testing.T) {
+			t.Parallel()
+			client := pingv1connect.NewPingServiceClient(server.Client(), server.URL(), protocol.opts...)
+			for _, status := range []int{
+				http.StatusBadGateway,
+				http.StatusServiceUnavailable,
+				http.StatusTooManyRequests,
+				http.StatusNotFound,
+			} {
+				t.Run(strconv.Itoa(status), func(t *testing.T) {
+					t.Parallel()
+					request := connect.NewRequest(&pingv1.PingRequest{})
+					request.Header().Set("X-Proxy-Status", strconv.Itoa(status))
+					_, err := client.Ping(context.Background(), request)
+					var connectErr *connect.Error
+					assert.True(t, errors.As(err, &connectErr))
+					assert.Equal(t, connectErr.HTTPStatus(), status)
+
+					streamRequest := connect.NewRequest(&pingv1.CountUpRequest{Number: 1})
+					streamRequest.Header().Set("X-Proxy-Status", strconv.Itoa(status))
+					stream, err := client.CountUp(context.Background(), streamRequest)
+					assert.Nil(t, err)
+					assert.False(t, stream.Receive())
+					assert.True(t, errors.As(stream.Err(), &connectErr))
+					assert.Equal(t, connectErr.HTTPStatus(), status)
+					assert.Nil(t, stream.Close())
+				})
+			}
+			t.Run("handler_error", func(t *testing.T) {
+				t.Parallel()
+				_, err := client.Fail(context.Background(), connect.NewRequest(&pingv1.FailRequest{
+					Code: int32(connect.CodeInvalidArgument),
+				}))
+				var connectErr *connect.Error
+				assert.True(t, errors.As(err, &connectErr))
+				assert.Equal(t, connectErr.Code(), connect.CodeInvalidArgument)
+				assert.Equal(t, connectErr.HTTPStatus(), protocol.handlerErrorStatus)
+			})
+			t.Run("success", func(t *testing.T) {
+				t.Parallel()
+				_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+				assert.Nil(t, err)
+			})
+		})
+	}
+	t.Run("not_from_response", func(t *testing.T) {
+		t.Parallel()
+		assert.Zero(t, connect.NewError(connect.CodeUnavailable, errors.New("oops")).HTTPStatus())
+	})
+}
+
+func TestClientWarmup(t *testing.T) {
+	t.Parallel()
+	// newServer returns a server that counts its connections and the calls
+	// that reach the handler.
+	newServer := func(t *testing.T, http2 bool) (*httptest.Server, *atomic.Int32, *atomic.Int32) {
+		t.Helper()
+		var conns, calls atomic.Int32
+		mux := http.NewServeMux()
+		mux.Handle(pingv1connect.NewPingServiceHandler(&pluggablePingServer{
+			ping: func(_ context.Context, request *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+				calls.Add(1)
+				return connect.NewResponse(&pingv1.PingResponse{Number: request.Msg.GetNumber()}), nil
+			},
+		}))
+		server := httptest.NewUnstartedServer(mux)
+		server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+			if state == http.StateNew {
+				conns.Add(1)
+			}
+		}
+		if http2 {
+			server.EnableHTTP2 = true
+			server.StartTLS()
+		} else {
+			server.Start()
+		}
+		t.Cleanup(server.Close)
+		return server, &conns, &calls
+	}
+	for _, http2 := range []bool{false, true} {
+		t.Run(fmt.Sprintf("http2=%t", http2), func(t *testing.T) {
+			t.Parallel()
+			server, conns, calls := newServer(t, http2)
+			client := connect.NewClient[pingv1.PingRequest, pingv1.PingResponse](
+				server.Client(),
+				server.URL+pingv1connect.PingServicePingProcedure,
+			)
+			assert.Nil(t, client.Warmup(context.Background()))
+			assert.Equal(t, conns.Load(), 1)
+			assert.Zero(t, calls.Load())
+
+			var reused atomic.Bool
+			ctx := httptrace.WithClientTrace(context.Background(), &httptrace.ClientTrace{
+				GotConn: func(info httptrace.GotConnInfo) {
+					reused.Store(info.Reused)
+				},
+			})
+			response, err := client.CallUnary(ctx, connect.NewRequest(&pingv1.PingRequest{Number: 42}))
+			assert.Nil(t, err)
+			assert.Equal(t, response.Msg.GetNumber(), 42)
+			assert.Equal(t, calls.Load(), 1)
+			// The call used the warmed connection.
+			assert.Equal(t, conns.Load(), 1)
+			assert.True(t, reused.Load())
+		})
+	}
+	t.Run("unreachable", func(t *testing.T) {
+		t.Parallel()
+		server, _, _ := newServer(t, false)
+		url := server.URL
+		server.Close()
+		client := connect.NewClient[pingv1.PingRequest, pingv1.PingResponse](http.DefaultClient, url+pingv1connect.PingServicePingProcedure)
+		err := client.Warmup(context.Background())
+		assert.Equal(t, connect.CodeOf(err), connect.CodeUnavailable)
+	})
+	t.Run("canceled", func(t *testing.T) {
+		t.Parallel()
+		server, _, _ := newServer(t, false)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		client := connect.NewClient[pingv1.PingRequest, pingv1.PingResponse](server.Client(), server.URL+pingv1connect.PingServicePingProcedure)
+		err := client.Warmup(ctx)
+		assert.Equal(t, connect.CodeOf(err), connect.CodeCanceled)
+	})
+	t.Run("invalid_client", func(t *testing.T) {
+		t.Parallel()
+		client := connect.NewClient[pingv1.PingRequest, pingv1.PingResponse](http.DefaultClient, "localhost:8080")
+		assert.Equal(t, connect.CodeOf(client.Warmup(context.Background())), connect.CodeUnavailable)
+	})
+}
+
+func TestClientUserAgent(t *testing.T) {
+	t.Parallel()
+	type userAgents struct {
+		UserAgent, XUserAgent string
+	}
+	var mu sync.Mutex
+	observed := make(map[string]userAgents)
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}))
+	server := memhttptest.NewServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		observed[r.Header.Get("X-Test-Case")] = userAgents{
+			UserAgent:  r.Header.Get("User-Agent"),
+			XUserAgent: r.Header.Get("X-User-Agent"),
+		}
+		mu.Unlock()
+		mux.ServeHTTP(w, r)
+	}))
+	connectDefault := fmt.Sprintf("connect-go/%s (%s)", connect.Version, runtime.Version())
+	grpcDefault := fmt.Sprintf("grpc-go-connect/%s (%s)", connect.Version, runtime.Version())
+	for _, protocol := range []struct {
+		name             string
+		opts             []connect.ClientOption
+		defaultUserAgent string
+		web              bool
+	}{
+		{name: "connect", defaultUserAgent: connectDefault},
+		{name: "grpc", opts: []connect.ClientOption{connect.WithGRPC()}, defaultUserAgent: grpcDefault},
+		{name: "grpcweb", opts: []connect.ClientOption{connect.WithGRPCWeb()}, defaultUserAgent: grpcDefault, web: true},
+	} {
+		testCases := []struct {
+			name    string
+			opts    []connect.ClientOption
+			header  string
+			wantUA  string
+			wantXUA string
+		}{
+			{
+				name:    "default",
+				wantUA:  protocol.defaultUserAgent,
+				wantXUA: protocol.defaultUserAgent,
+			},
+			{
+				name:    "empty",
+				opts:    []connect.ClientOption{connect.WithUserAgent("", false)},
+				wantUA:  protocol.defaultUserAgent,
+				wantXUA: protocol.defaultUserAgent,
+			},
+			{
+				name:    "append_default",
+				opts:    []connect.ClientOption{connect.WithUserAgent("billing/1.2", true)},
+				wantUA:  "billing/1.2 " + protocol.defaultUserAgent,
+				wantXUA: "billing/1.2 " + protocol.defaultUserAgent,
+			},
+			{
+				name:    "replace_default",
+				opts:    []connect.ClientOption{connect.WithUserAgent("billing/1.2", false)},
+				wantUA:  "billing/1.2",
+				wantXUA: "billing/1.2",
+			},
+			{
+				name:    "request_header",
+				opts:    []connect.ClientOption{connect.WithUserAgent("billing/1.2", false)},
+				header:  "billing-batch/1.2",
+				wantUA:  "billing-batch/1.2",
+				wantXUA: "billing/1.2",
+			},
+		}
+		for _, testCase := range testCases {
+			t.Run(protocol.name+"/"+testCase.name, func(t *testing.T) {
+				t.Parallel()
+				client := pingv1connect.NewPingServiceClient(
+					server.Client(),
+					server.URL(),
+					append(append([]connect.ClientOption{}, protocol.opts...), testCase.opts...)...,
+				)
+				key := protocol.name + "/" + testCase.name
+				want := userAgents{UserAgent: testCase.wantUA}
+				if protocol.web {
+					want.XUserAgent = testCase.wantXUA
+				}
+				request := connect.NewRequest(&pingv1.PingRequest{})
+				request.Header().Set("X-Test-Case", key+"/unary")
+				if testCase.header != "" {
+					request.Header().Set("User-Agent", testCase.header)
+				}
+				_, err := client.Ping(context.Background(), request)
+				assert.Nil(t, err)
+
+				streamRequest := connect.NewRequest(&pingv1.CountUpRequest{Number: 1})
+				streamRequest.Header().Set("X-Test-Case", key+"/stream")
+				if testCase.header != "" {
+					streamRequest.Header().Set("User-Agent", testCase.header)
+				}
+				stream, err := client.CountUp(context.Background(), streamRequest)
+				assert.Nil(t, err)
+				for stream.Receive() { //nolint:revive
+				}
+				assert.Nil(t, stream.Err())
+				assert.Nil(t, stream.Close())
+
+				mu.Lock()
+				defer mu.Unlock()
+				assert.Equal(t, observed[key+"/unary"], want)
+				assert.Equal(t, observed[key+"/stream"], want)
+			})
+		}
+	}
+}
+
+func TestWithRequestMutator(t *testing.T) {
+	t.Parallel()
+	type observed struct {
+		Host, Route, UserAgent string
+	}
+	var mu sync.Mutex
+	requests := make(map[string]observed)
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}))
+	server := memhttptest.NewServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.Header.Get("X-Test-Case")] = observed{
+			Host:      r.Host,
+			Route:     r.URL.Query().Get("route"),
+			UserAgent: r.Header.Get("User-Agent"),
+		}
+		mu.Unlock()
+		mux.ServeHTTP(w, r)
+	}))
+	received := func(key string) (observed, bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		got, ok := requests[key]
+		return got, ok
+	}
+	mutate := func(request *http.Request) error {
+		request.Host = "routed.example.com"
+		query := request.URL.Query()
+		query.Set("route", "blue")
+		request.URL.RawQuery = query.Encode()
+		// Protocol headers are already set, so they can be overridden.
+		request.Header.Set("User-Agent", "mutated/1.0")
+		return nil
+	}
+	want := observed{Host: "routed.example.com", Route: "blue", UserAgent: "mutated/1.0"}
+	for _, protocol := range []struct {
+		name string
+		opts []connect.ClientOption
+	}{
+		{name: "connect"},
+		{name: "connect_get", opts: []connect.ClientOption{connect.WithHTTPGet()}},
+		{name: "grpc", opts: []connect.ClientOption{connect.WithGRPC()}},
+		{name: "grpcweb", opts: []connect.ClientOption{connect.WithGRPCWeb()}},
+	} {
+		t.Run(protocol.name, func(t *testing.T) {
+			t.Parallel()
+			newClient := func(mutate func(*http.Request) error) pingv1connect.PingServiceClient {
+				return pingv1connect.NewPingServiceClient(
+					server.Client(),
+					server.URL(),
+					append([]connect.ClientOption{connect.WithRequestMutator(mutate)}, protocol.opts...)...,
+				)
+			}
+			client := newClient(mutate)
+			t.Run("unary", func(t *testing.T) {
+				t.Parallel()
+				key := protocol.name + "/unary"
+				request := connect.NewRequest(&pingv1.PingRequest{Number: 42})
+				request.Header().Set("X-Test-Case", key)
+				response, err := client.Ping(context.Background(), request)
+				assert.Nil(t, err)
+				assert.Equal(t, response.Msg.GetNumber(), 42)
+				if protocol.name == "connect_get" {
+					assert.Equal(t, request.HTTPMethod(), http.MethodGet)
+				}
+				got, ok := received(key)
+				assert.True(t, ok)
+				assert.Equal(t, got, want)
+			})
+			t.Run("bidi_stream", func(t *testing.T) {
+				t.Parallel()
+				key := protocol.name + "/bidi_stream"
+				stream := client.CumSum(context.Background())
+				stream.RequestHeader().Set("X-Test-Case", key)
+				assert.Nil(t, stream.Send(&pingv1.CumSumRequest{Number: 1}))
+				_, err := stream.Receive()
+				assert.Nil(t, err)
+				assert.Nil(t, stream.CloseRequest())
+				assert.Nil(t, stream.CloseResponse())
+				got, ok := received(key)
+				assert.True(t, ok)
+				assert.Equal(t, got, want)
+			})
+			t.Run("error", func(t *testing.T) {
+				t.Parallel()
+				var mutateErr error
+				client := newClient(func(*http.Request) error { return mutateErr })
+				key := protocol.name + "/error"
+				mutateErr = errors.New("no route")
+				request := connect.NewRequest(&pingv1.PingRequest{})
+				request.Header().Set("X-Test-Case", key)
+				_, err := client.Ping(context.Background(), request)
+				assert.Equal(t, connect.CodeOf(err), connect.CodeInternal)
+				mutateErr = connect.NewError(connect.CodeUnavailable, errors.New("no route"))
+				streamRequest := connect.NewRequest(&pingv1.CountUpRequest{Number: 1})
+				streamRequest.Header().Set("X-Test-Case", key)
+				stream, err := client.CountUp(context.Background(), streamRequest)
+				if err == nil {
+					assert.False(t, stream.Receive())
+					err = stream.Err()
+					assert.Nil(t, stream.Close())
+				}
+				assert.Equal(t, connect.CodeOf(err), connect.CodeUnavailable)
+				// Nothing was sent.
+				_, ok := received(key)
+				assert.False(t, ok)
+			})
+		})
+	}
+}
+
 func TestConnectionDropped(t *testing.T) {
 	t.Parallel()
 	ctx := context.Background()
@@ -279,6 +661,82 @@ func TestConnectionDropped(t *testing.T) {
 	}
 }
 
+func TestClientWithMaxResponseBytes(t *testing.T) {
+	t.Parallel()
+	const maxResponseBytes = 1024
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}))
+	server := memhttptest.NewServer(t, mux)
+	protocols := []struct {
+		name        string
+		opts        []connect.ClientOption
+		contentType string
+	}{
+		{name: connect.ProtocolConnect, contentType: "application/connect+proto"},
+		{name: connect.ProtocolGRPC, opts: []connect.ClientOption{connect.WithGRPC()}, contentType: "application/grpc"},
+		{name: connect.ProtocolGRPCWeb, opts: []connect.ClientOption{connect.WithGRPCWeb()}, contentType: "application/grpc-web+proto"},
+	}
+	for _, protocol := range protocols {
+		t.Run(protocol.name, func(t *testing.T) {
+			t.Parallel()
+			t.Run("unary", func(t *testing.T) {
+				t.Parallel()
+				// Gzipped requests get gzipped responses, so the limit must also
+				// apply after decompression.
+				for _, compression := range [][]connect.ClientOption{nil, {connect.WithSendGzip()}} {
+					client := pingv1connect.NewPingServiceClient(
+						server.Client(),
+						server.URL(),
+						connect.WithClientOptions(protocol.opts...),
+						connect.WithClientOptions(compression...),
+						connect.WithMaxResponseBytes(maxResponseBytes),
+					)
+					// Serializes to exactly maxResponseBytes.
+					request := &pingv1.PingRequest{Text: strings.Repeat("a", 1021)}
+					assert.Equal(t, proto.Size(request), maxResponseBytes)
+					_, err := client.Ping(context.Background(), connect.NewRequest(request))
+					assert.Nil(t, err)
+					request = &pingv1.PingRequest{Text: strings.Repeat("a", 1022)}
+					_, err = client.Ping(context.Background(), connect.NewRequest(request))
+					assert.Equal(t, connect.CodeOf(err), connect.CodeResourceExhausted)
+				}
+			})
+			t.Run("declared_size", func(t *testing.T) {
+				t.Parallel()
+				// The envelope promises an enormous message but delivers almost
+				// nothing; the client must reject it without waiting for the data.
+				body := []byte{0, 0xff, 0xff, 0xff, 0xff, 'a', 'b', 'c'}
+				httpClient := httpClientFunc(func(req *http.Request) (*http.Response, error) {
+					_, _ = io.Copy(io.Discard, req.Body)
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Header:     http.Header{"Content-Type": []string{protocol.contentType}},
+						Body:       io.NopCloser(bytes.NewReader(body)),
+						ProtoMajor: 2,
+					}, nil
+				})
+				client := pingv1connect.NewPingServiceClient(
+					httpClient,
+					"http://1.2.3.4",
+					connect.WithClientOptions(protocol.opts...),
+					connect.WithMaxResponseBytes(maxResponseBytes),
+				)
+				var before, after runtime.MemStats
+				runtime.ReadMemStats(&before)
+				stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{Number: 1}))
+				assert.Nil(t, err)
+				assert.False(t, stream.Receive())
+				runtime.ReadMemStats(&after)
+				assert.Equal(t, connect.CodeOf(stream.Err()), connect.CodeResourceExhausted)
+				assert.Nil(t, stream.Close())
+				// The client mustn't allocate a buffer for the declared 4GiB. Other
+				// tests run in parallel, so leave plenty of headroom.
+				assert.True(t, after.TotalAlloc-before.TotalAlloc < 1<<30)
+			})
+		})
+	}
+}
+
 func TestSpecSchema(t *testing.T) {
 	t.Parallel()
 	mux := http.NewServeMux()
@@ -802,6 +1260,187 @@ func (a *assertSchemaInterceptor) WrapStreamingHandler(next connect.StreamingHan
 	}
 }
 
+func TestClientGRPCWebTrailers(t *testing.T) {
+	t.Parallel()
+	frame := func(flags byte, data []byte) []byte {
+		prefix := []byte{flags, 0, 0, 0, 0}
+		binary.BigEndian.PutUint32(prefix[1:], uint32(len(data)))
+		return append(prefix, data...)
+	}
+	message, err := proto.Marshal(&pingv1.PingResponse{Number: 1})
+	assert.Nil(t, err)
+	// Each fixture sends a single response message, then an error status in the
+	// body's trailers frame (NotFound), in HTTP trailers (PermissionDenied), or
+	// in both.
+	newFixture := func(inBody, inHTTP bool) http.Handler {
+		return http.HandlerFunc(func(response http.ResponseWriter, _ *http.Request) {
+			response.Header().Set("Content-Type", "application/grpc-web+proto")
+			if inHTTP {
+				response.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+			}
+			response.WriteHeader(http.StatusOK)
+			_, _ = response.Write(frame(0, message))
+			if inBody {
+				_, _ = response.Write(frame(0x80, []byte("grpc-status: 5\r\ngrpc-message: body\r\n")))
+			}
+			if inHTTP {
+				response.Header().Set("Grpc-Status", "7")
+				response.Header().Set("Grpc-Message", "http")
+			}
+		})
+	}
+	fixtures := []struct {
+		name    string
+		handler http.Handler
+		want    map[connect.GRPCWebTrailerMode]connect.Code
+	}{
+		{
+			name:    "body",
+			handler: newFixture(true, false),
+			want: map[connect.GRPCWebTrailerMode]connect.Code{
+				connect.GRPCWebTrailersAuto: connect.CodeNotFound,
+				connect.GRPCWebTrailersBody: connect.CodeNotFound,
+				connect.GRPCWebTrailersHTTP: connect.CodeInternal, // no status
+			},
+		},
+		{
+			name:    "http",
+			handler: newFixture(false, true),
+			want: map[connect.GRPCWebTrailerMode]connect.Code{
+				connect.GRPCWebTrailersAuto: connect.CodePermissionDenied,
+				connect.GRPCWebTrailersBody: connect.CodeInternal, // no status
+				connect.GRPCWebTrailersHTTP: connect.CodePermissionDenied,
+			},
+		},
+		{
+			name:    "both",
+			handler: newFixture(true, true),
+			want: map[connect.GRPCWebTrailerMode]connect.Code{
+				connect.GRPCWebTrailersAuto: connect.CodeNotFound,
+				connect.GRPCWebTrailersBody: connect.CodeNotFound,
+				connect.GRPCWebTrailersHTTP: connect.CodePermissionDenied,
+			},
+		},
+	}
+	for _, fixture := range fixtures {
+		t.Run(fixture.name, func(t *testing.T) {
+			t.Parallel()
+			server := memhttptest.NewServer(t, fixture.handler)
+			for mode, code := range fixture.want {
+				client := pingv1connect.NewPingServiceClient(
+					server.Client(),
+					server.URL(),
+					connect.WithGRPCWeb(),
+					connect.WithGRPCWebTrailers(mode),
+				)
+				_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+				assert.Equal(t, connect.CodeOf(err), code, assert.Sprintf("mode %d: %v", mode, err))
+			}
+		})
+	}
+}
+
+func TestClientWithHTTP3(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}))
+	server := memhttptest.NewServer(t, mux)
+	// There's no HTTP/3 implementation in the standard library, so fake one by
+	// relabeling HTTP/2 responses. Real HTTP/3 round trippers may also drop
+	// HTTP trailers, so strip those too.
+	http3Client := httpClientFunc(func(request *http.Request) (*http.Response, error) {
+		response, err := server.Client().Do(request)
+		if err != nil {
+			return nil, err
+		}
+		response.Proto, response.ProtoMajor, response.ProtoMinor = "HTTP/3.0", 3, 0
+		response.Trailer = nil
+		return response, nil
+	})
+	t.Run("connect", func(t *testing.T) {
+		t.Parallel()
+		client := pingv1connect.NewPingServiceClient(http3Client, server.URL(), connect.WithHTTP3())
+		response, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Number: 42}))
+		assert.Nil(t, err)
+		assert.Equal(t, response.Msg.GetNumber(), 42)
+		stream := client.CumSum(context.Background())
+		assert.Nil(t, stream.Send(&pingv1.CumSumRequest{Number: 1}))
+		assert.Nil(t, stream.Send(&pingv1.CumSumRequest{Number: 2}))
+		assert.Nil(t, stream.CloseRequest())
+		var sums []int64
+		for {
+			msg, err := stream.Receive()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			assert.Nil(t, err)
+			sums = append(sums, msg.GetSum())
+		}
+		assert.Equal(t, sums, []int64{1, 3})
+		assert.Equal(t, stream.ResponseTrailer().Get(handlerTrailer), trailerValue)
+		assert.Nil(t, stream.CloseResponse())
+	})
+	t.Run("grpcweb", func(t *testing.T) {
+		t.Parallel()
+		client := pingv1connect.NewPingServiceClient(
+			http3Client,
+			server.URL(),
+			connect.WithGRPCWeb(),
+			connect.WithHTTP3(),
+		)
+		_, err := client.Fail(context.Background(), connect.NewRequest(&pingv1.FailRequest{Code: int32(connect.CodeNotFound)}))
+		assert.Equal(t, connect.CodeOf(err), connect.CodeNotFound)
+		stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{Number: 2}))
+		assert.Nil(t, err)
+		for stream.Receive() {
+			assert.NotNil(t, stream.Msg())
+		}
+		assert.Nil(t, stream.Err())
+		assert.Equal(t, stream.ResponseTrailer().Get(handlerTrailer), trailerValue)
+		assert.Nil(t, stream.Close())
+	})
+	t.Run("grpcweb_body_trailers_only", func(t *testing.T) {
+		t.Parallel()
+		// A server that only sends HTTP trailers doesn't work over HTTP/3.
+		fixture := memhttptest.NewServer(t, http.HandlerFunc(func(response http.ResponseWriter, _ *http.Request) {
+			response.Header().Set("Content-Type", "application/grpc-web+proto")
+			response.Header().Set("Trailer", "Grpc-Status")
+			response.WriteHeader(http.StatusOK)
+			_, _ = response.Write([]byte{0, 0, 0, 0, 0}) // empty message
+			response.Header().Set("Grpc-Status", "0")
+		}))
+		client := pingv1connect.NewPingServiceClient(
+			fixture.Client(),
+			fixture.URL(),
+			connect.WithGRPCWeb(),
+			connect.WithHTTP3(),
+		)
+		_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+		assert.Equal(t, connect.CodeOf(err), connect.CodeInternal)
+	})
+	t.Run("grpc", func(t *testing.T) {
+		t.Parallel()
+		// gRPC works over HTTP/3 round trippers that surface HTTP trailers.
+		withTrailers := httpClientFunc(func(request *http.Request) (*http.Response, error) {
+			response, err := server.Client().Do(request)
+			if err != nil {
+				return nil, err
+			}
+			response.Proto, response.ProtoMajor, response.ProtoMinor = "HTTP/3.0", 3, 0
+			return response, nil
+		})
+		client := pingv1connect.NewPingServiceClient(
+			withTrailers,
+			server.URL(),
+			connect.WithGRPC(),
+			connect.WithHTTP3(),
+		)
+		response, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Number: 42}))
+		assert.Nil(t, err)
+		assert.Equal(t, response.Msg.GetNumber(), 42)
+	})
+}
+
 type rpcErrors struct {
 	sendErr      error
 	recvErr      error
@@ -819,3 +1458,226 @@ type httpClientFunc func(*http.Request) (*http.Response, error)
 func (fn httpClientFunc) Do(req *http.Request) (*http.Response, error) {
 	return fn(req)
 }
+
+func TestClientStreamReceiveEOF(t *testing.T) {
+	t.Parallel()
+	const procedure = "/test.v1.Service/Echo"
+	// The handler sends the number of messages requested in the first message,
+	// then fails with the requested code, if any.
+	mux := http.NewServeMux()
+	mux.Handle(procedure, connect.NewBidiStreamHandler(
+		procedure,
+		func(_ context.Context, stream *connect.BidiStream[pingv1.FailRequest, pingv1.CountUpResponse]) error {
+			request, err := stream.Receive()
+			if err != nil {
+				return err
+			}
+			for i := range request.GetCode() / 100 {
+				if err := stream.Send(&pingv1.CountUpResponse{Number: int64(i)}); err != nil {
+					return err
+				}
+			}
+			if code := connect.Code(request.GetCode() % 100); code != 0 {
+				return connect.NewError(code, errors.New("oh no"))
+			}
+			return nil
+		},
+	))
+	server := memhttptest.NewServer(t, mux)
+	protocols := []struct {
+		name string
+		opts []connect.ClientOption
+	}{
+		{name: "connect"},
+		{name: "grpc", opts: []connect.ClientOption{connect.WithGRPC()}},
+		{name: "grpcweb", opts: []connect.ClientOption{connect.WithGRPCWeb()}},
+	}
+	testCases := []struct {
+		name     string
+		messages int32
+		code     connect.Code
+	}{
+		{name: "clean", messages: 2},
+		{name: "clean_empty"},
+		{name: "error", messages: 2, code: connect.CodeAborted},
+		{name: "error_empty", code: connect.CodeAborted},
+	}
+	for _, protocol := range protocols {
+		client := connect.NewClient[pingv1.FailRequest, pingv1.CountUpResponse](
+			server.Client(),
+			server.URL()+procedure,
+			protocol.opts...,
+		)
+		for _, testCase := range testCases {
+			t.Run(protocol.name+"/"+testCase.name, func(t *testing.T) {
+				t.Parallel()
+				stream := client.CallBidiStream(context.Background())
+				assert.Nil(t, stream.Send(&pingv1.FailRequest{Code: testCase.messages*100 + int32(testCase.code)}))
+				assert.Nil(t, stream.CloseRequest())
+				for range testCase.messages {
+					_, err := stream.Receive()
+					assert.Nil(t, err)
+				}
+				_, err := stream.Receive()
+				if testCase.code == 0 {
+					assert.True(t, err == io.EOF, assert.Sprintf("got %v", err)) //nolint:errorlint
+					assert.ErrorIs(t, err, io.EOF)
+				} else {
+					var connectErr *connect.Error
+					assert.True(t, errors.As(err, &connectErr))
+					assert.Equal(t, connectErr.Code(), testCase.code)
+					assert.False(t, errors.Is(err, io.EOF))
+				}
+				assert.Nil(t, stream.CloseResponse())
+			})
+		}
+	}
+}
+
+func TestClientBidiStreamHalfClose(t *testing.T) {
+	t.Parallel()
+	const procedure = "/test.v1.Service/Sum"
+	// The handler only responds once the client has finished sending, so the
+	// client can only receive anything if CloseRequest leaves the response open.
+	mux := http.NewServeMux()
+	mux.Handle(procedure, connect.NewBidiStreamHandler(
+		procedure,
+		func(_ context.Context, stream *connect.BidiStream[pingv1.CumSumRequest, pingv1.CumSumResponse]) error {
+			var numbers []int64
+			for {
+				request, err := stream.Receive()
+				if errors.Is(err, io.EOF) {
+					break
+				} else if err != nil {
+					return err
+				}
+				numbers = append(numbers, request.GetNumber())
+			}
+			var sum int64
+			for _, number := range numbers {
+				sum += number
+				if err := stream.Send(&pingv1.CumSumResponse{Sum: sum}); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	))
+	server := memhttptest.NewServer(t, mux)
+	protocols := []struct {
+		name string
+		opts []connect.ClientOption
+	}{
+		{name: "connect"},
+		{name: "grpc", opts: []connect.ClientOption{connect.WithGRPC()}},
+		{name: "grpcweb", opts: []connect.ClientOption{connect.WithGRPCWeb()}},
+	}
+	for _, protocol := range protocols {
+		t.Run(protocol.name, func(t *testing.T) {
+			t.Parallel()
+			client := connect.NewClient[pingv1.CumSumRequest, pingv1.CumSumResponse](
+				server.Client(),
+				server.URL()+procedure,
+				protocol.opts...,
+			)
+			stream := client.CallBidiStream(context.Background())
+			for i := range 3 {
+				assert.Nil(t, stream.Send(&pingv1.CumSumRequest{Number: int64(i + 1)}))
+			}
+			assert.Nil(t, stream.CloseRequest())
+			err := stream.Send(&pingv1.CumSumRequest{Number: 4})
+			assert.Equal(t, connect.CodeOf(err), connect.CodeFailedPrecondition)
+			assert.False(t, errors.Is(err, io.EOF))
+			var sums []int64
+			for {
+				response, err := stream.Receive()
+				if errors.Is(err, io.EOF) || !assert.Nil(t, err) {
+					break
+				}
+				sums = append(sums, response.GetSum())
+			}
+			assert.Equal(t, sums, []int64{1, 3, 6})
+			assert.Nil(t, stream.CloseResponse())
+		})
+	}
+}
+
+func TestClientDisableKeepAlives(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}))
+	newHTTP1Server := func(t *testing.T) *httptest.Server {
+		t.Helper()
+		server := httptest.NewServer(mux)
+		t.Cleanup(server.Close)
+		return server
+	}
+	newHTTP2Server := func(t *testing.T) *httptest.Server {
+		t.Helper()
+		server := httptest.NewUnstartedServer(mux)
+		server.EnableHTTP2 = true
+		server.StartTLS()
+		t.Cleanup(server.Close)
+		return server
+	}
+	for _, testCase := range []struct {
+		name      string
+		newServer func(*testing.T) *httptest.Server
+		bidi      bool
+	}{
+		{name: "http1", newServer: newHTTP1Server},
+		{name: "http2", newServer: newHTTP2Server, bidi: true},
+	} {
+		for _, disable := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s/disable=%t", testCase.name, disable), func(t *testing.T) {
+				t.Parallel()
+				server := testCase.newServer(t)
+				var opts []connect.ClientOption
+				if disable {
+					opts = append(opts, connect.WithDisableKeepAlives())
+				}
+				client := pingv1connect.NewPingServiceClient(server.Client(), server.URL, opts...)
+				var conns, reused atomic.Int32
+				ctx := httptrace.WithClientTrace(context.Background(), &httptrace.ClientTrace{
+					GotConn: func(info httptrace.GotConnInfo) {
+						conns.Add(1)
+						if info.Reused {
+							reused.Add(1)
+						}
+					},
+				})
+				for i := int64(1); i <= 3; i++ {
+					response, err := client.Ping(ctx, connect.NewRequest(&pingv1.PingRequest{Number: i}))
+					assert.Nil(t, err)
+					assert.Equal(t, response.Msg.GetNumber(), i)
+				}
+				stream, err := client.CountUp(ctx, connect.NewRequest(&pingv1.CountUpRequest{Number: 3}))
+				assert.Nil(t, err)
+				var count int
+				for stream.Receive() {
+					count++
+				}
+				assert.Nil(t, stream.Err())
+				assert.Equal(t, count, 3)
+				assert.Nil(t, stream.Close())
+				if testCase.bidi {
+					bidi := client.CumSum(ctx)
+					assert.Nil(t, bidi.Send(&pingv1.CumSumRequest{Number: 2}))
+					msg, err := bidi.Receive()
+					assert.Nil(t, err)
+					assert.Equal(t, msg.GetSum(), 2)
+					assert.Nil(t, bidi.CloseRequest())
+					_, err = bidi.Receive()
+					assert.True(t, errors.Is(err, io.EOF))
+					assert.Nil(t, bidi.CloseResponse())
+				}
+				assert.True(t, conns.Load() >= 4)
+				if disable {
+					assert.Zero(t, reused.Load())
+				} else {
+					assert.NotZero(t, reused.Load())
+				}
+			})
+		}
+	}
+}
@@ -57,3 +57,57 @@ func TestClientUnaryGetFallback(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, r.Msg.GetText(), text)
 }
+
+func TestClientUnaryGetDefaultMaxURLSize(t *testing.T) {
+	t.Parallel()
+	methods := make(chan string, 1)
+	mux := http.NewServeMux()
+	mux.Handle("/connect.ping.v1.PingService/Ping", NewUnaryHandler(
+		"/connect.ping.v1.PingService/Ping",
+		func(_ context.Context, r *Request[pingv1.PingRequest]) (*Response[pingv1.PingResponse], error) {
+			methods <- r.HTTPMethod()
+			return NewResponse(&pingv1.PingResponse{Text: r.Msg.GetText()}), nil
+		},
+		WithIdempotency(IdempotencyNoSideEffects),
+	))
+	server := memhttptest.NewServer(t, mux)
+	const url = "/connect.ping.v1.PingService/Ping"
+	testCases := []struct {
+		name       string
+		options    []ClientOption
+		text       string
+		wantMethod string
+	}{
+		{name: "small", text: "small", wantMethod: http.MethodGet},
+		{name: "below_default", text: strings.Repeat(".", defaultGetURLMaxBytes/2), wantMethod: http.MethodGet},
+		{name: "above_default", text: strings.Repeat(".", defaultGetURLMaxBytes), wantMethod: http.MethodPost},
+		{
+			// Compression shrinks the request enough to fit in the URL.
+			name:       "above_default_compressed",
+			options:    []ClientOption{WithSendGzip()},
+			text:       strings.Repeat(".", defaultGetURLMaxBytes),
+			wantMethod: http.MethodGet,
+		},
+		{
+			name:       "unlimited",
+			options:    []ClientOption{WithHTTPGetMaxURLSize(0, false)},
+			text:       strings.Repeat(".", defaultGetURLMaxBytes),
+			wantMethod: http.MethodGet,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			// Not parallel: the handler reports each request's method on a shared
+			// channel.
+			client := NewClient[pingv1.PingRequest, pingv1.PingResponse](
+				server.Client(),
+				server.URL()+url,
+				append([]ClientOption{WithHTTPGet(), WithIdempotency(IdempotencyNoSideEffects)}, testCase.options...)...,
+			)
+			response, err := client.CallUnary(context.Background(), NewRequest(&pingv1.PingRequest{Text: testCase.text}))
+			assert.Nil(t, err)
+			assert.Equal(t, response.Msg.GetText(), testCase.text)
+			assert.Equal(t, <-methods, testCase.wantMethod)
+		})
+	}
+}
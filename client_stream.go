@@ -154,7 +154,8 @@ func (s *ServerStreamForClient[Res]) ResponseHeader() http.Header {
 }
 
 // ResponseTrailer returns the trailers received from the server. Trailers
-// aren't fully populated until Receive() returns an error wrapping io.EOF.
+// aren't fully populated until Receive() returns false. They're populated
+// whether the stream ended cleanly or with an error from the server.
 func (s *ServerStreamForClient[Res]) ResponseTrailer() http.Header {
 	if s.constructErr != nil {
 		return http.Header{}
@@ -217,6 +218,10 @@ func (b *BidiStreamForClient[Req, Res]) RequestHeader() http.Header {
 // headers. To send just the request headers, without a body, call Send with a
 // nil pointer.
 //
+// Send returns once the HTTP transport has taken the message, so it doesn't
+// buffer without bound: over HTTP/2, a server that reads slowly makes Send
+// block on flow control.
+//
 // If the server returns an error, Send returns an error that wraps [io.EOF].
 // Clients should check for EOF using the standard library's [errors.Is] and
 // call Receive to retrieve the error.
@@ -230,7 +235,10 @@ func (b *BidiStreamForClient[Req, Res]) Send(msg *Req) error {
 	return b.conn.Send(msg)
 }
 
-// CloseRequest closes the send side of the stream.
+// CloseRequest closes the send side of the stream, telling the server that the
+// client is done sending. It doesn't close the receive side: call Receive to
+// read the server's remaining messages until it returns [io.EOF] or an error.
+// After CloseRequest, Send returns an error with [CodeFailedPrecondition].
 func (b *BidiStreamForClient[Req, Res]) CloseRequest() error {
 	if b.err != nil {
 		return b.err
@@ -239,7 +247,9 @@ func (b *BidiStreamForClient[Req, Res]) CloseRequest() error {
 }
 
 // Receive a message. When the server is done sending messages and no other
-// errors have occurred, Receive will return an error that wraps [io.EOF].
+// errors have occurred, Receive will return [io.EOF] itself, without wrapping.
+// If the server ends the stream with an error, Receive returns it as an
+// [*Error].
 func (b *BidiStreamForClient[Req, Res]) Receive() (*Res, error) {
 	if b.err != nil {
 		return nil, b.err
@@ -277,7 +287,8 @@ func (b *BidiStreamForClient[Req, Res]) ResponseHeader() http.Header {
 }
 
 // ResponseTrailer returns the trailers received from the server. Trailers
-// aren't fully populated until Receive() returns an error wrapping [io.EOF].
+// aren't fully populated until Receive() returns [io.EOF] or an error from the
+// server.
 func (b *BidiStreamForClient[Req, Res]) ResponseTrailer() http.Header {
 	if b.err != nil {
 		return http.Header{}
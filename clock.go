@@ -0,0 +1,134 @@
+// Copyright 2021-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// A Clock tells time for connect's timeout and deadline logic: the timeouts
+// clients send with each call, the deadlines handlers derive from them and
+// from [WithMethodTimeout], the delays between the attempts that [WithRetry]
+// makes, and the pings and timeouts of [WithStreamKeepalive]. Tests can
+// supply a fake clock with [WithClock] and advance it to trigger deadlines
+// without waiting for them.
+//
+// Timeouts that rely on the network connection's deadlines, like
+// [WithSendTimeout] and [WithFirstMessageTimeout], always use the real
+// clock.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// AfterFunc calls f in its own goroutine once d has elapsed. The returned
+	// function stops the timer, reporting whether it did so before f was
+	// called.
+	AfterFunc(d time.Duration, f func()) (stop func() bool)
+}
+
+// realClock is the default Clock, backed by the time package.
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) AfterFunc(d time.Duration, f func()) func() bool {
+	return time.AfterFunc(d, f).Stop
+}
+
+// withClockTimeout is like [context.WithTimeout], but measures the timeout
+// with the supplied clock. As with context.WithTimeout, an earlier deadline
+// on the parent wins.
+func withClockTimeout(ctx context.Context, clock Clock, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if _, ok := clock.(realClock); ok {
+		return context.WithTimeout(ctx, timeout)
+	}
+	if remaining, ok := timeUntilDeadline(ctx); ok && remaining < timeout {
+		return context.WithCancel(ctx)
+	}
+	inner, cancel := context.WithCancelCause(ctx)
+	deadlineCtx := &clockDeadlineContext{Context: inner, clock: clock, deadline: clock.Now().Add(timeout)}
+	if timeout <= 0 {
+		cancel(context.DeadlineExceeded)
+		return deadlineCtx, func() { cancel(context.Canceled) }
+	}
+	stop := clock.AfterFunc(timeout, func() { cancel(context.DeadlineExceeded) })
+	return deadlineCtx, func() {
+		stop()
+		cancel(context.Canceled)
+	}
+}
+
+// timeUntilDeadline reports how long remains until the context's deadline,
+// whether the deadline was set by [context.WithDeadline] or by
+// withClockTimeout. The former is measured with the real clock and the latter
+// with the clock that set it.
+func timeUntilDeadline(ctx context.Context) (time.Duration, bool) {
+	remaining, hasDeadline := time.Duration(0), false
+	if deadline, ok := ctx.Deadline(); ok {
+		remaining, hasDeadline = time.Until(deadline), true
+	}
+	if clockCtx, ok := ctx.Value(clockDeadlineKey{}).(*clockDeadlineContext); ok {
+		fromClock := clockCtx.deadline.Sub(clockCtx.clock.Now())
+		if !hasDeadline || fromClock < remaining {
+			remaining, hasDeadline = fromClock, true
+		}
+	}
+	return remaining, hasDeadline
+}
+
+type clockDeadlineKey struct{}
+
+// clockDeadlineContext is a context whose deadline is kept by a Clock other
+// than the real one. Its Deadline method doesn't report that deadline, which
+// would mean nothing to code using the real clock, like net.Dialer: use
+// timeUntilDeadline instead.
+type clockDeadlineContext struct {
+	context.Context //nolint:containedctx
+
+	clock    Clock
+	deadline time.Time
+}
+
+func (c *clockDeadlineContext) Err() error {
+	err := c.Context.Err()
+	if err != nil && errors.Is(context.Cause(c.Context), context.DeadlineExceeded) {
+		return context.DeadlineExceeded
+	}
+	return err
+}
+
+func (c *clockDeadlineContext) Value(key any) any {
+	if _, ok := key.(clockDeadlineKey); ok {
+		return c
+	}
+	return c.Context.Value(key)
+}
+
+// sleep waits for d to elapse on the clock, returning early with the
+// context's error if it's done first.
+func sleep(ctx context.Context, clock Clock, d time.Duration) error {
+	elapsed := make(chan struct{})
+	stop := clock.AfterFunc(d, func() { close(elapsed) })
+	defer stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-elapsed:
+		return nil
+	}
+}
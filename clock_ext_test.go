@@ -0,0 +1,219 @@
+// Copyright 2021-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	connect "connectrpc.com/connect"
+	"connectrpc.com/connect/internal/assert"
+	"connectrpc.com/connect/internal/clocktest"
+	pingv1 "connectrpc.com/connect/internal/gen/connect/ping/v1"
+	"connectrpc.com/connect/internal/gen/connect/ping/v1/pingv1connect"
+	"connectrpc.com/connect/internal/memhttp/memhttptest"
+)
+
+func TestWithClock(t *testing.T) {
+	t.Parallel()
+	protocols := []struct {
+		name string
+		opts []connect.ClientOption
+	}{
+		{name: "connect"},
+		{name: "grpc", opts: []connect.ClientOption{connect.WithGRPC()}},
+		{name: "grpcweb", opts: []connect.ClientOption{connect.WithGRPCWeb()}},
+	}
+	t.Run("handler_deadline", func(t *testing.T) {
+		t.Parallel()
+		for _, testCase := range []struct {
+			name       string
+			opts       []connect.HandlerOption
+			ctxTimeout time.Duration
+		}{
+			// The client's clock is real, so it sends an hour-long timeout that the
+			// handler measures with its fake clock.
+			{name: "client_timeout", ctxTimeout: time.Hour},
+			{name: "method_timeout", opts: []connect.HandlerOption{
+				connect.WithMethodTimeout(map[string]time.Duration{
+					pingv1connect.PingServicePingProcedure: time.Hour,
+				}),
+			}},
+		} {
+			for _, protocol := range protocols {
+				t.Run(testCase.name+"/"+protocol.name, func(t *testing.T) {
+					t.Parallel()
+					clock := clocktest.NewClock(time.Now())
+					started := make(chan struct{})
+					server := &pluggablePingServer{
+						ping: func(ctx context.Context, _ *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+							close(started)
+							<-ctx.Done()
+							return nil, ctx.Err()
+						},
+					}
+					mux := http.NewServeMux()
+					mux.Handle(pingv1connect.NewPingServiceHandler(
+						server,
+						append(testCase.opts, connect.WithClock(clock))...,
+					))
+					httpServer := memhttptest.NewServer(t, mux)
+					client := pingv1connect.NewPingServiceClient(httpServer.Client(), httpServer.URL(), protocol.opts...)
+					ctx := context.Background()
+					if testCase.ctxTimeout > 0 {
+						var cancel context.CancelFunc
+						ctx, cancel = context.WithTimeout(ctx, testCase.ctxTimeout)
+						defer cancel()
+					}
+					errs := make(chan error, 1)
+					go func() {
+						_, err := client.Ping(ctx, connect.NewRequest(&pingv1.PingRequest{}))
+						errs <- err
+					}()
+					<-started
+					clock.WaitForTimers(1)
+					clock.Advance(time.Hour)
+					select {
+					case err := <-errs:
+						assert.Equal(t, connect.CodeOf(err), connect.CodeDeadlineExceeded)
+					case <-time.After(5 * time.Second):
+						t.Fatal("advancing the clock didn't end the call")
+					}
+				})
+			}
+		}
+	})
+	t.Run("client_timeout_header", func(t *testing.T) {
+		t.Parallel()
+		headers := make(chan http.Header, 1)
+		downstream := &pluggablePingServer{
+			ping: func(_ context.Context, request *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+				headers <- request.Header().Clone()
+				return connect.NewResponse(&pingv1.PingResponse{}), nil
+			},
+		}
+		downstreamMux := http.NewServeMux()
+		downstreamMux.Handle(pingv1connect.NewPingServiceHandler(downstream))
+		downstreamServer := memhttptest.NewServer(t, downstreamMux)
+		for _, testCase := range []struct {
+			opts       []connect.ClientOption
+			header     string
+			wantHeader string
+		}{
+			{header: "Connect-Timeout-Ms", wantHeader: "6000"},
+			{opts: []connect.ClientOption{connect.WithGRPC()}, header: "Grpc-Timeout", wantHeader: "6000000u"},
+		} {
+			// A handler's deadline is 10 seconds from the start of its fake clock,
+			// but the clock moves on by 4 seconds before it calls another service.
+			clock := clocktest.NewClock(time.Now())
+			downstreamClient := pingv1connect.NewPingServiceClient(
+				downstreamServer.Client(),
+				downstreamServer.URL(),
+				testCase.opts...,
+			)
+			upstream := &pluggablePingServer{
+				ping: func(ctx context.Context, request *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+					// The fake deadline means nothing to code using the real clock, so
+					// the context doesn't report it.
+					_, ok := ctx.Deadline()
+					assert.False(t, ok)
+					clock.Advance(4 * time.Second)
+					return downstreamClient.Ping(ctx, request)
+				},
+			}
+			upstreamMux := http.NewServeMux()
+			upstreamMux.Handle(pingv1connect.NewPingServiceHandler(
+				upstream,
+				connect.WithClock(clock),
+				connect.WithMethodTimeout(map[string]time.Duration{
+					pingv1connect.PingServicePingProcedure: 10 * time.Second,
+				}),
+			))
+			upstreamServer := memhttptest.NewServer(t, upstreamMux)
+			client := pingv1connect.NewPingServiceClient(upstreamServer.Client(), upstreamServer.URL())
+			_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+			assert.Nil(t, err)
+			assert.Equal(t, (<-headers).Get(testCase.header), testCase.wantHeader)
+		}
+	})
+	t.Run("real_deadline_header", func(t *testing.T) {
+		t.Parallel()
+		headers := make(chan http.Header, 1)
+		server := &pluggablePingServer{
+			ping: func(_ context.Context, request *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+				headers <- request.Header().Clone()
+				return connect.NewResponse(&pingv1.PingResponse{}), nil
+			},
+		}
+		mux := http.NewServeMux()
+		mux.Handle(pingv1connect.NewPingServiceHandler(server))
+		httpServer := memhttptest.NewServer(t, mux)
+		// Deadlines from the context package are measured with the real clock,
+		// however far the client's clock has moved.
+		clock := clocktest.NewClock(time.Now().Add(-time.Hour))
+		client := pingv1connect.NewPingServiceClient(httpServer.Client(), httpServer.URL(), connect.WithClock(clock))
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_, err := client.Ping(ctx, connect.NewRequest(&pingv1.PingRequest{}))
+		assert.Nil(t, err)
+		millis, err := strconv.Atoi((<-headers).Get("Connect-Timeout-Ms"))
+		assert.Nil(t, err)
+		assert.True(t, millis > 5000 && millis <= 10000)
+	})
+	t.Run("retry_backoff", func(t *testing.T) {
+		t.Parallel()
+		var attempts atomic.Int32
+		server := &pluggablePingServer{
+			ping: func(_ context.Context, request *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+				if attempts.Add(1) == 1 {
+					return nil, connect.NewError(connect.CodeUnavailable, errors.New("try again"))
+				}
+				return connect.NewResponse(&pingv1.PingResponse{Number: request.Msg.GetNumber()}), nil
+			},
+		}
+		mux := http.NewServeMux()
+		mux.Handle(pingv1connect.NewPingServiceHandler(server))
+		httpServer := memhttptest.NewServer(t, mux)
+		clock := clocktest.NewClock(time.Now())
+		client := pingv1connect.NewPingServiceClient(
+			httpServer.Client(),
+			httpServer.URL(),
+			// The clock comes after the retry policy, but the policy still uses it.
+			connect.WithRetry(connect.RetryPolicy{InitialBackoff: time.Hour, Jitter: -1}),
+			connect.WithClock(clock),
+		)
+		responses := make(chan *connect.Response[pingv1.PingResponse], 1)
+		go func() {
+			response, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Number: 42}))
+			assert.Nil(t, err)
+			responses <- response
+		}()
+		clock.WaitForTimers(1)
+		assert.Equal(t, attempts.Load(), 1)
+		clock.Advance(time.Hour)
+		select {
+		case response := <-responses:
+			assert.Equal(t, response.Msg.GetNumber(), 42)
+			assert.Equal(t, attempts.Load(), 2)
+		case <-time.After(5 * time.Second):
+			t.Fatal("advancing the clock didn't end the backoff")
+		}
+	})
+}
@@ -15,6 +15,8 @@
 package connect
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
@@ -205,9 +207,8 @@ func (c *Code) UnmarshalText(data []byte) error {
 	}
 	// Ensure that non-canonical codes round-trip through MarshalText and
 	// UnmarshalText.
-	if strings.HasPrefix(dataStr, "code_") {
-		dataStr = strings.TrimPrefix(dataStr, "code_")
-		code, err := strconv.ParseUint(dataStr, 10 /* base */, 32 /* bitsize */)
+	if numStr, ok := strings.CutPrefix(dataStr, "code_"); ok {
+		code, err := strconv.ParseUint(numStr, 10 /* base */, 32 /* bitsize */)
 		if err == nil && (code < uint64(minCode) || code > uint64(maxCode)) {
 			*c = Code(code)
 			return nil
@@ -216,11 +217,19 @@ func (c *Code) UnmarshalText(data []byte) error {
 	return fmt.Errorf("invalid code %q", dataStr)
 }
 
-// CodeOf returns the error's status code if it is or wraps an [*Error] and
-// [CodeUnknown] otherwise.
+// CodeOf returns the error's status code if it is or wraps an [*Error]. Errors
+// that instead wrap [context.Canceled] or [context.DeadlineExceeded] have
+// [CodeCanceled] or [CodeDeadlineExceeded], matching the code they're sent
+// with on the wire. All other errors have [CodeUnknown].
 func CodeOf(err error) Code {
 	if connectErr, ok := asError(err); ok {
 		return connectErr.Code()
 	}
+	if errors.Is(err, context.Canceled) {
+		return CodeCanceled
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return CodeDeadlineExceeded
+	}
 	return CodeUnknown
 }
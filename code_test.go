@@ -15,6 +15,8 @@
 package connect
 
 import (
+	"encoding/json"
+	"flag"
 	"strconv"
 	"strings"
 	"testing"
@@ -54,3 +56,42 @@ func assertCodeRoundTrips(tb testing.TB, code Code) {
 		assert.NotNil(tb, invalid.UnmarshalText([]byte("code_"+strconv.Itoa(int(code)))))
 	}
 }
+
+func TestCodeText(t *testing.T) {
+	t.Parallel()
+	t.Run("json", func(t *testing.T) {
+		t.Parallel()
+		type config struct {
+			Code Code `json:"code"`
+		}
+		encoded, err := json.Marshal(config{Code: CodeUnavailable})
+		assert.Nil(t, err)
+		assert.Equal(t, string(encoded), `{"code":"unavailable"}`)
+		var decoded config
+		assert.Nil(t, json.Unmarshal([]byte(`{"code":"resource_exhausted"}`), &decoded))
+		assert.Equal(t, decoded.Code, CodeResourceExhausted)
+		assert.NotNil(t, json.Unmarshal([]byte(`{"code":"unavailable_"}`), &decoded))
+	})
+	t.Run("flag", func(t *testing.T) {
+		t.Parallel()
+		var code Code
+		flags := flag.NewFlagSet("test", flag.ContinueOnError)
+		flags.TextVar(&code, "code", CodeUnknown, "error code")
+		assert.Nil(t, flags.Parse([]string{"-code", "not_found"}))
+		assert.Equal(t, code, CodeNotFound)
+	})
+	t.Run("zero", func(t *testing.T) {
+		t.Parallel()
+		var zero Code
+		assertCodeRoundTrips(t, zero)
+	})
+	t.Run("invalid", func(t *testing.T) {
+		t.Parallel()
+		for _, input := range []string{"", "Unavailable", "code_", "code_abc", "code_1"} {
+			var code Code
+			err := code.UnmarshalText([]byte(input))
+			assert.NotNil(t, err)
+			assert.Equal(t, err.Error(), "invalid code "+strconv.Quote(input))
+		}
+	})
+}
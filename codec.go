@@ -21,6 +21,7 @@ import (
 	"fmt"
 
 	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/prototext"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/runtime/protoiface"
 )
@@ -29,6 +30,7 @@ const (
 	codecNameProto           = "proto"
 	codecNameJSON            = "json"
 	codecNameJSONCharsetUTF8 = codecNameJSON + "; charset=utf-8"
+	codecNameProtoText       = "prototext"
 )
 
 // Codec marshals structs (typically generated from a schema) to and from bytes.
@@ -91,7 +93,12 @@ type stableCodec interface {
 	IsBinary() bool
 }
 
-type protoBinaryCodec struct{}
+type protoBinaryCodec struct {
+	// marshalOptions and unmarshalOptions are set by WithProtoMarshalOptions
+	// and WithProtoUnmarshalOptions.
+	marshalOptions   proto.MarshalOptions
+	unmarshalOptions proto.UnmarshalOptions
+}
 
 var _ Codec = (*protoBinaryCodec)(nil)
 
@@ -102,7 +109,7 @@ func (c *protoBinaryCodec) Marshal(message any) ([]byte, error) {
 	if !ok {
 		return nil, errNotProto(message)
 	}
-	return proto.Marshal(protoMessage)
+	return c.marshalOptions.Marshal(protoMessage)
 }
 
 func (c *protoBinaryCodec) MarshalAppend(dst []byte, message any) ([]byte, error) {
@@ -110,7 +117,7 @@ func (c *protoBinaryCodec) MarshalAppend(dst []byte, message any) ([]byte, error
 	if !ok {
 		return nil, errNotProto(message)
 	}
-	return proto.MarshalOptions{}.MarshalAppend(dst, protoMessage)
+	return c.marshalOptions.MarshalAppend(dst, protoMessage)
 }
 
 func (c *protoBinaryCodec) Unmarshal(data []byte, message any) error {
@@ -118,7 +125,7 @@ func (c *protoBinaryCodec) Unmarshal(data []byte, message any) error {
 	if !ok {
 		return errNotProto(message)
 	}
-	err := proto.Unmarshal(data, protoMessage)
+	err := c.unmarshalOptions.Unmarshal(data, protoMessage)
 	if err != nil {
 		return fmt.Errorf("unmarshal into %T: %w", message, err)
 	}
@@ -135,7 +142,8 @@ func (c *protoBinaryCodec) MarshalStable(message any) ([]byte, error) {
 	// In addition, unknown fields may cause inconsistent output for otherwise
 	// equal messages.
 	// https://github.com/golang/protobuf/issues/1121
-	options := proto.MarshalOptions{Deterministic: true}
+	options := c.marshalOptions
+	options.Deterministic = true
 	return options.Marshal(protoMessage)
 }
 
@@ -145,6 +153,12 @@ func (c *protoBinaryCodec) IsBinary() bool {
 
 type protoJSONCodec struct {
 	name string
+	// rejectUnknown makes Unmarshal fail on fields that aren't in the schema.
+	rejectUnknown bool
+	// int64Encoding controls how Marshal represents 64-bit integers.
+	int64Encoding JSONInt64Encoding
+	// emitDefaults makes Marshal include fields set to their zero value.
+	emitDefaults bool
 }
 
 var _ Codec = (*protoJSONCodec)(nil)
@@ -156,7 +170,11 @@ func (c *protoJSONCodec) Marshal(message any) ([]byte, error) {
 	if !ok {
 		return nil, errNotProto(message)
 	}
-	return protojson.MarshalOptions{}.Marshal(protoMessage)
+	data, err := c.marshalOptions().Marshal(protoMessage)
+	if err != nil || c.int64Encoding == JSONInt64String {
+		return data, err
+	}
+	return rewriteJSONInt64s(data, protoMessage.ProtoReflect().Descriptor(), c.int64Encoding)
 }
 
 func (c *protoJSONCodec) MarshalAppend(dst []byte, message any) ([]byte, error) {
@@ -164,7 +182,14 @@ func (c *protoJSONCodec) MarshalAppend(dst []byte, message any) ([]byte, error)
 	if !ok {
 		return nil, errNotProto(message)
 	}
-	return protojson.MarshalOptions{}.MarshalAppend(dst, protoMessage)
+	if c.int64Encoding != JSONInt64String {
+		data, err := c.Marshal(message)
+		if err != nil {
+			return nil, err
+		}
+		return append(dst, data...), nil
+	}
+	return c.marshalOptions().MarshalAppend(dst, protoMessage)
 }
 
 func (c *protoJSONCodec) Unmarshal(binary []byte, message any) error {
@@ -175,9 +200,9 @@ func (c *protoJSONCodec) Unmarshal(binary []byte, message any) error {
 	if len(binary) == 0 {
 		return errors.New("zero-length payload is not a valid JSON object")
 	}
-	// Discard unknown fields so clients and servers aren't forced to always use
-	// exactly the same version of the schema.
-	options := protojson.UnmarshalOptions{DiscardUnknown: true}
+	// By default, discard unknown fields so clients and servers aren't forced
+	// to always use exactly the same version of the schema.
+	options := protojson.UnmarshalOptions{DiscardUnknown: !c.rejectUnknown}
 	err := options.Unmarshal(binary, protoMessage)
 	if err != nil {
 		return fmt.Errorf("unmarshal into %T: %w", message, err)
@@ -185,6 +210,10 @@ func (c *protoJSONCodec) Unmarshal(binary []byte, message any) error {
 	return nil
 }
 
+func (c *protoJSONCodec) marshalOptions() protojson.MarshalOptions {
+	return protojson.MarshalOptions{EmitDefaultValues: c.emitDefaults}
+}
+
 func (c *protoJSONCodec) MarshalStable(message any) ([]byte, error) {
 	// protojson does not offer a "deterministic" field ordering, but fields
 	// are still ordered consistently by their index. However, protojson can
@@ -206,6 +235,190 @@ func (c *protoJSONCodec) IsBinary() bool {
 	return false
 }
 
+// stableJSONCodec is a protoJSONCodec that always marshals stable output.
+// Unmarshaling is unchanged, so it accepts any valid Protobuf JSON.
+type stableJSONCodec struct {
+	protoJSONCodec
+}
+
+var _ Codec = (*stableJSONCodec)(nil)
+
+// jsonCodecTuning collects the options that adjust the JSON codecs. The zero
+// value leaves them unchanged.
+type jsonCodecTuning struct {
+	rejectUnknown bool
+	int64Encoding JSONInt64Encoding
+	emitDefaults  bool
+}
+
+// tuneJSONCodec returns a copy of codec with the tuning applied, or codec
+// itself if it isn't one of the JSON codecs or there's nothing to tune.
+func tuneJSONCodec(codec Codec, tuning jsonCodecTuning) Codec {
+	if tuning == (jsonCodecTuning{}) {
+		return codec
+	}
+	var tuned Codec
+	var base *protoJSONCodec
+	switch codec := codec.(type) {
+	case *protoJSONCodec:
+		withTuning := *codec
+		tuned, base = &withTuning, &withTuning
+	case *stableJSONCodec:
+		withTuning := *codec
+		tuned, base = &withTuning, &withTuning.protoJSONCodec
+	default:
+		return codec
+	}
+	if tuning.rejectUnknown {
+		base.rejectUnknown = true
+	}
+	if tuning.int64Encoding != JSONInt64String {
+		base.int64Encoding = tuning.int64Encoding
+	}
+	if tuning.emitDefaults {
+		base.emitDefaults = true
+	}
+	return tuned
+}
+
+func (c *stableJSONCodec) Marshal(message any) ([]byte, error) {
+	return c.protoJSONCodec.MarshalStable(message)
+}
+
+func (c *stableJSONCodec) MarshalAppend(dst []byte, message any) ([]byte, error) {
+	data, err := c.Marshal(message)
+	if err != nil {
+		return nil, err
+	}
+	return append(dst, data...), nil
+}
+
+type protoTextCodec struct{}
+
+var _ Codec = (*protoTextCodec)(nil)
+
+func (c *protoTextCodec) Name() string { return codecNameProtoText }
+
+func (c *protoTextCodec) Marshal(message any) ([]byte, error) {
+	protoMessage, ok := message.(proto.Message)
+	if !ok {
+		return nil, errNotProto(message)
+	}
+	text, err := prototext.MarshalOptions{Multiline: true, Indent: "  "}.Marshal(protoMessage)
+	if err != nil {
+		return nil, err
+	}
+	// Like protojson, prototext randomly adds extra whitespace to discourage
+	// byte-wise comparisons. In multi-line output, it's always after the colon
+	// that follows a field name. Trimming it makes the output stable across
+	// builds.
+	stable := make([]byte, 0, len(text))
+	for _, line := range bytes.SplitAfter(text, []byte("\n")) {
+		if colon := protoTextNameEnd(line); colon >= 0 {
+			stable = append(stable, line[:colon]...)
+			stable = append(stable, ": "...)
+			line = bytes.TrimLeft(line[colon+1:], " ")
+		}
+		stable = append(stable, line...)
+	}
+	return stable, nil
+}
+
+// protoTextNameEnd returns the index of the colon that ends the field name at
+// the start of a line of multi-line prototext output, or -1 if there isn't
+// one. Plain field names never contain colons, so it's the first on the line.
+// Extension names and expanded Any type URLs are bracketed, and type URLs may
+// contain colons (for example, in a port number), so for them it's the first
+// colon after the closing bracket.
+func protoTextNameEnd(line []byte) int {
+	start := 0
+	if bytes.HasPrefix(bytes.TrimLeft(line, " "), []byte("[")) {
+		start = bytes.IndexByte(line, ']')
+		if start < 0 {
+			return -1
+		}
+	}
+	colon := bytes.IndexByte(line[start:], ':')
+	if colon < 0 {
+		return -1
+	}
+	return start + colon
+}
+
+func (c *protoTextCodec) Unmarshal(text []byte, message any) error {
+	protoMessage, ok := message.(proto.Message)
+	if !ok {
+		return errNotProto(message)
+	}
+	// Discard unknown fields so clients and servers aren't forced to always use
+	// exactly the same version of the schema.
+	options := prototext.UnmarshalOptions{DiscardUnknown: true}
+	if err := options.Unmarshal(text, protoMessage); err != nil {
+		return fmt.Errorf("unmarshal into %T: %w", message, err)
+	}
+	return nil
+}
+
+func (c *protoTextCodec) MarshalStable(message any) ([]byte, error) {
+	// Marshal already normalizes its output.
+	return c.Marshal(message)
+}
+
+func (c *protoTextCodec) IsBinary() bool {
+	return false
+}
+
+// RawMessage is a message that's already been serialized. Codecs registered
+// with [WithBytesCodec] send RawMessages as-is and unmarshal into them without
+// parsing, so proxies can forward messages without knowing their schema. Use
+// *RawMessage as the request or response type parameter of clients and
+// handlers.
+type RawMessage []byte
+
+// bytesCodec passes the contents of RawMessages through unchanged. Any other
+// message is assumed to be one of the protocol's own Protobuf messages (for
+// example, gRPC's Status), so it's delegated to the default Protobuf codec.
+type bytesCodec struct {
+	name string
+}
+
+var _ Codec = (*bytesCodec)(nil)
+
+func (c *bytesCodec) Name() string { return c.name }
+
+func (c *bytesCodec) Marshal(message any) ([]byte, error) {
+	if raw, ok := message.(*RawMessage); ok {
+		if raw == nil {
+			// Like a nil Protobuf message, a nil RawMessage is empty.
+			return []byte{}, nil
+		}
+		return *raw, nil
+	}
+	return (&protoBinaryCodec{}).Marshal(message)
+}
+
+func (c *bytesCodec) MarshalAppend(dst []byte, message any) ([]byte, error) {
+	if raw, ok := message.(*RawMessage); ok {
+		if raw == nil {
+			return dst, nil
+		}
+		return append(dst, *raw...), nil
+	}
+	return (&protoBinaryCodec{}).MarshalAppend(dst, message)
+}
+
+func (c *bytesCodec) Unmarshal(data []byte, message any) error {
+	if raw, ok := message.(*RawMessage); ok {
+		if raw == nil {
+			return errors.New("unmarshal into nil *connect.RawMessage")
+		}
+		// The data is usually backed by a pooled buffer, so we must copy it.
+		*raw = append((*raw)[:0], data...)
+		return nil
+	}
+	return (&protoBinaryCodec{}).Unmarshal(data, message)
+}
+
 // readOnlyCodecs is a read-only interface to a map of named codecs.
 type readOnlyCodecs interface {
 	// Get gets the Codec with the given name.
@@ -0,0 +1,86 @@
+// Copyright 2021-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	connect "connectrpc.com/connect"
+	pingv1 "connectrpc.com/connect/internal/gen/connect/ping/v1"
+	"connectrpc.com/connect/internal/memhttp"
+)
+
+// Example_arrowCodec streams Apache Arrow record batches, one per message.
+// Connect doesn't encode or decode Arrow data: the "arrow" codec registered
+// with [connect.WithBytesCodec] passes each [connect.RawMessage] through
+// unchanged, so the handler sends bytes it already has and the client gets
+// them back as-is. Real programs write and read those bytes as Arrow IPC
+// encapsulated messages, with an Arrow library such as the ipc package in
+// github.com/apache/arrow/go. The request is an ordinary Protobuf message,
+// which the codec marshals as usual.
+//
+// Because the content type is "application/connect+arrow" (or
+// "application/grpc+arrow"), both sides must register the codec.
+func Example_arrowCodec() {
+	const procedure = "/example.table.v1.TableService/Scan"
+	mux := http.NewServeMux()
+	mux.Handle(procedure, connect.NewServerStreamHandler(
+		procedure,
+		func(_ context.Context, request *connect.Request[pingv1.CountUpRequest], stream *connect.ServerStream[connect.RawMessage]) error {
+			for i := range request.Msg.GetNumber() {
+				// Stand-in for a record batch written by an Arrow IPC writer.
+				batch := connect.RawMessage(fmt.Sprintf("record batch %d", i+1))
+				if err := stream.Send(&batch); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		connect.WithBytesCodec("arrow"),
+	))
+	server := memhttp.NewServer(mux)
+	defer server.Close()
+
+	client := connect.NewClient[pingv1.CountUpRequest, connect.RawMessage](
+		server.Client(),
+		server.URL()+procedure,
+		connect.WithBytesCodec("arrow"),
+	)
+	stream, err := client.CallServerStream(
+		context.Background(),
+		connect.NewRequest(&pingv1.CountUpRequest{Number: 2}),
+	)
+	if err != nil {
+		fmt.Println("error:", err)
+		return
+	}
+	defer stream.Close()
+	for stream.Receive() {
+		// An Arrow IPC reader would decode the batch from these bytes.
+		fmt.Println(string(*stream.Msg()))
+	}
+	if err := stream.Err(); err != nil {
+		fmt.Println("error:", err)
+		return
+	}
+	fmt.Println(stream.ResponseHeader().Get("Content-Type"))
+
+	// Output:
+	// record batch 1
+	// record batch 2
+	// application/connect+arrow
+}
@@ -16,6 +16,7 @@ package connect
 
 import (
 	"bytes"
+	"strconv"
 	"strings"
 	"testing"
 	"testing/quick"
@@ -23,6 +24,7 @@ import (
 	"connectrpc.com/connect/internal/assert"
 	pingv1 "connectrpc.com/connect/internal/gen/connect/ping/v1"
 	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
 	"google.golang.org/protobuf/types/known/emptypb"
 	"google.golang.org/protobuf/types/known/structpb"
 )
@@ -58,6 +60,9 @@ func TestCodecRoundTrips(t *testing.T) {
 	if err := quick.Check(makeRoundtrip(&protoJSONCodec{}), nil /* config */); err != nil {
 		t.Error(err)
 	}
+	if err := quick.Check(makeRoundtrip(&protoTextCodec{}), nil /* config */); err != nil {
+		t.Error(err)
+	}
 }
 
 func TestAppendCodec(t *testing.T) {
@@ -123,6 +128,9 @@ func TestStableCodec(t *testing.T) {
 	if err := quick.Check(makeRoundtrip(&protoJSONCodec{}), nil /* config */); err != nil {
 		t.Error(err)
 	}
+	if err := quick.Check(makeRoundtrip(&protoTextCodec{}), nil /* config */); err != nil {
+		t.Error(err)
+	}
 }
 
 func TestJSONCodec(t *testing.T) {
@@ -153,3 +161,282 @@ func TestJSONCodec(t *testing.T) {
 		)
 	})
 }
+
+func TestStableJSONCodec(t *testing.T) {
+	t.Parallel()
+
+	codec := &stableJSONCodec{protoJSONCodec{name: codecNameJSON}}
+
+	// Map entries are inserted in an arbitrary order, and the Any wraps
+	// another message with a map.
+	nested, err := structpb.NewStruct(map[string]any{"z": 1, "a": "b"})
+	assert.Nil(t, err)
+	packed, err := anypb.New(nested)
+	assert.Nil(t, err)
+	message, err := structpb.NewStruct(map[string]any{
+		"zebra": true,
+		"apple": []any{"x", 1},
+		"mango": map[string]any{"y": nil, "b": 2},
+	})
+	assert.Nil(t, err)
+	want := `{"apple":["x",1],"mango":{"b":2,"y":null},"zebra":true}`
+	for range 2 {
+		got, err := codec.Marshal(message)
+		assert.Nil(t, err)
+		assert.Equal(t, string(got), want)
+		got, err = codec.MarshalAppend([]byte("prefix:"), message)
+		assert.Nil(t, err)
+		assert.Equal(t, string(got), "prefix:"+want)
+	}
+	first, err := codec.Marshal(packed)
+	assert.Nil(t, err)
+	second, err := codec.Marshal(packed)
+	assert.Nil(t, err)
+	assert.Equal(t, first, second)
+	assert.Equal(t, string(first), `{"@type":"type.googleapis.com/google.protobuf.Struct","value":{"a":"b","z":1}}`)
+
+	// Decoding accepts anything protojson produces, including its whitespace.
+	indented := []byte("{\n  \"zebra\": true,\n  \"apple\": [\"x\", 1]\n}")
+	decoded := &structpb.Struct{}
+	assert.Nil(t, codec.Unmarshal(indented, decoded))
+	assert.Equal(t, decoded.GetFields()["zebra"].GetBoolValue(), true)
+}
+
+func TestJSONCodecEmitDefaultValues(t *testing.T) {
+	t.Parallel()
+	zero := &pingv1.PingResponse{}
+	defaults := &protoJSONCodec{name: codecNameJSON}
+	data, err := defaults.Marshal(zero)
+	assert.Nil(t, err)
+	assert.Equal(t, compactJSON(t, data), `{}`)
+
+	emitting := &protoJSONCodec{name: codecNameJSON, emitDefaults: true}
+	data, err = emitting.Marshal(zero)
+	assert.Nil(t, err)
+	assert.Equal(t, compactJSON(t, data), `{"number":"0","text":""}`)
+	data, err = emitting.MarshalAppend([]byte("prefix:"), zero)
+	assert.Nil(t, err)
+	assert.Equal(t, string(data[:7]), "prefix:")
+	assert.Equal(t, compactJSON(t, data[7:]), `{"number":"0","text":""}`)
+	decoded := &pingv1.PingResponse{Number: 1}
+	assert.Nil(t, emitting.Unmarshal(data[7:], decoded))
+	assert.True(t, proto.Equal(decoded, zero))
+
+	t.Run("options", func(t *testing.T) {
+		t.Parallel()
+		clientConfig, configErr := newClientConfig("http://localhost/connect.ping.v1.PingService/Ping", []ClientOption{
+			WithEmitDefaultValues(),
+			WithProtoJSON(),
+		})
+		assert.Nil(t, configErr)
+		data, err := clientConfig.Codec.Marshal(&pingv1.PingRequest{})
+		assert.Nil(t, err)
+		assert.Equal(t, compactJSON(t, data), `{"number":"0","text":""}`)
+		handlerConfig := newHandlerConfig("/connect.ping.v1.PingService/Ping", StreamTypeUnary, []HandlerOption{
+			WithEmitDefaultValues(),
+			WithStableJSON(),
+			WithJSONInt64Encoding(JSONInt64Number),
+		})
+		for _, name := range []string{codecNameJSON, codecNameJSONCharsetUTF8} {
+			data, err := handlerConfig.Codecs[name].Marshal(zero)
+			assert.Nil(t, err)
+			assert.Equal(t, string(data), `{"number":0,"text":""}`)
+		}
+		// Binary Protobuf is unaffected.
+		data, err = handlerConfig.Codecs[codecNameProto].Marshal(zero)
+		assert.Nil(t, err)
+		assert.Equal(t, len(data), 0)
+	})
+}
+
+func TestProtoTextCodec(t *testing.T) {
+	t.Parallel()
+
+	codec := &protoTextCodec{}
+
+	t.Run("stable", func(t *testing.T) {
+		t.Parallel()
+		message, err := structpb.NewStruct(map[string]any{
+			"text":   "colons: and  spaces",
+			"nested": map[string]any{"number": 42},
+		})
+		assert.Nil(t, err)
+		got, err := codec.Marshal(message)
+		assert.Nil(t, err)
+		want := `fields: {
+  key: "nested"
+  value: {
+    struct_value: {
+      fields: {
+        key: "number"
+        value: {
+          number_value: 42
+        }
+      }
+    }
+  }
+}
+fields: {
+  key: "text"
+  value: {
+    string_value: "colons: and  spaces"
+  }
+}
+`
+		assert.Equal(t, string(got), want)
+	})
+
+	t.Run("bracketed_names", func(t *testing.T) {
+		t.Parallel()
+		message, err := anypb.New(&pingv1.PingRequest{Text: "colons: in  values"})
+		assert.Nil(t, err)
+		got, err := codec.Marshal(message)
+		assert.Nil(t, err)
+		assert.Equal(t, string(got), `[type.googleapis.com/connect.ping.v1.PingRequest]: {
+  text: "colons: in  values"
+}
+`)
+		var roundTripped anypb.Any
+		assert.Nil(t, codec.Unmarshal(got, &roundTripped))
+		assert.True(t, proto.Equal(&roundTripped, message))
+		// Type URLs may contain colons, which don't end the name.
+		message.TypeUrl = "example.com:8080/connect.ping.v1.PingRequest"
+		got, err = codec.Marshal(message)
+		assert.Nil(t, err)
+		assert.True(t, strings.HasPrefix(string(got), "[example.com:8080/connect.ping.v1.PingRequest]: {\n"))
+	})
+
+	t.Run("unknown fields", func(t *testing.T) {
+		t.Parallel()
+		err := codec.Unmarshal([]byte(`foo: "bar"`), &emptypb.Empty{})
+		assert.Nil(t, err)
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		t.Parallel()
+		err := codec.Unmarshal([]byte{}, &emptypb.Empty{})
+		assert.Nil(t, err)
+	})
+}
+
+func TestBytesCodec(t *testing.T) {
+	t.Parallel()
+
+	codec := &bytesCodec{name: codecNameProto}
+
+	t.Run("passthrough", func(t *testing.T) {
+		t.Parallel()
+		data := []byte("not actually protobuf")
+		got, err := codec.Marshal(new(RawMessage))
+		assert.Nil(t, err)
+		assert.Zero(t, len(got))
+		raw := RawMessage(data)
+		got, err = codec.MarshalAppend([]byte("prefix:"), &raw)
+		assert.Nil(t, err)
+		assert.Equal(t, string(got), "prefix:not actually protobuf")
+		var unmarshaled RawMessage
+		assert.Nil(t, codec.Unmarshal(data, &unmarshaled))
+		assert.Equal(t, unmarshaled, RawMessage(data))
+		// Unmarshal must copy, since callers reuse their buffers.
+		data[0] = 'N'
+		assert.Equal(t, string(unmarshaled), "not actually protobuf")
+	})
+
+	t.Run("nil", func(t *testing.T) {
+		t.Parallel()
+		got, err := codec.Marshal((*RawMessage)(nil))
+		assert.Nil(t, err)
+		assert.Zero(t, len(got))
+		got, err = codec.MarshalAppend([]byte("prefix"), (*RawMessage)(nil))
+		assert.Nil(t, err)
+		assert.Equal(t, string(got), "prefix")
+		assert.NotNil(t, codec.Unmarshal([]byte("data"), (*RawMessage)(nil)))
+	})
+
+	t.Run("fallback", func(t *testing.T) {
+		t.Parallel()
+		message := &pingv1.PingRequest{Number: 42}
+		data, err := codec.Marshal(message)
+		assert.Nil(t, err)
+		want, err := proto.Marshal(message)
+		assert.Nil(t, err)
+		assert.Equal(t, data, want)
+		got := &pingv1.PingRequest{}
+		assert.Nil(t, codec.Unmarshal(data, got))
+		assert.Equal(t, got.GetNumber(), 42)
+		assert.NotNil(t, codec.Unmarshal(data, "not a message"))
+	})
+}
+
+func TestProtoBinaryCodecOptions(t *testing.T) {
+	t.Parallel()
+	const procedure = "/foo.v1.Bar/Baz"
+	// protoCodecs returns the binary Protobuf codecs clients and handlers use
+	// with the given options.
+	protoCodecs := func(t *testing.T, options ...Option) []*protoBinaryCodec {
+		t.Helper()
+		clientOptions := make([]ClientOption, len(options))
+		handlerOptions := make([]HandlerOption, len(options))
+		for i, option := range options {
+			clientOptions[i] = option
+			handlerOptions[i] = option
+		}
+		clientConfig, err := newClientConfig("http://localhost"+procedure, clientOptions)
+		assert.Nil(t, err)
+		clientCodec, ok := clientConfig.Codec.(*protoBinaryCodec)
+		assert.True(t, ok)
+		handlerConfig := newHandlerConfig(procedure, StreamTypeUnary, handlerOptions)
+		handlerCodec, ok := handlerConfig.Codecs[codecNameProto].(*protoBinaryCodec)
+		assert.True(t, ok)
+		return []*protoBinaryCodec{clientCodec, handlerCodec}
+	}
+	t.Run("marshal", func(t *testing.T) {
+		t.Parallel()
+		// Go randomizes map iteration, so only deterministic marshaling reliably
+		// orders the entries of a Struct the same way twice.
+		fields := make(map[string]any)
+		for i := range 64 {
+			fields["field"+strconv.Itoa(i)] = strconv.Itoa(i)
+		}
+		message, err := structpb.NewStruct(fields)
+		assert.Nil(t, err)
+		want, err := proto.MarshalOptions{Deterministic: true}.Marshal(message)
+		assert.Nil(t, err)
+		options := proto.MarshalOptions{Deterministic: true, UseCachedSize: true}
+		for _, codec := range protoCodecs(t, WithProtoMarshalOptions(options)) {
+			assert.Equal(t, codec.marshalOptions, options)
+			for range 2 {
+				_ = proto.Size(message) // populate the cached sizes
+				first, err := codec.Marshal(message)
+				assert.Nil(t, err)
+				assert.Equal(t, first, want)
+				second, err := codec.MarshalAppend(nil, message)
+				assert.Nil(t, err)
+				assert.Equal(t, second, want)
+			}
+			stable, err := codec.MarshalStable(message)
+			assert.Nil(t, err)
+			assert.Equal(t, stable, want)
+		}
+	})
+	t.Run("unmarshal", func(t *testing.T) {
+		t.Parallel()
+		data, err := proto.Marshal(&pingv1.PingRequest{Number: 42, Text: "unknown to CountUpRequest"})
+		assert.Nil(t, err)
+		for _, codec := range protoCodecs(t, WithProtoUnmarshalOptions(proto.UnmarshalOptions{DiscardUnknown: true})) {
+			var view pingv1.CountUpRequest
+			assert.Nil(t, codec.Unmarshal(data, &view))
+			assert.Equal(t, view.GetNumber(), 42)
+			assert.Zero(t, len(view.ProtoReflect().GetUnknown()))
+		}
+	})
+	t.Run("other_codecs", func(t *testing.T) {
+		t.Parallel()
+		clientConfig, err := newClientConfig("http://localhost"+procedure, []ClientOption{
+			WithProtoMarshalOptions(proto.MarshalOptions{Deterministic: true}),
+			WithProtoJSON(),
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, clientConfig.Codec.Name(), codecNameJSON)
+	})
+}
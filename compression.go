@@ -22,10 +22,13 @@ import (
 	"net/http"
 	"strings"
 	"sync"
+
+	"github.com/andybalholm/brotli"
 )
 
 const (
 	compressionGzip     = "gzip"
+	compressionBrotli   = "br"
 	compressionIdentity = "identity"
 )
 
@@ -130,6 +133,36 @@ func (c *compressionPool) Compress(dst *bytes.Buffer, src *bytes.Buffer) *Error
 	return nil
 }
 
+// compressIfWorthwhile compresses src into dst, unless the heuristic
+// estimates that compression would save too little, in which case it leaves
+// dst empty and src unread and returns false.
+func (c *compressionPool) compressIfWorthwhile(dst, src *bytes.Buffer, heuristic compressionHeuristic, pool *bufferPool) (bool, *Error) {
+	if !heuristic.enabled() {
+		return true, c.Compress(dst, src)
+	}
+	if src.Len() <= heuristic.SampleBytes {
+		// The sample is the whole message, so compress it once and judge the
+		// result.
+		if err := c.Compress(dst, bytes.NewBuffer(src.Bytes())); err != nil {
+			return false, err
+		}
+		if !heuristic.worthwhile(src.Len(), dst.Len()) {
+			dst.Reset()
+			return false, nil
+		}
+		return true, nil
+	}
+	sample := pool.Get()
+	defer pool.Put(sample)
+	if err := c.Compress(sample, bytes.NewBuffer(src.Bytes()[:heuristic.SampleBytes])); err != nil {
+		return false, err
+	}
+	if !heuristic.worthwhile(heuristic.SampleBytes, sample.Len()) {
+		return false, nil
+	}
+	return true, c.Compress(dst, src)
+}
+
 func (c *compressionPool) getDecompressor(reader io.Reader) (Decompressor, error) {
 	decompressor, ok := c.decompressors.Get().(Decompressor)
 	if !ok {
@@ -171,6 +204,37 @@ func (c *compressionPool) putCompressor(compressor Compressor) error {
 	return nil
 }
 
+// brotliDecompressor adapts [*brotli.Reader], which doesn't need closing, to
+// the Decompressor interface.
+type brotliDecompressor struct {
+	*brotli.Reader
+}
+
+func (d *brotliDecompressor) Close() error {
+	return nil
+}
+
+// compressionHeuristic skips compressing messages that compress poorly,
+// judging by how well their first bytes compress. See
+// [WithCompressionHeuristic].
+type compressionHeuristic struct {
+	SampleBytes int
+	MinRatio    float64
+}
+
+func (h compressionHeuristic) enabled() bool {
+	return h.SampleBytes > 0
+}
+
+// worthwhile reports whether compressing size bytes down to compressedSize
+// bytes meets the minimum ratio.
+func (h compressionHeuristic) worthwhile(size, compressedSize int) bool {
+	if compressedSize == 0 {
+		return true
+	}
+	return float64(size)/float64(compressedSize) >= h.MinRatio
+}
+
 // readOnlyCompressionPools is a read-only interface to a map of named
 // compressionPools.
 type readOnlyCompressionPools interface {
@@ -184,8 +248,17 @@ func newReadOnlyCompressionPools(
 	nameToPool map[string]*compressionPool,
 	reversedNames []string,
 ) readOnlyCompressionPools {
-	// Client and handler configs keep compression names in registration order,
-	// but we want the last registered to be the most preferred.
+	return &namedCompressionPools{
+		nameToPool:          nameToPool,
+		commaSeparatedNames: strings.Join(preferredCompressionNames(reversedNames), ","),
+	}
+}
+
+// preferredCompressionNames returns the unique compression names, most
+// preferred first. Client and handler configs keep compression names in
+// registration order, but we want the last registered to be the most
+// preferred.
+func preferredCompressionNames(reversedNames []string) []string {
 	names := make([]string, 0, len(reversedNames))
 	seen := make(map[string]struct{}, len(reversedNames))
 	for i := len(reversedNames) - 1; i >= 0; i-- {
@@ -196,10 +269,7 @@ func newReadOnlyCompressionPools(
 		seen[name] = struct{}{}
 		names = append(names, name)
 	}
-	return &namedCompressionPools{
-		nameToPool:          nameToPool,
-		commaSeparatedNames: strings.Join(names, ","),
-	}
+	return names
 }
 
 type namedCompressionPools struct {
@@ -0,0 +1,56 @@
+// Copyright 2021-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"net/http"
+	"strings"
+)
+
+// isCompressionRejected reports whether err is the server refusing a request
+// compressed with name: negotiation failures are always CodeUnimplemented,
+// and the server advertises the encodings it does accept.
+func isCompressionRejected(err error, name string) bool {
+	connectErr, ok := asError(err)
+	if !ok || !connectErr.wireErr || connectErr.Code() != CodeUnimplemented {
+		return false
+	}
+	for _, key := range []string{
+		connectUnaryHeaderAcceptCompression,
+		connectStreamingHeaderAcceptCompression,
+		grpcHeaderAcceptCompression,
+	} {
+		values, ok := connectErr.meta[key]
+		if !ok {
+			continue
+		}
+		// Servers that only support identity advertise an empty list.
+		for _, accepted := range strings.FieldsFunc(strings.Join(values, ","), isCommaOrSpace) {
+			if accepted == name {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// deleteRequestCompression removes the headers describing the compression of
+// a request, so that it can be sent again uncompressed.
+func deleteRequestCompression(header http.Header) {
+	delHeaderCanonical(header, connectUnaryHeaderCompression)
+	delHeaderCanonical(header, connectStreamingHeaderCompression)
+	delHeaderCanonical(header, grpcHeaderCompression)
+}
@@ -15,13 +15,19 @@
 package connect
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"io"
+	"math/rand/v2"
 	"net/http"
+	"strings"
 	"testing"
 
 	"connectrpc.com/connect/internal/assert"
 	"connectrpc.com/connect/internal/memhttp/memhttptest"
 	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
 )
 
 func TestAcceptEncodingOrdering(t *testing.T) {
@@ -107,6 +113,28 @@ func TestClientCompressionOptionTest(t *testing.T) {
 		assert.Equal(t, config.CompressionNames, nil)
 		checkPools(t, config)
 	})
+	t.Run("WithGzipLevel", func(t *testing.T) {
+		t.Parallel()
+		opts := []ClientOption{WithAcceptCompression("foo", dummyDecompressCtor, dummyCompressCtor), WithGzipLevel(gzip.BestSpeed)}
+		config, err := newClientConfig(testURL, opts)
+		assert.Nil(t, err)
+		assert.Equal(t, config.CompressionNames, []string{compressionGzip, "foo"})
+		checkPools(t, config)
+	})
+	t.Run("WithGzipLevel-unregistered", func(t *testing.T) {
+		t.Parallel()
+		opts := []ClientOption{WithAcceptCompression("gzip", nil, nil), WithGzipLevel(gzip.BestSpeed)}
+		config, err := newClientConfig(testURL, opts)
+		assert.Nil(t, err)
+		assert.Equal(t, config.CompressionNames, nil)
+		checkPools(t, config)
+	})
+	t.Run("WithGzipLevel-invalid", func(t *testing.T) {
+		t.Parallel()
+		_, err := newClientConfig(testURL, []ClientOption{WithGzipLevel(42)})
+		assert.NotNil(t, err)
+		assert.Equal(t, err.Message(), "invalid gzip compression level 42")
+	})
 }
 
 func TestHandlerCompressionOptionTest(t *testing.T) {
@@ -158,4 +186,132 @@ func TestHandlerCompressionOptionTest(t *testing.T) {
 		assert.Equal(t, config.CompressionNames, nil)
 		checkPools(t, config)
 	})
+	t.Run("WithGzipLevel", func(t *testing.T) {
+		t.Parallel()
+		opts := []HandlerOption{WithGzipLevel(gzip.BestCompression)}
+		config := newHandlerConfig(testProc, StreamTypeUnary, opts)
+		assert.Equal(t, config.CompressionNames, []string{compressionGzip})
+		checkPools(t, config)
+	})
+	t.Run("WithGzipLevel-unregistered", func(t *testing.T) {
+		t.Parallel()
+		opts := []HandlerOption{WithCompression("gzip", nil, nil), WithGzipLevel(gzip.BestCompression)}
+		config := newHandlerConfig(testProc, StreamTypeUnary, opts)
+		assert.Equal(t, config.CompressionNames, nil)
+		checkPools(t, config)
+	})
+	t.Run("WithGzipLevel-invalid", func(t *testing.T) {
+		t.Parallel()
+		defer func() {
+			assert.Equal(t, recover(), any("connect: invalid gzip compression level -3"))
+		}()
+		newHandlerConfig(testProc, StreamTypeUnary, []HandlerOption{WithGzipLevel(-3)})
+		t.Error("expected panic")
+	})
+}
+
+func TestCompressionNames(t *testing.T) {
+	t.Parallel()
+	dummyDecompressCtor := func() Decompressor { return nil }
+	dummyCompressCtor := func() Compressor { return nil }
+
+	t.Run("client", func(t *testing.T) {
+		t.Parallel()
+		var acceptEncoding string
+		server := memhttptest.NewServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			acceptEncoding = r.Header.Get(connectUnaryHeaderAcceptCompression)
+			w.WriteHeader(http.StatusOK)
+		}))
+		client := NewClient[emptypb.Empty, emptypb.Empty](
+			server.Client(),
+			server.URL(),
+			WithBrotli(),
+			WithAcceptCompression("foo", dummyDecompressCtor, dummyCompressCtor),
+		)
+		names := client.CompressionNames()
+		assert.Equal(t, names, []string{"foo", compressionBrotli, compressionGzip})
+		_, _ = client.CallUnary(context.Background(), NewRequest(&emptypb.Empty{}))
+		assert.Equal(t, acceptEncoding, strings.Join(names, ","))
+
+		unregistered := NewClient[emptypb.Empty, emptypb.Empty](
+			server.Client(),
+			server.URL(),
+			WithBrotli(),
+			WithAcceptCompression(compressionGzip, nil, nil),
+		)
+		assert.Equal(t, unregistered.CompressionNames(), []string{compressionBrotli})
+		invalid := NewClient[emptypb.Empty, emptypb.Empty](server.Client(), "://invalid")
+		assert.Zero(t, len(invalid.CompressionNames()))
+	})
+	t.Run("handler", func(t *testing.T) {
+		t.Parallel()
+		handler := NewUnaryHandler(
+			"/service/method",
+			func(context.Context, *Request[emptypb.Empty]) (*Response[emptypb.Empty], error) {
+				return NewResponse(&emptypb.Empty{}), nil
+			},
+			WithBrotli(),
+			WithCompression("foo", dummyDecompressCtor, dummyCompressCtor),
+			// Registering gzip again makes it the most preferred.
+			withGzip(),
+		)
+		names := handler.CompressionNames()
+		assert.Equal(t, names, []string{compressionGzip, "foo", compressionBrotli})
+		// Callers can't modify the handler's configuration.
+		names[0] = "bar"
+		assert.Equal(t, handler.CompressionNames()[0], compressionGzip)
+	})
+}
+
+func TestGzipLevel(t *testing.T) {
+	t.Parallel()
+	// Sentences built from a small vocabulary compress well, but not so
+	// trivially that every level produces the same output.
+	words := strings.Fields("the quick brown fox jumps over a lazy dog while seven wizards quietly hex jovial zebras")
+	rng := rand.New(rand.NewPCG(1, 2))
+	var text strings.Builder
+	for text.Len() < 64*1024 {
+		text.WriteString(words[rng.IntN(len(words))])
+		text.WriteByte(' ')
+	}
+	payload := text.String()
+
+	compressedSize := func(t *testing.T, level int) int {
+		t.Helper()
+		pool := WithGzipLevel(level).(*gzipLevelOption).pool //nolint:forcetypeassert
+		compressed := &bytes.Buffer{}
+		assert.Nil(t, pool.Compress(compressed, bytes.NewBufferString(payload)))
+		// The output is still standard gzip.
+		reader, err := gzip.NewReader(bytes.NewReader(compressed.Bytes()))
+		assert.Nil(t, err)
+		decompressed, err := io.ReadAll(reader)
+		assert.Nil(t, err)
+		assert.Equal(t, string(decompressed), payload)
+		return compressed.Len()
+	}
+	fast := compressedSize(t, gzip.BestSpeed)
+	small := compressedSize(t, gzip.BestCompression)
+	assert.True(t, small < fast, assert.Sprintf("BestCompression %d bytes, BestSpeed %d bytes", small, fast))
+
+	t.Run("negotiated", func(t *testing.T) {
+		t.Parallel()
+		mux := http.NewServeMux()
+		mux.Handle("/test.v1.Service/Echo", NewUnaryHandler(
+			"/test.v1.Service/Echo",
+			func(_ context.Context, request *Request[wrapperspb.StringValue]) (*Response[wrapperspb.StringValue], error) {
+				return NewResponse(request.Msg), nil
+			},
+			WithGzipLevel(gzip.BestCompression),
+		))
+		server := memhttptest.NewServer(t, mux)
+		client := NewClient[wrapperspb.StringValue, wrapperspb.StringValue](
+			server.Client(),
+			server.URL()+"/test.v1.Service/Echo",
+			WithGzipLevel(gzip.BestSpeed),
+			WithSendGzip(),
+		)
+		response, err := client.CallUnary(context.Background(), NewRequest(wrapperspb.String(payload)))
+		assert.Nil(t, err)
+		assert.Equal(t, response.Msg.GetValue(), payload)
+	})
 }
@@ -28,8 +28,11 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/netip"
 	"net/url"
+	"sync/atomic"
 )
 
 // Version is the semantic version of the connect module.
@@ -69,6 +72,18 @@ func (s StreamType) String() string {
 	return fmt.Sprintf("stream_%d", s)
 }
 
+// IsClientStream reports whether the client sends a stream of messages, as it
+// does in client streaming and bidirectional streaming RPCs.
+func (s StreamType) IsClientStream() bool {
+	return s&StreamTypeClient != 0
+}
+
+// IsServerStream reports whether the server sends a stream of messages, as it
+// does in server streaming and bidirectional streaming RPCs.
+func (s StreamType) IsServerStream() bool {
+	return s&StreamTypeServer != 0
+}
+
 // StreamingHandlerConn is the server's view of a bidirectional message
 // exchange. Interceptors for streaming RPCs may wrap StreamingHandlerConns.
 //
@@ -106,8 +121,10 @@ type StreamingHandlerConn interface {
 // StreamingClientConns write request headers to the network with the first
 // call to Send. Any subsequent mutations are effectively no-ops. When the
 // server is done sending data, the StreamingClientConn's Receive method
-// returns an error wrapping [io.EOF]. Clients should check for this using the
-// standard library's [errors.Is]. If the server encounters an error during
+// returns [io.EOF] itself, without wrapping, so clients may check for it using
+// either the standard library's [errors.Is] or a direct comparison. If the
+// server ends the stream with an error, Receive returns that error as an
+// [*Error] instead. If the server encounters an error during
 // processing, subsequent calls to the StreamingClientConn's Send method will
 // return an error wrapping [io.EOF]; clients may then call Receive to unmarshal
 // the error.
@@ -117,7 +134,8 @@ type StreamingHandlerConn interface {
 // shouldn't write them.
 //
 // StreamingClientConn implementations provided by this module guarantee that
-// all returned errors can be cast to [*Error] using the standard library's
+// all returned errors, other than the [io.EOF] returned by Receive at the end
+// of a successful stream, can be cast to [*Error] using the standard library's
 // [errors.As].
 //
 // In order to support bidirectional streaming RPCs, all StreamingClientConn
@@ -129,7 +147,10 @@ type StreamingClientConn interface {
 	Peer() Peer
 
 	// Send, RequestHeader, and CloseRequest may race with each other, but must
-	// be safe to call concurrently with all other methods.
+	// be safe to call concurrently with all other methods. CloseRequest only
+	// half-closes the stream: it tells the server that the client is done
+	// sending, but Receive keeps working until the server ends the stream.
+	// Calling Send after CloseRequest returns an error.
 	Send(any) error
 	RequestHeader() http.Header
 	CloseRequest() error
@@ -211,6 +232,12 @@ func (r *Request[_]) setRequestMethod(method string) {
 	r.method = method
 }
 
+// setPeer replaces the request's peer, once the response reveals more about
+// it.
+func (r *Request[_]) setPeer(peer Peer) {
+	r.peer = peer
+}
+
 // AnyRequest is the common method set of every [Request], regardless of type
 // parameter. It's used in unary interceptors.
 //
@@ -230,6 +257,7 @@ type AnyRequest interface {
 
 	internalOnly()
 	setRequestMethod(string)
+	setPeer(Peer)
 }
 
 // Response is a wrapper around a generated response message. It provides
@@ -331,19 +359,85 @@ type Spec struct {
 // Currently, it's either [ProtocolConnect], [ProtocolGRPC], or
 // [ProtocolGRPCWeb], but additional protocols may be added in the future.
 //
+// Codec is the name of the codec used to encode messages, such as "proto" or
+// "json". For the server, this is the codec selected from the request's
+// Content-Type. For the client, it's the codec configured with [WithCodec] or
+// one of its shorthands, like [WithProtoJSON].
+//
 // Query contains the query parameters for the request. For the server, this
-// will reflect the actual query parameters sent. For the client, it is unset.
+// will reflect the query parameters sent, except for those reserved by the
+// Connect protocol to carry GET requests ("connect", "encoding", "message",
+// "base64", and "compression"), so handlers can read their own parameters for
+// routing or feature flags. It's nil if there are none. For the client, it is
+// unset.
+//
+// NetAddr is Addr as a [net.Addr], when it can be determined without a DNS
+// lookup. Server-side, it's a [*net.UnixAddr] if the request arrived on a Unix
+// domain socket and a [*net.TCPAddr] if the request's RemoteAddr is an IP:port
+// pair. Client-side, it's a [*net.TCPAddr] if the server's URL uses an IP
+// address and port. Otherwise, it's nil. NetAddr always describes the
+// immediate peer: behind a proxy, it's the proxy's address, and any headers
+// carrying the original client's address are left for the caller to parse.
+//
+// RequestCompression and ResponseCompression name the compression algorithms
+// negotiated for each direction, such as "gzip", and are empty if messages
+// are sent uncompressed. Messages smaller than [WithCompressMinBytes] are
+// always sent uncompressed, so these name the algorithm messages may use. For
+// the server, both are known as soon as the request arrives. For the client,
+// RequestCompression is the algorithm configured with
+// [WithSendCompression], and ResponseCompression is set once the response
+// headers arrive: unary interceptors see it in the request's Peer after the
+// call returns, and streaming interceptors see it in the conn's Peer after
+// the first Receive.
 type Peer struct {
-	Addr     string
-	Protocol string
-	Query    url.Values // server-only
+	Addr                string
+	Protocol            string
+	Codec               string
+	Query               url.Values // server-only
+	NetAddr             net.Addr
+	RequestCompression  string
+	ResponseCompression string
 }
 
-func newPeerFromURL(url *url.URL, protocol string) Peer {
+func newPeerFromURL(url *url.URL, protocol string, codec Codec, compression string) Peer {
 	return Peer{
-		Addr:     url.Host,
-		Protocol: protocol,
+		Addr:               url.Host,
+		Protocol:           protocol,
+		Codec:              codec.Name(),
+		NetAddr:            netAddrFromHostPort(url.Host),
+		RequestCompression: peerCompression(compression),
+	}
+}
+
+// peerCompression converts a compression name from a header or option to the
+// form Peer uses, in which no compression is the empty string.
+func peerCompression(name string) string {
+	if name == compressionIdentity {
+		return ""
+	}
+	return name
+}
+
+// newPeerNetAddr returns the net.Addr of the client that sent the request.
+func newPeerNetAddr(request *http.Request) net.Addr {
+	// The server stores the listener's address in the context, which tells us
+	// whether the connection is a Unix domain socket. Clients of Unix sockets are
+	// usually unnamed, so RemoteAddr is typically empty.
+	if local, ok := request.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		switch network := local.Network(); network {
+		case "unix", "unixpacket":
+			return &net.UnixAddr{Name: request.RemoteAddr, Net: network}
+		}
+	}
+	return netAddrFromHostPort(request.RemoteAddr)
+}
+
+func netAddrFromHostPort(hostport string) net.Addr {
+	addrPort, err := netip.ParseAddrPort(hostport)
+	if err != nil {
+		return nil
 	}
+	return net.TCPAddrFromAddrPort(addrPort)
 }
 
 // handlerConnCloser extends StreamingHandlerConn with a method for handlers to
@@ -439,3 +533,60 @@ func receiveUnaryMessage[T any](conn receiveConn, initializer maybeInitializer,
 	}
 	return &msg, nil
 }
+
+// MessageCounts returns the number of messages successfully sent and received
+// so far on a [StreamingClientConn] or [StreamingHandlerConn]. Calling Send
+// with a nil message, which only sends headers, doesn't count as a message.
+// It's safe to call concurrently with the conn's methods, so interceptors can
+// observe streams in use on other goroutines.
+//
+// The conns provided by this module keep counts. Interceptors that wrap conns
+// should give their wrappers an Unwrap method that returns the wrapped
+// StreamingClientConn or StreamingHandlerConn, so that MessageCounts can reach
+// the counts. If it can't, ok is false.
+func MessageCounts(conn any) (sent, received int, ok bool) {
+	for {
+		if counter, ok := conn.(messageCounter); ok {
+			return counter.sentMessages(), counter.receivedMessages(), true
+		}
+		switch wrapper := conn.(type) {
+		case interface{ Unwrap() StreamingClientConn }:
+			conn = wrapper.Unwrap()
+		case interface{ Unwrap() StreamingHandlerConn }:
+			conn = wrapper.Unwrap()
+		default:
+			return 0, 0, false
+		}
+	}
+}
+
+// messageCounter is implemented by conns that embed messageCounts.
+type messageCounter interface {
+	sentMessages() int
+	receivedMessages() int
+}
+
+// messageCounts counts the messages sent and received on a conn. Interceptors
+// may read the counts from any goroutine, so the counters are atomic.
+type messageCounts struct {
+	sent     atomic.Int64
+	received atomic.Int64
+}
+
+func (c *messageCounts) sentMessages() int {
+	return int(c.sent.Load())
+}
+
+func (c *messageCounts) receivedMessages() int {
+	return int(c.received.Load())
+}
+
+func (c *messageCounts) countSent(msg any) {
+	if msg != nil {
+		c.sent.Add(1)
+	}
+}
+
+func (c *messageCounts) countReceived() {
+	c.received.Add(1)
+}
@@ -29,8 +29,10 @@ import (
 	"net"
 	"net/http"
 	"runtime"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -39,8 +41,10 @@ import (
 	"connectrpc.com/connect/internal/gen/connect/import/v1/importv1connect"
 	pingv1 "connectrpc.com/connect/internal/gen/connect/ping/v1"
 	"connectrpc.com/connect/internal/gen/connect/ping/v1/pingv1connect"
+	statusv1 "connectrpc.com/connect/internal/gen/connectext/grpc/status/v1"
 	"connectrpc.com/connect/internal/memhttp"
 	"connectrpc.com/connect/internal/memhttp/memhttptest"
+	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/reflect/protoregistry"
 	"google.golang.org/protobuf/types/known/wrapperspb"
@@ -702,6 +706,81 @@ func TestHeaderBasic(t *testing.T) {
 	assert.Equal(t, response.Header().Get(key), hval)
 }
 
+func TestHeaderMultipleValues(t *testing.T) {
+	t.Parallel()
+	const (
+		headerKey  = "Set-Cookie"
+		trailerKey = "Multi-Trailer"
+	)
+	// Cookies often contain commas, so joining and splitting values on commas
+	// would corrupt them.
+	values := []string{"a=1", "b=2; Path=/", "c=3; Expires=Wed, 21 Oct 2037 07:28:00 GMT"}
+	addAll := func(header http.Header, key string) {
+		for _, value := range values {
+			header.Add(key, value)
+		}
+	}
+	pingServer := &pluggablePingServer{
+		ping: func(_ context.Context, request *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+			if request.Msg.GetNumber() < 0 {
+				err := connect.NewError(connect.CodeFailedPrecondition, errors.New("negative"))
+				addAll(err.Meta(), headerKey)
+				return nil, err
+			}
+			response := connect.NewResponse(&pingv1.PingResponse{})
+			addAll(response.Header(), headerKey)
+			addAll(response.Trailer(), trailerKey)
+			return response, nil
+		},
+		countUp: func(_ context.Context, _ *connect.Request[pingv1.CountUpRequest], stream *connect.ServerStream[pingv1.CountUpResponse]) error {
+			addAll(stream.ResponseHeader(), headerKey)
+			addAll(stream.ResponseTrailer(), trailerKey)
+			return stream.Send(&pingv1.CountUpResponse{Number: 1})
+		},
+	}
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(pingServer))
+	server := memhttptest.NewServer(t, mux)
+	for _, protocol := range []struct {
+		name string
+		opts []connect.ClientOption
+	}{
+		{name: "connect"},
+		{name: "grpc", opts: []connect.ClientOption{connect.WithGRPC()}},
+		{name: "grpcweb", opts: []connect.ClientOption{connect.WithGRPCWeb()}},
+	} {
+		t.Run(protocol.name, func(t *testing.T) {
+			t.Parallel()
+			client := pingv1connect.NewPingServiceClient(server.Client(), server.URL(), protocol.opts...)
+			t.Run("unary", func(t *testing.T) {
+				t.Parallel()
+				response, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+				assert.Nil(t, err)
+				assert.Equal(t, response.Header().Values(headerKey), values)
+				assert.Equal(t, response.Trailer().Values(trailerKey), values)
+			})
+			t.Run("unary_error", func(t *testing.T) {
+				t.Parallel()
+				_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Number: -1}))
+				var connectErr *connect.Error
+				assert.True(t, errors.As(err, &connectErr))
+				assert.Equal(t, connectErr.Meta().Values(headerKey), values)
+			})
+			t.Run("server_stream", func(t *testing.T) {
+				t.Parallel()
+				stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{}))
+				assert.Nil(t, err)
+				for stream.Receive() { //nolint:revive
+				}
+				assert.Nil(t, stream.Err())
+				assert.Equal(t, stream.ResponseHeader().Values(headerKey), values)
+				assert.Equal(t, stream.ResponseTrailer().Values(trailerKey), values)
+				assert.Nil(t, stream.Close())
+			})
+		})
+	}
+}
+
 func TestHeaderHost(t *testing.T) {
 	t.Parallel()
 	const (
@@ -861,7 +940,10 @@ func TestGRPCMissingTrailersError(t *testing.T) {
 	trimTrailers := func(handler http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			r.Header.Del("Te")
-			handler.ServeHTTP(&trimTrailerWriter{w: w}, r)
+			writer := &trimTrailerWriter{w: w}
+			handler.ServeHTTP(writer, r)
+			// Trailers-only responses are written after the handler returns.
+			writer.removeTrailers()
 		})
 	}
 
@@ -1085,6 +1167,538 @@ func TestCustomCompression(t *testing.T) {
 	assert.Equal(t, response.Msg, &pingv1.PingResponse{Text: request.GetText()})
 }
 
+func TestBrotliCompression(t *testing.T) {
+	t.Parallel()
+	var requestEncoding atomic.Value
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(
+		pingServer{},
+		connect.WithBrotli(),
+	))
+	server := memhttptest.NewServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, key := range []string{"Content-Encoding", "Connect-Content-Encoding", "Grpc-Encoding"} {
+			if encoding := r.Header.Get(key); encoding != "" {
+				requestEncoding.Store(encoding)
+			}
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	request := &pingv1.PingRequest{Text: strings.Repeat("brotli ", 1024)}
+	for _, protocol := range []struct {
+		name    string
+		options []connect.ClientOption
+	}{
+		{name: "connect"},
+		{name: "grpc", options: []connect.ClientOption{connect.WithGRPC()}},
+		{name: "grpcweb", options: []connect.ClientOption{connect.WithGRPCWeb()}},
+	} {
+		t.Run(protocol.name, func(t *testing.T) {
+			client := pingv1connect.NewPingServiceClient(
+				server.Client(),
+				server.URL(),
+				connect.WithClientOptions(protocol.options...),
+				connect.WithBrotli(),
+				connect.WithSendCompression("br"),
+			)
+			requestEncoding.Store("")
+			response, err := client.Ping(context.Background(), connect.NewRequest(request))
+			assert.Nil(t, err)
+			assert.Equal(t, response.Msg.GetText(), request.GetText())
+			assert.Equal(t, requestEncoding.Load(), any("br"))
+		})
+	}
+	t.Run("gzip_only_server", func(t *testing.T) {
+		t.Parallel()
+		mux := http.NewServeMux()
+		mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}))
+		server := memhttptest.NewServer(t, mux)
+		client := pingv1connect.NewPingServiceClient(
+			server.Client(),
+			server.URL(),
+			connect.WithBrotli(),
+		)
+		response, err := client.Ping(context.Background(), connect.NewRequest(request))
+		assert.Nil(t, err)
+		assert.Equal(t, response.Msg.GetText(), request.GetText())
+	})
+}
+
+func TestSendCompressionFallback(t *testing.T) {
+	t.Parallel()
+	// newServer returns a server that records the encoding of each request.
+	newServer := func(t *testing.T, opts ...connect.HandlerOption) (*memhttp.Server, func() []string) {
+		t.Helper()
+		var mu sync.Mutex
+		var encodings []string
+		mux := http.NewServeMux()
+		mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}, opts...))
+		server := memhttptest.NewServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			encoding := "identity"
+			for _, key := range []string{"Content-Encoding", "Connect-Content-Encoding", "Grpc-Encoding"} {
+				if value := r.Header.Get(key); value != "" {
+					encoding = value
+				}
+			}
+			mu.Lock()
+			encodings = append(encodings, encoding)
+			mu.Unlock()
+			mux.ServeHTTP(w, r)
+		}))
+		return server, func() []string {
+			mu.Lock()
+			defer mu.Unlock()
+			recorded := encodings
+			encodings = nil
+			return recorded
+		}
+	}
+	request := &pingv1.PingRequest{Text: strings.Repeat("compress me ", 128)}
+	for _, protocol := range []struct {
+		name    string
+		options []connect.ClientOption
+	}{
+		{name: "connect"},
+		{name: "grpc", options: []connect.ClientOption{connect.WithGRPC()}},
+		{name: "grpcweb", options: []connect.ClientOption{connect.WithGRPCWeb()}},
+	} {
+		t.Run(protocol.name, func(t *testing.T) {
+			t.Parallel()
+			t.Run("accepted", func(t *testing.T) {
+				t.Parallel()
+				server, encodings := newServer(t)
+				client := pingv1connect.NewPingServiceClient(server.Client(), server.URL(), connect.WithClientOptions(protocol.options...), connect.WithSendGzip())
+				response, err := client.Ping(context.Background(), connect.NewRequest(request))
+				assert.Nil(t, err)
+				assert.Equal(t, response.Msg.GetText(), request.GetText())
+				assert.Equal(t, encodings(), []string{"gzip"})
+			})
+			for _, testCase := range []struct {
+				name string
+				opts []connect.HandlerOption
+			}{
+				{name: "brotli_only", opts: []connect.HandlerOption{connect.WithBrotli(), connect.WithCompression("gzip", nil, nil)}},
+				{name: "identity_only", opts: []connect.HandlerOption{connect.WithCompression("gzip", nil, nil)}},
+			} {
+				t.Run(testCase.name, func(t *testing.T) {
+					t.Parallel()
+					server, encodings := newServer(t, testCase.opts...)
+					sendGzip := connect.WithSendGzip()
+					client := pingv1connect.NewPingServiceClient(server.Client(), server.URL(), connect.WithClientOptions(protocol.options...), sendGzip)
+					pingRequest := connect.NewRequest(request)
+					response, err := client.Ping(context.Background(), pingRequest)
+					assert.Nil(t, err)
+					assert.Equal(t, response.Msg.GetText(), request.GetText())
+					assert.Equal(t, encodings(), []string{"gzip", "identity"})
+					assert.Equal(t, pingRequest.Peer().RequestCompression, "")
+					// Later calls skip compression.
+					pingRequest = connect.NewRequest(request)
+					_, err = client.Ping(context.Background(), pingRequest)
+					assert.Nil(t, err)
+					assert.Equal(t, encodings(), []string{"identity"})
+					assert.Equal(t, pingRequest.Peer().RequestCompression, "")
+					// Clients built later from the same option start out
+					// compressing again.
+					client = pingv1connect.NewPingServiceClient(server.Client(), server.URL(), connect.WithClientOptions(protocol.options...), sendGzip)
+					_, err = client.Ping(context.Background(), connect.NewRequest(request))
+					assert.Nil(t, err)
+					assert.Equal(t, encodings(), []string{"gzip", "identity"})
+				})
+			}
+		})
+	}
+	t.Run("other_unimplemented", func(t *testing.T) {
+		t.Parallel()
+		server, encodings := newServer(t)
+		client := connect.NewClient[pingv1.PingRequest, pingv1.PingResponse](
+			server.Client(),
+			server.URL()+"/connect.ping.v1.PingService/Missing",
+			connect.WithSendGzip(),
+		)
+		_, err := client.CallUnary(context.Background(), connect.NewRequest(request))
+		assert.Equal(t, connect.CodeOf(err), connect.CodeUnimplemented)
+		assert.Equal(t, encodings(), []string{"gzip"})
+	})
+}
+
+func TestResponseCompression(t *testing.T) {
+	t.Parallel()
+	// newClient starts a server with the given options and returns a client
+	// along with a function that reports whether the first request and
+	// response messages were compressed, according to their envelope flags.
+	newClient := func(
+		t *testing.T,
+		handlerOpts []connect.HandlerOption,
+		clientOpts ...connect.ClientOption,
+	) (pingv1connect.PingServiceClient, func() (request, response bool, responseEncoding string)) {
+		t.Helper()
+		var mu sync.Mutex
+		var requestFlags, responseFlags byte
+		var responseEncoding string
+		mux := http.NewServeMux()
+		mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}, handlerOpts...))
+		server := memhttptest.NewServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, err := io.ReadAll(r.Body)
+			assert.Nil(t, err)
+			assert.True(t, len(body) > 5)
+			mu.Lock()
+			requestFlags = body[0]
+			mu.Unlock()
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			mux.ServeHTTP(w, r)
+		}))
+		httpClient := httpClientFunc(func(request *http.Request) (*http.Response, error) {
+			response, err := server.Client().Do(request)
+			if err != nil {
+				return nil, err
+			}
+			body, err := io.ReadAll(response.Body)
+			if err != nil {
+				return nil, err
+			}
+			mu.Lock()
+			responseFlags = body[0]
+			for _, key := range []string{"Connect-Content-Encoding", "Grpc-Encoding"} {
+				if value := response.Header.Get(key); value != "" {
+					responseEncoding = value
+				}
+			}
+			mu.Unlock()
+			response.Body = io.NopCloser(bytes.NewReader(body))
+			return response, nil
+		})
+		client := pingv1connect.NewPingServiceClient(httpClient, server.URL(), clientOpts...)
+		return client, func() (bool, bool, string) {
+			mu.Lock()
+			defer mu.Unlock()
+			return requestFlags&1 != 0, responseFlags&1 != 0, responseEncoding
+		}
+	}
+	for _, protocol := range []struct {
+		name string
+		opts []connect.ClientOption
+	}{
+		{name: "connect"},
+		{name: "grpc", opts: []connect.ClientOption{connect.WithGRPC()}},
+		{name: "grpcweb", opts: []connect.ClientOption{connect.WithGRPCWeb()}},
+	} {
+		t.Run(protocol.name, func(t *testing.T) {
+			t.Parallel()
+			testCases := []struct {
+				name             string
+				handlerOpts      []connect.HandlerOption
+				clientOpts       []connect.ClientOption
+				request          bool
+				response         bool
+				responseEncoding string
+			}{
+				{
+					name:             "symmetric",
+					clientOpts:       []connect.ClientOption{connect.WithSendGzip()},
+					request:          true,
+					response:         true,
+					responseEncoding: "gzip",
+				},
+				{
+					name:        "compressed_requests_only",
+					handlerOpts: []connect.HandlerOption{connect.WithResponseCompression("identity")},
+					clientOpts:  []connect.ClientOption{connect.WithSendGzip()},
+					request:     true,
+				},
+				{
+					name:             "compressed_responses_only",
+					handlerOpts:      []connect.HandlerOption{connect.WithResponseCompression("gzip")},
+					response:         true,
+					responseEncoding: "gzip",
+				},
+				{
+					name:             "different_algorithms",
+					handlerOpts:      []connect.HandlerOption{connect.WithBrotli(), connect.WithResponseCompression("br")},
+					clientOpts:       []connect.ClientOption{connect.WithBrotli(), connect.WithSendGzip()},
+					request:          true,
+					response:         true,
+					responseEncoding: "br",
+				},
+				{
+					name:             "not_accepted",
+					handlerOpts:      []connect.HandlerOption{connect.WithBrotli(), connect.WithResponseCompression("br")},
+					clientOpts:       []connect.ClientOption{connect.WithSendGzip()},
+					request:          true,
+					response:         true,
+					responseEncoding: "gzip",
+				},
+				{
+					name:        "disabled",
+					handlerOpts: []connect.HandlerOption{connect.WithDisableCompression()},
+					clientOpts:  []connect.ClientOption{connect.WithSendGzip()},
+					request:     true,
+				},
+				{
+					name: "disabled_overrides_preferred",
+					handlerOpts: []connect.HandlerOption{
+						connect.WithDisableCompression(),
+						connect.WithBrotli(),
+						connect.WithResponseCompression("br"),
+					},
+					clientOpts: []connect.ClientOption{connect.WithBrotli(), connect.WithSendGzip()},
+					request:    true,
+				},
+			}
+			for _, testCase := range testCases {
+				t.Run(testCase.name, func(t *testing.T) {
+					t.Parallel()
+					client, compressed := newClient(t, testCase.handlerOpts, append(protocol.opts, testCase.clientOpts...)...)
+					stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{Number: 3}))
+					assert.Nil(t, err)
+					var numbers []int64
+					for stream.Receive() {
+						numbers = append(numbers, stream.Msg().GetNumber())
+					}
+					assert.Nil(t, stream.Err())
+					assert.Nil(t, stream.Close())
+					assert.Equal(t, numbers, []int64{1, 2, 3})
+					request, response, responseEncoding := compressed()
+					assert.Equal(t, request, testCase.request)
+					assert.Equal(t, response, testCase.response)
+					assert.Equal(t, responseEncoding, testCase.responseEncoding)
+				})
+			}
+		})
+	}
+}
+
+func TestDisableCompressionUnary(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}, connect.WithDisableCompression()))
+	server := memhttptest.NewServer(t, mux)
+	var responseEncoding atomic.Value
+	httpClient := httpClientFunc(func(request *http.Request) (*http.Response, error) {
+		response, err := server.Client().Do(request)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range []string{"Content-Encoding", "Grpc-Encoding"} {
+			if value := response.Header.Get(key); value != "" {
+				responseEncoding.Store(value)
+			}
+		}
+		return response, nil
+	})
+	for _, protocol := range []struct {
+		name string
+		opts []connect.ClientOption
+	}{
+		{name: "connect"},
+		{name: "grpc", opts: []connect.ClientOption{connect.WithGRPC()}},
+		{name: "grpcweb", opts: []connect.ClientOption{connect.WithGRPCWeb()}},
+	} {
+		t.Run(protocol.name, func(t *testing.T) {
+			responseEncoding.Store("")
+			// The client compresses its request and accepts gzip responses.
+			client := pingv1connect.NewPingServiceClient(
+				httpClient,
+				server.URL(),
+				append(protocol.opts, connect.WithSendGzip())...,
+			)
+			text := strings.Repeat("compressible ", 1024)
+			response, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Text: text}))
+			assert.Nil(t, err)
+			assert.Equal(t, response.Msg.GetText(), text)
+			encoding, _ := responseEncoding.Load().(string)
+			assert.True(t, encoding == "" || encoding == "identity")
+		})
+	}
+}
+
+func TestGRPCAcceptCompression(t *testing.T) {
+	t.Parallel()
+	// The server records the compression headers and the first request
+	// envelope's flags.
+	type observed struct {
+		Accept, Encoding string
+		Compressed       bool
+	}
+	var mu sync.Mutex
+	requests := make(map[string]observed)
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}, connect.WithBrotli()))
+	server := memhttptest.NewServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		assert.Nil(t, err)
+		assert.True(t, len(body) > 0)
+		mu.Lock()
+		requests[r.Header.Get("X-Test-Case")] = observed{
+			Accept:     r.Header.Get("Grpc-Accept-Encoding"),
+			Encoding:   r.Header.Get("Grpc-Encoding"),
+			Compressed: body[0]&1 != 0,
+		}
+		mu.Unlock()
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		mux.ServeHTTP(w, r)
+	}))
+	testCases := []struct {
+		name string
+		opts []connect.ClientOption
+		want observed
+	}{
+		{
+			name: "default",
+			want: observed{Accept: "gzip"},
+		},
+		{
+			name: "accept_only",
+			opts: []connect.ClientOption{connect.WithBrotli()},
+			want: observed{Accept: "br,gzip"},
+		},
+		{
+			name: "send_and_accept",
+			opts: []connect.ClientOption{connect.WithBrotli(), connect.WithSendGzip()},
+			want: observed{Accept: "br,gzip", Encoding: "gzip", Compressed: true},
+		},
+		{
+			name: "accept_nothing",
+			opts: []connect.ClientOption{connect.WithAcceptCompression("gzip", nil, nil)},
+			want: observed{},
+		},
+	}
+	for _, protocol := range []struct {
+		name string
+		opt  connect.ClientOption
+	}{
+		{name: "grpc", opt: connect.WithGRPC()},
+		{name: "grpcweb", opt: connect.WithGRPCWeb()},
+	} {
+		for _, testCase := range testCases {
+			t.Run(protocol.name+"/"+testCase.name, func(t *testing.T) {
+				t.Parallel()
+				client := pingv1connect.NewPingServiceClient(
+					server.Client(),
+					server.URL(),
+					append([]connect.ClientOption{protocol.opt}, testCase.opts...)...,
+				)
+				request := connect.NewRequest(&pingv1.PingRequest{Number: 42, Text: strings.Repeat("compressible ", 100)})
+				key := protocol.name + "/" + testCase.name
+				request.Header().Set("X-Test-Case", key)
+				response, err := client.Ping(context.Background(), request)
+				assert.Nil(t, err)
+				assert.Equal(t, response.Msg.GetNumber(), 42)
+				mu.Lock()
+				got := requests[key]
+				mu.Unlock()
+				assert.Equal(t, got, testCase.want)
+			})
+		}
+	}
+}
+
+func TestWireStats(t *testing.T) {
+	t.Parallel()
+	handlerStats := make(chan connect.WireStats, 1)
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(
+		pingServer{},
+		connect.WithWireStats(func(stats connect.WireStats) { handlerStats <- stats }),
+	))
+	server := memhttptest.NewServer(t, mux)
+	// A 100-byte string encodes to a 102-byte message: a 1-byte tag, a 1-byte
+	// length, and the string itself. The response echoes it.
+	const messageSize = 102
+	text := strings.Repeat("a", 100)
+	for _, protocol := range []struct {
+		name    string
+		options []connect.ClientOption
+		// Size of the framing around each message. Unary Connect doesn't
+		// envelope messages.
+		unaryFraming int64
+		// Number of envelopes following the messages in a response: the Connect
+		// end-of-stream message and gRPC-Web trailers are enveloped, but gRPC
+		// uses HTTP trailers.
+		unaryTrailers, streamTrailers int64
+	}{
+		{name: "connect", unaryFraming: 0, unaryTrailers: 0, streamTrailers: 1},
+		{name: "grpc", options: []connect.ClientOption{connect.WithGRPC()}, unaryFraming: 5, unaryTrailers: 0, streamTrailers: 0},
+		{name: "grpcweb", options: []connect.ClientOption{connect.WithGRPCWeb()}, unaryFraming: 5, unaryTrailers: 1, streamTrailers: 1},
+	} {
+		newClient := func(t *testing.T, options ...connect.ClientOption) (pingv1connect.PingServiceClient, chan connect.WireStats) {
+			t.Helper()
+			clientStats := make(chan connect.WireStats, 1)
+			client := pingv1connect.NewPingServiceClient(
+				server.Client(),
+				server.URL(),
+				connect.WithClientOptions(protocol.options...),
+				connect.WithClientOptions(options...),
+				connect.WithWireStats(func(stats connect.WireStats) { clientStats <- stats }),
+			)
+			return client, clientStats
+		}
+		t.Run(protocol.name, func(t *testing.T) {
+			t.Run("unary_uncompressed", func(t *testing.T) {
+				client, clientStats := newClient(t, connect.WithAcceptCompression("gzip", nil, nil))
+				request := connect.NewRequest(&pingv1.PingRequest{Text: text})
+				// Without this, net/http asks for gzip and transparently decompresses.
+				request.Header().Set("Accept-Encoding", "identity")
+				_, err := client.Ping(context.Background(), request)
+				assert.Nil(t, err)
+				sent, received := <-clientStats, <-handlerStats
+				assert.Equal(t, sent.Spec.Procedure, pingv1connect.PingServicePingProcedure)
+				assert.Equal(t, sent.EnvelopesSent, 1)
+				assert.Equal(t, sent.BytesSent, messageSize+protocol.unaryFraming)
+				assert.Equal(t, sent.UncompressedBytesSent, messageSize)
+				assert.Equal(t, sent.EnvelopesReceived, 1+protocol.unaryTrailers)
+				assert.Equal(t, received.Spec.Procedure, pingv1connect.PingServicePingProcedure)
+				assert.Equal(t, received.EnvelopesReceived, 1)
+				assert.Equal(t, received.BytesReceived, sent.BytesSent)
+				assert.Equal(t, received.UncompressedBytesReceived, messageSize)
+				assert.Equal(t, received.EnvelopesSent, sent.EnvelopesReceived)
+				assert.Equal(t, received.BytesSent, sent.BytesReceived)
+				if protocol.unaryTrailers == 0 {
+					assert.Equal(t, received.BytesSent, messageSize+protocol.unaryFraming)
+				}
+			})
+			t.Run("unary_compressed", func(t *testing.T) {
+				client, clientStats := newClient(t, connect.WithSendGzip())
+				_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Text: text}))
+				assert.Nil(t, err)
+				sent, received := <-clientStats, <-handlerStats
+				assert.Equal(t, sent.EnvelopesSent, 1)
+				assert.Equal(t, sent.UncompressedBytesSent, messageSize)
+				assert.True(t, sent.BytesSent < messageSize)
+				assert.True(t, sent.SendCompressionRatio() > 1)
+				assert.Equal(t, received.BytesReceived, sent.BytesSent)
+				assert.Equal(t, received.UncompressedBytesReceived, messageSize)
+				assert.Equal(t, received.BytesSent, sent.BytesReceived)
+				assert.Equal(t, received.UncompressedBytesSent, sent.UncompressedBytesReceived)
+			})
+			t.Run("server_stream", func(t *testing.T) {
+				client, clientStats := newClient(t)
+				stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{Number: 3}))
+				assert.Nil(t, err)
+				for stream.Receive() {
+					// Do nothing
+				}
+				assert.Nil(t, stream.Err())
+				assert.Nil(t, stream.Close())
+				sent, received := <-clientStats, <-handlerStats
+				assert.Equal(t, sent.EnvelopesSent, 1)
+				assert.Equal(t, sent.EnvelopesReceived, 3+protocol.streamTrailers)
+				assert.Equal(t, received.EnvelopesSent, sent.EnvelopesReceived)
+				assert.Equal(t, received.BytesSent, sent.BytesReceived)
+				assert.Equal(t, received.BytesReceived, sent.BytesSent)
+			})
+			t.Run("error", func(t *testing.T) {
+				client, clientStats := newClient(t)
+				_, err := client.Fail(context.Background(), connect.NewRequest(&pingv1.FailRequest{Code: int32(connect.CodeResourceExhausted)}))
+				assert.Equal(t, connect.CodeOf(err), connect.CodeResourceExhausted)
+				sent, received := <-clientStats, <-handlerStats
+				assert.Equal(t, sent.Spec.Procedure, pingv1connect.PingServiceFailProcedure)
+				assert.Equal(t, sent.EnvelopesSent, 1)
+				assert.NotZero(t, sent.BytesSent)
+				assert.Equal(t, received.BytesReceived, sent.BytesSent)
+			})
+		})
+	}
+}
+
 func TestClientWithoutGzipSupport(t *testing.T) {
 	// See https://connectrpc.com/connect/pull/349 for why we want to
 	// support this. TL;DR is that Microsoft's dapr sidecar can't handle
@@ -1105,6 +1719,326 @@ func TestClientWithoutGzipSupport(t *testing.T) {
 	assert.True(t, strings.Contains(err.Error(), "unknown compression"))
 }
 
+func TestProtoTextCodec(t *testing.T) {
+	t.Parallel()
+	newServer := func(t *testing.T, opts ...connect.HandlerOption) *memhttp.Server {
+		t.Helper()
+		mux := http.NewServeMux()
+		mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}, opts...))
+		return memhttptest.NewServer(t, mux)
+	}
+	textServer := newServer(t, connect.WithProtoText())
+	binaryServer := newServer(t)
+	protocols := []struct {
+		name       string
+		opts       []connect.ClientOption
+		unaryType  string
+		streamType string
+	}{
+		{
+			name:       "connect",
+			unaryType:  "application/prototext",
+			streamType: "application/connect+prototext",
+		},
+		{
+			name:       "grpc",
+			opts:       []connect.ClientOption{connect.WithGRPC()},
+			unaryType:  "application/grpc+prototext",
+			streamType: "application/grpc+prototext",
+		},
+		{
+			name:       "grpcweb",
+			opts:       []connect.ClientOption{connect.WithGRPCWeb()},
+			unaryType:  "application/grpc-web+prototext",
+			streamType: "application/grpc-web+prototext",
+		},
+	}
+	for _, protocol := range protocols {
+		clientOpts := append([]connect.ClientOption{connect.WithProtoText()}, protocol.opts...)
+		t.Run(protocol.name, func(t *testing.T) {
+			t.Parallel()
+			t.Run("unary", func(t *testing.T) {
+				t.Parallel()
+				client := pingv1connect.NewPingServiceClient(textServer.Client(), textServer.URL(), clientOpts...)
+				request := connect.NewRequest(&pingv1.PingRequest{Number: 42, Text: "text: format"})
+				response, err := client.Ping(context.Background(), request)
+				assert.Nil(t, err)
+				assert.Equal(t, response.Msg.GetNumber(), 42)
+				assert.Equal(t, response.Msg.GetText(), "text: format")
+				assert.Equal(t, request.Peer().Codec, "prototext")
+				assert.Equal(t, response.Header().Get("Content-Type"), protocol.unaryType)
+			})
+			t.Run("server_stream", func(t *testing.T) {
+				t.Parallel()
+				client := pingv1connect.NewPingServiceClient(textServer.Client(), textServer.URL(), clientOpts...)
+				stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{Number: 3}))
+				assert.Nil(t, err)
+				var got []int64
+				for stream.Receive() {
+					got = append(got, stream.Msg().GetNumber())
+				}
+				assert.Nil(t, stream.Err())
+				assert.Equal(t, got, []int64{1, 2, 3})
+				assert.Equal(t, stream.ResponseHeader().Get("Content-Type"), protocol.streamType)
+				assert.Nil(t, stream.Close())
+			})
+			t.Run("rejected_by_binary_handler", func(t *testing.T) {
+				t.Parallel()
+				client := pingv1connect.NewPingServiceClient(binaryServer.Client(), binaryServer.URL(), clientOpts...)
+				_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+				// Handlers answer unsupported content types with HTTP 415.
+				assert.Equal(t, connect.CodeOf(err), connect.CodeUnknown)
+				assert.True(t, strings.Contains(err.Error(), "415"), assert.Sprintf("%v", err))
+			})
+		})
+	}
+}
+
+func TestStableJSON(t *testing.T) {
+	t.Parallel()
+	var bodies sync.Map
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}, connect.WithStableJSON()))
+	server := memhttptest.NewServer(t, http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		body, err := io.ReadAll(request.Body)
+		assert.Nil(t, err)
+		bodies.Store(request.Header.Get("Content-Type"), string(body))
+		request.Body = io.NopCloser(bytes.NewReader(body))
+		mux.ServeHTTP(writer, request)
+	}))
+	client := pingv1connect.NewPingServiceClient(server.Client(), server.URL(), connect.WithStableJSON())
+	response, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Number: 42, Text: "stable"}))
+	assert.Nil(t, err)
+	assert.Equal(t, response.Msg.GetNumber(), 42)
+	assert.Equal(t, response.Msg.GetText(), "stable")
+	body, ok := bodies.Load("application/json")
+	assert.True(t, ok)
+	assert.Equal(t, body, `{"number":"42","text":"stable"}`)
+}
+
+func TestBytesCodec(t *testing.T) {
+	t.Parallel()
+	var backendContentTypes sync.Map
+	backendMux := http.NewServeMux()
+	backendMux.Handle(pingv1connect.NewPingServiceHandler(pingServer{includeErrorDetails: true}))
+	backend := memhttptest.NewServer(t, http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		backendContentTypes.Store(request.Header.Get("Content-Type"), struct{}{})
+		backendMux.ServeHTTP(writer, request)
+	}))
+	protocols := []struct {
+		name        string
+		opts        []connect.ClientOption
+		contentType string
+	}{
+		{name: "connect", contentType: "application/proto"},
+		{name: "grpc", opts: []connect.ClientOption{connect.WithGRPC()}, contentType: "application/grpc"},
+		{name: "grpcweb", opts: []connect.ClientOption{connect.WithGRPCWeb()}, contentType: "application/grpc-web+proto"},
+	}
+	for _, protocol := range protocols {
+		t.Run(protocol.name, func(t *testing.T) {
+			t.Parallel()
+			// The proxy forwards opaque bytes to the backend, which uses the
+			// standard Protobuf codec.
+			upstreamOpts := append([]connect.ClientOption{connect.WithBytesCodec("proto")}, protocol.opts...)
+			newProxyHandler := func(procedure string) http.Handler {
+				upstream := connect.NewClient[connect.RawMessage, connect.RawMessage](
+					backend.Client(),
+					backend.URL()+procedure,
+					upstreamOpts...,
+				)
+				return connect.NewUnaryHandler(
+					procedure,
+					func(ctx context.Context, request *connect.Request[connect.RawMessage]) (*connect.Response[connect.RawMessage], error) {
+						response, err := upstream.CallUnary(ctx, connect.NewRequest(request.Msg))
+						if err != nil {
+							return nil, err
+						}
+						return connect.NewResponse(response.Msg), nil
+					},
+					connect.WithBytesCodec("proto"),
+				)
+			}
+			proxyMux := http.NewServeMux()
+			proxyMux.Handle(pingv1connect.PingServicePingProcedure, newProxyHandler(pingv1connect.PingServicePingProcedure))
+			proxyMux.Handle(pingv1connect.PingServiceFailProcedure, newProxyHandler(pingv1connect.PingServiceFailProcedure))
+			proxy := memhttptest.NewServer(t, proxyMux)
+			client := pingv1connect.NewPingServiceClient(proxy.Client(), proxy.URL(), protocol.opts...)
+			t.Run("success", func(t *testing.T) {
+				t.Parallel()
+				response, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Number: 42, Text: "opaque"}))
+				assert.Nil(t, err)
+				assert.Equal(t, response.Msg.GetNumber(), 42)
+				assert.Equal(t, response.Msg.GetText(), "opaque")
+				assert.Equal(t, response.Header().Get("Content-Type"), protocol.contentType)
+				_, ok := backendContentTypes.Load(protocol.contentType)
+				assert.True(t, ok)
+			})
+			t.Run("error", func(t *testing.T) {
+				t.Parallel()
+				_, err := client.Fail(context.Background(), connect.NewRequest(&pingv1.FailRequest{Code: int32(connect.CodeResourceExhausted)}))
+				assert.Equal(t, connect.CodeOf(err), connect.CodeResourceExhausted)
+				var connectErr *connect.Error
+				assert.True(t, errors.As(err, &connectErr))
+				assert.Equal(t, connectErr.Message(), errorMessage)
+				// Error details are still Protobuf messages, even when the proxy
+				// only handles opaque bytes.
+				assert.Equal(t, len(connectErr.Details()), 1)
+			})
+		})
+	}
+}
+
+func TestErrorDetailsOrder(t *testing.T) {
+	t.Parallel()
+	const procedure = "/test.v1.Service/Fail"
+	fail := func(context.Context, *connect.Request[pingv1.FailRequest]) (*connect.Response[pingv1.FailResponse], error) {
+		connectErr := connect.NewError(connect.CodeInvalidArgument, errors.New(errorMessage))
+		for _, msg := range []proto.Message{
+			&pingv1.FailRequest{Code: 1},
+			&pingv1.PingRequest{Text: "between"},
+			&pingv1.FailRequest{Code: 2},
+		} {
+			detail, err := connect.NewErrorDetail(msg)
+			if err != nil {
+				return nil, err
+			}
+			connectErr.AddDetail(detail)
+		}
+		return nil, connectErr
+	}
+	mux := http.NewServeMux()
+	mux.Handle(procedure, connect.NewUnaryHandler(procedure, fail))
+	server := memhttptest.NewServer(t, mux)
+	protocols := []struct {
+		name string
+		opts []connect.ClientOption
+	}{
+		{name: "connect"},
+		{name: "grpc", opts: []connect.ClientOption{connect.WithGRPC()}},
+		{name: "grpcweb", opts: []connect.ClientOption{connect.WithGRPCWeb()}},
+	}
+	for _, protocol := range protocols {
+		t.Run(protocol.name, func(t *testing.T) {
+			t.Parallel()
+			client := connect.NewClient[pingv1.FailRequest, pingv1.FailResponse](
+				server.Client(),
+				server.URL()+procedure,
+				protocol.opts...,
+			)
+			_, err := client.CallUnary(context.Background(), connect.NewRequest(&pingv1.FailRequest{}))
+			var connectErr *connect.Error
+			assert.True(t, errors.As(err, &connectErr))
+			details := connectErr.Details()
+			assert.Equal(t, len(details), 3)
+			assert.Equal(t, details[1].Type(), "connect.ping.v1.PingRequest")
+			fails := connect.DetailsOf[*pingv1.FailRequest](err)
+			assert.Equal(t, len(fails), 2)
+			assert.Equal(t, fails[0].GetCode(), 1)
+			assert.Equal(t, fails[1].GetCode(), 2)
+		})
+	}
+}
+
+func TestGRPCStatusDetailsTrailer(t *testing.T) {
+	t.Parallel()
+	const procedure = "/test.v1.Service/Fail"
+	sent := []proto.Message{
+		&pingv1.FailRequest{Code: 1},
+		&pingv1.PingRequest{Text: "detail"},
+	}
+	fail := func(context.Context, *connect.Request[pingv1.FailRequest]) (*connect.Response[pingv1.FailResponse], error) {
+		connectErr := connect.NewError(connect.CodeFailedPrecondition, errors.New("café closed"))
+		for _, msg := range sent {
+			detail, err := connect.NewErrorDetail(msg)
+			if err != nil {
+				return nil, err
+			}
+			connectErr.AddDetail(detail)
+		}
+		return nil, connectErr
+	}
+	mux := http.NewServeMux()
+	mux.Handle(procedure, connect.NewUnaryHandler(procedure, fail))
+	server := memhttptest.NewServer(t, mux)
+	var response *http.Response
+	httpClient := httpClientFunc(func(request *http.Request) (*http.Response, error) {
+		var err error
+		response, err = server.Client().Do(request)
+		return response, err
+	})
+	client := connect.NewClient[pingv1.FailRequest, pingv1.FailResponse](
+		httpClient,
+		server.URL()+procedure,
+		connect.WithGRPC(),
+	)
+	_, err := client.CallUnary(context.Background(), connect.NewRequest(&pingv1.FailRequest{}))
+	assert.Equal(t, connect.CodeOf(err), connect.CodeFailedPrecondition)
+	assert.NotNil(t, response)
+
+	// Decode the trailer the way grpc-go does, without any help from connect.
+	// The handler fails without sending a message, so the response is
+	// trailers-only and the trailing metadata arrives in the headers.
+	assert.Zero(t, len(response.Trailer))
+	trailer := response.Header
+	encoded := trailer.Get("Grpc-Status-Details-Bin")
+	assert.NotZero(t, len(encoded))
+	binary, err := connect.DecodeBinaryHeader(encoded)
+	assert.Nil(t, err)
+	var status statusv1.Status
+	assert.Nil(t, proto.Unmarshal(binary, &status))
+	assert.Equal(t, trailer.Get("Grpc-Status"), strconv.Itoa(int(status.GetCode())))
+	assert.Equal(t, connect.Code(status.GetCode()), connect.CodeFailedPrecondition)
+	assert.Equal(t, status.GetMessage(), "café closed")
+	assert.Equal(t, trailer.Get("Grpc-Message"), "caf%C3%A9 closed")
+	assert.Equal(t, len(status.GetDetails()), len(sent))
+	for i, detail := range status.GetDetails() {
+		got, err := detail.UnmarshalNew()
+		assert.Nil(t, err)
+		assert.True(t, proto.Equal(got, sent[i]), assert.Sprintf("detail %d: got %v, want %v", i, got, sent[i]))
+	}
+}
+
+func TestErrorDetailPrefixRoundTrip(t *testing.T) {
+	t.Parallel()
+	const typeURL = "example.com/types/connect.ping.v1.FailRequest"
+	fail := func(context.Context, *connect.Request[pingv1.FailRequest]) (*connect.Response[pingv1.FailResponse], error) {
+		detail, err := connect.NewErrorDetailWithPrefix(&pingv1.FailRequest{Code: 1}, "example.com/types")
+		if err != nil {
+			return nil, err
+		}
+		connectErr := connect.NewError(connect.CodeAborted, errors.New(errorMessage))
+		connectErr.AddDetail(detail)
+		return nil, connectErr
+	}
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.PingServiceFailProcedure, connect.NewUnaryHandler(pingv1connect.PingServiceFailProcedure, fail))
+	server := memhttptest.NewServer(t, mux)
+	for _, protocol := range []struct {
+		name string
+		opts []connect.ClientOption
+	}{
+		{name: "connect"},
+		{name: "grpc", opts: []connect.ClientOption{connect.WithGRPC()}},
+		{name: "grpcweb", opts: []connect.ClientOption{connect.WithGRPCWeb()}},
+	} {
+		t.Run(protocol.name, func(t *testing.T) {
+			t.Parallel()
+			client := pingv1connect.NewPingServiceClient(server.Client(), server.URL(), protocol.opts...)
+			_, err := client.Fail(context.Background(), connect.NewRequest(&pingv1.FailRequest{}))
+			var connectErr *connect.Error
+			assert.True(t, errors.As(err, &connectErr))
+			assert.Equal(t, connectErr.Code(), connect.CodeAborted)
+			details := connectErr.Details()
+			assert.Equal(t, len(details), 1)
+			assert.Equal(t, details[0].TypeURL(), typeURL)
+			assert.Equal(t, details[0].Type(), "connect.ping.v1.FailRequest")
+			value, err := details[0].Value()
+			assert.Nil(t, err)
+			assert.True(t, proto.Equal(value, &pingv1.FailRequest{Code: 1}))
+		})
+	}
+}
+
 func TestInvalidHeaderTimeout(t *testing.T) {
 	t.Parallel()
 	mux := http.NewServeMux()
@@ -1136,6 +2070,75 @@ func TestInvalidHeaderTimeout(t *testing.T) {
 		t.Parallel()
 		assert.Equal(t, getPingResponseWithTimeout(t, "12345678901").StatusCode, http.StatusBadRequest) //nolint:bodyclose
 	})
+	t.Run("timeout_negative", func(t *testing.T) {
+		t.Parallel()
+		assert.Equal(t, getPingResponseWithTimeout(t, "-100").StatusCode, http.StatusBadRequest) //nolint:bodyclose
+	})
+}
+
+func TestConnectTimeoutPropagation(t *testing.T) {
+	t.Parallel()
+	// The handler echoes the timeout header it received and reports how many
+	// milliseconds remain before its context's deadline, or -1 if there's none.
+	ping := func(ctx context.Context, request *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+		remaining := int64(-1)
+		if deadline, ok := ctx.Deadline(); ok {
+			remaining = time.Until(deadline).Milliseconds()
+		}
+		return connect.NewResponse(&pingv1.PingResponse{
+			Number: remaining,
+			Text:   request.Header().Get("Connect-Timeout-Ms"),
+		}), nil
+	}
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.PingServicePingProcedure, connect.NewUnaryHandler(pingv1connect.PingServicePingProcedure, ping))
+	server := memhttptest.NewServer(t, mux)
+	client := pingv1connect.NewPingServiceClient(server.Client(), server.URL())
+
+	t.Run("round_trip", func(t *testing.T) {
+		t.Parallel()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		response, err := client.Ping(ctx, connect.NewRequest(&pingv1.PingRequest{}))
+		assert.Nil(t, err)
+		sent, err := strconv.ParseInt(response.Msg.GetText(), 10, 64)
+		assert.Nil(t, err)
+		assert.True(t, sent > 0)
+		assert.True(t, sent <= time.Minute.Milliseconds())
+		remaining := response.Msg.GetNumber()
+		assert.True(t, remaining > 0)
+		assert.True(t, remaining <= sent)
+	})
+	t.Run("no_deadline", func(t *testing.T) {
+		t.Parallel()
+		response, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+		assert.Nil(t, err)
+		assert.Equal(t, response.Msg.GetText(), "")
+		assert.Equal(t, response.Msg.GetNumber(), -1)
+	})
+	t.Run("handler_observes_shorter_deadline", func(t *testing.T) {
+		t.Parallel()
+		// The header, not the caller's own context, sets the handler's deadline.
+		request, err := http.NewRequestWithContext(
+			context.Background(),
+			http.MethodPost,
+			server.URL()+pingv1connect.PingServicePingProcedure,
+			strings.NewReader("{}"),
+		)
+		assert.Nil(t, err)
+		request.Header.Set("Content-Type", "application/json")
+		request.Header.Set("Connect-Timeout-Ms", "5000")
+		response, err := server.Client().Do(request)
+		assert.Nil(t, err)
+		defer response.Body.Close()
+		assert.Equal(t, response.StatusCode, http.StatusOK)
+		var got pingv1.PingResponse
+		body, err := io.ReadAll(response.Body)
+		assert.Nil(t, err)
+		assert.Nil(t, protojson.Unmarshal(body, &got))
+		assert.True(t, got.GetNumber() > 0)
+		assert.True(t, got.GetNumber() <= 5000)
+	})
 }
 
 func TestInterceptorReturnsWrongType(t *testing.T) {
@@ -1677,6 +2680,141 @@ func TestBidiStreamServerSendsFirstMessage(t *testing.T) {
 	})
 }
 
+func TestStreamErrorTrailers(t *testing.T) {
+	t.Parallel()
+	const timingTrailer = "Server-Timing"
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(&pluggablePingServer{
+		countUp: func(_ context.Context, request *connect.Request[pingv1.CountUpRequest], stream *connect.ServerStream[pingv1.CountUpResponse]) error {
+			stream.ResponseTrailer().Set(timingTrailer, "db;dur=53")
+			for i := range request.Msg.GetNumber() {
+				if err := stream.Send(&pingv1.CountUpResponse{Number: i + 1}); err != nil {
+					return err
+				}
+			}
+			return connect.NewError(connect.CodeDataLoss, errors.New("ran out of numbers"))
+		},
+		cumSum: func(_ context.Context, stream *connect.BidiStream[pingv1.CumSumRequest, pingv1.CumSumResponse]) error {
+			stream.ResponseTrailer().Set(timingTrailer, "db;dur=53")
+			if _, err := stream.Receive(); err != nil {
+				return err
+			}
+			if err := stream.Send(&pingv1.CumSumResponse{}); err != nil {
+				return err
+			}
+			return connect.NewError(connect.CodeDataLoss, errors.New("ran out of numbers"))
+		},
+	}))
+	server := memhttptest.NewServer(t, mux)
+	for _, protocol := range []struct {
+		name string
+		opts []connect.ClientOption
+	}{
+		{name: "connect"},
+		{name: "grpc", opts: []connect.ClientOption{connect.WithGRPC()}},
+		{name: "grpcweb", opts: []connect.ClientOption{connect.WithGRPCWeb()}},
+	} {
+		t.Run(protocol.name, func(t *testing.T) {
+			t.Parallel()
+			client := pingv1connect.NewPingServiceClient(server.Client(), server.URL(), protocol.opts...)
+			// With no messages, gRPC sends a trailers-only response.
+			for _, messages := range []int64{0, 2} {
+				t.Run(fmt.Sprintf("server_stream/messages=%d", messages), func(t *testing.T) {
+					t.Parallel()
+					stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{Number: messages}))
+					assert.Nil(t, err)
+					var received int64
+					for stream.Receive() {
+						received++
+					}
+					assert.Equal(t, received, messages)
+					assert.Equal(t, connect.CodeOf(stream.Err()), connect.CodeDataLoss)
+					assert.Equal(t, stream.ResponseTrailer().Values(timingTrailer), []string{"db;dur=53"})
+					var connectErr *connect.Error
+					assert.True(t, errors.As(stream.Err(), &connectErr))
+					assert.Equal(t, connectErr.Meta().Values(timingTrailer), []string{"db;dur=53"})
+					assert.Nil(t, stream.Close())
+				})
+			}
+			t.Run("bidi_stream", func(t *testing.T) {
+				t.Parallel()
+				stream := client.CumSum(context.Background())
+				assert.Nil(t, stream.Send(&pingv1.CumSumRequest{Number: 1}))
+				_, err := stream.Receive()
+				assert.Nil(t, err)
+				_, err = stream.Receive()
+				assert.Equal(t, connect.CodeOf(err), connect.CodeDataLoss)
+				assert.Equal(t, stream.ResponseTrailer().Values(timingTrailer), []string{"db;dur=53"})
+				assert.Nil(t, stream.CloseRequest())
+				assert.Nil(t, stream.CloseResponse())
+			})
+		})
+	}
+}
+
+func TestServerStreamPartialResults(t *testing.T) {
+	t.Parallel()
+	const messages = 3
+	// The detail is large and repetitive enough to be compressed, so the
+	// Connect end-stream message is compressed along with the data.
+	detailText := strings.Repeat("partial results ", 1000)
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(&pluggablePingServer{
+		countUp: func(_ context.Context, _ *connect.Request[pingv1.CountUpRequest], stream *connect.ServerStream[pingv1.CountUpResponse]) error {
+			for i := range int64(messages) {
+				if err := stream.Send(&pingv1.CountUpResponse{Number: i + 1}); err != nil {
+					return err
+				}
+			}
+			err := connect.NewError(connect.CodeAborted, errors.New("stream interrupted"))
+			detail, detailErr := connect.NewErrorDetail(wrapperspb.String(detailText))
+			if detailErr != nil {
+				return detailErr
+			}
+			err.AddDetail(detail)
+			err.Meta().Set("Resume-After", strconv.Itoa(messages))
+			return err
+		},
+	}))
+	server := memhttptest.NewServer(t, mux)
+	for _, protocol := range []struct {
+		name string
+		opts []connect.ClientOption
+	}{
+		{name: "connect"},
+		{name: "connect_json", opts: []connect.ClientOption{connect.WithProtoJSON()}},
+		{name: "connect_uncompressed", opts: []connect.ClientOption{connect.WithAcceptCompression("gzip", nil, nil)}},
+		{name: "grpc", opts: []connect.ClientOption{connect.WithGRPC()}},
+		{name: "grpcweb", opts: []connect.ClientOption{connect.WithGRPCWeb()}},
+	} {
+		t.Run(protocol.name, func(t *testing.T) {
+			t.Parallel()
+			client := pingv1connect.NewPingServiceClient(server.Client(), server.URL(), protocol.opts...)
+			stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{}))
+			assert.Nil(t, err)
+			var numbers []int64
+			for stream.Receive() {
+				numbers = append(numbers, stream.Msg().GetNumber())
+			}
+			// Every message sent before the error is delivered, in order.
+			assert.Equal(t, numbers, []int64{1, 2, 3})
+			var connectErr *connect.Error
+			assert.True(t, errors.As(stream.Err(), &connectErr))
+			assert.Equal(t, connectErr.Code(), connect.CodeAborted)
+			assert.Equal(t, connectErr.Message(), "stream interrupted")
+			assert.Equal(t, connectErr.Meta().Get("Resume-After"), "3")
+			assert.Equal(t, len(connectErr.Details()), 1)
+			detail, err := connectErr.Details()[0].Value()
+			assert.Nil(t, err)
+			assert.True(t, proto.Equal(detail, wrapperspb.String(detailText)))
+			// Further calls keep returning the same error.
+			assert.False(t, stream.Receive())
+			assert.Equal(t, connect.CodeOf(stream.Err()), connect.CodeAborted)
+			assert.Nil(t, stream.Close())
+		})
+	}
+}
+
 func TestStreamForServer(t *testing.T) {
 	t.Parallel()
 	newPingClient := func(t *testing.T, pingServer pingv1connect.PingServiceHandler) pingv1connect.PingServiceClient {
@@ -2048,14 +3186,51 @@ func TestGRPCErrorMetadataIsTrailersOnly(t *testing.T) {
 	assert.Equal(t, res.StatusCode, http.StatusOK)
 	assert.Equal(t, res.Header.Get("Content-Type"), "application/grpc")
 	// pingServer.Fail adds handlerHeader and handlerTrailer to the error
-	// metadata. The gRPC protocol should send all error metadata as trailers.
-	assert.Zero(t, res.Header.Get(handlerHeader))
-	assert.Zero(t, res.Header.Get(handlerTrailer))
-	_, err = io.Copy(io.Discard, res.Body)
+	// metadata. The handler fails before sending a message, so the gRPC protocol
+	// should send a trailers-only response: the status and all error metadata
+	// in the headers, with no body and no trailers.
+	assert.Equal(t, res.Header.Get("Grpc-Status"), strconv.Itoa(int(connect.CodeInternal)))
+	assert.NotZero(t, res.Header.Get(handlerHeader))
+	assert.NotZero(t, res.Header.Get(handlerTrailer))
+	responseBody, err := io.ReadAll(res.Body)
 	assert.Nil(t, err)
+	assert.Zero(t, len(responseBody))
 	assert.Nil(t, res.Body.Close())
-	assert.NotZero(t, res.Trailer.Get(handlerHeader))
-	assert.NotZero(t, res.Trailer.Get(handlerTrailer))
+	assert.Zero(t, len(res.Trailer))
+}
+
+func TestGRPCStreamErrorIsTrailersOnly(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}))
+	server := memhttptest.NewServer(t, mux)
+
+	// CountUp fails before sending anything if the number isn't positive.
+	protoBytes, err := proto.Marshal(&pingv1.CountUpRequest{Number: -1})
+	assert.Nil(t, err)
+	var prefix [5]byte
+	binary.BigEndian.PutUint32(prefix[1:5], uint32(len(protoBytes)))
+	body := append(prefix[:], protoBytes...)
+	for _, contentType := range []string{"application/grpc", "application/grpc-web"} {
+		req, err := http.NewRequestWithContext(
+			context.Background(),
+			http.MethodPost,
+			server.URL()+pingv1connect.PingServiceCountUpProcedure,
+			bytes.NewReader(body),
+		)
+		assert.Nil(t, err)
+		req.Header.Set("Content-Type", contentType)
+		res, err := server.Client().Do(req)
+		assert.Nil(t, err)
+		assert.Equal(t, res.StatusCode, http.StatusOK)
+		assert.Equal(t, res.Header.Get("Grpc-Status"), strconv.Itoa(int(connect.CodeInvalidArgument)))
+		assert.NotZero(t, res.Header.Get("Grpc-Message"))
+		responseBody, err := io.ReadAll(res.Body)
+		assert.Nil(t, err)
+		assert.Zero(t, len(responseBody))
+		assert.Nil(t, res.Body.Close())
+		assert.Zero(t, len(res.Trailer))
+	}
 }
 
 func TestConnectProtocolHeaderSentByDefault(t *testing.T) {
@@ -3008,6 +4183,10 @@ func (l *trimTrailerWriter) removeTrailers() {
 		l.w.Header().Del(v)
 	}
 	l.w.Header().Del("Trailer")
+	// Trailers-only responses carry the status in the headers.
+	l.w.Header().Del("Grpc-Status")
+	l.w.Header().Del("Grpc-Message")
+	l.w.Header().Del("Grpc-Status-Details-Bin")
 	for k := range l.w.Header() {
 		if strings.HasPrefix(k, http.TrailerPrefix) {
 			l.w.Header().Del(k)
@@ -0,0 +1,45 @@
+// Copyright 2021-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"testing"
+
+	"connectrpc.com/connect/internal/assert"
+)
+
+func TestStreamType(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		streamType   StreamType
+		name         string
+		clientStream bool
+		serverStream bool
+	}{
+		{streamType: StreamTypeUnary, name: "unary"},
+		{streamType: StreamTypeClient, name: "client", clientStream: true},
+		{streamType: StreamTypeServer, name: "server", serverStream: true},
+		{streamType: StreamTypeBidi, name: "bidi", clientStream: true, serverStream: true},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, testCase.streamType.String(), testCase.name)
+			assert.Equal(t, testCase.streamType.IsClientStream(), testCase.clientStream)
+			assert.Equal(t, testCase.streamType.IsServerStream(), testCase.serverStream)
+		})
+	}
+	assert.Equal(t, StreamType(4).String(), "stream_4")
+}
@@ -0,0 +1,121 @@
+// Copyright 2021-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+)
+
+// errDraining is the cause of the context cancellation that a [Drainer]
+// delivers to active streams.
+var errDraining = errors.New("server is shutting down")
+
+// A Drainer helps handlers shut down gracefully. Install it on handlers with
+// [WithDrainer], then call Drain when the server starts shutting down. Once
+// draining, handlers reject new RPCs with [CodeUnavailable] and cancel the
+// contexts of active streaming RPCs, which then fail with [CodeUnavailable]
+// too. Unary RPCs already in progress are left to finish normally.
+//
+// To drain when an [http.Server] shuts down, register Drain with the server:
+//
+//	drainer := connect.NewDrainer(5 * time.Second)
+//	server.RegisterOnShutdown(drainer.Drain)
+//
+// Without this, [http.Server.Shutdown] waits for long-lived streams to finish
+// on their own.
+//
+// A Drainer is safe to use concurrently, and may be shared by many handlers.
+type Drainer struct {
+	retryAfter time.Duration
+	ctx        context.Context //nolint:containedctx
+	cancel     context.CancelCauseFunc
+}
+
+// NewDrainer constructs a Drainer. If retryAfter is positive, the errors
+// sent while draining include a Retry-After header with the number of
+// seconds clients should wait before retrying, typically against another
+// server.
+func NewDrainer(retryAfter time.Duration) *Drainer {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	return &Drainer{
+		retryAfter: retryAfter,
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+}
+
+// Drain starts draining. It returns immediately, without waiting for active
+// streams to finish. Calling Drain more than once has no further effect.
+func (d *Drainer) Drain() {
+	d.cancel(errDraining)
+}
+
+// Draining reports whether Drain has been called.
+func (d *Drainer) Draining() bool {
+	return d.ctx.Err() != nil
+}
+
+func (d *Drainer) newError() *Error {
+	err := NewError(CodeUnavailable, errDraining)
+	if d.retryAfter > 0 {
+		seconds := int64((d.retryAfter + time.Second - 1) / time.Second)
+		err.Meta().Set("Retry-After", strconv.FormatInt(seconds, 10 /* base */))
+	}
+	return err
+}
+
+// drainInterceptor rejects RPCs and cancels active streams once its Drainer
+// starts draining.
+type drainInterceptor struct {
+	Interceptor
+
+	drainer *Drainer
+}
+
+func (i *drainInterceptor) WrapUnary(next UnaryFunc) UnaryFunc {
+	return func(ctx context.Context, req AnyRequest) (AnyResponse, error) {
+		if req.Spec().IsClient {
+			return next(ctx, req)
+		}
+		if i.drainer.Draining() {
+			return nil, i.drainer.newError()
+		}
+		return next(ctx, req)
+	}
+}
+
+func (i *drainInterceptor) WrapStreamingHandler(next StreamingHandlerFunc) StreamingHandlerFunc {
+	return func(ctx context.Context, conn StreamingHandlerConn) error {
+		if i.drainer.Draining() {
+			return i.drainer.newError()
+		}
+		ctx, cancel := context.WithCancelCause(ctx)
+		defer cancel(nil)
+		stop := context.AfterFunc(i.drainer.ctx, func() {
+			cancel(errDraining)
+		})
+		defer stop()
+		err := next(ctx, conn)
+		if err != nil && errors.Is(context.Cause(ctx), errDraining) {
+			// The handler most likely failed because we canceled its context, so
+			// tell the client why.
+			return i.drainer.newError()
+		}
+		return err
+	}
+}
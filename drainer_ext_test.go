@@ -0,0 +1,170 @@
+// Copyright 2021-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	connect "connectrpc.com/connect"
+	"connectrpc.com/connect/internal/assert"
+	pingv1 "connectrpc.com/connect/internal/gen/connect/ping/v1"
+	"connectrpc.com/connect/internal/memhttp/memhttptest"
+)
+
+// newDrainTestMux serves a unary procedure and a bidi procedure that blocks
+// until its context is canceled, reporting the context's cause on the
+// returned channel.
+func newDrainTestMux(drainer *connect.Drainer) (*http.ServeMux, <-chan struct{}, <-chan error) {
+	const (
+		unaryProcedure = "/test.v1.Service/Ping"
+		bidiProcedure  = "/test.v1.Service/Wait"
+	)
+	started := make(chan struct{}, 1)
+	canceled := make(chan error, 1)
+	mux := http.NewServeMux()
+	mux.Handle(unaryProcedure, connect.NewUnaryHandler(
+		unaryProcedure,
+		func(context.Context, *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+			return connect.NewResponse(&pingv1.PingResponse{}), nil
+		},
+		connect.WithDrainer(drainer),
+	))
+	mux.Handle(bidiProcedure, connect.NewBidiStreamHandler(
+		bidiProcedure,
+		func(ctx context.Context, stream *connect.BidiStream[pingv1.PingRequest, pingv1.PingResponse]) error {
+			if _, err := stream.Receive(); err != nil {
+				return err
+			}
+			started <- struct{}{}
+			<-ctx.Done()
+			canceled <- context.Cause(ctx)
+			return ctx.Err()
+		},
+		connect.WithDrainer(drainer),
+	))
+	return mux, started, canceled
+}
+
+func TestDrainer(t *testing.T) {
+	t.Parallel()
+	protocols := []struct {
+		name string
+		opts []connect.ClientOption
+	}{
+		{name: "connect"},
+		{name: "grpc", opts: []connect.ClientOption{connect.WithGRPC()}},
+		{name: "grpcweb", opts: []connect.ClientOption{connect.WithGRPCWeb()}},
+	}
+	for _, protocol := range protocols {
+		t.Run(protocol.name, func(t *testing.T) {
+			t.Parallel()
+			drainer := connect.NewDrainer(1500 * time.Millisecond)
+			mux, started, canceled := newDrainTestMux(drainer)
+			server := memhttptest.NewServer(t, mux)
+			unaryClient := connect.NewClient[pingv1.PingRequest, pingv1.PingResponse](
+				server.Client(),
+				server.URL()+"/test.v1.Service/Ping",
+				protocol.opts...,
+			)
+			bidiClient := connect.NewClient[pingv1.PingRequest, pingv1.PingResponse](
+				server.Client(),
+				server.URL()+"/test.v1.Service/Wait",
+				protocol.opts...,
+			)
+			_, err := unaryClient.CallUnary(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+			assert.Nil(t, err)
+			assert.False(t, drainer.Draining())
+
+			stream := bidiClient.CallBidiStream(context.Background())
+			assert.Nil(t, stream.Send(&pingv1.PingRequest{}))
+			<-started
+			drainer.Drain()
+			drainer.Drain() // idempotent
+			assert.True(t, drainer.Draining())
+
+			// The active stream's context is canceled, and the client learns why.
+			select {
+			case cause := <-canceled:
+				assert.NotNil(t, cause)
+				assert.Equal(t, cause.Error(), "server is shutting down")
+			case <-time.After(5 * time.Second):
+				t.Fatal("active stream's context wasn't canceled")
+			}
+			_, err = stream.Receive()
+			var connectErr *connect.Error
+			assert.True(t, errors.As(err, &connectErr))
+			assert.Equal(t, connectErr.Code(), connect.CodeUnavailable)
+			assert.Equal(t, connectErr.Meta().Get("Retry-After"), "2")
+			assert.Nil(t, stream.CloseRequest())
+			assert.Nil(t, stream.CloseResponse())
+
+			// New calls are rejected.
+			_, err = unaryClient.CallUnary(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+			assert.True(t, errors.As(err, &connectErr))
+			assert.Equal(t, connectErr.Code(), connect.CodeUnavailable)
+			assert.Equal(t, connectErr.Meta().Get("Retry-After"), "2")
+			stream = bidiClient.CallBidiStream(context.Background())
+			assert.Nil(t, stream.Send(&pingv1.PingRequest{}))
+			_, err = stream.Receive()
+			assert.Equal(t, connect.CodeOf(err), connect.CodeUnavailable)
+			assert.Nil(t, stream.CloseRequest())
+			assert.Nil(t, stream.CloseResponse())
+		})
+	}
+}
+
+func TestDrainerServerShutdown(t *testing.T) {
+	t.Parallel()
+	drainer := connect.NewDrainer(0)
+	mux, started, canceled := newDrainTestMux(drainer)
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.Config.RegisterOnShutdown(drainer.Drain)
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	client := connect.NewClient[pingv1.PingRequest, pingv1.PingResponse](
+		server.Client(),
+		server.URL+"/test.v1.Service/Wait",
+		connect.WithGRPC(),
+	)
+	stream := client.CallBidiStream(context.Background())
+	assert.Nil(t, stream.Send(&pingv1.PingRequest{}))
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	shutdown := make(chan error, 1)
+	go func() {
+		shutdown <- server.Config.Shutdown(ctx)
+	}()
+	cause := <-canceled
+	assert.NotNil(t, cause)
+	assert.Equal(t, cause.Error(), "server is shutting down")
+	_, err := stream.Receive()
+	var connectErr *connect.Error
+	assert.True(t, errors.As(err, &connectErr))
+	assert.Equal(t, connectErr.Code(), connect.CodeUnavailable)
+	assert.Zero(t, connectErr.Meta().Get("Retry-After"))
+	assert.Nil(t, stream.CloseRequest())
+	assert.Nil(t, stream.CloseResponse())
+	// Once the stream ends, the server finishes shutting down without waiting
+	// for the timeout.
+	assert.Nil(t, <-shutdown)
+}
@@ -22,6 +22,7 @@ import (
 	"net/url"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
 // duplexHTTPCall is a full-duplex stream between the client and server. The
@@ -42,7 +43,21 @@ type duplexHTTPCall struct {
 
 	// requestSent ensures we only send the request once.
 	requestSent atomic.Bool
-	request     *http.Request
+	// requestClosed is set once the caller has finished sending with
+	// CloseRequest, so later Sends fail with a clear error.
+	requestClosed atomic.Bool
+	request       *http.Request
+	// signer, if set, signs requests sent in a single body. See
+	// request_signer.go.
+	signer           *requestSigner
+	uncompressedBody []byte
+	// mutator, if set, adjusts the request just before it's sent. See
+	// WithRequestMutator.
+	mutator func(*http.Request) error
+	// pinger, if set, sends keepalive pings on the request body once the
+	// server accepts them. See stream_keepalive.go.
+	pinger           *keepalivePinger
+	keepaliveTimeout time.Duration
 
 	// responseReady is closed when the response is ready or when the request
 	// fails. Any error on request initialisation will be set on the
@@ -92,6 +107,9 @@ func newDuplexHTTPCall(
 
 // Send sends a message to the server.
 func (d *duplexHTTPCall) Send(payload messagePayload) (int64, error) {
+	if d.requestClosed.Load() {
+		return 0, errorf(CodeFailedPrecondition, "cannot send after CloseRequest")
+	}
 	if d.streamType&StreamTypeClient == 0 {
 		return d.sendUnary(payload)
 	}
@@ -115,7 +133,14 @@ func (d *duplexHTTPCall) Send(payload messagePayload) (int64, error) {
 		return 0, nil
 	}
 	// It's safe to write to this side of the pipe while net/http concurrently
-	// reads from the other side.
+	// reads from the other side. Writes to the pipe block until net/http has
+	// consumed them, and both the HTTP/1.1 and HTTP/2 transports flush the
+	// request body as they read it, so each Send reaches the network before it
+	// returns rather than being buffered until CloseWrite.
+	if d.pinger != nil {
+		d.pinger.hold()
+		defer d.pinger.release()
+	}
 	bytesWritten, err := payload.WriteTo(d.requestBodyWriter)
 	if err != nil && errors.Is(err, io.ErrClosedPipe) {
 		// Signal that the stream is closed with the more-typical io.EOF instead of
@@ -149,6 +174,9 @@ func (d *duplexHTTPCall) sendUnary(payload messagePayload) (int64, error) {
 		// more details.
 		defer payloadBody.Release()
 	}
+	if err := d.signRequest(payload); err != nil {
+		return 0, err
+	}
 	d.makeRequest() // synchronous request
 	if d.responseErr != nil {
 		// Check on response errors for context errors. Other errors are
@@ -163,10 +191,17 @@ func (d *duplexHTTPCall) sendUnary(payload messagePayload) (int64, error) {
 // CloseWrite closes the request body. Callers *must* call CloseWrite before Read when
 // using HTTP/1.x.
 func (d *duplexHTTPCall) CloseWrite() error {
+	d.pinger.stop()
 	// Even if Write was never called, we need to make an HTTP request. This
 	// ensures that we've sent any headers to the server and that we have an HTTP
 	// response to read from.
 	if d.requestSent.CompareAndSwap(false, true) {
+		if d.streamType&StreamTypeClient == 0 {
+			// Unary and server-streaming requests without a body, like GETs.
+			if err := d.signRequest(nil); err != nil {
+				return err
+			}
+		}
 		go d.makeRequest()
 		// We never setup a request body, so it's effectively already closed.
 		// So nothing else to do.
@@ -189,6 +224,15 @@ func (d *duplexHTTPCall) CloseWrite() error {
 	return d.request.Body.Close()
 }
 
+// CloseRequest closes the request body on behalf of the caller. Unlike
+// CloseWrite, which we also use internally once the server has ended the
+// stream, later calls to Send fail with an error explaining that the caller
+// already closed the request. Reading the response is unaffected.
+func (d *duplexHTTPCall) CloseRequest() error {
+	d.requestClosed.Store(true)
+	return d.CloseWrite()
+}
+
 // Header returns the HTTP request headers.
 func (d *duplexHTTPCall) Header() http.Header {
 	return d.request.Header
@@ -230,11 +274,13 @@ func (d *duplexHTTPCall) Read(data []byte) (int, error) {
 	if err != nil && !errors.Is(err, io.EOF) {
 		err = wrapIfContextDone(d.ctx, err)
 		err = wrapIfRSTError(err)
+		err = wrapIfConnectionLost(err)
 	}
 	return n, err
 }
 
 func (d *duplexHTTPCall) CloseRead() error {
+	d.pinger.stop()
 	_ = d.BlockUntilResponseReady()
 	if d.response == nil {
 		return nil
@@ -283,6 +329,18 @@ func (d *duplexHTTPCall) BlockUntilResponseReady() error {
 	return d.responseErr
 }
 
+// ResponseReady reports, without blocking, whether the response is ready or
+// the request has failed. Once it returns true, fields set while validating
+// the response are safe to read.
+func (d *duplexHTTPCall) ResponseReady() bool {
+	select {
+	case <-d.responseReady:
+		return true
+	default:
+		return false
+	}
+}
+
 func (d *duplexHTTPCall) makeRequest() {
 	// This runs concurrently with Write and CloseWrite. Read and CloseRead wait
 	// on d.responseReady, so we can't race with them.
@@ -292,6 +350,16 @@ func (d *duplexHTTPCall) makeRequest() {
 	if host := getHeaderCanonical(d.request.Header, headerHost); len(host) > 0 {
 		d.request.Host = host
 	}
+	if d.mutator != nil {
+		if err := d.mutator(d.request); err != nil {
+			if _, ok := asError(err); !ok {
+				err = errorf(CodeInternal, "mutate request: %w", err)
+			}
+			d.responseErr = err
+			_ = d.CloseWrite()
+			return
+		}
+	}
 	if d.onRequestSend != nil {
 		d.onRequestSend(d.request)
 	}
@@ -321,7 +389,11 @@ func (d *duplexHTTPCall) makeRequest() {
 	// We've got a response. We can now read from the response body.
 	// Closing the response body is delegated to the caller even on error.
 	d.response = response
+	d.startKeepalive(response)
 	if err := d.validateResponse(response); err != nil {
+		if response.StatusCode != http.StatusOK {
+			err.httpStatus = response.StatusCode
+		}
 		d.responseErr = err
 		_ = d.CloseWrite()
 		return
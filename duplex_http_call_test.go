@@ -24,6 +24,7 @@ import (
 	"net/url"
 	"sync"
 	"testing"
+	"time"
 
 	"connectrpc.com/connect/internal/assert"
 )
@@ -120,3 +121,72 @@ func TestHTTPCallGetBody(t *testing.T) {
 	close(workChan)
 	wg.Wait()
 }
+
+// TestHTTPCallStreamSendIsIncremental checks that each Send on a client stream
+// reaches the server before the next one starts, rather than being buffered
+// until the request body is closed.
+func TestHTTPCallStreamSendIsIncremental(t *testing.T) {
+	t.Parallel()
+	const (
+		messages    = 3
+		messageSize = 64
+	)
+	servers := []struct {
+		name  string
+		start func(*httptest.Server)
+	}{
+		{name: "http1", start: (*httptest.Server).Start},
+		{name: "http2", start: func(server *httptest.Server) {
+			server.EnableHTTP2 = true
+			server.StartTLS()
+		}},
+	}
+	for _, testCase := range servers {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+			received := make(chan int)
+			handler := http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+				// Read slowly, one message at a time, and report each as it arrives.
+				message := make([]byte, messageSize)
+				for i := range messages {
+					if _, err := io.ReadFull(request.Body, message); err != nil {
+						t.Errorf("read message %d: %v", i, err)
+						return
+					}
+					received <- i
+				}
+				_ = request.Body.Close()
+				responseWriter.WriteHeader(http.StatusOK)
+			})
+			server := httptest.NewUnstartedServer(handler)
+			testCase.start(server)
+			t.Cleanup(server.Close)
+			serverURL, _ := url.Parse(server.URL)
+			call := newDuplexHTTPCall(
+				context.Background(),
+				server.Client(),
+				serverURL,
+				Spec{StreamType: StreamTypeClient},
+				http.Header{},
+			)
+			call.SetValidateResponse(func(*http.Response) *Error {
+				return nil
+			})
+			for i := range messages {
+				_, err := call.Send(bytes.NewReader(make([]byte, messageSize)))
+				assert.Nil(t, err)
+				// If Send buffered, the server would never see this message and
+				// we'd time out.
+				select {
+				case got := <-received:
+					assert.Equal(t, got, i)
+				case <-time.After(5 * time.Second):
+					t.Fatalf("message %d wasn't delivered before the next Send", i)
+				}
+			}
+			assert.Nil(t, call.CloseWrite())
+			assert.Nil(t, call.BlockUntilResponseReady())
+			assert.Nil(t, call.CloseRead())
+		})
+	}
+}
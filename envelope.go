@@ -18,6 +18,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/binary"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -126,13 +127,19 @@ func (e *envelope) Len() int {
 }
 
 type envelopeWriter struct {
-	ctx              context.Context //nolint:containedctx
-	sender           messageSender
-	codec            Codec
-	compressMinBytes int
-	compressionPool  *compressionPool
-	bufferPool       *bufferPool
-	sendMaxBytes     int
+	ctx                  context.Context //nolint:containedctx
+	sender               messageSender
+	codec                Codec
+	compressMinBytes     int
+	compressionHeuristic compressionHeuristic
+	compressionPool      *compressionPool
+	bufferPool           *bufferPool
+	sendMaxBytes         int
+	stats                *wireStatsCounter
+	// newlineDelimited replaces the binary envelope with newline-delimited
+	// framing. Envelope flags are dropped, so it's only suitable for
+	// uncompressed JSON.
+	newlineDelimited bool
 }
 
 func (w *envelopeWriter) Marshal(message any) *Error {
@@ -156,26 +163,52 @@ func (w *envelopeWriter) Marshal(message any) *Error {
 // Write writes the enveloped message, compressing as necessary. It doesn't
 // retain any references to the supplied envelope or its underlying data.
 func (w *envelopeWriter) Write(env *envelope) *Error {
-	if env.IsSet(flagEnvelopeCompressed) ||
-		w.compressionPool == nil ||
-		env.Data.Len() < w.compressMinBytes {
-		if w.sendMaxBytes > 0 && env.Data.Len() > w.sendMaxBytes {
-			return errorf(CodeResourceExhausted, "message size %d exceeds sendMaxBytes %d", env.Data.Len(), w.sendMaxBytes)
+	if w.newlineDelimited {
+		// Each message must fit on one line, but codecs may emit indented
+		// JSON.
+		compacted := w.bufferPool.Get()
+		defer w.bufferPool.Put(compacted)
+		if err := json.Compact(compacted, env.Data.Bytes()); err != nil {
+			return errorf(CodeInternal, "compact JSON message: %w", err)
 		}
-		return w.write(env)
+		env = &envelope{Data: compacted, Flags: env.Flags}
 	}
-	data := w.bufferPool.Get()
-	defer w.bufferPool.Put(data)
-	if err := w.compressionPool.Compress(data, env.Data); err != nil {
-		return err
+	if !env.IsSet(flagEnvelopeCompressed) {
+		recordUncompressedRequest(w.sender, env.Data.Bytes())
 	}
-	if w.sendMaxBytes > 0 && data.Len() > w.sendMaxBytes {
-		return errorf(CodeResourceExhausted, "compressed message size %d exceeds sendMaxBytes %d", data.Len(), w.sendMaxBytes)
+	if !env.IsSet(flagEnvelopeCompressed) &&
+		w.compressionPool != nil &&
+		env.Data.Len() >= w.compressMinBytes {
+		uncompressedSize := env.Data.Len()
+		data := w.bufferPool.Get()
+		defer w.bufferPool.Put(data)
+		compressed, err := w.compressionPool.compressIfWorthwhile(data, env.Data, w.compressionHeuristic, w.bufferPool)
+		if err != nil {
+			return err
+		}
+		if compressed {
+			if w.sendMaxBytes > 0 && data.Len() > w.sendMaxBytes {
+				return errorf(CodeResourceExhausted, "compressed message size %d exceeds sendMaxBytes %d", data.Len(), w.sendMaxBytes)
+			}
+			if err := w.write(&envelope{
+				Data:  data,
+				Flags: env.Flags | flagEnvelopeCompressed,
+			}); err != nil {
+				return err
+			}
+			w.stats.sent(w.framingSize()+data.Len(), uncompressedSize)
+			return nil
+		}
+	}
+	if w.sendMaxBytes > 0 && env.Data.Len() > w.sendMaxBytes {
+		return errorf(CodeResourceExhausted, "message size %d exceeds sendMaxBytes %d", env.Data.Len(), w.sendMaxBytes)
 	}
-	return w.write(&envelope{
-		Data:  data,
-		Flags: env.Flags | flagEnvelopeCompressed,
-	})
+	size := env.Data.Len()
+	if err := w.write(env); err != nil {
+		return err
+	}
+	w.stats.sent(w.framingSize()+size, size)
+	return nil
 }
 
 func (w *envelopeWriter) marshalAppend(message any, codec marshalAppender) *Error {
@@ -217,7 +250,15 @@ func (w *envelopeWriter) marshal(message any) *Error {
 }
 
 func (w *envelopeWriter) write(env *envelope) *Error {
-	if _, err := w.sender.Send(env); err != nil {
+	var payload messagePayload = env
+	if w.newlineDelimited {
+		line := w.bufferPool.Get()
+		defer w.bufferPool.Put(line)
+		line.Write(env.Data.Bytes())
+		line.WriteByte('\n')
+		payload = bytes.NewReader(line.Bytes())
+	}
+	if _, err := w.sender.Send(payload); err != nil {
 		err = wrapIfContextDone(w.ctx, err)
 		if connectErr, ok := asError(err); ok {
 			return connectErr
@@ -227,6 +268,14 @@ func (w *envelopeWriter) write(env *envelope) *Error {
 	return nil
 }
 
+// framingSize is the number of bytes added to each message on the wire.
+func (w *envelopeWriter) framingSize() int {
+	if w.newlineDelimited {
+		return 1 // trailing newline
+	}
+	return 5 // envelope prefix
+}
+
 type envelopeReader struct {
 	ctx             context.Context //nolint:containedctx
 	reader          io.Reader
@@ -236,6 +285,7 @@ type envelopeReader struct {
 	compressionPool *compressionPool
 	bufferPool      *bufferPool
 	readMaxBytes    int
+	stats           *wireStatsCounter
 }
 
 func (r *envelopeReader) Unmarshal(message any) *Error {
@@ -251,7 +301,7 @@ func (r *envelopeReader) Unmarshal(message any) *Error {
 	err := r.Read(env)
 	switch {
 	case err == nil && env.IsSet(flagEnvelopeCompressed) && r.compressionPool == nil:
-		return errorf(
+		return protocolErrorf(
 			CodeInternal,
 			"protocol error: sent compressed message without compression support",
 		)
@@ -282,6 +332,7 @@ func (r *envelopeReader) Unmarshal(message any) *Error {
 		}
 		data = decompressed
 	}
+	r.stats.receivedUncompressed(data.Len())
 
 	if env.Flags != 0 && env.Flags != flagEnvelopeCompressed {
 		// Drain the rest of the stream to ensure there is no extra data.
@@ -294,7 +345,7 @@ func (r *envelopeReader) Unmarshal(message any) *Error {
 			}
 			return errorf(CodeInternal, "corrupt response: I/O error after end-stream message: %w", err)
 		} else if numBytes > 0 {
-			return errorf(CodeInternal, "corrupt response: %d extra bytes after end of stream", numBytes)
+			return protocolErrorf(CodeInternal, "corrupt response: %d extra bytes after end of stream", numBytes)
 		}
 		// One of the protocol-specific flags are set, so this is the end of the
 		// stream. Save the message for protocol-specific code to process and
@@ -333,7 +384,7 @@ func (r *envelopeReader) Read(env *envelope) *Error {
 			return connectErr
 		}
 		// Something else has gone wrong - the stream didn't end cleanly.
-		return errorf(
+		return protocolErrorf(
 			CodeInvalidArgument,
 			"protocol error: incomplete envelope: %w", err,
 		)
@@ -342,21 +393,23 @@ func (r *envelopeReader) Read(env *envelope) *Error {
 	if r.readMaxBytes > 0 && size > int64(r.readMaxBytes) {
 		n, err := io.CopyN(io.Discard, r.reader, size)
 		r.bytesRead += n
+		r.stats.received(5 + n)
 		if err != nil && !errors.Is(err, io.EOF) {
 			return errorf(CodeResourceExhausted, "message is larger than configured max %d - unable to determine message size: %w", r.readMaxBytes, err)
 		}
 		return errorf(CodeResourceExhausted, "message size %d is larger than configured max %d", size, r.readMaxBytes)
 	}
-	// We've read the prefix, so we know how many bytes to expect.
-	// CopyN will return an error if it doesn't read the requested
-	// number of bytes.
-	readN, err := io.CopyN(env.Data, r.reader, size)
+	// We've read the prefix, so we know how many bytes to expect. The prefix
+	// comes from the peer, though, so we grow the buffer as data arrives rather
+	// than trusting it: readEnvelopeData returns io.EOF if it reads fewer bytes
+	// than promised.
+	readN, err := readEnvelopeData(env.Data, r.reader, size)
 	r.bytesRead += readN
 	if err != nil {
 		if errors.Is(err, io.EOF) {
 			// We've gotten fewer bytes than we expected, so the stream has ended
 			// unexpectedly.
-			return errorf(
+			return protocolErrorf(
 				CodeInvalidArgument,
 				"protocol error: promised %d bytes in enveloped message, got %d bytes",
 				size,
@@ -371,9 +424,39 @@ func (r *envelopeReader) Read(env *envelope) *Error {
 		return errorf(CodeUnknown, "read enveloped message: %w", err)
 	}
 	env.Flags = prefixes[0]
+	r.stats.received(5 + size)
 	return nil
 }
 
+// minEnvelopeReadChunk is the smallest amount by which readEnvelopeData grows
+// its buffer.
+const minEnvelopeReadChunk = 4 * 1024
+
+// readEnvelopeData reads exactly size bytes from src into dst, returning
+// io.EOF if src ends early. It grows dst geometrically, but never by more than
+// it has already read (or minEnvelopeReadChunk) nor beyond size, so a peer
+// that declares a huge message but sends little can't make us allocate much.
+func readEnvelopeData(dst *bytes.Buffer, src io.Reader, size int64) (int64, error) {
+	var total int64
+	for total < size {
+		chunk := max(int64(dst.Len()), minEnvelopeReadChunk)
+		chunk = min(chunk, size-total)
+		dst.Grow(int(chunk))
+		buf := dst.AvailableBuffer()[:chunk]
+		n, err := src.Read(buf)
+		dst.Write(buf[:n])
+		total += int64(n)
+		if errors.Is(err, io.EOF) {
+			if total < size {
+				return total, io.EOF
+			}
+		} else if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
 func makeEnvelopePrefix(flags uint8, size int) ([5]byte, error) {
 	if size < 0 || size > math.MaxUint32 {
 		return [5]byte{}, fmt.Errorf("connect.makeEnvelopePrefix: size %d out of bounds", size)
@@ -16,11 +16,22 @@ package connect
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
+	"errors"
+	"fmt"
 	"io"
+	"math"
+	"math/rand"
+	"net/http"
+	"runtime"
+	"strings"
 	"testing"
 
 	"connectrpc.com/connect/internal/assert"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
 )
 
 func TestEnvelope(t *testing.T) {
@@ -119,3 +130,326 @@ func (b byteByByteReader) Read(data []byte) (int, error) {
 	data[0] = next
 	return 1, nil
 }
+
+func TestEnvelopeReadMaxBytes(t *testing.T) {
+	t.Parallel()
+	const readMaxBytes = 1024
+	// Declare a message far larger than the limit, but only send a handful of
+	// bytes: the reader must reject the envelope based on the prefix alone.
+	head, err := makeEnvelopePrefix(0, math.MaxUint32)
+	assert.Nil(t, err)
+	buf := &bytes.Buffer{}
+	buf.Write(head[:])
+	buf.WriteString("not nearly enough data")
+	env := &envelope{Data: &bytes.Buffer{}}
+	rdr := envelopeReader{
+		ctx:          context.Background(),
+		reader:       bytes.NewReader(buf.Bytes()),
+		readMaxBytes: readMaxBytes,
+	}
+	readErr := rdr.Read(env)
+	assert.NotNil(t, readErr)
+	assert.Equal(t, readErr.Code(), CodeResourceExhausted)
+	assert.Equal(t, env.Data.Cap(), 0)
+}
+
+func TestEnvelopeReadLyingPrefix(t *testing.T) {
+	t.Parallel()
+	// The prefix promises 2GiB, but the peer only sends 1MiB.
+	const (
+		promised = math.MaxInt32
+		sent     = 1 << 20
+	)
+	head, err := makeEnvelopePrefix(0, promised)
+	assert.Nil(t, err)
+	body := append(head[:], bytes.Repeat([]byte{'x'}, sent)...)
+	t.Run("unlimited", func(t *testing.T) {
+		env := &envelope{Data: &bytes.Buffer{}}
+		rdr := envelopeReader{
+			ctx:    context.Background(),
+			reader: bytes.NewReader(body),
+		}
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		readErr := rdr.Read(env)
+		runtime.ReadMemStats(&after)
+		assert.NotNil(t, readErr)
+		assert.Equal(t, readErr.Code(), CodeInvalidArgument)
+		assert.Equal(t, readErr.Message(), fmt.Sprintf("protocol error: promised %d bytes in enveloped message, got %d bytes", promised, sent))
+		assert.Equal(t, env.Data.Len(), sent)
+		// Growing the buffer as data arrives allocates a small multiple of what
+		// was sent, nowhere near what was promised.
+		assert.True(t, after.TotalAlloc-before.TotalAlloc < 8*sent)
+	})
+	t.Run("limited", func(t *testing.T) {
+		env := &envelope{Data: &bytes.Buffer{}}
+		rdr := envelopeReader{
+			ctx:          context.Background(),
+			reader:       bytes.NewReader(body),
+			readMaxBytes: sent,
+		}
+		readErr := rdr.Read(env)
+		assert.NotNil(t, readErr)
+		assert.Equal(t, readErr.Code(), CodeResourceExhausted)
+		assert.Equal(t, readErr.Message(), fmt.Sprintf("message size %d is larger than configured max %d", promised, sent))
+		assert.Equal(t, env.Data.Cap(), 0)
+	})
+}
+
+func TestEnvelopeWriteCompressMinBytes(t *testing.T) {
+	t.Parallel()
+	const compressMinBytes = 8
+	gzipPool := newCompressionPool(
+		func() Decompressor { return &gzip.Reader{} },
+		func() Compressor { return gzip.NewWriter(io.Discard) },
+	)
+	dst := &bytes.Buffer{}
+	wtr := envelopeWriter{
+		sender:           writeSender{writer: dst},
+		compressionPool:  gzipPool,
+		compressMinBytes: compressMinBytes,
+		bufferPool:       newBufferPool(),
+	}
+	// Each message on the stream is considered on its own, so a single writer
+	// should compress some envelopes and not others.
+	sizes := []int{compressMinBytes - 1, compressMinBytes, 0, compressMinBytes + 1}
+	for _, size := range sizes {
+		env := &envelope{Data: bytes.NewBuffer(bytes.Repeat([]byte("a"), size))}
+		assert.Nil(t, wtr.Write(env))
+	}
+	rdr := envelopeReader{
+		ctx:    context.Background(),
+		reader: bytes.NewReader(dst.Bytes()),
+	}
+	for _, size := range sizes {
+		env := &envelope{Data: &bytes.Buffer{}}
+		assert.Nil(t, rdr.Read(env))
+		assert.Equal(t, env.IsSet(flagEnvelopeCompressed), size >= compressMinBytes)
+	}
+}
+
+func TestEnvelopeProtocolViolations(t *testing.T) {
+	t.Parallel()
+	// envelopes concatenates envelopes with the given flags and payloads.
+	envelopes := func(t *testing.T, flags []uint8, payloads ...string) []byte {
+		t.Helper()
+		buf := &bytes.Buffer{}
+		for i, payload := range payloads {
+			head, err := makeEnvelopePrefix(flags[i], len(payload))
+			assert.Nil(t, err)
+			buf.Write(head[:])
+			buf.WriteString(payload)
+		}
+		return buf.Bytes()
+	}
+	newReader := func(data []byte) envelopeReader {
+		return envelopeReader{
+			ctx:        context.Background(),
+			reader:     bytes.NewReader(data),
+			codec:      &protoBinaryCodec{},
+			bufferPool: newBufferPool(),
+		}
+	}
+	testCases := []struct {
+		name     string
+		read     func(t *testing.T) *Error
+		wantCode Code
+	}{
+		{
+			name: "truncated_prefix",
+			read: func(t *testing.T) *Error {
+				t.Helper()
+				rdr := newReader([]byte{0, 0, 0})
+				return rdr.Read(&envelope{Data: &bytes.Buffer{}})
+			},
+			wantCode: CodeInvalidArgument,
+		},
+		{
+			name: "truncated_message",
+			read: func(t *testing.T) *Error {
+				t.Helper()
+				data := envelopes(t, []uint8{0}, "0123456789")
+				rdr := newReader(data[:len(data)-3])
+				return rdr.Read(&envelope{Data: &bytes.Buffer{}})
+			},
+			wantCode: CodeInvalidArgument,
+		},
+		{
+			name: "compressed_without_compression",
+			read: func(t *testing.T) *Error {
+				t.Helper()
+				rdr := newReader(envelopes(t, []uint8{flagEnvelopeCompressed}, "data"))
+				return rdr.Unmarshal(&emptypb.Empty{})
+			},
+			wantCode: CodeInternal,
+		},
+		{
+			name: "data_after_end_stream",
+			read: func(t *testing.T) *Error {
+				t.Helper()
+				rdr := newReader(envelopes(t, []uint8{connectFlagEnvelopeEndStream, 0}, "{}", "extra"))
+				return rdr.Unmarshal(&emptypb.Empty{})
+			},
+			wantCode: CodeInternal,
+		},
+		{
+			name: "connect_invalid_flags",
+			read: func(t *testing.T) *Error {
+				t.Helper()
+				unmarshaler := connectStreamingUnmarshaler{
+					envelopeReader: newReader(envelopes(t, []uint8{0b0100}, "{}")),
+				}
+				return unmarshaler.Unmarshal(&emptypb.Empty{})
+			},
+			wantCode: CodeInternal,
+		},
+		{
+			name: "grpc_invalid_flags",
+			read: func(t *testing.T) *Error {
+				t.Helper()
+				unmarshaler := grpcUnmarshaler{
+					envelopeReader: newReader(envelopes(t, []uint8{grpcFlagEnvelopeTrailer}, "grpc-status: 0")),
+				}
+				return unmarshaler.Unmarshal(&emptypb.Empty{})
+			},
+			wantCode: CodeInternal,
+		},
+		{
+			name: "grpc_missing_status",
+			read: func(t *testing.T) *Error {
+				t.Helper()
+				return grpcErrorFromTrailer(&protoBinaryCodec{}, http.Header{})
+			},
+			wantCode: CodeInternal,
+		},
+		{
+			name: "grpc_invalid_status",
+			read: func(t *testing.T) *Error {
+				t.Helper()
+				return grpcErrorFromTrailer(&protoBinaryCodec{}, http.Header{grpcHeaderStatus: []string{"bogus"}})
+			},
+			wantCode: CodeUnknown,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+			err := testCase.read(t)
+			assert.NotNil(t, err)
+			assert.Equal(t, err.Code(), testCase.wantCode)
+			assert.True(t, IsProtocolViolation(err))
+			assert.True(t, errors.Is(err, errProtocolViolation))
+			// Wrapping the error hides neither the code nor the violation.
+			wrapped := fmt.Errorf("call failed: %w", err)
+			assert.Equal(t, CodeOf(wrapped), testCase.wantCode)
+			assert.True(t, IsProtocolViolation(wrapped))
+			assert.False(t, strings.Contains(err.Message(), errProtocolViolation.Error()))
+		})
+	}
+	t.Run("not_violations", func(t *testing.T) {
+		t.Parallel()
+		rdr := newReader(nil)
+		eofErr := rdr.Read(&envelope{Data: &bytes.Buffer{}})
+		assert.True(t, errors.Is(eofErr, io.EOF))
+		assert.False(t, IsProtocolViolation(eofErr))
+		valid := newReader(envelopes(t, []uint8{0}, ""))
+		assert.Nil(t, valid.Unmarshal(&emptypb.Empty{}))
+		assert.False(t, IsProtocolViolation(NewError(CodeInternal, errors.New("application failure"))))
+		assert.False(t, IsProtocolViolation(nil))
+	})
+}
+
+func TestEnvelopeWriteCompressionHeuristic(t *testing.T) {
+	t.Parallel()
+	const sampleBytes = 256
+	gzipPool := newCompressionPool(
+		func() Decompressor { return &gzip.Reader{} },
+		func() Compressor { return gzip.NewWriter(io.Discard) },
+	)
+	compressible := bytes.Repeat([]byte("connect "), 1024)
+	incompressible := make([]byte, len(compressible))
+	_, _ = rand.New(rand.NewSource(1)).Read(incompressible) //nolint:gosec // deterministic noise is fine
+	// Compressible data after an incompressible prefix only fools the sample.
+	prefixed := append(append([]byte{}, incompressible[:sampleBytes]...), compressible...)
+	testCases := []struct {
+		name           string
+		heuristic      compressionHeuristic
+		data           []byte
+		wantCompressed bool
+	}{
+		{name: "disabled/incompressible", data: incompressible, wantCompressed: true},
+		{name: "compressible", heuristic: compressionHeuristic{SampleBytes: sampleBytes, MinRatio: 1.25}, data: compressible, wantCompressed: true},
+		{name: "incompressible", heuristic: compressionHeuristic{SampleBytes: sampleBytes, MinRatio: 1.25}, data: incompressible},
+		{name: "incompressible_prefix", heuristic: compressionHeuristic{SampleBytes: sampleBytes, MinRatio: 1.25}, data: prefixed},
+		{name: "small/compressible", heuristic: compressionHeuristic{SampleBytes: sampleBytes, MinRatio: 1.25}, data: compressible[:sampleBytes/2], wantCompressed: true},
+		{name: "small/incompressible", heuristic: compressionHeuristic{SampleBytes: sampleBytes, MinRatio: 1.25}, data: incompressible[:sampleBytes/2]},
+		{name: "unreachable_ratio", heuristic: compressionHeuristic{SampleBytes: sampleBytes, MinRatio: 1000}, data: compressible},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+			t.Run("envelope", func(t *testing.T) {
+				t.Parallel()
+				dst := &bytes.Buffer{}
+				wtr := envelopeWriter{
+					sender:               writeSender{writer: dst},
+					compressionPool:      gzipPool,
+					compressionHeuristic: testCase.heuristic,
+					bufferPool:           newBufferPool(),
+				}
+				assert.Nil(t, wtr.Write(&envelope{Data: bytes.NewBuffer(testCase.data)}))
+				rdr := envelopeReader{
+					ctx:    context.Background(),
+					reader: bytes.NewReader(dst.Bytes()),
+				}
+				env := &envelope{Data: &bytes.Buffer{}}
+				assert.Nil(t, rdr.Read(env))
+				assert.Equal(t, env.IsSet(flagEnvelopeCompressed), testCase.wantCompressed)
+				// Whichever encoding was chosen, the message arrives intact.
+				got := env.Data
+				if testCase.wantCompressed {
+					got = &bytes.Buffer{}
+					assert.Nil(t, gzipPool.Decompress(got, env.Data, 0))
+				}
+				assert.Equal(t, got.Bytes(), testCase.data)
+			})
+			t.Run("unary", func(t *testing.T) {
+				t.Parallel()
+				dst := &bytes.Buffer{}
+				marshaler := connectUnaryMarshaler{
+					sender:               writeSender{writer: dst},
+					codec:                &protoBinaryCodec{},
+					compressionName:      compressionGzip,
+					compressionPool:      gzipPool,
+					compressionHeuristic: testCase.heuristic,
+					bufferPool:           newBufferPool(),
+					header:               http.Header{},
+				}
+				assert.Nil(t, marshaler.Marshal(wrapperspb.Bytes(testCase.data)))
+				encoding := getHeaderCanonical(marshaler.header, connectUnaryHeaderCompression)
+				assert.Equal(t, encoding == compressionGzip, testCase.wantCompressed)
+				body := dst
+				if testCase.wantCompressed {
+					body = &bytes.Buffer{}
+					assert.Nil(t, gzipPool.Decompress(body, dst, 0))
+				}
+				var msg wrapperspb.BytesValue
+				assert.Nil(t, proto.Unmarshal(body.Bytes(), &msg))
+				assert.Equal(t, msg.GetValue(), testCase.data)
+			})
+		})
+	}
+	t.Run("options", func(t *testing.T) {
+		t.Parallel()
+		want := compressionHeuristic{SampleBytes: sampleBytes, MinRatio: 1.25}
+		clientConfig, err := newClientConfig("http://localhost/connect.ping.v1.PingService/Ping", []ClientOption{
+			WithCompressionHeuristic(sampleBytes, 1.25),
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, clientConfig.CompressionHeuristic, want)
+		handlerConfig := newHandlerConfig("/connect.ping.v1.PingService/Ping", StreamTypeUnary, []HandlerOption{
+			WithCompressionHeuristic(sampleBytes, 1.25),
+		})
+		assert.Equal(t, handlerConfig.CompressionHeuristic, want)
+	})
+}
@@ -24,6 +24,7 @@ import (
 	"strings"
 
 	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoregistry"
 	"google.golang.org/protobuf/types/known/anypb"
 )
 
@@ -69,6 +70,32 @@ func NewErrorDetail(msg proto.Message) (*ErrorDetail, error) {
 	return &ErrorDetail{pbAny: pb, pbInner: msg}, nil
 }
 
+// NewErrorDetailWithPrefix is like [NewErrorDetail], but uses the supplied
+// prefix instead of "type.googleapis.com/" in the detail's
+// [google.protobuf.Any] type URL. It's useful when interoperating with
+// services that expect a different prefix. A trailing slash is added to the
+// prefix if it's missing. If msg is already an *[anypb.Any], it's copied and
+// the copy's prefix is replaced.
+//
+// [google.protobuf.Any]: https://protobuf.dev/reference/protobuf/google.protobuf/#any
+func NewErrorDetailWithPrefix(msg proto.Message, prefix string) (*ErrorDetail, error) {
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	if pb, ok := msg.(*anypb.Any); ok {
+		return &ErrorDetail{pbAny: &anypb.Any{
+			TypeUrl: prefix + typeNameFromURL(pb.GetTypeUrl()),
+			Value:   pb.GetValue(),
+		}}, nil
+	}
+	pb := &anypb.Any{}
+	if err := anypb.MarshalFrom(pb, msg, proto.MarshalOptions{}); err != nil {
+		return nil, err
+	}
+	pb.TypeUrl = prefix + string(msg.ProtoReflect().Descriptor().FullName())
+	return &ErrorDetail{pbAny: pb, pbInner: msg}, nil
+}
+
 // Type is the fully-qualified name of the detail's Protobuf message (for
 // example, acme.foo.v1.FooDetail).
 func (d *ErrorDetail) Type() string {
@@ -83,6 +110,12 @@ func (d *ErrorDetail) Type() string {
 	return typeNameFromURL(d.pbAny.GetTypeUrl())
 }
 
+// TypeURL is the detail's full type URL, including its prefix (for example,
+// type.googleapis.com/acme.foo.v1.FooDetail).
+func (d *ErrorDetail) TypeURL() string {
+	return d.pbAny.GetTypeUrl()
+}
+
 // Bytes returns a copy of the Protobuf-serialized detail.
 func (d *ErrorDetail) Bytes() []byte {
 	out := make([]byte, len(d.pbAny.GetValue()))
@@ -102,6 +135,51 @@ func (d *ErrorDetail) Value() (proto.Message, error) {
 	return d.pbAny.UnmarshalNew()
 }
 
+// ValueWithResolver is like [ErrorDetail.Value], but looks up the detail's
+// message type with the supplied resolver rather than the package-global
+// registry. It's useful for details whose types come from schemas loaded at
+// runtime, which aren't in the global registry: for example, a
+// [protoregistry.Types] populated with dynamicpb types. If the resolver
+// also implements [protoregistry.ExtensionTypeResolver], it resolves
+// extensions too; otherwise, extensions are resolved with the global
+// registry.
+func (d *ErrorDetail) ValueWithResolver(resolver protoregistry.MessageTypeResolver) (proto.Message, error) {
+	if d.pbInner != nil {
+		return proto.Clone(d.pbInner), nil
+	}
+	var options proto.UnmarshalOptions
+	if combined, ok := resolver.(interface {
+		protoregistry.MessageTypeResolver
+		protoregistry.ExtensionTypeResolver
+	}); ok {
+		options.Resolver = combined
+	} else {
+		options.Resolver = &detailResolver{
+			MessageTypeResolver:   resolver,
+			ExtensionTypeResolver: protoregistry.GlobalTypes,
+		}
+	}
+	return anypb.UnmarshalNew(d.pbAny, options)
+}
+
+// detailResolver combines a message type resolver with an extension resolver,
+// as proto.UnmarshalOptions requires.
+type detailResolver struct {
+	protoregistry.MessageTypeResolver
+	protoregistry.ExtensionTypeResolver
+}
+
+func (d *ErrorDetail) clone() *ErrorDetail {
+	clone := &ErrorDetail{wireJSON: d.wireJSON}
+	if d.pbAny != nil {
+		clone.pbAny, _ = proto.Clone(d.pbAny).(*anypb.Any)
+	}
+	if d.pbInner != nil {
+		clone.pbInner = proto.Clone(d.pbInner)
+	}
+	return clone
+}
+
 // An Error captures four key pieces of information: a [Code], an underlying Go
 // error, a map of metadata, and an optional collection of arbitrary Protobuf
 // messages called "details" (more on those below). Servers send the code, the
@@ -126,6 +204,9 @@ type Error struct {
 	details []*ErrorDetail
 	meta    http.Header
 	wireErr bool
+	// httpStatus is the status of the HTTP response a client received, if it
+	// wasn't 200 OK.
+	httpStatus int
 }
 
 // NewError annotates any Go error with a status code.
@@ -215,12 +296,14 @@ func (e *Error) Code() Code {
 	return e.code
 }
 
-// Details returns the error's details.
+// Details returns the error's details, in the order they were added. Details
+// keep their order on the wire, so clients see them in the order the handler
+// added them.
 func (e *Error) Details() []*ErrorDetail {
 	return e.details
 }
 
-// AddDetail appends to the error's details.
+// AddDetail appends to the error's details. Details may repeat types.
 func (e *Error) AddDetail(d *ErrorDetail) {
 	e.details = append(e.details, d)
 }
@@ -248,6 +331,47 @@ func (e *Error) Meta() http.Header {
 	return e.meta
 }
 
+// Clone returns a deep copy of the error: changes to the copy's metadata and
+// details don't affect the original, and vice versa. The copy wraps the same
+// underlying error, has the same code, and is a wire error if the original
+// is. Clone returns nil if e is nil.
+func (e *Error) Clone() *Error {
+	if e == nil {
+		return nil
+	}
+	clone := *e
+	clone.meta = e.meta.Clone()
+	if e.details != nil {
+		clone.details = make([]*ErrorDetail, len(e.details))
+		for i, detail := range e.details {
+			clone.details[i] = detail.clone()
+		}
+	}
+	return &clone
+}
+
+// WithCode returns a deep copy of the error with a different code, leaving
+// the original unchanged. It's useful for translating codes, as a gateway
+// might: the copy keeps the original's message, details, and metadata. See
+// [Error.Clone]. If e is nil, WithCode returns a new error with no message.
+func (e *Error) WithCode(c Code) *Error {
+	if e == nil {
+		return NewError(c, nil)
+	}
+	clone := e.Clone()
+	clone.code = c
+	return clone
+}
+
+// HTTPStatus returns the status code of the HTTP response that produced the
+// error, if a client received one other than 200 OK. This distinguishes
+// infrastructure failures, like a 502 from a proxy, from errors sent by
+// handlers. It returns zero for all other errors, including errors that
+// handlers create and errors the gRPC protocols send with a 200 OK response.
+func (e *Error) HTTPStatus() int {
+	return e.httpStatus
+}
+
 func (e *Error) detailsAsAny() []*anypb.Any {
 	anys := make([]*anypb.Any, 0, len(e.details))
 	for _, detail := range e.details {
@@ -264,6 +388,60 @@ func IsNotModifiedError(err error) bool {
 	return errors.Is(err, errNotModified)
 }
 
+// FindDetail returns the first detail of type T attached to an [*Error] in
+// err's chain. Details that can't be unmarshaled, perhaps because their type
+// isn't in the Protobuf registry, are skipped. If err doesn't wrap an [*Error]
+// or none of its details are a T, FindDetail returns the zero value and false.
+//
+// If err's chain contains multiple [*Error] values, FindDetail searches each of
+// them in order.
+func FindDetail[T proto.Message](err error) (T, bool) {
+	for err != nil {
+		connectErr, ok := asError(err)
+		if !ok {
+			break
+		}
+		for _, detail := range connectErr.details {
+			value, valueErr := detail.Value()
+			if valueErr != nil {
+				continue
+			}
+			if typed, ok := value.(T); ok {
+				return typed, true
+			}
+		}
+		err = connectErr.Unwrap()
+	}
+	var zero T
+	return zero, false
+}
+
+// DetailsOf returns all the details of type T attached to an [*Error] in err's
+// chain, in order. Like [FindDetail], it skips details that can't be
+// unmarshaled and searches each [*Error] in the chain, outermost first. If
+// err doesn't wrap an [*Error] or none of its details are a T, DetailsOf
+// returns nil.
+func DetailsOf[T proto.Message](err error) []T {
+	var found []T
+	for err != nil {
+		connectErr, ok := asError(err)
+		if !ok {
+			break
+		}
+		for _, detail := range connectErr.details {
+			value, valueErr := detail.Value()
+			if valueErr != nil {
+				continue
+			}
+			if typed, ok := value.(T); ok {
+				found = append(found, typed)
+			}
+		}
+		err = connectErr.Unwrap()
+	}
+	return found
+}
+
 // errorf calls fmt.Errorf with the supplied template and arguments, then wraps
 // the resulting error.
 func errorf(c Code, template string, args ...any) *Error {
@@ -442,6 +620,33 @@ func wrapIfRSTError(err error) error {
 	}
 }
 
+// wrapIfConnectionLost wraps errors reading a response body after the
+// underlying connection has failed, whether because a peer closed it
+// mid-stream, a middlebox dropped it, or HTTP/2 health checks (see
+// [HTTP2Settings]) found it dead. Like gRPC, we treat these as transient:
+// trying again on a new connection may well succeed. As with RST_STREAM
+// errors, the transports don't export these errors, so we match on strings.
+func wrapIfConnectionLost(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := asError(err); ok {
+		return err
+	}
+	msg := err.Error()
+	for _, lost := range []string{
+		"http2: client connection lost",
+		"http2: client connection force closed via ClientConn.Close",
+		"http2: server sent GOAWAY and closed the connection",
+		"connection reset by peer",
+	} {
+		if strings.Contains(msg, lost) {
+			return NewError(CodeUnavailable, err)
+		}
+	}
+	return err
+}
+
 // wrapIfMaxBytesError wraps errors returned reading from a http.MaxBytesHandler
 // whose limit has been exceeded.
 func wrapIfMaxBytesError(err error, tmpl string, args ...any) error {
@@ -15,16 +15,25 @@
 package connect
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"net/http"
 	"strings"
 	"testing"
 	"time"
 
 	"connectrpc.com/connect/internal/assert"
 	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/anypb"
 	"google.golang.org/protobuf/types/known/durationpb"
 	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
 )
 
 func TestErrorNilUnderlying(t *testing.T) {
@@ -75,6 +84,13 @@ func TestCodeOf(t *testing.T) {
 		CodeUnavailable,
 	)
 	assert.Equal(t, CodeOf(errors.New("foo")), CodeUnknown)
+	assert.Equal(t, CodeOf(nil), CodeUnknown)
+	assert.Equal(t, CodeOf(context.Canceled), CodeCanceled)
+	assert.Equal(t, CodeOf(context.DeadlineExceeded), CodeDeadlineExceeded)
+	assert.Equal(t, CodeOf(fmt.Errorf("query: %w", context.Canceled)), CodeCanceled)
+	assert.Equal(t, CodeOf(fmt.Errorf("query: %w", context.DeadlineExceeded)), CodeDeadlineExceeded)
+	// An explicit code takes precedence over the wrapped context error.
+	assert.Equal(t, CodeOf(NewError(CodeAborted, context.Canceled)), CodeAborted)
 }
 
 func TestErrorDetails(t *testing.T) {
@@ -94,6 +110,267 @@ func TestErrorDetails(t *testing.T) {
 	assert.Equal(t, detail.Bytes(), secondBin)
 }
 
+func TestErrorClone(t *testing.T) {
+	t.Parallel()
+	underlying := errors.New("database unreachable")
+	newOriginal := func(t *testing.T) *Error {
+		t.Helper()
+		original := NewWireError(CodeInternal, underlying)
+		detail, err := NewErrorDetail(durationpb.New(time.Second))
+		assert.Nil(t, err)
+		original.AddDetail(detail)
+		original.Meta().Set("Retry-After", "1")
+		return original
+	}
+	assertUnchanged := func(t *testing.T, original *Error) {
+		t.Helper()
+		assert.Equal(t, original.Code(), CodeInternal)
+		assert.Equal(t, original.Meta(), http.Header{"Retry-After": []string{"1"}})
+		assert.Equal(t, len(original.Details()), 1)
+		value, err := original.Details()[0].Value()
+		assert.Nil(t, err)
+		assert.Equal(t, value, proto.Message(durationpb.New(time.Second)))
+	}
+	t.Run("clone", func(t *testing.T) {
+		t.Parallel()
+		original := newOriginal(t)
+		clone := original.Clone()
+		assert.Equal(t, clone.Code(), CodeInternal)
+		assert.Equal(t, clone.Message(), "database unreachable")
+		assert.ErrorIs(t, clone, underlying)
+		assert.True(t, IsWireError(clone))
+		assert.Equal(t, clone.Meta(), original.Meta())
+		assert.Equal(t, clone.Details()[0].Bytes(), original.Details()[0].Bytes())
+		// The copies are independent.
+		clone.Meta().Set("Retry-After", "5")
+		clone.Meta().Set("X-Gateway", "edge")
+		detail, err := NewErrorDetail(wrapperspb.String("from the gateway"))
+		assert.Nil(t, err)
+		clone.AddDetail(detail)
+		clone.Details()[0] = detail
+		assertUnchanged(t, original)
+		assert.Equal(t, len(clone.Details()), 2)
+	})
+	t.Run("with_code", func(t *testing.T) {
+		t.Parallel()
+		original := newOriginal(t)
+		translated := original.WithCode(CodeUnavailable)
+		assert.Equal(t, translated.Code(), CodeUnavailable)
+		assert.Equal(t, translated.Error(), "unavailable: database unreachable")
+		assert.Equal(t, translated.Meta().Get("Retry-After"), "1")
+		assert.Equal(t, len(translated.Details()), 1)
+		translated.Meta().Del("Retry-After")
+		assertUnchanged(t, original)
+	})
+	t.Run("no_metadata_or_details", func(t *testing.T) {
+		t.Parallel()
+		original := NewError(CodeNotFound, nil)
+		clone := original.Clone()
+		clone.Meta().Set("X-Gateway", "edge")
+		assert.Zero(t, len(original.Meta()))
+		assert.Zero(t, original.Details())
+		assert.Equal(t, clone.Error(), "not_found")
+	})
+	t.Run("nil", func(t *testing.T) {
+		t.Parallel()
+		var nilErr *Error
+		assert.Nil(t, nilErr.Clone())
+		assert.Equal(t, nilErr.WithCode(CodeAborted).Code(), CodeAborted)
+	})
+}
+
+func TestErrorDetailValueWithResolver(t *testing.T) {
+	t.Parallel()
+	// The detail's type comes from a schema loaded at runtime, so it's not in
+	// the global registry.
+	file, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:    proto.String("acme/quota/v1/quota.proto"),
+		Package: proto.String("acme.quota.v1"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("QuotaDetail"),
+			Field: []*descriptorpb.FieldDescriptorProto{{
+				Name:     proto.String("limit"),
+				JsonName: proto.String("limit"),
+				Number:   proto.Int32(1),
+				Type:     descriptorpb.FieldDescriptorProto_TYPE_INT64.Enum(),
+				Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			}},
+		}},
+	}, nil)
+	assert.Nil(t, err)
+	desc := file.Messages().Get(0)
+	limitField := desc.Fields().ByName("limit")
+	msg := dynamicpb.NewMessage(desc)
+	msg.Set(limitField, protoreflect.ValueOfInt64(100))
+	data, err := proto.Marshal(msg)
+	assert.Nil(t, err)
+	// Details received from the wire only have the Any.
+	detail, err := NewErrorDetail(&anypb.Any{
+		TypeUrl: defaultAnyResolverPrefix + "acme.quota.v1.QuotaDetail",
+		Value:   data,
+	})
+	assert.Nil(t, err)
+
+	_, err = detail.Value()
+	assert.ErrorIs(t, err, protoregistry.NotFound)
+
+	types := new(protoregistry.Types)
+	assert.Nil(t, types.RegisterMessage(dynamicpb.NewMessageType(desc)))
+	for name, resolver := range map[string]protoregistry.MessageTypeResolver{
+		"types": types,
+		"message_only": struct {
+			protoregistry.MessageTypeResolver
+		}{types},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			value, err := detail.ValueWithResolver(resolver)
+			assert.Nil(t, err)
+			assert.Equal(t, value.ProtoReflect().Descriptor().FullName(), "acme.quota.v1.QuotaDetail")
+			assert.Equal(t, value.ProtoReflect().Get(limitField).Int(), 100)
+		})
+	}
+	t.Run("not_found", func(t *testing.T) {
+		t.Parallel()
+		_, err := detail.ValueWithResolver(new(protoregistry.Types))
+		assert.ErrorIs(t, err, protoregistry.NotFound)
+	})
+	t.Run("local_detail", func(t *testing.T) {
+		t.Parallel()
+		// Details constructed from messages don't need resolving.
+		local, err := NewErrorDetail(durationpb.New(time.Second))
+		assert.Nil(t, err)
+		value, err := local.ValueWithResolver(new(protoregistry.Types))
+		assert.Nil(t, err)
+		assert.Equal(t, value, proto.Message(durationpb.New(time.Second)))
+	})
+}
+
+func TestNewErrorDetailWithPrefix(t *testing.T) {
+	t.Parallel()
+	second := durationpb.New(time.Second)
+	assertDetail := func(t *testing.T, detail *ErrorDetail) {
+		t.Helper()
+		assert.Equal(t, detail.TypeURL(), "example.com/types/google.protobuf.Duration")
+		assert.Equal(t, detail.Type(), "google.protobuf.Duration")
+		unmarshaled, err := detail.Value()
+		assert.Nil(t, err)
+		assert.Equal(t, unmarshaled, proto.Message(second))
+	}
+	t.Run("message", func(t *testing.T) {
+		t.Parallel()
+		detail, err := NewErrorDetailWithPrefix(second, "example.com/types")
+		assert.Nil(t, err)
+		assertDetail(t, detail)
+		// Without the cached message, Value must resolve the custom URL.
+		detail.pbInner = nil
+		assertDetail(t, detail)
+	})
+	t.Run("any", func(t *testing.T) {
+		t.Parallel()
+		pb, err := anypb.New(second)
+		assert.Nil(t, err)
+		detail, err := NewErrorDetailWithPrefix(pb, "example.com/types/")
+		assert.Nil(t, err)
+		assertDetail(t, detail)
+		assert.Equal(t, pb.GetTypeUrl(), defaultAnyResolverPrefix+"google.protobuf.Duration")
+	})
+}
+
+func TestFindDetail(t *testing.T) {
+	t.Parallel()
+	newDetail := func(t *testing.T, msg proto.Message) *ErrorDetail {
+		t.Helper()
+		detail, err := NewErrorDetail(msg)
+		assert.Nil(t, err)
+		return detail
+	}
+	connectErr := NewError(CodeUnknown, errors.New("error with details"))
+	// A detail whose bytes don't match its declared type, followed by one with
+	// a type that isn't in the registry.
+	connectErr.AddDetail(&ErrorDetail{pbAny: &anypb.Any{
+		TypeUrl: defaultAnyResolverPrefix + "google.protobuf.Duration",
+		Value:   []byte{0xff},
+	}})
+	connectErr.AddDetail(&ErrorDetail{pbAny: &anypb.Any{
+		TypeUrl: defaultAnyResolverPrefix + "acme.v1.Unregistered",
+	}})
+	connectErr.AddDetail(newDetail(t, &emptypb.Empty{}))
+	connectErr.AddDetail(newDetail(t, durationpb.New(time.Second)))
+	connectErr.AddDetail(newDetail(t, durationpb.New(time.Minute)))
+	wrapped := fmt.Errorf("wrapped: %w", connectErr)
+
+	duration, ok := FindDetail[*durationpb.Duration](wrapped)
+	assert.True(t, ok)
+	assert.Equal(t, duration.AsDuration(), time.Second)
+	_, ok = FindDetail[*emptypb.Empty](wrapped)
+	assert.True(t, ok)
+	str, ok := FindDetail[*wrapperspb.StringValue](wrapped)
+	assert.False(t, ok)
+	assert.Nil(t, str)
+	_, ok = FindDetail[*durationpb.Duration](errors.New("not a connect error"))
+	assert.False(t, ok)
+	_, ok = FindDetail[*durationpb.Duration](nil)
+	assert.False(t, ok)
+
+	// Errors nested inside other errors are searched too.
+	outer := NewError(CodeInternal, wrapped)
+	outer.AddDetail(newDetail(t, wrapperspb.String("outer")))
+	str, ok = FindDetail[*wrapperspb.StringValue](outer)
+	assert.True(t, ok)
+	assert.Equal(t, str.GetValue(), "outer")
+	duration, ok = FindDetail[*durationpb.Duration](outer)
+	assert.True(t, ok)
+	assert.Equal(t, duration.AsDuration(), time.Second)
+}
+
+func TestDetailsOf(t *testing.T) {
+	t.Parallel()
+	newDetail := func(t *testing.T, msg proto.Message) *ErrorDetail {
+		t.Helper()
+		detail, err := NewErrorDetail(msg)
+		assert.Nil(t, err)
+		return detail
+	}
+	connectErr := NewError(CodeInvalidArgument, errors.New("error with details"))
+	connectErr.AddDetail(newDetail(t, wrapperspb.String("first")))
+	connectErr.AddDetail(newDetail(t, durationpb.New(time.Second)))
+	connectErr.AddDetail(newDetail(t, wrapperspb.String("second")))
+	// Undecodable details are skipped.
+	connectErr.AddDetail(&ErrorDetail{pbAny: &anypb.Any{
+		TypeUrl: defaultAnyResolverPrefix + "google.protobuf.StringValue",
+		Value:   []byte{0xff},
+	}})
+	wrapped := fmt.Errorf("wrapped: %w", connectErr)
+
+	details := connectErr.Details()
+	assert.Equal(t, len(details), 4)
+	assert.Equal(t, details[0].Type(), "google.protobuf.StringValue")
+	assert.Equal(t, details[1].Type(), "google.protobuf.Duration")
+	assert.Equal(t, details[2].Type(), "google.protobuf.StringValue")
+
+	strs := DetailsOf[*wrapperspb.StringValue](wrapped)
+	assert.Equal(t, len(strs), 2)
+	assert.Equal(t, strs[0].GetValue(), "first")
+	assert.Equal(t, strs[1].GetValue(), "second")
+	durations := DetailsOf[*durationpb.Duration](wrapped)
+	assert.Equal(t, len(durations), 1)
+	assert.Equal(t, durations[0].AsDuration(), time.Second)
+	assert.Zero(t, len(DetailsOf[*emptypb.Empty](wrapped)))
+	assert.Zero(t, len(DetailsOf[*wrapperspb.StringValue](errors.New("not a connect error"))))
+	assert.Zero(t, len(DetailsOf[*wrapperspb.StringValue](nil)))
+
+	// Outer errors come first.
+	outer := NewError(CodeInternal, wrapped)
+	outer.AddDetail(newDetail(t, wrapperspb.String("outer")))
+	strs = DetailsOf[*wrapperspb.StringValue](outer)
+	assert.Equal(t, len(strs), 3)
+	assert.Equal(t, strs[0].GetValue(), "outer")
+	assert.Equal(t, strs[1].GetValue(), "first")
+	assert.Equal(t, strs[2].GetValue(), "second")
+}
+
 func TestErrorIs(t *testing.T) {
 	t.Parallel()
 	// errors.New and fmt.Errorf return *errors.errorString. errors.Is
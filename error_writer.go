@@ -42,21 +42,26 @@ type ErrorWriter struct {
 	bufferPool                   *bufferPool
 	protobuf                     Codec
 	requireConnectProtocolHeader bool
+	statusMapper                 func(Code) int
 }
 
 // NewErrorWriter constructs an ErrorWriter. Handler options may be passed to
 // configure the error writer behaviour to match the handlers.
 // [WithRequiredConnectProtocolHeader] will assert that Connect protocol
 // requests include the version header allowing the error writer to correctly
-// classify the request.
+// classify the request, and [WithHTTPStatusMapper] overrides the HTTP status
+// of unary Connect errors.
 // Options supplied via [WithConditionalHandlerOptions] are ignored.
 func NewErrorWriter(opts ...HandlerOption) *ErrorWriter {
+	// Error writers aren't tied to a procedure.
+	opts = append([]HandlerOption{WithoutProcedureValidation()}, opts...)
 	config := newHandlerConfig("", StreamTypeUnary, opts)
 	codecs := newReadOnlyCodecs(config.Codecs)
 	return &ErrorWriter{
 		bufferPool:                   config.BufferPool,
 		protobuf:                     codecs.Protobuf(),
 		requireConnectProtocolHeader: config.RequireConnectProtocolHeader,
+		statusMapper:                 config.HTTPStatusMapper,
 	}
 }
 
@@ -130,7 +135,7 @@ func (w *ErrorWriter) writeConnectUnary(response http.ResponseWriter, err error)
 	if connectErr, ok := asError(err); ok && !connectErr.wireErr {
 		mergeNonProtocolHeaders(response.Header(), connectErr.meta)
 	}
-	response.WriteHeader(connectCodeToHTTP(CodeOf(err)))
+	response.WriteHeader(w.httpStatus(CodeOf(err)))
 	data, marshalErr := json.Marshal(newConnectWireError(err))
 	if marshalErr != nil {
 		return fmt.Errorf("marshal error: %w", marshalErr)
@@ -139,6 +144,10 @@ func (w *ErrorWriter) writeConnectUnary(response http.ResponseWriter, err error)
 	return writeErr
 }
 
+func (w *ErrorWriter) httpStatus(code Code) int {
+	return mapConnectCodeToHTTP(w.statusMapper, code)
+}
+
 func (w *ErrorWriter) writeConnectStreaming(response http.ResponseWriter, err error) error {
 	response.WriteHeader(http.StatusOK)
 	marshaler := &connectStreamingMarshaler{
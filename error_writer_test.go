@@ -110,4 +110,32 @@ func TestErrorWriter(t *testing.T) {
 			assert.True(t, writer.IsSupported(req))
 		})
 	})
+	t.Run("HTTPStatusMapper", func(t *testing.T) {
+		t.Parallel()
+		writer := NewErrorWriter(WithHTTPStatusMapper(func(code Code) int {
+			switch code {
+			case CodeUnavailable:
+				return http.StatusTooManyRequests
+			case CodeInternal:
+				// Not an error status, so it's ignored.
+				return http.StatusOK
+			case CodeUnknown:
+				return 1000
+			default:
+				return 0
+			}
+		}))
+		for code, want := range map[Code]int{
+			CodeUnavailable: http.StatusTooManyRequests,
+			CodeNotFound:    http.StatusNotFound,
+			CodeInternal:    http.StatusInternalServerError,
+			CodeUnknown:     http.StatusInternalServerError,
+		} {
+			req := httptest.NewRequest(http.MethodPost, "http://localhost", nil)
+			req.Header.Set("Content-Type", connectUnaryContentTypePrefix+codecNameJSON)
+			recorder := httptest.NewRecorder()
+			assert.Nil(t, writer.Write(recorder, req, NewError(code, nil)))
+			assert.Equal(t, recorder.Code, want)
+		}
+	})
 }
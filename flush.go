@@ -0,0 +1,73 @@
+// Copyright 2021-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+type flusherContextKey struct{}
+
+// responseFlusher decides when a streaming handler's responses are flushed to
+// the client. By default, each message is flushed as it's sent. With
+// auto-flush disabled, messages stay buffered until the handler calls Flush
+// or, if threshold is positive, until that many messages are waiting.
+type responseFlusher struct {
+	responseWriter http.ResponseWriter
+	manual         bool
+	threshold      int
+	buffered       int
+}
+
+// sent records that a message was written to the response, flushing it if
+// it's due. Flushes only fail once the client has gone away, which the next
+// write reports with the right code, so sent ignores their errors.
+func (f *responseFlusher) sent() {
+	f.buffered++
+	if f.manual && (f.threshold <= 0 || f.buffered < f.threshold) {
+		return
+	}
+	_ = f.flush()
+}
+
+func (f *responseFlusher) flush() error {
+	f.buffered = 0
+	err := http.NewResponseController(f.responseWriter).Flush()
+	if err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return errorf(CodeUnknown, "flush: %w", err)
+	}
+	return nil
+}
+
+// withFlusher adds the stream's flush function to the context, so that
+// ServerStream and BidiStream can reach it however interceptors have wrapped
+// the connection.
+func withFlusher(ctx context.Context, conn handlerConnCloser) context.Context {
+	if flusher, ok := conn.(interface{ flush() error }); ok {
+		return context.WithValue(ctx, flusherContextKey{}, flusher.flush)
+	}
+	return ctx
+}
+
+// flusherFromContext returns the function that flushes the handler's buffered
+// responses. Connections that can't flush get a no-op.
+func flusherFromContext(ctx context.Context) func() error {
+	if flush, ok := ctx.Value(flusherContextKey{}).(func() error); ok {
+		return flush
+	}
+	return func() error { return nil }
+}
@@ -0,0 +1,165 @@
+// Copyright 2021-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	connect "connectrpc.com/connect"
+	"connectrpc.com/connect/internal/assert"
+	pingv1 "connectrpc.com/connect/internal/gen/connect/ping/v1"
+	"connectrpc.com/connect/internal/gen/connect/ping/v1/pingv1connect"
+	"connectrpc.com/connect/internal/memhttp/memhttptest"
+)
+
+func TestWithAutoFlush(t *testing.T) {
+	t.Parallel()
+	const (
+		messages = 3
+		// wait is how long we give buffered messages to show up, if they're
+		// going to.
+		wait = 200 * time.Millisecond
+	)
+	for _, testCase := range []struct {
+		name string
+		opts []connect.HandlerOption
+		// early is how many messages the client should see before the handler
+		// flushes explicitly.
+		early int
+	}{
+		{name: "auto", early: messages},
+		{name: "manual", opts: []connect.HandlerOption{connect.WithAutoFlush(false)}, early: 0},
+		{
+			name:  "threshold",
+			opts:  []connect.HandlerOption{connect.WithAutoFlush(false), connect.WithFlushThreshold(2)},
+			early: 2,
+		},
+	} {
+		for _, protocol := range []struct {
+			name string
+			opts []connect.ClientOption
+		}{
+			{name: "connect"},
+			{name: "grpc", opts: []connect.ClientOption{connect.WithGRPC()}},
+			{name: "grpcweb", opts: []connect.ClientOption{connect.WithGRPCWeb()}},
+		} {
+			t.Run(testCase.name+"/"+protocol.name, func(t *testing.T) {
+				t.Parallel()
+				release := make(chan struct{})
+				flushed := make(chan error, 1)
+				server := &pluggablePingServer{
+					countUp: func(ctx context.Context, _ *connect.Request[pingv1.CountUpRequest], stream *connect.ServerStream[pingv1.CountUpResponse]) error {
+						for i := range messages {
+							if err := stream.Send(&pingv1.CountUpResponse{Number: int64(i + 1)}); err != nil {
+								return err
+							}
+						}
+						select {
+						case <-release:
+						case <-ctx.Done():
+							return ctx.Err()
+						}
+						err := stream.Flush()
+						flushed <- err
+						if err != nil {
+							return err
+						}
+						// Keep the stream open, so that only the explicit flush can
+						// deliver the remaining messages.
+						<-ctx.Done()
+						return nil
+					},
+				}
+				mux := http.NewServeMux()
+				mux.Handle(pingv1connect.NewPingServiceHandler(server, testCase.opts...))
+				httpServer := memhttptest.NewServer(t, mux)
+				client := pingv1connect.NewPingServiceClient(httpServer.Client(), httpServer.URL(), protocol.opts...)
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+				received := make(chan int64, messages)
+				go func() {
+					defer close(received)
+					stream, err := client.CountUp(ctx, connect.NewRequest(&pingv1.CountUpRequest{Number: messages}))
+					if err != nil {
+						return
+					}
+					defer stream.Close()
+					for stream.Receive() {
+						received <- stream.Msg().GetNumber()
+					}
+				}()
+				receiveWithin := func(t *testing.T, want int64, timeout time.Duration) {
+					t.Helper()
+					select {
+					case number := <-received:
+						assert.Equal(t, number, want)
+					case <-time.After(timeout):
+						t.Fatalf("message %d not received within %v", want, timeout)
+					}
+				}
+				for i := range testCase.early {
+					receiveWithin(t, int64(i+1), 5*time.Second)
+				}
+				select {
+				case number := <-received:
+					t.Fatalf("received buffered message %d before flushing", number)
+				case <-time.After(wait):
+				}
+				close(release)
+				assert.Nil(t, <-flushed)
+				for i := testCase.early; i < messages; i++ {
+					receiveWithin(t, int64(i+1), 5*time.Second)
+				}
+			})
+		}
+	}
+}
+
+func TestFlushBeforeSend(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(&pluggablePingServer{
+		countUp: func(_ context.Context, _ *connect.Request[pingv1.CountUpRequest], stream *connect.ServerStream[pingv1.CountUpResponse]) error {
+			stream.ResponseHeader().Set("X-Flushed", "yes")
+			if err := stream.Flush(); err != nil {
+				return err
+			}
+			return connect.NewError(connect.CodeAborted, nil)
+		},
+	}))
+	httpServer := memhttptest.NewServer(t, mux)
+	for _, protocol := range []struct {
+		name string
+		opts []connect.ClientOption
+	}{
+		{name: "connect"},
+		{name: "grpc", opts: []connect.ClientOption{connect.WithGRPC()}},
+		{name: "grpcweb", opts: []connect.ClientOption{connect.WithGRPCWeb()}},
+	} {
+		t.Run(protocol.name, func(t *testing.T) {
+			t.Parallel()
+			client := pingv1connect.NewPingServiceClient(httpServer.Client(), httpServer.URL(), protocol.opts...)
+			stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{}))
+			assert.Nil(t, err)
+			defer stream.Close()
+			assert.False(t, stream.Receive())
+			assert.Equal(t, connect.CodeOf(stream.Err()), connect.CodeAborted)
+			assert.Equal(t, stream.ResponseHeader().Get("X-Flushed"), "yes")
+		})
+	}
+}
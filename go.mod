@@ -8,6 +8,7 @@ retract (
 )
 
 require (
+	github.com/andybalholm/brotli v1.2.5
 	github.com/google/go-cmp v0.5.9
 	golang.org/x/net v0.33.0
 	google.golang.org/protobuf v1.34.2
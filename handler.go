@@ -16,7 +16,12 @@ package connect
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
+	"slices"
+	"time"
+
+	"google.golang.org/protobuf/proto"
 )
 
 // A Handler is the server-side implementation of a single RPC defined by a
@@ -31,6 +36,14 @@ type Handler struct {
 	protocolHandlers map[string][]protocolHandler // Method to protocol handlers
 	allowMethod      string                       // Allow header
 	acceptPost       string                       // Accept-Post header
+	errorReporter    func(context.Context, Spec, error)
+	timeout          time.Duration
+	clock            Clock
+	compressionNames []string
+	// keepaliveInterval and keepaliveTimeout configure keepalives for streams.
+	// See WithStreamKeepalive.
+	keepaliveInterval time.Duration
+	keepaliveTimeout  time.Duration
 }
 
 // NewUnaryHandler constructs a [Handler] for a request-response procedure.
@@ -57,6 +70,7 @@ func NewUnaryHandler[Req, Res any](
 		return res, err
 	})
 	config := newHandlerConfig(procedure, StreamTypeUnary, options)
+	untyped = newHandlerResponseCacheFunc[Res](config, untyped)
 	if interceptor := config.Interceptor; interceptor != nil {
 		untyped = interceptor.WrapUnary(untyped)
 	}
@@ -77,11 +91,17 @@ func NewUnaryHandler[Req, Res any](
 
 	protocolHandlers := config.newProtocolHandlers()
 	return &Handler{
-		spec:             config.newSpec(),
-		implementation:   implementation,
-		protocolHandlers: mappedMethodHandlers(protocolHandlers),
-		allowMethod:      sortedAllowMethodValue(protocolHandlers),
-		acceptPost:       sortedAcceptPostValue(protocolHandlers),
+		spec:              config.newSpec(),
+		implementation:    implementation,
+		protocolHandlers:  mappedMethodHandlers(protocolHandlers),
+		allowMethod:       sortedAllowMethodValue(protocolHandlers),
+		acceptPost:        sortedAcceptPostValue(protocolHandlers),
+		errorReporter:     config.ErrorReporter,
+		timeout:           config.Timeout,
+		clock:             config.Clock,
+		compressionNames:  preferredCompressionNames(config.CompressionNames),
+		keepaliveInterval: config.KeepaliveInterval,
+		keepaliveTimeout:  config.KeepaliveTimeout,
 	}
 }
 
@@ -129,7 +149,10 @@ func NewServerStreamHandler[Req, Res any](
 			if err != nil {
 				return err
 			}
-			return implementation(ctx, req, &ServerStream[Res]{conn: conn})
+			return implementation(ctx, req, &ServerStream[Res]{
+				conn:  conn,
+				flush: flusherFromContext(ctx),
+			})
 		},
 	)
 }
@@ -149,12 +172,21 @@ func NewBidiStreamHandler[Req, Res any](
 				&BidiStream[Req, Res]{
 					conn:        conn,
 					initializer: config.Initializer,
+					flush:       flusherFromContext(ctx),
 				},
 			)
 		},
 	)
 }
 
+// CompressionNames returns the names of the compression algorithms the
+// handler supports, most preferred first. The handler advertises them to
+// clients in this order. It's useful for checking configuration at startup:
+// for example, after registering a compressor with [WithCompression].
+func (h *Handler) CompressionNames() []string {
+	return slices.Clone(h.compressionNames)
+}
+
 // ServeHTTP implements [http.Handler].
 func (h *Handler) ServeHTTP(responseWriter http.ResponseWriter, request *http.Request) {
 	// We don't need to defer functions to close the request body or read to
@@ -173,8 +205,22 @@ func (h *Handler) ServeHTTP(responseWriter http.ResponseWriter, request *http.Re
 
 	protocolHandlers := h.protocolHandlers[request.Method]
 	if len(protocolHandlers) == 0 {
-		responseWriter.Header().Set("Allow", h.allowMethod)
+		// Reject the request before doing any codec work. We don't know which
+		// protocol the client is using, so we describe the error the same way
+		// unary Connect would: it's the only protocol that isn't POST-only, so
+		// it's the most likely to see other HTTP methods.
+		header := responseWriter.Header()
+		header.Set("Allow", h.allowMethod)
+		setHeaderCanonical(header, headerContentType, connectUnaryContentTypeJSON)
 		responseWriter.WriteHeader(http.StatusMethodNotAllowed)
+		data, err := json.Marshal(newConnectWireError(errorf(
+			CodeUnimplemented,
+			"HTTP method %s isn't supported: use %s",
+			request.Method, h.allowMethod,
+		)))
+		if err == nil {
+			_, _ = responseWriter.Write(data)
+		}
 		return
 	}
 
@@ -221,6 +267,17 @@ func (h *Handler) ServeHTTP(responseWriter http.ResponseWriter, request *http.Re
 	if cancel != nil {
 		defer cancel()
 	}
+	if h.timeout > 0 {
+		// If the client sent a shorter timeout, withClockTimeout keeps its
+		// deadline.
+		var cancelMethod context.CancelFunc
+		ctx, cancelMethod = withClockTimeout(ctx, h.clock, h.timeout)
+		defer cancelMethod()
+	}
+	responseWriter, pinger := h.acceptKeepalive(responseWriter, request)
+	// Pings mustn't outlive the response, so stop them before the stream is
+	// closed.
+	defer pinger.close()
 	connCloser, ok := protocolHandler.NewConn(
 		responseWriter,
 		request.WithContext(ctx),
@@ -231,10 +288,20 @@ func (h *Handler) ServeHTTP(responseWriter http.ResponseWriter, request *http.Re
 		return
 	}
 	if timeoutErr != nil {
+		pinger.close()
 		_ = connCloser.Close(timeoutErr)
 		return
 	}
-	_ = connCloser.Close(h.implementation(ctx, connCloser))
+	ctx = withHandlerCall(ctx, h.spec, connCloser.Peer())
+	ctx = withFlusher(ctx, connCloser)
+	err := h.implementation(ctx, connCloser)
+	if err != nil && h.errorReporter != nil {
+		// Report the error as the protocol will serialize it.
+		connectErr, _ := asError(wrapIfUncoded(err))
+		h.errorReporter(ctx, h.spec, connectErr)
+	}
+	pinger.close()
+	_ = connCloser.Close(err)
 }
 
 type handlerConfig struct {
@@ -242,16 +309,41 @@ type handlerConfig struct {
 	CompressionNames             []string
 	Codecs                       map[string]Codec
 	CompressMinBytes             int
+	CompressionHeuristic         compressionHeuristic
 	Interceptor                  Interceptor
 	Procedure                    string
 	Schema                       any
 	Initializer                  maybeInitializer
 	RequireConnectProtocolHeader bool
+	SkipProcedureValidation      bool
 	IdempotencyLevel             IdempotencyLevel
 	BufferPool                   *bufferPool
 	ReadMaxBytes                 int
 	SendMaxBytes                 int
+	MaxHeaderBytes               int
 	StreamType                   StreamType
+	WireStats                    func(WireStats)
+	HTTPStatusMapper             func(Code) int
+	NewlineDelimitedJSON         bool
+	ErrorReporter                func(context.Context, Spec, error)
+	Timeout                      time.Duration
+	RejectUnknownJSON            bool
+	ProtoMarshalOptions          *proto.MarshalOptions
+	ProtoUnmarshalOptions        *proto.UnmarshalOptions
+	JSONInt64Encoding            JSONInt64Encoding
+	EmitDefaultJSONValues        bool
+	ConnectErrorFields           func(context.Context, *Error) map[string]any
+	PanicHandling                PanicHandling
+	SendTimeout                  time.Duration
+	FirstMessageTimeout          time.Duration
+	ManualFlush                  bool
+	FlushThreshold               int
+	Clock                        Clock
+	KeepaliveInterval            time.Duration
+	KeepaliveTimeout             time.Duration
+	ResponseCompressionName      string
+	DisableCompression           bool
+	ResponseCache                *handlerResponseCache
 }
 
 func newHandlerConfig(procedure string, streamType StreamType, options []HandlerOption) *handlerConfig {
@@ -262,6 +354,7 @@ func newHandlerConfig(procedure string, streamType StreamType, options []Handler
 		Codecs:           make(map[string]Codec),
 		BufferPool:       newBufferPool(),
 		StreamType:       streamType,
+		Clock:            realClock{},
 	}
 	withProtoBinaryCodec().applyToHandler(&config)
 	withProtoJSONCodecs().applyToHandler(&config)
@@ -269,6 +362,51 @@ func newHandlerConfig(procedure string, streamType StreamType, options []Handler
 	for _, opt := range options {
 		opt.applyToHandler(&config)
 	}
+	if !config.SkipProcedureValidation {
+		if err := validateProcedure(procedure); err != nil {
+			// Malformed procedures would otherwise surface as 404s at runtime.
+			panic("connect: " + err.Error() + `: expected "/package.Service/Method"`) //nolint:forbidigo
+		}
+	}
+	// Options may replace the JSON codecs in any order, so we tune them once
+	// they're settled.
+	tuning := jsonCodecTuning{
+		rejectUnknown: config.RejectUnknownJSON,
+		int64Encoding: config.JSONInt64Encoding,
+		emitDefaults:  config.EmitDefaultJSONValues,
+	}
+	for name, codec := range config.Codecs {
+		config.Codecs[name] = tuneJSONCodec(codec, tuning)
+	}
+	if codec, ok := config.Codecs[codecNameProto].(*protoBinaryCodec); ok {
+		tuned := *codec
+		if config.ProtoMarshalOptions != nil {
+			tuned.marshalOptions = *config.ProtoMarshalOptions
+		}
+		if config.ProtoUnmarshalOptions != nil {
+			tuned.unmarshalOptions = *config.ProtoUnmarshalOptions
+		}
+		config.Codecs[codecNameProto] = &tuned
+	}
+	if config.MaxHeaderBytes > 0 {
+		// Check metadata before the other interceptors see the request.
+		config.Interceptor = newChain([]Interceptor{
+			&maxHeaderBytesInterceptor{limit: config.MaxHeaderBytes},
+			config.Interceptor,
+		})
+	}
+	if handle := config.PanicHandling.handle; handle != nil {
+		// Recover outside all the other interceptors, so panics in them are
+		// handled too.
+		config.Interceptor = newChain([]Interceptor{
+			&recoverHandlerInterceptor{
+				handle: func(ctx context.Context, _ Spec, _ http.Header, panicValue any, stack []byte) error {
+					return handle(ctx, panicValue, stack)
+				},
+			},
+			config.Interceptor,
+		})
+	}
 	return &config
 }
 
@@ -293,17 +431,32 @@ func (c *handlerConfig) newProtocolHandlers() []protocolHandler {
 		c.CompressionPools,
 		c.CompressionNames,
 	)
+	responseCompression := c.ResponseCompressionName
+	if c.DisableCompression {
+		responseCompression = compressionIdentity
+	}
 	for _, protocol := range protocols {
 		handlers = append(handlers, protocol.NewHandler(&protocolHandlerParams{
 			Spec:                         c.newSpec(),
 			Codecs:                       codecs,
 			CompressionPools:             compressors,
 			CompressMinBytes:             c.CompressMinBytes,
+			CompressionHeuristic:         c.CompressionHeuristic,
 			BufferPool:                   c.BufferPool,
 			ReadMaxBytes:                 c.ReadMaxBytes,
 			SendMaxBytes:                 c.SendMaxBytes,
 			RequireConnectProtocolHeader: c.RequireConnectProtocolHeader,
 			IdempotencyLevel:             c.IdempotencyLevel,
+			WireStats:                    c.WireStats,
+			HTTPStatusMapper:             c.HTTPStatusMapper,
+			NewlineDelimitedJSON:         c.NewlineDelimitedJSON,
+			ConnectErrorFields:           c.ConnectErrorFields,
+			SendTimeout:                  c.SendTimeout,
+			FirstMessageTimeout:          c.FirstMessageTimeout,
+			ManualFlush:                  c.ManualFlush,
+			FlushThreshold:               c.FlushThreshold,
+			Clock:                        c.Clock,
+			ResponseCompressionName:      responseCompression,
 		}))
 	}
 	return handlers
@@ -318,10 +471,16 @@ func newStreamHandler(
 	}
 	protocolHandlers := config.newProtocolHandlers()
 	return &Handler{
-		spec:             config.newSpec(),
-		implementation:   implementation,
-		protocolHandlers: mappedMethodHandlers(protocolHandlers),
-		allowMethod:      sortedAllowMethodValue(protocolHandlers),
-		acceptPost:       sortedAcceptPostValue(protocolHandlers),
+		spec:              config.newSpec(),
+		implementation:    implementation,
+		protocolHandlers:  mappedMethodHandlers(protocolHandlers),
+		allowMethod:       sortedAllowMethodValue(protocolHandlers),
+		acceptPost:        sortedAcceptPostValue(protocolHandlers),
+		errorReporter:     config.ErrorReporter,
+		timeout:           config.Timeout,
+		clock:             config.Clock,
+		compressionNames:  preferredCompressionNames(config.CompressionNames),
+		keepaliveInterval: config.KeepaliveInterval,
+		keepaliveTimeout:  config.KeepaliveTimeout,
 	}
 }
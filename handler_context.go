@@ -0,0 +1,51 @@
+// Copyright 2021-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+)
+
+type (
+	specContextKey struct{}
+	peerContextKey struct{}
+)
+
+// SpecFromContext returns the [Spec] of the RPC a handler is serving. Handlers
+// add it to the context before running interceptors and the implementation,
+// so handler logic can read its own procedure and stream type without having
+// them passed in. It returns false for contexts that don't belong to a
+// handler, including client calls.
+func SpecFromContext(ctx context.Context) (Spec, bool) {
+	spec, ok := ctx.Value(specContextKey{}).(Spec)
+	return spec, ok
+}
+
+// PeerFromContext returns the [Peer] that sent the RPC a handler is serving,
+// describing the client's address and the protocol, codec, and compression in
+// use. Like [SpecFromContext], it lets handler logic read what interceptors
+// see on requests and streams, without changing signatures. It returns false
+// for contexts that don't belong to a handler, including client calls.
+func PeerFromContext(ctx context.Context) (Peer, bool) {
+	peer, ok := ctx.Value(peerContextKey{}).(Peer)
+	return peer, ok
+}
+
+// withHandlerCall adds the handler's Spec and the client's Peer to the
+// context.
+func withHandlerCall(ctx context.Context, spec Spec, peer Peer) context.Context {
+	ctx = context.WithValue(ctx, specContextKey{}, spec)
+	return context.WithValue(ctx, peerContextKey{}, peer)
+}
@@ -0,0 +1,132 @@
+// Copyright 2021-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	connect "connectrpc.com/connect"
+	"connectrpc.com/connect/internal/assert"
+	pingv1 "connectrpc.com/connect/internal/gen/connect/ping/v1"
+	"connectrpc.com/connect/internal/gen/connect/ping/v1/pingv1connect"
+	"connectrpc.com/connect/internal/memhttp/memhttptest"
+)
+
+func TestSpecFromContext(t *testing.T) {
+	t.Parallel()
+	_, ok := connect.SpecFromContext(context.Background())
+	assert.False(t, ok)
+	specs := make(chan connect.Spec, 1)
+	recordSpec := func(ctx context.Context) {
+		spec, ok := connect.SpecFromContext(ctx)
+		assert.True(t, ok)
+		specs <- spec
+	}
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(&pluggablePingServer{
+		ping: func(ctx context.Context, request *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+			recordSpec(ctx)
+			return connect.NewResponse(&pingv1.PingResponse{}), nil
+		},
+		countUp: func(ctx context.Context, _ *connect.Request[pingv1.CountUpRequest], _ *connect.ServerStream[pingv1.CountUpResponse]) error {
+			recordSpec(ctx)
+			return nil
+		},
+	}))
+	server := memhttptest.NewServer(t, mux)
+	client := pingv1connect.NewPingServiceClient(server.Client(), server.URL())
+
+	t.Run("unary", func(t *testing.T) {
+		_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+		assert.Nil(t, err)
+		spec := <-specs
+		assert.Equal(t, spec.Procedure, pingv1connect.PingServicePingProcedure)
+		assert.Equal(t, spec.StreamType, connect.StreamTypeUnary)
+		assert.False(t, spec.IsClient)
+		assert.Equal(t, spec.IdempotencyLevel, connect.IdempotencyNoSideEffects)
+		assert.NotNil(t, spec.Schema)
+	})
+	t.Run("server_stream", func(t *testing.T) {
+		stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{}))
+		assert.Nil(t, err)
+		assert.False(t, stream.Receive())
+		assert.Nil(t, stream.Err())
+		assert.Nil(t, stream.Close())
+		spec := <-specs
+		assert.Equal(t, spec.Procedure, pingv1connect.PingServiceCountUpProcedure)
+		assert.Equal(t, spec.StreamType, connect.StreamTypeServer)
+		assert.False(t, spec.IsClient)
+	})
+}
+
+func TestPeerFromContext(t *testing.T) {
+	t.Parallel()
+	_, ok := connect.PeerFromContext(context.Background())
+	assert.False(t, ok)
+	peers := make(chan connect.Peer, 1)
+	// recordPeer checks that the context carries the same Peer that
+	// interceptors see on the request or stream.
+	recordPeer := func(ctx context.Context, want connect.Peer) {
+		peer, ok := connect.PeerFromContext(ctx)
+		assert.True(t, ok)
+		assert.Equal(t, peer, want)
+		peers <- peer
+	}
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(&pluggablePingServer{
+		ping: func(ctx context.Context, request *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+			recordPeer(ctx, request.Peer())
+			return connect.NewResponse(&pingv1.PingResponse{}), nil
+		},
+		sum: func(ctx context.Context, stream *connect.ClientStream[pingv1.SumRequest]) (*connect.Response[pingv1.SumResponse], error) {
+			recordPeer(ctx, stream.Peer())
+			for stream.Receive() {
+				// Drain the request.
+			}
+			return connect.NewResponse(&pingv1.SumResponse{}), stream.Err()
+		},
+	}))
+	server := memhttptest.NewServer(t, mux)
+	for _, protocol := range []struct {
+		name string
+		want string
+		opts []connect.ClientOption
+	}{
+		{name: "connect", want: connect.ProtocolConnect},
+		{name: "grpc", want: connect.ProtocolGRPC, opts: []connect.ClientOption{connect.WithGRPC()}},
+		{name: "grpcweb", want: connect.ProtocolGRPCWeb, opts: []connect.ClientOption{connect.WithGRPCWeb()}},
+	} {
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL(), protocol.opts...)
+		t.Run(protocol.name+"/unary", func(t *testing.T) {
+			_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+			assert.Nil(t, err)
+			peer := <-peers
+			assert.Equal(t, peer.Protocol, protocol.want)
+			assert.NotZero(t, peer.Addr)
+			assert.Equal(t, peer.Codec, "proto")
+		})
+		t.Run(protocol.name+"/client_stream", func(t *testing.T) {
+			stream := client.Sum(context.Background())
+			assert.Nil(t, stream.Send(&pingv1.SumRequest{Number: 1}))
+			_, err := stream.CloseAndReceive()
+			assert.Nil(t, err)
+			peer := <-peers
+			assert.Equal(t, peer.Protocol, protocol.want)
+			assert.NotZero(t, peer.Addr)
+		})
+	}
+}
@@ -22,16 +22,26 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	connect "connectrpc.com/connect"
 	"connectrpc.com/connect/internal/assert"
 	pingv1 "connectrpc.com/connect/internal/gen/connect/ping/v1"
 	"connectrpc.com/connect/internal/gen/connect/ping/v1/pingv1connect"
+	"connectrpc.com/connect/internal/memhttp"
 	"connectrpc.com/connect/internal/memhttp/memhttptest"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/reflect/protoreflect"
 	"google.golang.org/protobuf/reflect/protoregistry"
 	"google.golang.org/protobuf/types/dynamicpb"
@@ -245,6 +255,276 @@ func TestHandler_ServeHTTP(t *testing.T) {
 	})
 }
 
+func TestHandlerProcedureValidation(t *testing.T) {
+	t.Parallel()
+	ping := func(_ context.Context, request *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+		return connect.NewResponse(&pingv1.PingResponse{Number: request.Msg.GetNumber()}), nil
+	}
+	constructors := map[string]func(procedure string, opts ...connect.HandlerOption) http.Handler{
+		"unary": func(procedure string, opts ...connect.HandlerOption) http.Handler {
+			return connect.NewUnaryHandler(procedure, ping, opts...)
+		},
+		"client_stream": func(procedure string, opts ...connect.HandlerOption) http.Handler {
+			return connect.NewClientStreamHandler(procedure, pingServer{}.Sum, opts...)
+		},
+		"server_stream": func(procedure string, opts ...connect.HandlerOption) http.Handler {
+			return connect.NewServerStreamHandler(procedure, pingServer{}.CountUp, opts...)
+		},
+		"bidi_stream": func(procedure string, opts ...connect.HandlerOption) http.Handler {
+			return connect.NewBidiStreamHandler(procedure, pingServer{}.CumSum, opts...)
+		},
+	}
+	// assertPanics checks that constructing the handler fails immediately.
+	assertPanics := func(t *testing.T, construct func()) {
+		t.Helper()
+		defer func() {
+			message, ok := recover().(string)
+			assert.True(t, ok)
+			assert.True(t, strings.HasPrefix(message, "connect: procedure"))
+			assert.True(t, strings.HasSuffix(message, `expected "/package.Service/Method"`))
+		}()
+		construct()
+		t.Error("expected panic")
+	}
+	for name, construct := range constructors {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			assert.NotNil(t, construct(pingv1connect.PingServicePingProcedure))
+			for _, procedure := range []string{
+				"connect.ping.v1.PingService/Ping",
+				"/connect.ping.v1.PingService",
+				"/connect.ping.v1.PingService/Ping/",
+				"/connect.ping.v1.PingService/Pi ng",
+			} {
+				assertPanics(t, func() { construct(procedure) })
+				assert.NotNil(t, construct(procedure, connect.WithoutProcedureValidation()))
+			}
+		})
+	}
+	t.Run("opt_out", func(t *testing.T) {
+		t.Parallel()
+		// Handlers mounted under a custom path still route by the trailing
+		// service and method.
+		mux := http.NewServeMux()
+		mux.Handle("/api/", http.StripPrefix("/api", connect.NewUnaryHandler(
+			"/api"+pingv1connect.PingServicePingProcedure,
+			ping,
+			connect.WithoutProcedureValidation(),
+		)))
+		server := memhttptest.NewServer(t, mux)
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL()+"/api")
+		response, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Number: 42}))
+		assert.Nil(t, err)
+		assert.Equal(t, response.Msg.GetNumber(), 42)
+	})
+}
+
+func TestHandlerRejectsUnsupportedMethods(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}))
+	server := memhttptest.NewServer(t, mux)
+	send := func(t *testing.T, method, procedure string) *http.Response {
+		t.Helper()
+		request, err := http.NewRequestWithContext(
+			context.Background(),
+			method,
+			server.URL()+procedure,
+			strings.NewReader(`{}`),
+		)
+		assert.Nil(t, err)
+		request.Header.Set("Content-Type", "application/json")
+		response, err := server.Client().Do(request)
+		assert.Nil(t, err)
+		t.Cleanup(func() { _ = response.Body.Close() })
+		return response
+	}
+	testCases := []struct {
+		method    string
+		procedure string
+		allow     string
+	}{
+		{method: http.MethodPut, procedure: pingv1connect.PingServiceFailProcedure, allow: "POST"},
+		{method: http.MethodDelete, procedure: pingv1connect.PingServiceFailProcedure, allow: "POST"},
+		// Handlers for side-effect-free procedures also support GET.
+		{method: http.MethodPut, procedure: pingv1connect.PingServicePingProcedure, allow: "GET, POST"},
+		{method: http.MethodDelete, procedure: pingv1connect.PingServicePingProcedure, allow: "GET, POST"},
+		{method: http.MethodGet, procedure: pingv1connect.PingServiceFailProcedure, allow: "POST"},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.method+testCase.procedure, func(t *testing.T) {
+			t.Parallel()
+			response := send(t, testCase.method, testCase.procedure)
+			assert.Equal(t, response.StatusCode, http.StatusMethodNotAllowed)
+			assert.Equal(t, response.Header.Get("Allow"), testCase.allow)
+			assert.Equal(t, response.Header.Get("Content-Type"), "application/json")
+			var wireError struct {
+				Code    string `json:"code"`
+				Message string `json:"message"`
+			}
+			assert.Nil(t, json.NewDecoder(response.Body).Decode(&wireError))
+			assert.Equal(t, wireError.Code, connect.CodeUnimplemented.String())
+			assert.Equal(t, wireError.Message, fmt.Sprintf("HTTP method %s isn't supported: use %s", testCase.method, testCase.allow))
+		})
+	}
+	t.Run("get_enabled", func(t *testing.T) {
+		t.Parallel()
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL(), connect.WithHTTPGet())
+		request := connect.NewRequest(&pingv1.PingRequest{Number: 42})
+		response, err := client.Ping(context.Background(), request)
+		assert.Nil(t, err)
+		assert.Equal(t, response.Msg.GetNumber(), 42)
+		assert.Equal(t, request.HTTPMethod(), http.MethodGet)
+	})
+}
+
+func TestHandlerHTTPGet(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}))
+	server := memhttptest.NewServer(t, mux)
+
+	for _, testCase := range []struct {
+		name        string
+		options     []connect.ClientOption
+		compression string
+	}{
+		{name: "uncompressed"},
+		{name: "uncompressed_json", options: []connect.ClientOption{connect.WithProtoJSON()}},
+		{
+			// Clients only compress GET requests when the URL would otherwise be
+			// too long.
+			name: "gzip",
+			options: []connect.ClientOption{
+				connect.WithSendGzip(),
+				connect.WithHTTPGetMaxURLSize(512, false /* fallback */),
+			},
+			compression: "gzip",
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+			var query url.Values
+			httpClient := httpClientFunc(func(request *http.Request) (*http.Response, error) {
+				assert.Equal(t, request.Method, http.MethodGet)
+				query = request.URL.Query()
+				return server.Client().Do(request)
+			})
+			client := pingv1connect.NewPingServiceClient(
+				httpClient,
+				server.URL(),
+				append(testCase.options, connect.WithHTTPGet())...,
+			)
+			// Make the message long enough to be worth compressing.
+			text := strings.Repeat("cacheable ", 128)
+			request := connect.NewRequest(&pingv1.PingRequest{Number: 42, Text: text})
+			response, err := client.Ping(context.Background(), request)
+			assert.Nil(t, err)
+			assert.Equal(t, request.HTTPMethod(), http.MethodGet)
+			assert.Equal(t, response.Msg.GetNumber(), 42)
+			assert.Equal(t, response.Msg.GetText(), text)
+			assert.Equal(t, query.Get("connect"), "v1")
+			assert.Equal(t, query.Get("compression"), testCase.compression)
+		})
+	}
+
+	t.Run("malformed", func(t *testing.T) {
+		t.Parallel()
+		for _, testCase := range []struct {
+			query  string
+			status int
+			code   connect.Code
+		}{
+			{query: "encoding=proto", status: http.StatusBadRequest, code: connect.CodeInvalidArgument},
+			{query: "encoding=proto&base64=1&message=%2A%2A%2A", status: http.StatusBadRequest, code: connect.CodeInvalidArgument},
+			{query: "encoding=json&message=%7Bnope", status: http.StatusBadRequest, code: connect.CodeInvalidArgument},
+			{query: "encoding=proto&message=&connect=v2", status: http.StatusBadRequest, code: connect.CodeInvalidArgument},
+			{query: "encoding=proto&message=&compression=bogus", status: http.StatusNotImplemented, code: connect.CodeUnimplemented},
+		} {
+			request, err := http.NewRequestWithContext(
+				context.Background(),
+				http.MethodGet,
+				server.URL()+pingv1connect.PingServicePingProcedure+"?"+testCase.query,
+				http.NoBody,
+			)
+			assert.Nil(t, err)
+			response, err := server.Client().Do(request)
+			assert.Nil(t, err)
+			var wireError struct {
+				Code string `json:"code"`
+			}
+			assert.Nil(t, json.NewDecoder(response.Body).Decode(&wireError))
+			assert.Nil(t, response.Body.Close())
+			assert.Equal(t, response.StatusCode, testCase.status, assert.Sprintf("query %q", testCase.query))
+			assert.Equal(t, wireError.Code, testCase.code.String(), assert.Sprintf("query %q", testCase.query))
+		}
+	})
+}
+
+func TestHandlerHTTPGetQuery(t *testing.T) {
+	t.Parallel()
+	queries := make(chan url.Values, 1)
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(&pluggablePingServer{
+		ping: func(_ context.Context, request *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+			queries <- request.Peer().Query
+			return connect.NewResponse(&pingv1.PingResponse{Number: request.Msg.GetNumber()}), nil
+		},
+	}))
+	server := memhttptest.NewServer(t, mux)
+	// addParams adds application parameters alongside the protocol's own.
+	addParams := connect.WithRequestMutator(func(request *http.Request) error {
+		query := request.URL.Query()
+		query.Set("flag", "on")
+		query.Add("region", "eu")
+		query.Add("region", "us")
+		request.URL.RawQuery = query.Encode()
+		return nil
+	})
+	for _, testCase := range []struct {
+		name    string
+		options []connect.ClientOption
+		method  string
+		want    url.Values
+	}{
+		{
+			name:    "get",
+			options: []connect.ClientOption{connect.WithHTTPGet(), addParams},
+			method:  http.MethodGet,
+			want:    url.Values{"flag": {"on"}, "region": {"eu", "us"}},
+		},
+		{
+			name:    "get_compressed",
+			options: []connect.ClientOption{connect.WithHTTPGet(), connect.WithSendGzip(), connect.WithHTTPGetMaxURLSize(512, false /* fallback */), addParams},
+			method:  http.MethodGet,
+			want:    url.Values{"flag": {"on"}, "region": {"eu", "us"}},
+		},
+		{
+			name:    "get_without_params",
+			options: []connect.ClientOption{connect.WithHTTPGet()},
+			method:  http.MethodGet,
+		},
+		{
+			name:    "post",
+			options: []connect.ClientOption{addParams},
+			method:  http.MethodPost,
+			want:    url.Values{"flag": {"on"}, "region": {"eu", "us"}},
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			client := pingv1connect.NewPingServiceClient(server.Client(), server.URL(), testCase.options...)
+			// Make the message long enough to be worth compressing.
+			text := strings.Repeat("cacheable ", 128)
+			request := connect.NewRequest(&pingv1.PingRequest{Number: 42, Text: text})
+			response, err := client.Ping(context.Background(), request)
+			assert.Nil(t, err)
+			assert.Equal(t, response.Msg.GetNumber(), 42)
+			assert.Equal(t, request.HTTPMethod(), testCase.method)
+			assert.Equal(t, <-queries, testCase.want)
+		})
+	}
+}
+
 func TestHandlerMaliciousPrefix(t *testing.T) {
 	t.Parallel()
 	mux := http.NewServeMux()
@@ -285,6 +565,987 @@ func TestHandlerMaliciousPrefix(t *testing.T) {
 	wg.Wait()
 }
 
+func TestHandlerWithHTTPStatusMapper(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(
+		pingServer{},
+		connect.WithHTTPStatusMapper(func(code connect.Code) int {
+			switch code {
+			case connect.CodeResourceExhausted:
+				return http.StatusServiceUnavailable
+			case connect.CodeInvalidArgument:
+				return http.StatusUnprocessableEntity
+			case connect.CodeNotFound:
+				// Not an error status, so the default is used instead.
+				return http.StatusOK
+			default:
+				return 0
+			}
+		}),
+	))
+	server := memhttptest.NewServer(t, mux)
+	// Record the HTTP status of each response.
+	var mu sync.Mutex
+	var statuses []int
+	httpClient := httpClientFunc(func(request *http.Request) (*http.Response, error) {
+		response, err := server.Client().Do(request)
+		if err == nil {
+			mu.Lock()
+			statuses = append(statuses, response.StatusCode)
+			mu.Unlock()
+		}
+		return response, err
+	})
+	lastStatus := func(t *testing.T) int {
+		t.Helper()
+		mu.Lock()
+		defer mu.Unlock()
+		assert.NotZero(t, len(statuses))
+		return statuses[len(statuses)-1]
+	}
+
+	t.Run("connect_unary", func(t *testing.T) {
+		client := pingv1connect.NewPingServiceClient(httpClient, server.URL())
+		_, err := client.Fail(context.Background(), connect.NewRequest(&pingv1.FailRequest{
+			Code: int32(connect.CodeResourceExhausted),
+		}))
+		assert.Equal(t, lastStatus(t), http.StatusServiceUnavailable)
+		// The code in the body is authoritative.
+		assert.Equal(t, connect.CodeOf(err), connect.CodeResourceExhausted)
+
+		_, err = client.Fail(context.Background(), connect.NewRequest(&pingv1.FailRequest{
+			Code: int32(connect.CodeNotFound),
+		}))
+		assert.Equal(t, lastStatus(t), http.StatusNotFound)
+		assert.Equal(t, connect.CodeOf(err), connect.CodeNotFound)
+	})
+	t.Run("connect_unary_raw", func(t *testing.T) {
+		request, err := http.NewRequestWithContext(
+			context.Background(),
+			http.MethodPost,
+			server.URL()+pingv1connect.PingServiceFailProcedure,
+			strings.NewReader(`{"code": 8}`),
+		)
+		assert.Nil(t, err)
+		request.Header.Set("Content-Type", "application/json")
+		response, err := server.Client().Do(request)
+		assert.Nil(t, err)
+		defer response.Body.Close()
+		assert.Equal(t, response.StatusCode, http.StatusServiceUnavailable)
+		var wireError struct {
+			Code string `json:"code"`
+		}
+		assert.Nil(t, json.NewDecoder(response.Body).Decode(&wireError))
+		assert.Equal(t, wireError.Code, connect.CodeResourceExhausted.String())
+	})
+	for _, protocol := range []struct {
+		name    string
+		options []connect.ClientOption
+	}{
+		{name: "connect"},
+		{name: "grpc", options: []connect.ClientOption{connect.WithGRPC()}},
+		{name: "grpcweb", options: []connect.ClientOption{connect.WithGRPCWeb()}},
+	} {
+		t.Run(protocol.name+"_stream", func(t *testing.T) {
+			client := pingv1connect.NewPingServiceClient(httpClient, server.URL(), protocol.options...)
+			stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{}))
+			assert.Nil(t, err)
+			assert.False(t, stream.Receive())
+			assert.Equal(t, connect.CodeOf(stream.Err()), connect.CodeInvalidArgument)
+			assert.Nil(t, stream.Close())
+			assert.Equal(t, lastStatus(t), http.StatusOK)
+		})
+	}
+	for _, protocol := range []struct {
+		name    string
+		options []connect.ClientOption
+	}{
+		{name: "grpc", options: []connect.ClientOption{connect.WithGRPC()}},
+		{name: "grpcweb", options: []connect.ClientOption{connect.WithGRPCWeb()}},
+	} {
+		t.Run(protocol.name+"_unary", func(t *testing.T) {
+			client := pingv1connect.NewPingServiceClient(httpClient, server.URL(), protocol.options...)
+			_, err := client.Fail(context.Background(), connect.NewRequest(&pingv1.FailRequest{
+				Code: int32(connect.CodeResourceExhausted),
+			}))
+			assert.Equal(t, connect.CodeOf(err), connect.CodeResourceExhausted)
+			assert.Equal(t, lastStatus(t), http.StatusOK)
+		})
+	}
+}
+
+func TestHandlerWithConnectErrorFields(t *testing.T) {
+	t.Parallel()
+	const requestIDHeader = "X-Request-Id"
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(
+		pingServer{},
+		connect.WithRequestID(requestIDHeader, func() string { return "abc123" }),
+		connect.WithConnectErrorFields(func(_ context.Context, err *connect.Error) map[string]any {
+			return map[string]any{
+				"requestId": err.Meta().Get(requestIDHeader),
+				"retryable": err.Code() == connect.CodeResourceExhausted,
+				// Canonical fields can't be overridden.
+				"code":    "ok",
+				"message": "overridden",
+			}
+		}),
+	))
+	server := memhttptest.NewServer(t, mux)
+
+	t.Run("connect_unary_raw", func(t *testing.T) {
+		t.Parallel()
+		request, err := http.NewRequestWithContext(
+			context.Background(),
+			http.MethodPost,
+			server.URL()+pingv1connect.PingServiceFailProcedure,
+			strings.NewReader(`{"code": 8}`),
+		)
+		assert.Nil(t, err)
+		request.Header.Set("Content-Type", "application/json")
+		response, err := server.Client().Do(request)
+		assert.Nil(t, err)
+		defer response.Body.Close()
+		assert.Equal(t, response.StatusCode, http.StatusTooManyRequests)
+		var wireError struct {
+			Code      string `json:"code"`
+			Message   string `json:"message"`
+			RequestID string `json:"requestId"`
+			Retryable bool   `json:"retryable"`
+		}
+		assert.Nil(t, json.NewDecoder(response.Body).Decode(&wireError))
+		assert.Equal(t, wireError.Code, connect.CodeResourceExhausted.String())
+		assert.Equal(t, wireError.Message, errorMessage)
+		assert.Equal(t, wireError.RequestID, "abc123")
+		assert.True(t, wireError.Retryable)
+	})
+	t.Run("unencodable_field", func(t *testing.T) {
+		t.Parallel()
+		mux := http.NewServeMux()
+		mux.Handle(pingv1connect.NewPingServiceHandler(
+			pingServer{},
+			connect.WithConnectErrorFields(func(context.Context, *connect.Error) map[string]any {
+				return map[string]any{"requestId": "abc123", "broken": make(chan int)}
+			}),
+		))
+		server := memhttptest.NewServer(t, mux)
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL())
+		// The client still gets the error, without any of the extra fields.
+		_, err := client.Fail(context.Background(), connect.NewRequest(&pingv1.FailRequest{
+			Code: int32(connect.CodeResourceExhausted),
+		}))
+		var connectErr *connect.Error
+		assert.True(t, errors.As(err, &connectErr))
+		assert.Equal(t, connectErr.Code(), connect.CodeResourceExhausted)
+		assert.Equal(t, connectErr.Message(), errorMessage)
+	})
+	for _, protocol := range []struct {
+		name    string
+		options []connect.ClientOption
+	}{
+		{name: "connect"},
+		{name: "grpc", options: []connect.ClientOption{connect.WithGRPC()}},
+		{name: "grpcweb", options: []connect.ClientOption{connect.WithGRPCWeb()}},
+	} {
+		t.Run(protocol.name, func(t *testing.T) {
+			t.Parallel()
+			client := pingv1connect.NewPingServiceClient(server.Client(), server.URL(), protocol.options...)
+			// Clients still decode the canonical fields.
+			_, err := client.Fail(context.Background(), connect.NewRequest(&pingv1.FailRequest{
+				Code: int32(connect.CodeResourceExhausted),
+			}))
+			var connectErr *connect.Error
+			assert.True(t, errors.As(err, &connectErr))
+			assert.Equal(t, connectErr.Code(), connect.CodeResourceExhausted)
+			assert.Equal(t, connectErr.Message(), errorMessage)
+			stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{}))
+			assert.Nil(t, err)
+			assert.False(t, stream.Receive())
+			assert.Equal(t, connect.CodeOf(stream.Err()), connect.CodeInvalidArgument)
+			assert.Nil(t, stream.Close())
+		})
+	}
+}
+
+func TestHandlerWithErrorReporter(t *testing.T) {
+	t.Parallel()
+	type report struct {
+		procedure string
+		err       *connect.Error
+	}
+	var (
+		mu      sync.Mutex
+		reports []report
+	)
+	reporter := connect.WithErrorReporter(func(_ context.Context, spec connect.Spec, err error) {
+		connectErr, ok := err.(*connect.Error) //nolint:errorlint
+		assert.True(t, ok)
+		mu.Lock()
+		defer mu.Unlock()
+		reports = append(reports, report{procedure: spec.Procedure, err: connectErr})
+	})
+	takeReports := func() []report {
+		mu.Lock()
+		defer mu.Unlock()
+		taken := reports
+		reports = nil
+		return taken
+	}
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(
+		pingServer{includeErrorDetails: true},
+		reporter,
+		connect.WithInterceptors(rejectBidiInterceptor{}),
+	))
+	server := memhttptest.NewServer(t, mux)
+	panicMux := http.NewServeMux()
+	panicMux.Handle(pingv1connect.NewPingServiceHandler(
+		&panicPingServer{panicWith: "boom"},
+		connect.WithRecover(func(context.Context, connect.Spec, http.Header, any) error {
+			return connect.NewError(connect.CodeFailedPrecondition, errors.New("recovered"))
+		}),
+		reporter,
+	))
+	panicServer := memhttptest.NewServer(t, panicMux)
+
+	// Subtests share the reports, so they run sequentially.
+	t.Run("unary_with_details", func(t *testing.T) {
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL())
+		_, err := client.Fail(context.Background(), connect.NewRequest(&pingv1.FailRequest{Code: int32(connect.CodeResourceExhausted)}))
+		assert.Equal(t, connect.CodeOf(err), connect.CodeResourceExhausted)
+		got := takeReports()
+		assert.Equal(t, len(got), 1)
+		assert.Equal(t, got[0].procedure, pingv1connect.PingServiceFailProcedure)
+		assert.Equal(t, got[0].err.Code(), connect.CodeResourceExhausted)
+		assert.Equal(t, got[0].err.Message(), errorMessage)
+		assert.Equal(t, len(got[0].err.Details()), 1)
+	})
+	t.Run("server_stream", func(t *testing.T) {
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL(), connect.WithGRPC())
+		stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{}))
+		assert.Nil(t, err)
+		assert.False(t, stream.Receive())
+		assert.Equal(t, connect.CodeOf(stream.Err()), connect.CodeInvalidArgument)
+		assert.Nil(t, stream.Close())
+		got := takeReports()
+		assert.Equal(t, len(got), 1)
+		assert.Equal(t, got[0].procedure, pingv1connect.PingServiceCountUpProcedure)
+		assert.Equal(t, got[0].err.Code(), connect.CodeInvalidArgument)
+	})
+	t.Run("interceptor_uncoded", func(t *testing.T) {
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL())
+		stream := client.CumSum(context.Background())
+		assert.Nil(t, stream.Send(&pingv1.CumSumRequest{Number: 1}))
+		_, err := stream.Receive()
+		assert.Equal(t, connect.CodeOf(err), connect.CodeUnknown)
+		assert.Nil(t, stream.CloseRequest())
+		assert.Nil(t, stream.CloseResponse())
+		got := takeReports()
+		assert.Equal(t, len(got), 1)
+		assert.Equal(t, got[0].err.Code(), connect.CodeUnknown)
+		assert.Equal(t, got[0].err.Message(), "rejected by interceptor")
+	})
+	t.Run("recovered_panic", func(t *testing.T) {
+		client := pingv1connect.NewPingServiceClient(panicServer.Client(), panicServer.URL())
+		_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+		assert.Equal(t, connect.CodeOf(err), connect.CodeFailedPrecondition)
+		got := takeReports()
+		assert.Equal(t, len(got), 1)
+		assert.Equal(t, got[0].err.Code(), connect.CodeFailedPrecondition)
+	})
+	t.Run("success", func(t *testing.T) {
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL())
+		_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+		assert.Nil(t, err)
+		assert.Equal(t, len(takeReports()), 0)
+	})
+}
+
+// rejectBidiInterceptor fails bidirectional streams before they reach the
+// handler, with an uncoded error.
+type rejectBidiInterceptor struct{}
+
+func (rejectBidiInterceptor) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return next
+}
+
+func (rejectBidiInterceptor) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return next
+}
+
+func (rejectBidiInterceptor) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return func(ctx context.Context, conn connect.StreamingHandlerConn) error {
+		if conn.Spec().StreamType == connect.StreamTypeBidi {
+			return errors.New("rejected by interceptor")
+		}
+		return next(ctx, conn)
+	}
+}
+
+func TestHandlerNewlineDelimitedJSON(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(
+		pingServer{},
+		connect.WithNewlineDelimitedJSON(),
+	))
+	server := memhttptest.NewServer(t, mux)
+	// indentedMux uses a JSON codec that spreads messages over several lines.
+	indentedMux := http.NewServeMux()
+	indentedMux.Handle(pingv1connect.NewPingServiceHandler(
+		pingServer{},
+		connect.WithNewlineDelimitedJSON(),
+		connect.WithCodec(indentedJSONCodec{}),
+	))
+	indentedServer := memhttptest.NewServer(t, indentedMux)
+	countUpFrom := func(t *testing.T, server *memhttp.Server, number int, accept string) *http.Response {
+		t.Helper()
+		message := fmt.Sprintf(`{"number": %d}`, number)
+		body := make([]byte, 5, 5+len(message))
+		binary.BigEndian.PutUint32(body[1:5], uint32(len(message)))
+		body = append(body, message...)
+		request, err := http.NewRequestWithContext(
+			context.Background(),
+			http.MethodPost,
+			server.URL()+pingv1connect.PingServiceCountUpProcedure,
+			bytes.NewReader(body),
+		)
+		assert.Nil(t, err)
+		request.Header.Set("Content-Type", "application/connect+json")
+		request.Header.Set("Connect-Accept-Encoding", "gzip")
+		if accept != "" {
+			request.Header.Set("Accept", accept)
+		}
+		response, err := server.Client().Do(request)
+		assert.Nil(t, err)
+		t.Cleanup(func() {
+			assert.Nil(t, response.Body.Close())
+		})
+		assert.Equal(t, response.StatusCode, http.StatusOK)
+		return response
+	}
+	countUp := func(t *testing.T, number int, accept string) *http.Response {
+		t.Helper()
+		return countUpFrom(t, server, number, accept)
+	}
+	type endStream struct {
+		EndStream *struct {
+			Error *struct {
+				Code    string `json:"code"`
+				Message string `json:"message"`
+			} `json:"error"`
+			Metadata map[string][]string `json:"metadata"`
+		} `json:"endStream"`
+	}
+	readLines := func(t *testing.T, response *http.Response) ([]*pingv1.CountUpResponse, endStream) {
+		t.Helper()
+		data, err := io.ReadAll(response.Body)
+		assert.Nil(t, err)
+		lines := strings.Split(string(data), "\n")
+		// The final line is terminated by a newline too.
+		assert.Equal(t, lines[len(lines)-1], "")
+		lines = lines[:len(lines)-1]
+		assert.NotZero(t, len(lines))
+		var messages []*pingv1.CountUpResponse
+		for _, line := range lines[:len(lines)-1] {
+			msg := &pingv1.CountUpResponse{}
+			assert.Nil(t, protojson.Unmarshal([]byte(line), msg))
+			messages = append(messages, msg)
+		}
+		var end endStream
+		assert.Nil(t, json.Unmarshal([]byte(lines[len(lines)-1]), &end))
+		assert.NotNil(t, end.EndStream)
+		return messages, end
+	}
+
+	t.Run("messages", func(t *testing.T) {
+		t.Parallel()
+		response := countUp(t, 3, "application/jsonl")
+		assert.Equal(t, response.Header.Get("Content-Type"), "application/jsonl")
+		assert.Equal(t, response.Header.Get("Connect-Content-Encoding"), "")
+		messages, end := readLines(t, response)
+		assert.Equal(t, len(messages), 3)
+		for i, msg := range messages {
+			assert.Equal(t, msg.GetNumber(), int64(i+1))
+		}
+		assert.Nil(t, end.EndStream.Error)
+		assert.Equal(t, end.EndStream.Metadata[handlerTrailer], []string{trailerValue})
+	})
+	t.Run("multiline_codec", func(t *testing.T) {
+		t.Parallel()
+		response := countUpFrom(t, indentedServer, 2, "application/jsonl")
+		assert.Equal(t, response.Header.Get("Content-Type"), "application/jsonl")
+		messages, end := readLines(t, response)
+		assert.Equal(t, len(messages), 2)
+		for i, msg := range messages {
+			assert.Equal(t, msg.GetNumber(), int64(i+1))
+		}
+		assert.Nil(t, end.EndStream.Error)
+	})
+	t.Run("error", func(t *testing.T) {
+		t.Parallel()
+		response := countUp(t, 0, "application/json, application/jsonl; q=0.9")
+		assert.Equal(t, response.Header.Get("Content-Type"), "application/jsonl")
+		messages, end := readLines(t, response)
+		assert.Zero(t, len(messages))
+		assert.NotNil(t, end.EndStream.Error)
+		assert.Equal(t, end.EndStream.Error.Code, connect.CodeInvalidArgument.String())
+	})
+	t.Run("not_requested", func(t *testing.T) {
+		t.Parallel()
+		response := countUp(t, 3, "")
+		assert.Equal(t, response.Header.Get("Content-Type"), "application/connect+json")
+		data, err := io.ReadAll(response.Body)
+		assert.Nil(t, err)
+		// Enveloped and compressed: the first byte holds the envelope flags.
+		assert.Equal(t, response.Header.Get("Connect-Content-Encoding"), "gzip")
+		assert.True(t, len(data) > 5)
+		assert.Equal(t, data[0], 1)
+	})
+	t.Run("not_enabled", func(t *testing.T) {
+		t.Parallel()
+		mux := http.NewServeMux()
+		mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}))
+		server := memhttptest.NewServer(t, mux)
+		client := pingv1connect.NewPingServiceClient(
+			server.Client(),
+			server.URL(),
+			connect.WithProtoJSON(),
+		)
+		request := connect.NewRequest(&pingv1.CountUpRequest{Number: 2})
+		request.Header().Set("Accept", "application/jsonl")
+		stream, err := client.CountUp(context.Background(), request)
+		assert.Nil(t, err)
+		var got []int64
+		for stream.Receive() {
+			got = append(got, stream.Msg().GetNumber())
+		}
+		assert.Nil(t, stream.Err())
+		assert.Equal(t, got, []int64{1, 2})
+		assert.Equal(t, stream.ResponseHeader().Get("Content-Type"), "application/connect+json")
+	})
+}
+
+func TestHandlerPeerNetAddr(t *testing.T) {
+	t.Parallel()
+	serve := func(t *testing.T, listener net.Listener) chan connect.Peer {
+		t.Helper()
+		peers := make(chan connect.Peer, 1)
+		mux := http.NewServeMux()
+		mux.Handle(pingv1connect.NewPingServiceHandler(
+			pingServer{},
+			connect.WithInterceptors(connect.UnaryInterceptorFunc(func(next connect.UnaryFunc) connect.UnaryFunc {
+				return func(ctx context.Context, request connect.AnyRequest) (connect.AnyResponse, error) {
+					peers <- request.Peer()
+					return next(ctx, request)
+				}
+			})),
+		))
+		server := &http.Server{Handler: mux, ReadHeaderTimeout: time.Second}
+		go func() { _ = server.Serve(listener) }()
+		t.Cleanup(func() { assert.Nil(t, server.Close()) })
+		return peers
+	}
+	t.Run("tcp", func(t *testing.T) {
+		t.Parallel()
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.Nil(t, err)
+		peers := serve(t, listener)
+		var clientPeer connect.Peer
+		client := pingv1connect.NewPingServiceClient(
+			http.DefaultClient,
+			"http://"+listener.Addr().String(),
+			connect.WithInterceptors(connect.UnaryInterceptorFunc(func(next connect.UnaryFunc) connect.UnaryFunc {
+				return func(ctx context.Context, request connect.AnyRequest) (connect.AnyResponse, error) {
+					clientPeer = request.Peer()
+					return next(ctx, request)
+				}
+			})),
+		)
+		_, err = client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+		assert.Nil(t, err)
+		handlerPeer := <-peers
+		addr, ok := handlerPeer.NetAddr.(*net.TCPAddr)
+		assert.True(t, ok)
+		assert.Equal(t, addr.String(), handlerPeer.Addr)
+		assert.True(t, addr.IP.IsLoopback())
+		serverAddr, ok := clientPeer.NetAddr.(*net.TCPAddr)
+		assert.True(t, ok)
+		assert.Equal(t, serverAddr.String(), listener.Addr().String())
+	})
+	t.Run("unix", func(t *testing.T) {
+		t.Parallel()
+		// Unix socket paths are limited to about 100 bytes, which t.TempDir may
+		// exceed.
+		dir, err := os.MkdirTemp("", "connect")
+		assert.Nil(t, err)
+		t.Cleanup(func() { _ = os.RemoveAll(dir) })
+		listener, err := net.Listen("unix", filepath.Join(dir, "sock"))
+		assert.Nil(t, err)
+		peers := serve(t, listener)
+		transport := &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, "unix", listener.Addr().String())
+			},
+		}
+		t.Cleanup(transport.CloseIdleConnections)
+		client := pingv1connect.NewPingServiceClient(&http.Client{Transport: transport}, "http://localhost")
+		_, err = client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+		assert.Nil(t, err)
+		handlerPeer := <-peers
+		addr, ok := handlerPeer.NetAddr.(*net.UnixAddr)
+		assert.True(t, ok)
+		assert.Equal(t, addr.Network(), "unix")
+		assert.Equal(t, addr.Name, handlerPeer.Addr)
+	})
+}
+
+func TestServerStreamSendAfterClientCancel(t *testing.T) {
+	t.Parallel()
+	sendErrs := make(chan error, 3)
+	countUp := func(ctx context.Context, _ *connect.Request[pingv1.CountUpRequest], stream *connect.ServerStream[pingv1.CountUpResponse]) error {
+		if err := stream.Send(&pingv1.CountUpResponse{Number: 1}); err != nil {
+			sendErrs <- err
+			return err
+		}
+		<-ctx.Done()
+		err := stream.Send(&pingv1.CountUpResponse{Number: 2})
+		sendErrs <- err
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.PingServiceCountUpProcedure, connect.NewServerStreamHandler(pingv1connect.PingServiceCountUpProcedure, countUp))
+	server := memhttptest.NewServer(t, mux)
+	for _, protocol := range []struct {
+		name string
+		opts []connect.ClientOption
+	}{
+		{name: "connect"},
+		{name: "grpc", opts: []connect.ClientOption{connect.WithGRPC()}},
+		{name: "grpcweb", opts: []connect.ClientOption{connect.WithGRPCWeb()}},
+	} {
+		t.Run(protocol.name, func(t *testing.T) {
+			client := pingv1connect.NewPingServiceClient(server.Client(), server.URL(), protocol.opts...)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			stream, err := client.CountUp(ctx, connect.NewRequest(&pingv1.CountUpRequest{}))
+			assert.Nil(t, err)
+			assert.True(t, stream.Receive())
+			// Cancelling resets the HTTP/2 stream, which should cancel the
+			// handler's context.
+			cancel()
+			assert.Nil(t, stream.Close())
+			err = <-sendErrs
+			assert.NotNil(t, err)
+			assert.Equal(t, connect.CodeOf(err), connect.CodeCanceled)
+		})
+	}
+}
+
+func TestHandlerWithMethodTimeout(t *testing.T) {
+	t.Parallel()
+	const methodTimeout = 200 * time.Millisecond
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(
+		deadlinePingServer{},
+		connect.WithMethodTimeout(map[string]time.Duration{
+			pingv1connect.PingServicePingProcedure: methodTimeout,
+		}),
+	))
+	server := memhttptest.NewServer(t, mux)
+	client := pingv1connect.NewPingServiceClient(server.Client(), server.URL())
+	ping := func(ctx context.Context, sleep time.Duration) (time.Duration, error) {
+		response, err := client.Ping(ctx, connect.NewRequest(&pingv1.PingRequest{Number: int64(sleep)}))
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(response.Msg.GetNumber()), nil
+	}
+	t.Run("slow_handler_cut_off", func(t *testing.T) {
+		t.Parallel()
+		start := time.Now()
+		_, err := ping(context.Background(), time.Minute)
+		assert.Equal(t, connect.CodeOf(err), connect.CodeDeadlineExceeded)
+		assert.True(t, time.Since(start) < time.Minute/2)
+	})
+	t.Run("fast_handler_unaffected", func(t *testing.T) {
+		t.Parallel()
+		remaining, err := ping(context.Background(), 0)
+		assert.Nil(t, err)
+		assert.True(t, remaining > 0)
+		assert.True(t, remaining <= methodTimeout)
+	})
+	t.Run("longer_client_deadline", func(t *testing.T) {
+		t.Parallel()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		remaining, err := ping(ctx, 0)
+		assert.Nil(t, err)
+		assert.True(t, remaining <= methodTimeout)
+	})
+	t.Run("shorter_client_deadline", func(t *testing.T) {
+		t.Parallel()
+		const clientTimeout = 50 * time.Millisecond
+		ctx, cancel := context.WithTimeout(context.Background(), clientTimeout)
+		defer cancel()
+		remaining, err := ping(ctx, 0)
+		assert.Nil(t, err)
+		assert.True(t, remaining <= clientTimeout)
+	})
+	t.Run("unlisted_method", func(t *testing.T) {
+		t.Parallel()
+		stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{}))
+		assert.Nil(t, err)
+		assert.True(t, stream.Receive())
+		// A zero remaining duration means the handler had no deadline.
+		assert.Zero(t, stream.Msg().GetNumber())
+		assert.Nil(t, stream.Close())
+	})
+}
+
+// deadlinePingServer reports how much time remains before its context's
+// deadline. Ping sleeps for the requested number of nanoseconds first, giving
+// up early if the context is canceled.
+type deadlinePingServer struct {
+	pingv1connect.UnimplementedPingServiceHandler
+}
+
+func (deadlinePingServer) Ping(
+	ctx context.Context,
+	request *connect.Request[pingv1.PingRequest],
+) (*connect.Response[pingv1.PingResponse], error) {
+	timer := time.NewTimer(time.Duration(request.Msg.GetNumber()))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-timer.C:
+	}
+	return connect.NewResponse(&pingv1.PingResponse{Number: int64(remainingTime(ctx))}), nil
+}
+
+func (deadlinePingServer) CountUp(
+	ctx context.Context,
+	_ *connect.Request[pingv1.CountUpRequest],
+	stream *connect.ServerStream[pingv1.CountUpResponse],
+) error {
+	return stream.Send(&pingv1.CountUpResponse{Number: int64(remainingTime(ctx))})
+}
+
+func remainingTime(ctx context.Context) time.Duration {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0
+	}
+	return time.Until(deadline)
+}
+
+func TestHandlerWithResponseTrailers(t *testing.T) {
+	t.Parallel()
+	const outcomeTrailer = "Rpc-Outcome"
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(
+		pingServer{},
+		connect.WithResponseTrailers(func(_ context.Context, spec connect.Spec, trailer http.Header, err error) {
+			outcome := "ok"
+			if err != nil {
+				outcome = connect.CodeOf(err).String()
+			}
+			trailer.Set(outcomeTrailer, spec.StreamType.String()+"/"+outcome)
+		}),
+	))
+	server := memhttptest.NewServer(t, mux)
+	protocols := []struct {
+		name string
+		opts []connect.ClientOption
+	}{
+		{name: "connect"},
+		{name: "grpc", opts: []connect.ClientOption{connect.WithGRPC()}},
+		{name: "grpcweb", opts: []connect.ClientOption{connect.WithGRPCWeb()}},
+	}
+	for _, protocol := range protocols {
+		t.Run(protocol.name, func(t *testing.T) {
+			t.Parallel()
+			client := pingv1connect.NewPingServiceClient(server.Client(), server.URL(), protocol.opts...)
+			t.Run("unary_success", func(t *testing.T) {
+				t.Parallel()
+				response, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+				assert.Nil(t, err)
+				assert.Equal(t, response.Trailer().Get(outcomeTrailer), "unary/ok")
+				// The handler's own trailers are preserved.
+				assert.Equal(t, response.Trailer().Get(handlerTrailer), trailerValue)
+			})
+			t.Run("unary_error", func(t *testing.T) {
+				t.Parallel()
+				_, err := client.Fail(context.Background(), connect.NewRequest(&pingv1.FailRequest{Code: int32(connect.CodeAborted)}))
+				var connectErr *connect.Error
+				assert.True(t, errors.As(err, &connectErr))
+				assert.Equal(t, connectErr.Code(), connect.CodeAborted)
+				assert.Equal(t, connectErr.Meta().Get(outcomeTrailer), "unary/aborted")
+			})
+			t.Run("stream_success", func(t *testing.T) {
+				t.Parallel()
+				stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{Number: 2}))
+				assert.Nil(t, err)
+				for stream.Receive() {
+					assert.NotNil(t, stream.Msg())
+				}
+				assert.Nil(t, stream.Err())
+				assert.Equal(t, stream.ResponseTrailer().Get(outcomeTrailer), "server/ok")
+				assert.Equal(t, stream.ResponseTrailer().Get(handlerTrailer), trailerValue)
+				assert.Nil(t, stream.Close())
+			})
+			t.Run("stream_error", func(t *testing.T) {
+				t.Parallel()
+				stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{}))
+				assert.Nil(t, err)
+				assert.False(t, stream.Receive())
+				assert.Equal(t, connect.CodeOf(stream.Err()), connect.CodeInvalidArgument)
+				assert.Equal(t, stream.ResponseTrailer().Get(outcomeTrailer), "server/invalid_argument")
+				assert.Nil(t, stream.Close())
+			})
+		})
+	}
+}
+
+func TestHandlerWithResponseValidator(t *testing.T) {
+	t.Parallel()
+	errInvalid := errors.New("missing required field")
+	var validated atomic.Int64
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(
+		pingServer{},
+		connect.WithResponseValidator(func(_ context.Context, spec connect.Spec, message any) error {
+			assert.False(t, spec.IsClient)
+			validated.Add(1)
+			switch message := message.(type) {
+			case *pingv1.PingResponse:
+				if message.GetText() == "" {
+					return errInvalid
+				}
+			case *pingv1.CountUpResponse:
+				if message.GetNumber() == 3 {
+					return errInvalid
+				}
+			}
+			return nil
+		}),
+	))
+	server := memhttptest.NewServer(t, mux)
+	protocols := []struct {
+		name string
+		opts []connect.ClientOption
+	}{
+		{name: "connect"},
+		{name: "grpc", opts: []connect.ClientOption{connect.WithGRPC()}},
+		{name: "grpcweb", opts: []connect.ClientOption{connect.WithGRPCWeb()}},
+	}
+	for _, protocol := range protocols {
+		t.Run(protocol.name, func(t *testing.T) {
+			client := pingv1connect.NewPingServiceClient(server.Client(), server.URL(), protocol.opts...)
+			t.Run("unary_valid", func(t *testing.T) {
+				response, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Text: "ok"}))
+				assert.Nil(t, err)
+				assert.Equal(t, response.Msg.GetText(), "ok")
+			})
+			t.Run("unary_invalid", func(t *testing.T) {
+				before := validated.Load()
+				_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Number: 1}))
+				assert.Equal(t, connect.CodeOf(err), connect.CodeInternal)
+				assert.True(t, strings.Contains(err.Error(), errInvalid.Error()))
+				assert.Equal(t, validated.Load()-before, 1)
+			})
+			t.Run("unary_error", func(t *testing.T) {
+				// Errors aren't responses, so they aren't validated.
+				before := validated.Load()
+				_, err := client.Fail(context.Background(), connect.NewRequest(&pingv1.FailRequest{Code: int32(connect.CodeAborted)}))
+				assert.Equal(t, connect.CodeOf(err), connect.CodeAborted)
+				assert.Equal(t, validated.Load(), before)
+			})
+			t.Run("stream_valid", func(t *testing.T) {
+				stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{Number: 2}))
+				assert.Nil(t, err)
+				var got []int64
+				for stream.Receive() {
+					got = append(got, stream.Msg().GetNumber())
+				}
+				assert.Nil(t, stream.Err())
+				assert.Equal(t, got, []int64{1, 2})
+				assert.Nil(t, stream.Close())
+			})
+			t.Run("stream_invalid", func(t *testing.T) {
+				stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{Number: 5}))
+				assert.Nil(t, err)
+				var got []int64
+				for stream.Receive() {
+					got = append(got, stream.Msg().GetNumber())
+				}
+				// Messages before the invalid one are delivered, and the stream
+				// fails instead of sending the rest.
+				assert.Equal(t, got, []int64{1, 2})
+				assert.Equal(t, connect.CodeOf(stream.Err()), connect.CodeInternal)
+				assert.True(t, strings.Contains(stream.Err().Error(), errInvalid.Error()))
+				assert.Nil(t, stream.Close())
+			})
+		})
+	}
+}
+
+func TestHandlerContextErrorCodes(t *testing.T) {
+	t.Parallel()
+	const procedure = "/test.v1.Service/Fail"
+	testCases := []struct {
+		name string
+		err  error
+		want connect.Code
+	}{
+		{name: "canceled", err: context.Canceled, want: connect.CodeCanceled},
+		{name: "deadline_exceeded", err: context.DeadlineExceeded, want: connect.CodeDeadlineExceeded},
+		{name: "wrapped_canceled", err: fmt.Errorf("query: %w", context.Canceled), want: connect.CodeCanceled},
+		{name: "wrapped_deadline_exceeded", err: fmt.Errorf("query: %w", context.DeadlineExceeded), want: connect.CodeDeadlineExceeded},
+	}
+	protocols := []struct {
+		name string
+		opts []connect.ClientOption
+	}{
+		{name: "connect"},
+		{name: "grpc", opts: []connect.ClientOption{connect.WithGRPC()}},
+		{name: "grpcweb", opts: []connect.ClientOption{connect.WithGRPCWeb()}},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, connect.CodeOf(testCase.err), testCase.want)
+			mux := http.NewServeMux()
+			mux.Handle(procedure, connect.NewUnaryHandler(
+				procedure,
+				func(context.Context, *connect.Request[pingv1.FailRequest]) (*connect.Response[pingv1.FailResponse], error) {
+					return nil, testCase.err
+				},
+			))
+			server := memhttptest.NewServer(t, mux)
+			for _, protocol := range protocols {
+				client := connect.NewClient[pingv1.FailRequest, pingv1.FailResponse](
+					server.Client(),
+					server.URL()+procedure,
+					protocol.opts...,
+				)
+				_, err := client.CallUnary(context.Background(), connect.NewRequest(&pingv1.FailRequest{}))
+				assert.Equal(t, connect.CodeOf(err), testCase.want, assert.Sprintf("%s: %v", protocol.name, err))
+			}
+		})
+	}
+}
+
+func TestHandlerWithRejectUnknownJSON(t *testing.T) {
+	t.Parallel()
+	const (
+		known   = `{"number": "42"}`
+		unknown = `{"number": "42", "extra": true}`
+	)
+	unary := func(t *testing.T, server *memhttp.Server, body, contentType string) (int, string) {
+		t.Helper()
+		request, err := http.NewRequestWithContext(
+			context.Background(),
+			http.MethodPost,
+			server.URL()+pingv1connect.PingServicePingProcedure,
+			strings.NewReader(body),
+		)
+		assert.Nil(t, err)
+		request.Header.Set("Content-Type", contentType)
+		response, err := server.Client().Do(request)
+		assert.Nil(t, err)
+		defer response.Body.Close()
+		if response.StatusCode == http.StatusOK {
+			return response.StatusCode, ""
+		}
+		var wireError struct {
+			Code string `json:"code"`
+		}
+		assert.Nil(t, json.NewDecoder(response.Body).Decode(&wireError))
+		return response.StatusCode, wireError.Code
+	}
+	stream := func(t *testing.T, server *memhttp.Server, body string) connect.Code {
+		t.Helper()
+		envelope := make([]byte, 5, 5+len(body))
+		binary.BigEndian.PutUint32(envelope[1:], uint32(len(body)))
+		envelope = append(envelope, body...)
+		request, err := http.NewRequestWithContext(
+			context.Background(),
+			http.MethodPost,
+			server.URL()+pingv1connect.PingServiceCountUpProcedure,
+			bytes.NewReader(envelope),
+		)
+		assert.Nil(t, err)
+		request.Header.Set("Content-Type", "application/connect+json")
+		response, err := server.Client().Do(request)
+		assert.Nil(t, err)
+		defer response.Body.Close()
+		assert.Equal(t, response.StatusCode, http.StatusOK)
+		raw, err := io.ReadAll(response.Body)
+		assert.Nil(t, err)
+		// The end-of-stream message is last; anything before it is a response.
+		var endStream struct {
+			Error *struct {
+				Code string `json:"code"`
+			} `json:"error"`
+		}
+		for len(raw) >= 5 {
+			size := binary.BigEndian.Uint32(raw[1:5])
+			flags, payload := raw[0], raw[5:5+size]
+			raw = raw[5+size:]
+			if flags&0b00000010 != 0 {
+				assert.Nil(t, json.Unmarshal(payload, &endStream))
+			}
+		}
+		if endStream.Error == nil {
+			return 0
+		}
+		var code connect.Code
+		assert.Nil(t, code.UnmarshalText([]byte(endStream.Error.Code)))
+		return code
+	}
+	t.Run("default", func(t *testing.T) {
+		t.Parallel()
+		mux := http.NewServeMux()
+		mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}))
+		server := memhttptest.NewServer(t, mux)
+		status, _ := unary(t, server, unknown, "application/json")
+		assert.Equal(t, status, http.StatusOK)
+		assert.Equal(t, stream(t, server, `{"number": "1", "extra": true}`), connect.Code(0))
+	})
+	for _, testCase := range []struct {
+		name    string
+		options []connect.HandlerOption
+	}{
+		{name: "reject", options: []connect.HandlerOption{connect.WithRejectUnknownJSON()}},
+		{name: "reject_stable", options: []connect.HandlerOption{connect.WithRejectUnknownJSON(), connect.WithStableJSON()}},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+			mux := http.NewServeMux()
+			mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}, testCase.options...))
+			server := memhttptest.NewServer(t, mux)
+			for _, contentType := range []string{"application/json", "application/json; charset=utf-8"} {
+				status, _ := unary(t, server, known, contentType)
+				assert.Equal(t, status, http.StatusOK)
+				status, code := unary(t, server, unknown, contentType)
+				assert.Equal(t, status, http.StatusBadRequest)
+				assert.Equal(t, code, connect.CodeInvalidArgument.String())
+			}
+			assert.Equal(t, stream(t, server, `{"number": "1"}`), connect.Code(0))
+			assert.Equal(t, stream(t, server, `{"number": "1", "extra": true}`), connect.CodeInvalidArgument)
+			// Binary Protobuf requests aren't affected.
+			client := pingv1connect.NewPingServiceClient(server.Client(), server.URL())
+			response, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Number: 42}))
+			assert.Nil(t, err)
+			assert.Equal(t, response.Msg.GetNumber(), 42)
+		})
+	}
+}
+
 func TestDynamicHandler(t *testing.T) {
 	t.Parallel()
 	initializer := func(spec connect.Spec, msg any) error {
@@ -534,3 +1795,196 @@ type successPingServer struct {
 func (successPingServer) Ping(context.Context, *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
 	return &connect.Response[pingv1.PingResponse]{}, nil
 }
+
+func TestHandlerUnaryContentLength(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}))
+	server := memhttptest.NewServer(t, mux)
+	// newClient returns a client that records the body and Content-Length of
+	// each response.
+	newClient := func(t *testing.T, opts ...connect.ClientOption) (pingv1connect.PingServiceClient, func() (int64, []string, int)) {
+		t.Helper()
+		var response *http.Response
+		var body bytes.Buffer
+		httpClient := httpClientFunc(func(request *http.Request) (*http.Response, error) {
+			res, err := server.Client().Do(request)
+			if err != nil {
+				return nil, err
+			}
+			response = res
+			res.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.TeeReader(res.Body, &body), res.Body}
+			return res, nil
+		})
+		client := pingv1connect.NewPingServiceClient(httpClient, server.URL(), opts...)
+		return client, func() (int64, []string, int) {
+			return response.ContentLength, response.Header.Values("Content-Length"), body.Len()
+		}
+	}
+	text := strings.Repeat("length ", 128)
+	for _, testCase := range []struct {
+		name string
+		opts []connect.ClientOption
+	}{
+		{name: "proto"},
+		{name: "json", opts: []connect.ClientOption{connect.WithProtoJSON()}},
+		{name: "gzip", opts: []connect.ClientOption{connect.WithSendGzip()}},
+		{name: "get", opts: []connect.ClientOption{connect.WithHTTPGet()}},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+			client, last := newClient(t, testCase.opts...)
+			_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Text: text}))
+			assert.Nil(t, err)
+			contentLength, header, bodyLength := last()
+			assert.Equal(t, contentLength, int64(bodyLength))
+			assert.Equal(t, header, []string{strconv.Itoa(bodyLength)})
+		})
+	}
+	t.Run("error", func(t *testing.T) {
+		t.Parallel()
+		client, last := newClient(t)
+		_, err := client.Fail(context.Background(), connect.NewRequest(&pingv1.FailRequest{Code: int32(connect.CodeInternal)}))
+		assert.Equal(t, connect.CodeOf(err), connect.CodeInternal)
+		contentLength, header, bodyLength := last()
+		assert.NotZero(t, bodyLength)
+		assert.Equal(t, contentLength, int64(bodyLength))
+		assert.Equal(t, header, []string{strconv.Itoa(bodyLength)})
+	})
+	t.Run("streaming", func(t *testing.T) {
+		t.Parallel()
+		client, last := newClient(t)
+		stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{Number: 3}))
+		assert.Nil(t, err)
+		for stream.Receive() { //nolint:revive
+		}
+		assert.Nil(t, stream.Err())
+		assert.Nil(t, stream.Close())
+		contentLength, header, _ := last()
+		assert.Equal(t, contentLength, int64(-1))
+		assert.Zero(t, len(header))
+	})
+}
+
+func TestHandlerWithCodecAliases(t *testing.T) {
+	t.Parallel()
+	codec := &countingJSONCodec{}
+	var peerCodecs sync.Map // content type -> codec name from Peer
+	server := &pluggablePingServer{
+		ping: func(_ context.Context, request *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+			peerCodecs.Store(request.Header().Get("Content-Type"), request.Peer().Codec)
+			return connect.NewResponse(&pingv1.PingResponse{Number: request.Msg.GetNumber()}), nil
+		},
+	}
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(
+		server,
+		connect.WithCodecAliases(codec, "vnd.acme+json"),
+	))
+	httpServer := memhttptest.NewServer(t, mux)
+	for _, testCase := range []struct {
+		name            string
+		contentType     string
+		wantContentType string
+		enveloped       bool
+	}{
+		{name: "connect", contentType: "application/json", wantContentType: "application/json"},
+		{name: "connect_alias", contentType: "application/vnd.acme+json", wantContentType: "application/json"},
+		{name: "grpc", contentType: "application/grpc+json", wantContentType: "application/grpc+json", enveloped: true},
+		{name: "grpc_alias", contentType: "application/grpc+vnd.acme+json", wantContentType: "application/grpc+json", enveloped: true},
+		{name: "grpcweb_alias", contentType: "application/grpc-web+vnd.acme+json", wantContentType: "application/grpc-web+json", enveloped: true},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			before := codec.unmarshals.Load()
+			body := []byte(`{"number": "42"}`)
+			if testCase.enveloped {
+				envelope := make([]byte, 5, 5+len(body))
+				binary.BigEndian.PutUint32(envelope[1:5], uint32(len(body)))
+				body = append(envelope, body...)
+			}
+			request, err := http.NewRequestWithContext(
+				context.Background(),
+				http.MethodPost,
+				httpServer.URL()+pingv1connect.PingServicePingProcedure,
+				bytes.NewReader(body),
+			)
+			assert.Nil(t, err)
+			request.Header.Set("Content-Type", testCase.contentType)
+			response, err := httpServer.Client().Do(request)
+			assert.Nil(t, err)
+			defer response.Body.Close()
+			assert.Equal(t, response.StatusCode, http.StatusOK)
+			assert.Equal(t, response.Header.Get("Content-Type"), testCase.wantContentType)
+			data, err := io.ReadAll(response.Body)
+			assert.Nil(t, err)
+			if testCase.enveloped {
+				assert.True(t, len(data) > 5)
+				assert.Equal(t, data[0], 0)
+				data = data[5 : 5+binary.BigEndian.Uint32(data[1:5])]
+			}
+			var msg pingv1.PingResponse
+			assert.Nil(t, protojson.Unmarshal(data, &msg))
+			assert.Equal(t, msg.GetNumber(), 42)
+			// The registered codec handled the request, whichever name the
+			// client used, and the handler saw its canonical name.
+			assert.Equal(t, codec.unmarshals.Load(), before+1)
+			peerCodec, ok := peerCodecs.Load(testCase.contentType)
+			assert.True(t, ok)
+			assert.Equal(t, peerCodec, any("json"))
+		})
+	}
+}
+
+// indentedJSONCodec is a Protobuf JSON codec that writes each message over
+// several lines.
+type indentedJSONCodec struct{}
+
+func (indentedJSONCodec) Name() string {
+	return "json"
+}
+
+func (indentedJSONCodec) Marshal(message any) ([]byte, error) {
+	protoMessage, ok := message.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("%T isn't a proto.Message", message)
+	}
+	return protojson.MarshalOptions{Multiline: true}.Marshal(protoMessage)
+}
+
+func (indentedJSONCodec) Unmarshal(data []byte, message any) error {
+	protoMessage, ok := message.(proto.Message)
+	if !ok {
+		return fmt.Errorf("%T isn't a proto.Message", message)
+	}
+	return protojson.Unmarshal(data, protoMessage)
+}
+
+// countingJSONCodec is a Protobuf JSON codec that counts the messages it
+// unmarshals.
+type countingJSONCodec struct {
+	unmarshals atomic.Int32
+}
+
+func (*countingJSONCodec) Name() string {
+	return "json"
+}
+
+func (*countingJSONCodec) Marshal(message any) ([]byte, error) {
+	protoMessage, ok := message.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("%T isn't a proto.Message", message)
+	}
+	return protojson.Marshal(protoMessage)
+}
+
+func (c *countingJSONCodec) Unmarshal(data []byte, message any) error {
+	protoMessage, ok := message.(proto.Message)
+	if !ok {
+		return fmt.Errorf("%T isn't a proto.Message", message)
+	}
+	c.unmarshals.Add(1)
+	return protojson.Unmarshal(data, protoMessage)
+}
@@ -91,7 +91,8 @@ func (c *ClientStream[Req]) Conn() StreamingHandlerConn {
 // It's constructed as part of [Handler] invocation, but doesn't currently have
 // an exported constructor.
 type ServerStream[Res any] struct {
-	conn StreamingHandlerConn
+	conn  StreamingHandlerConn
+	flush func() error
 }
 
 // ResponseHeader returns the response headers. Headers are sent with the first
@@ -114,6 +115,16 @@ func (s *ServerStream[Res]) ResponseTrailer() http.Header {
 
 // Send a message to the client. The first call to Send also sends the response
 // headers.
+//
+// Once the client disconnects, including by resetting an HTTP/2 stream, or the
+// RPC's deadline passes, Send returns an error with [CodeCanceled] or
+// [CodeDeadlineExceeded] without writing anything. Handlers producing an
+// unbounded stream should stop when Send fails.
+//
+// By default, each message is flushed to the client before Send returns; see
+// [WithAutoFlush] to batch them instead. Over HTTP/2, a client that stops
+// reading exhausts the stream's flow control window, and Send blocks until it
+// catches up.
 func (s *ServerStream[Res]) Send(msg *Res) error {
 	if msg == nil {
 		return s.conn.Send(nil)
@@ -121,6 +132,16 @@ func (s *ServerStream[Res]) Send(msg *Res) error {
 	return s.conn.Send(msg)
 }
 
+// Flush sends any buffered messages to the client. It's only needed when
+// auto-flush is disabled with [WithAutoFlush]: otherwise, Send flushes each
+// message itself. Returning from the handler always flushes.
+func (s *ServerStream[Res]) Flush() error {
+	if s.flush == nil {
+		return nil
+	}
+	return s.flush()
+}
+
 // Conn exposes the underlying StreamingHandlerConn. This may be useful if
 // you'd prefer to wrap the connection in a different high-level API.
 func (s *ServerStream[Res]) Conn() StreamingHandlerConn {
@@ -134,6 +155,7 @@ func (s *ServerStream[Res]) Conn() StreamingHandlerConn {
 type BidiStream[Req, Res any] struct {
 	conn        StreamingHandlerConn
 	initializer maybeInitializer
+	flush       func() error
 }
 
 // Spec returns the specification for the RPC.
@@ -191,6 +213,16 @@ func (b *BidiStream[Req, Res]) Send(msg *Res) error {
 	return b.conn.Send(msg)
 }
 
+// Flush sends any buffered messages to the client. As with
+// [ServerStream.Flush], it's only needed when auto-flush is disabled with
+// [WithAutoFlush].
+func (b *BidiStream[Req, Res]) Flush() error {
+	if b.flush == nil {
+		return nil
+	}
+	return b.flush()
+}
+
 // Conn exposes the underlying StreamingHandlerConn. This may be useful if
 // you'd prefer to wrap the connection in a different high-level API.
 func (b *BidiStream[Req, Res]) Conn() StreamingHandlerConn {
@@ -17,6 +17,7 @@ package connect
 import (
 	"encoding/base64"
 	"net/http"
+	"strings"
 )
 
 var (
@@ -37,6 +38,7 @@ var (
 		connectStreamingHeaderAcceptCompression: {},
 		connectHeaderTimeout:                    {},
 		connectHeaderProtocolVersion:            {},
+		connectHeaderKeepalive:                  {},
 		// gRPC headers.
 		grpcHeaderCompression:       {},
 		grpcHeaderAcceptCompression: {},
@@ -57,20 +59,22 @@ func EncodeBinaryHeader(data []byte) string {
 }
 
 // DecodeBinaryHeader base64-decodes the data. It can decode padded or unpadded
-// values. Following usual HTTP semantics, multiple base64-encoded values may
-// be joined with a comma. When receiving such comma-separated values, split
-// them with [strings.Split] before calling DecodeBinaryHeader.
+// values, and to tolerate peers that don't follow the gRPC specification
+// exactly, it also accepts the URL-safe base64 alphabet. Following usual HTTP
+// semantics, multiple base64-encoded values may be joined with a comma. When
+// receiving such comma-separated values, split them with [strings.Split]
+// before calling DecodeBinaryHeader.
 //
 // Binary headers sent using the Connect, gRPC, and gRPC-Web protocols have
 // keys ending in "-Bin".
 func DecodeBinaryHeader(data string) ([]byte, error) {
-	if len(data)%4 != 0 {
-		// Data definitely isn't padded.
-		return base64.RawStdEncoding.DecodeString(data)
+	// Padding carries no information, so dropping it lets one decoder handle
+	// padded and unpadded values alike.
+	data = strings.TrimRight(data, "=")
+	if strings.ContainsAny(data, "-_") {
+		return base64.RawURLEncoding.DecodeString(data)
 	}
-	// Either the data was padded, or padding wasn't necessary. In both cases,
-	// the padding-aware decoder works.
-	return base64.StdEncoding.DecodeString(data)
+	return base64.RawStdEncoding.DecodeString(data)
 }
 
 func mergeHeaders(into, from http.Header) {
@@ -16,7 +16,9 @@ package connect
 
 import (
 	"bytes"
+	"encoding/base64"
 	"net/http"
+	"strings"
 	"testing"
 	"testing/quick"
 
@@ -39,6 +41,33 @@ func TestBinaryEncodingQuick(t *testing.T) {
 	}
 }
 
+func TestBinaryEncodingPadding(t *testing.T) {
+	t.Parallel()
+	// Each length leaves a different remainder, so the padded encodings end with
+	// zero, two, or one "=". The high bytes exercise the characters that differ
+	// between the standard and URL-safe alphabets.
+	for size := range 7 {
+		binary := bytes.Repeat([]byte{0xfb, 0xff, 0xbf}, 3)[:size]
+		encoded := EncodeBinaryHeader(binary)
+		assert.False(t, strings.HasSuffix(encoded, "="), assert.Sprintf("size %d: emitted padding", size))
+		assert.Equal(t, encoded, base64.RawStdEncoding.EncodeToString(binary))
+		for _, input := range []string{
+			encoded,
+			base64.StdEncoding.EncodeToString(binary),
+			base64.RawURLEncoding.EncodeToString(binary),
+			base64.URLEncoding.EncodeToString(binary),
+		} {
+			decoded, err := DecodeBinaryHeader(input)
+			assert.Nil(t, err, assert.Sprintf("size %d: decode %q", size, input))
+			assert.Equal(t, decoded, binary, assert.Sprintf("size %d: decode %q", size, input))
+		}
+	}
+	for _, invalid := range []string{"a", "a===", "ab!c", "+-__"} {
+		_, err := DecodeBinaryHeader(invalid)
+		assert.NotNil(t, err, assert.Sprintf("decode %q", invalid))
+	}
+}
+
 func TestHeaderMerge(t *testing.T) {
 	t.Parallel()
 	header := http.Header{
@@ -0,0 +1,116 @@
+// Copyright 2021-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// defaultHTTP2ReadIdleTimeout is how long a transport from
+// [NewHTTP2Transport] waits for frames before health-checking a connection.
+const defaultHTTP2ReadIdleTimeout = 30 * time.Second
+
+// HTTP2Settings tunes the transports built by [NewHTTP2Transport]. The zero
+// value is ready to use.
+//
+// HTTP/2 settings live in the transport rather than in a [ClientOption]
+// because connect clients accept any [HTTPClient], and several clients
+// typically share one transport (and so one pool of connections). The flow
+// control windows and the maximum number of concurrent streams are among the
+// settings servers advertise: clients can't raise them, only decide whether
+// to respect the server's stream limit. On Go 1.24 and later, set the window
+// sizes with the HTTP2 field of a [net/http.Transport] instead.
+type HTTP2Settings struct {
+	// AllowHTTP makes the transport speak HTTP/2 without TLS (h2c) to URLs
+	// with the http scheme. The transport assumes the server supports HTTP/2
+	// and doesn't negotiate an upgrade. The http2 package can't tell the
+	// schemes apart when dialing, so such a transport dials every connection
+	// without TLS: use a separate transport for https URLs.
+	AllowHTTP bool
+	// TLSClientConfig configures TLS connections. If nil, the default
+	// configuration is used. It's ignored if AllowHTTP is set.
+	TLSClientConfig *tls.Config
+	// ReadIdleTimeout is how long a connection may go without receiving any
+	// frames before the transport sends a ping to check its health. Long-lived
+	// streams are often quiet, so if zero, it defaults to 30 seconds: dead
+	// connections are detected rather than hanging streams forever. A negative
+	// value disables health checks.
+	//
+	// Health checks double as keepalives: on quiet streams, set it below the
+	// idle timeout of any NAT gateways or load balancers between client and
+	// server so that they don't drop the connection. Streams on connections
+	// that fail health checks end with [CodeUnavailable]. To keep streams alive
+	// whatever the transport, see [WithStreamKeepalive].
+	ReadIdleTimeout time.Duration
+	// PingTimeout is how long the transport waits for a reply to a health
+	// check before closing the connection. If zero, the http2 package's
+	// default of 15 seconds applies.
+	PingTimeout time.Duration
+	// WriteByteTimeout closes connections that accept no data for this long
+	// while the transport has data to write. If zero, there's no timeout.
+	WriteByteTimeout time.Duration
+	// IdleConnTimeout closes connections with no active streams after this
+	// long. If zero, idle connections are kept open.
+	IdleConnTimeout time.Duration
+	// MaxReadFrameSize is the largest frame the transport asks servers to
+	// send, between 16KiB and 16MiB. If zero, the http2 package's default
+	// applies.
+	MaxReadFrameSize uint32
+	// StrictMaxConcurrentStreams queues new streams once a connection reaches
+	// the server's limit on concurrent streams, rather than opening another
+	// connection.
+	StrictMaxConcurrentStreams bool
+}
+
+// NewHTTP2Transport builds an HTTP/2 transport suited to connect clients,
+// particularly those using streaming RPCs: it supports full-duplex
+// bidirectional streams and health-checks idle connections. Use it as the
+// Transport of an [net/http.Client]:
+//
+//	client := &http.Client{Transport: connect.NewHTTP2Transport(connect.HTTP2Settings{})}
+//
+// Callers may further configure the returned transport before using it.
+func NewHTTP2Transport(settings HTTP2Settings) *http2.Transport {
+	transport := &http2.Transport{
+		AllowHTTP:                  settings.AllowHTTP,
+		TLSClientConfig:            settings.TLSClientConfig,
+		ReadIdleTimeout:            settings.ReadIdleTimeout,
+		PingTimeout:                settings.PingTimeout,
+		WriteByteTimeout:           settings.WriteByteTimeout,
+		IdleConnTimeout:            settings.IdleConnTimeout,
+		MaxReadFrameSize:           settings.MaxReadFrameSize,
+		StrictMaxConcurrentStreams: settings.StrictMaxConcurrentStreams,
+	}
+	switch {
+	case transport.ReadIdleTimeout == 0:
+		transport.ReadIdleTimeout = defaultHTTP2ReadIdleTimeout
+	case transport.ReadIdleTimeout < 0:
+		transport.ReadIdleTimeout = 0
+	}
+	if settings.AllowHTTP {
+		// The http2 package dials TLS whatever the URL's scheme, so h2c needs a
+		// dialer that doesn't.
+		transport.DialTLSContext = func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, addr)
+		}
+	}
+	return transport
+}
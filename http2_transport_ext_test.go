@@ -0,0 +1,295 @@
+// Copyright 2021-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	connect "connectrpc.com/connect"
+	"connectrpc.com/connect/internal/assert"
+	pingv1 "connectrpc.com/connect/internal/gen/connect/ping/v1"
+	"connectrpc.com/connect/internal/gen/connect/ping/v1/pingv1connect"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+func TestNewHTTP2Transport(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}))
+	// Bidirectional streaming needs HTTP/2, so reject anything else.
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 2 {
+			http.Error(w, "HTTP/2 required", http.StatusHTTPVersionNotSupported)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+	newTLSServer := func(t *testing.T) (*httptest.Server, connect.HTTP2Settings) {
+		t.Helper()
+		server := httptest.NewUnstartedServer(handler)
+		server.EnableHTTP2 = true
+		server.StartTLS()
+		t.Cleanup(server.Close)
+		tlsConfig := server.Client().Transport.(*http.Transport).TLSClientConfig //nolint:forcetypeassert
+		return server, connect.HTTP2Settings{TLSClientConfig: tlsConfig}
+	}
+	newH2CServer := func(t *testing.T) (*httptest.Server, connect.HTTP2Settings) {
+		t.Helper()
+		server := httptest.NewServer(h2c.NewHandler(handler, &http2.Server{}))
+		t.Cleanup(server.Close)
+		return server, connect.HTTP2Settings{AllowHTTP: true}
+	}
+	for _, testCase := range []struct {
+		name      string
+		newServer func(*testing.T) (*httptest.Server, connect.HTTP2Settings)
+	}{
+		{name: "tls", newServer: newTLSServer},
+		{name: "h2c", newServer: newH2CServer},
+	} {
+		for _, protocol := range []struct {
+			name string
+			opts []connect.ClientOption
+		}{
+			{name: "connect"},
+			{name: "grpc", opts: []connect.ClientOption{connect.WithGRPC()}},
+			{name: "grpcweb", opts: []connect.ClientOption{connect.WithGRPCWeb()}},
+		} {
+			t.Run(testCase.name+"/"+protocol.name, func(t *testing.T) {
+				t.Parallel()
+				server, settings := testCase.newServer(t)
+				settings.StrictMaxConcurrentStreams = true
+				settings.IdleConnTimeout = time.Minute
+				transport := connect.NewHTTP2Transport(settings)
+				t.Cleanup(transport.CloseIdleConnections)
+				client := pingv1connect.NewPingServiceClient(
+					&http.Client{Transport: transport},
+					server.URL,
+					protocol.opts...,
+				)
+				stream := client.CumSum(context.Background())
+				// Receive each sum before sending the next number, which only works if
+				// the stream is full-duplex.
+				var want int64
+				for i := int64(1); i <= 3; i++ {
+					assert.Nil(t, stream.Send(&pingv1.CumSumRequest{Number: i}))
+					want += i
+					msg, err := stream.Receive()
+					assert.Nil(t, err)
+					assert.Equal(t, msg.GetSum(), want)
+				}
+				assert.Nil(t, stream.CloseRequest())
+				_, err := stream.Receive()
+				assert.True(t, errors.Is(err, io.EOF))
+				assert.Nil(t, stream.CloseResponse())
+			})
+		}
+	}
+	t.Run("defaults", func(t *testing.T) {
+		t.Parallel()
+		transport := connect.NewHTTP2Transport(connect.HTTP2Settings{})
+		assert.Equal(t, transport.ReadIdleTimeout, 30*time.Second)
+		assert.Nil(t, transport.DialTLSContext)
+		transport = connect.NewHTTP2Transport(connect.HTTP2Settings{ReadIdleTimeout: -1})
+		assert.Zero(t, transport.ReadIdleTimeout)
+		transport = connect.NewHTTP2Transport(connect.HTTP2Settings{ReadIdleTimeout: time.Second})
+		assert.Equal(t, transport.ReadIdleTimeout, time.Second)
+	})
+}
+
+func TestHTTP2TransportKeepalive(t *testing.T) {
+	t.Parallel()
+	const (
+		natTimeout = 300 * time.Millisecond
+		idle       = 3 * natTimeout
+	)
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}))
+	server := httptest.NewServer(h2c.NewHandler(mux, &http2.Server{}))
+	t.Cleanup(server.Close)
+	keepalive := connect.HTTP2Settings{
+		AllowHTTP:       true,
+		ReadIdleTimeout: natTimeout / 3,
+		PingTimeout:     natTimeout / 3,
+	}
+	// cumSum sends a number on the stream and checks the running total.
+	cumSum := func(t *testing.T, stream *connect.BidiStreamForClient[pingv1.CumSumRequest, pingv1.CumSumResponse], number, want int64) error {
+		t.Helper()
+		if err := stream.Send(&pingv1.CumSumRequest{Number: number}); errors.Is(err, io.EOF) {
+			// The stream has failed, and Receive reports why.
+			_, err = stream.Receive()
+			return err
+		} else if err != nil {
+			return err
+		}
+		msg, err := stream.Receive()
+		if err != nil {
+			return err
+		}
+		assert.Equal(t, msg.GetSum(), want)
+		return nil
+	}
+	newStream := func(t *testing.T, proxy *natProxy, settings connect.HTTP2Settings) *connect.BidiStreamForClient[pingv1.CumSumRequest, pingv1.CumSumResponse] {
+		t.Helper()
+		transport := connect.NewHTTP2Transport(settings)
+		t.Cleanup(transport.CloseIdleConnections)
+		client := pingv1connect.NewPingServiceClient(&http.Client{Transport: transport}, proxy.URL())
+		stream := client.CumSum(context.Background())
+		t.Cleanup(func() {
+			_ = stream.CloseRequest()
+			_ = stream.CloseResponse()
+		})
+		assert.Nil(t, cumSum(t, stream, 1, 1))
+		return stream
+	}
+	t.Run("idle_stream_survives", func(t *testing.T) {
+		t.Parallel()
+		proxy := newNATProxy(t, server.Listener.Addr().String(), natTimeout)
+		stream := newStream(t, proxy, keepalive)
+		time.Sleep(idle)
+		assert.Nil(t, cumSum(t, stream, 2, 3))
+		assert.Zero(t, proxy.Dropped())
+	})
+	t.Run("idle_stream_dropped_without_keepalive", func(t *testing.T) {
+		t.Parallel()
+		proxy := newNATProxy(t, server.Listener.Addr().String(), natTimeout)
+		stream := newStream(t, proxy, connect.HTTP2Settings{AllowHTTP: true, ReadIdleTimeout: -1})
+		time.Sleep(idle)
+		err := cumSum(t, stream, 2, 3)
+		assert.NotNil(t, err)
+		// The response ends mid-stream, which is a protocol error rather than a
+		// lost connection.
+		assert.True(t, strings.Contains(err.Error(), "incomplete envelope"))
+		assert.NotZero(t, proxy.Dropped())
+	})
+	t.Run("dead_peer_detected", func(t *testing.T) {
+		t.Parallel()
+		proxy := newNATProxy(t, server.Listener.Addr().String(), 0)
+		stream := newStream(t, proxy, keepalive)
+		// The peer disappears without closing the connection, so only pings can
+		// tell that it's gone.
+		proxy.Blackhole()
+		start := time.Now()
+		_, err := stream.Receive()
+		assert.NotNil(t, err)
+		assert.Equal(t, connect.CodeOf(err), connect.CodeUnavailable)
+		assert.True(t, time.Since(start) < 10*time.Second)
+	})
+}
+
+// natProxy forwards TCP connections to a backend, imitating a NAT gateway:
+// connections idle for longer than a timeout are dropped.
+type natProxy struct {
+	listener  net.Listener
+	dropped   atomic.Int32
+	blackhole atomic.Bool
+}
+
+func newNATProxy(t *testing.T, backend string, idleTimeout time.Duration) *natProxy {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	proxy := &natProxy{listener: listener}
+	var wg sync.WaitGroup
+	t.Cleanup(func() {
+		_ = listener.Close()
+		wg.Wait()
+	})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				proxy.forward(t, conn, backend, idleTimeout)
+			}()
+		}
+	}()
+	return proxy
+}
+
+func (p *natProxy) URL() string {
+	return "http://" + p.listener.Addr().String()
+}
+
+// Dropped returns the number of connections dropped for being idle.
+func (p *natProxy) Dropped() int32 {
+	return p.dropped.Load()
+}
+
+// Blackhole silently discards all further traffic, in both directions.
+func (p *natProxy) Blackhole() {
+	p.blackhole.Store(true)
+}
+
+func (p *natProxy) forward(t *testing.T, client net.Conn, backend string, idleTimeout time.Duration) {
+	t.Helper()
+	defer client.Close()
+	server, err := net.Dial("tcp", backend)
+	if err != nil {
+		return
+	}
+	defer server.Close()
+	var lastActive atomic.Int64
+	lastActive.Store(time.Now().UnixNano())
+	done := make(chan struct{}, 2)
+	pipe := func(dst, src net.Conn) {
+		defer func() { done <- struct{}{} }()
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := src.Read(buf)
+			if n > 0 && !p.blackhole.Load() {
+				lastActive.Store(time.Now().UnixNano())
+				if _, err := dst.Write(buf[:n]); err != nil {
+					return
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}
+	go pipe(server, client)
+	go pipe(client, server)
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			idle := time.Since(time.Unix(0, lastActive.Load()))
+			if idleTimeout > 0 && idle > idleTimeout {
+				p.dropped.Add(1)
+				return
+			}
+		}
+	}
+}
@@ -48,7 +48,13 @@ type Interceptor interface {
 }
 
 // UnaryInterceptorFunc is a simple Interceptor implementation that only
-// wraps unary RPCs. It has no effect on streaming RPCs.
+// wraps unary RPCs. It has no effect on streaming RPCs: its
+// WrapStreamingClient and WrapStreamingHandler methods return the next
+// function unchanged, so streams pass through it with no overhead.
+//
+// As with any interceptor, the same function wraps unary RPCs on both clients
+// and handlers. Interceptors that only make sense on one side should check
+// the IsClient field of the request's [Spec].
 type UnaryInterceptorFunc func(UnaryFunc) UnaryFunc
 
 // WrapUnary implements [Interceptor] by applying the interceptor function.
@@ -64,6 +70,76 @@ func (f UnaryInterceptorFunc) WrapStreamingHandler(next StreamingHandlerFunc) St
 	return next
 }
 
+// Interceptors composes multiple interceptors into one, which applies them
+// in the same order as [WithInterceptors]: the first interceptor is the
+// outermost layer of the onion. It acts first on the context and request (and,
+// for streams, on sent messages), and last on the response, error, and
+// received messages. Nil interceptors are ignored.
+//
+// Composed interceptors nest, so
+//
+//	WithInterceptors(A, Interceptors(B, C), D) == WithInterceptors(A, B, C, D)
+//
+// This makes it easy to bundle interceptors that must run in a fixed order,
+// such as authentication before authorization, and pass them around as one.
+func Interceptors(interceptors ...Interceptor) Interceptor {
+	return newChain(interceptors)
+}
+
+// InterceptorFor applies inner only to RPCs whose [Spec] matches the
+// predicate, such as authorization for just the mutating procedures of a
+// service. Other RPCs pass straight through. The predicate runs once per call,
+// on clients before the call starts and on handlers before the interceptor
+// would act, and must be safe to call concurrently.
+//
+//	mutating := func(spec connect.Spec) bool {
+//		return spec.IdempotencyLevel != connect.IdempotencyNoSideEffects
+//	}
+//	connect.WithInterceptors(connect.InterceptorFor(mutating, auth))
+func InterceptorFor(predicate func(Spec) bool, inner Interceptor) Interceptor {
+	if inner == nil {
+		return newChain(nil)
+	}
+	return &conditionalInterceptor{predicate: predicate, inner: inner}
+}
+
+// conditionalInterceptor wraps each function twice, with and without the
+// inner interceptor, and picks one per call.
+type conditionalInterceptor struct {
+	predicate func(Spec) bool
+	inner     Interceptor
+}
+
+func (c *conditionalInterceptor) WrapUnary(next UnaryFunc) UnaryFunc {
+	wrapped := c.inner.WrapUnary(next)
+	return func(ctx context.Context, request AnyRequest) (AnyResponse, error) {
+		if c.predicate(request.Spec()) {
+			return wrapped(ctx, request)
+		}
+		return next(ctx, request)
+	}
+}
+
+func (c *conditionalInterceptor) WrapStreamingClient(next StreamingClientFunc) StreamingClientFunc {
+	wrapped := c.inner.WrapStreamingClient(next)
+	return func(ctx context.Context, spec Spec) StreamingClientConn {
+		if c.predicate(spec) {
+			return wrapped(ctx, spec)
+		}
+		return next(ctx, spec)
+	}
+}
+
+func (c *conditionalInterceptor) WrapStreamingHandler(next StreamingHandlerFunc) StreamingHandlerFunc {
+	wrapped := c.inner.WrapStreamingHandler(next)
+	return func(ctx context.Context, conn StreamingHandlerConn) error {
+		if c.predicate(conn.Spec()) {
+			return wrapped(ctx, conn)
+		}
+		return next(ctx, conn)
+	}
+}
+
 // A chain composes multiple interceptors into one.
 type chain struct {
 	interceptors []Interceptor
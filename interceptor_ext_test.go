@@ -16,8 +16,12 @@ package connect_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"reflect"
+	"sync"
 	"sync/atomic"
 	"testing"
 
@@ -189,6 +193,48 @@ func TestEmptyUnaryInterceptorFunc(t *testing.T) {
 	assert.Nil(t, countUpStream.Close())
 }
 
+func TestUnaryInterceptorFunc(t *testing.T) {
+	t.Parallel()
+	var calls atomic.Int32
+	interceptor := connect.UnaryInterceptorFunc(func(next connect.UnaryFunc) connect.UnaryFunc {
+		return func(ctx context.Context, request connect.AnyRequest) (connect.AnyResponse, error) {
+			calls.Add(1)
+			return next(ctx, request)
+		}
+	})
+	t.Run("streaming_identity", func(t *testing.T) {
+		t.Parallel()
+		clientFunc := connect.StreamingClientFunc(func(context.Context, connect.Spec) connect.StreamingClientConn {
+			return nil
+		})
+		handlerFunc := connect.StreamingHandlerFunc(func(context.Context, connect.StreamingHandlerConn) error {
+			return nil
+		})
+		assert.Equal(
+			t,
+			reflect.ValueOf(interceptor.WrapStreamingClient(clientFunc)).Pointer(),
+			reflect.ValueOf(clientFunc).Pointer(),
+		)
+		assert.Equal(
+			t,
+			reflect.ValueOf(interceptor.WrapStreamingHandler(handlerFunc)).Pointer(),
+			reflect.ValueOf(handlerFunc).Pointer(),
+		)
+	})
+	t.Run("unary_wrapped", func(t *testing.T) {
+		t.Parallel()
+		mux := http.NewServeMux()
+		mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}, connect.WithInterceptors(interceptor)))
+		server := memhttptest.NewServer(t, mux)
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL(), connect.WithInterceptors(interceptor))
+		before := calls.Load()
+		_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+		assert.Nil(t, err)
+		// Once on the client and once on the handler.
+		assert.Equal(t, calls.Load()-before, 2)
+	})
+}
+
 func TestInterceptorFuncAccessingHTTPMethod(t *testing.T) {
 	t.Parallel()
 	clientChecker := &httpMethodChecker{client: true}
@@ -235,6 +281,363 @@ func TestInterceptorFuncAccessingHTTPMethod(t *testing.T) {
 	assert.Equal(t, int32(2), handlerChecker.count.Load())
 }
 
+func TestInterceptorPeerProtocolAndCodec(t *testing.T) {
+	t.Parallel()
+	for _, protocol := range []struct {
+		name     string
+		protocol string
+		options  []connect.ClientOption
+	}{
+		{name: "connect", protocol: connect.ProtocolConnect},
+		{name: "grpc", protocol: connect.ProtocolGRPC, options: []connect.ClientOption{connect.WithGRPC()}},
+		{name: "grpcweb", protocol: connect.ProtocolGRPCWeb, options: []connect.ClientOption{connect.WithGRPCWeb()}},
+	} {
+		for _, codec := range []struct {
+			name    string
+			options []connect.ClientOption
+		}{
+			{name: "proto"},
+			{name: "json", options: []connect.ClientOption{connect.WithProtoJSON()}},
+		} {
+			t.Run(protocol.name+"_"+codec.name, func(t *testing.T) {
+				t.Parallel()
+				clientRecorder, handlerRecorder := &peerRecorder{}, &peerRecorder{}
+				mux := http.NewServeMux()
+				mux.Handle(pingv1connect.NewPingServiceHandler(
+					pingServer{},
+					connect.WithInterceptors(handlerRecorder),
+				))
+				server := memhttptest.NewServer(t, mux)
+				client := pingv1connect.NewPingServiceClient(
+					server.Client(),
+					server.URL(),
+					connect.WithClientOptions(protocol.options...),
+					connect.WithClientOptions(codec.options...),
+					connect.WithInterceptors(clientRecorder),
+				)
+				_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+				assert.Nil(t, err)
+				stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{Number: 1}))
+				assert.Nil(t, err)
+				for stream.Receive() {
+					assert.NotNil(t, stream.Msg())
+				}
+				assert.Nil(t, stream.Close())
+				for _, recorder := range []*peerRecorder{clientRecorder, handlerRecorder} {
+					peers := recorder.Peers()
+					assert.Equal(t, len(peers), 2) // one unary, one streaming
+					for _, peer := range peers {
+						assert.Equal(t, peer.Protocol, protocol.protocol)
+						assert.Equal(t, peer.Codec, codec.name)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestInterceptorPeerCompression(t *testing.T) {
+	t.Parallel()
+	for _, protocol := range []struct {
+		name    string
+		options []connect.ClientOption
+	}{
+		{name: "connect"},
+		{name: "grpc", options: []connect.ClientOption{connect.WithGRPC()}},
+		{name: "grpcweb", options: []connect.ClientOption{connect.WithGRPCWeb()}},
+	} {
+		for _, compression := range []struct {
+			name           string
+			options        []connect.ClientOption
+			handlerOptions []connect.HandlerOption
+			want           string
+		}{
+			{name: "gzip", options: []connect.ClientOption{connect.WithSendGzip()}, want: "gzip"},
+			{
+				name:    "identity",
+				options: []connect.ClientOption{connect.WithAcceptCompression("gzip", nil, nil)},
+				// net/http asks for gzip on its own, and transparently decompresses
+				// the response, so the handler must refuse it too.
+				handlerOptions: []connect.HandlerOption{connect.WithCompression("gzip", nil, nil)},
+			},
+		} {
+			t.Run(protocol.name+"_"+compression.name, func(t *testing.T) {
+				t.Parallel()
+				clientRecorder, handlerRecorder := &completedPeerRecorder{}, &completedPeerRecorder{}
+				mux := http.NewServeMux()
+				mux.Handle(pingv1connect.NewPingServiceHandler(
+					pingServer{},
+					connect.WithInterceptors(handlerRecorder),
+					connect.WithHandlerOptions(compression.handlerOptions...),
+				))
+				server := memhttptest.NewServer(t, mux)
+				client := pingv1connect.NewPingServiceClient(
+					server.Client(),
+					server.URL(),
+					connect.WithClientOptions(protocol.options...),
+					connect.WithClientOptions(compression.options...),
+					connect.WithInterceptors(clientRecorder),
+				)
+				_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Number: 42}))
+				assert.Nil(t, err)
+				stream := client.CumSum(context.Background())
+				assert.Nil(t, stream.Send(&pingv1.CumSumRequest{Number: 42}))
+				_, err = stream.Receive()
+				assert.Nil(t, err)
+				assert.Nil(t, stream.CloseRequest())
+				assert.Nil(t, stream.CloseResponse())
+				for _, recorder := range []*completedPeerRecorder{clientRecorder, handlerRecorder} {
+					peers := recorder.Peers()
+					assert.Equal(t, len(peers), 2) // one unary, one streaming
+					for _, peer := range peers {
+						assert.Equal(t, peer.RequestCompression, compression.want)
+						assert.Equal(t, peer.ResponseCompression, compression.want)
+					}
+				}
+			})
+		}
+	}
+	t.Run("before_response", func(t *testing.T) {
+		t.Parallel()
+		mux := http.NewServeMux()
+		mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}))
+		server := memhttptest.NewServer(t, mux)
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL(), connect.WithSendGzip())
+		stream := client.CumSum(context.Background())
+		conn, err := stream.Conn()
+		assert.Nil(t, err)
+		// Until the response headers arrive, the response compression isn't known.
+		assert.Equal(t, conn.Peer().RequestCompression, "gzip")
+		assert.Zero(t, conn.Peer().ResponseCompression)
+		assert.Nil(t, stream.Send(&pingv1.CumSumRequest{Number: 42}))
+		_, err = stream.Receive()
+		assert.Nil(t, err)
+		assert.Equal(t, conn.Peer().ResponseCompression, "gzip")
+		assert.Nil(t, stream.CloseRequest())
+		assert.Nil(t, stream.CloseResponse())
+	})
+}
+
+func TestInterceptorStreamMessageCounts(t *testing.T) {
+	t.Parallel()
+	for _, protocol := range []struct {
+		name    string
+		options []connect.ClientOption
+	}{
+		{name: "connect"},
+		{name: "grpc", options: []connect.ClientOption{connect.WithGRPC()}},
+		{name: "grpcweb", options: []connect.ClientOption{connect.WithGRPCWeb()}},
+	} {
+		t.Run(protocol.name, func(t *testing.T) {
+			t.Parallel()
+			clientRecorder, handlerRecorder := &messageCountRecorder{}, &messageCountRecorder{}
+			mux := http.NewServeMux()
+			// The recorders see conns wrapped by the inner interceptors, so
+			// MessageCounts has to unwrap them.
+			mux.Handle(pingv1connect.NewPingServiceHandler(
+				pingServer{},
+				connect.WithInterceptors(handlerRecorder),
+				connect.WithMaxStreamMessages(10, 10),
+			))
+			server := memhttptest.NewServer(t, mux)
+			client := pingv1connect.NewPingServiceClient(
+				server.Client(),
+				server.URL(),
+				connect.WithClientOptions(protocol.options...),
+				connect.WithInterceptors(clientRecorder),
+				connect.WithMaxStreamMessages(10, 10),
+			)
+			stream := client.CumSum(context.Background())
+			// Read the counts concurrently with the stream, as a metrics
+			// interceptor might. The race detector checks that this is safe.
+			done := make(chan struct{})
+			var polling sync.WaitGroup
+			polling.Add(1)
+			go func() {
+				defer polling.Done()
+				for {
+					select {
+					case <-done:
+						return
+					default:
+						clientRecorder.Counts()
+					}
+				}
+			}()
+			const messages = 3
+			for i := range messages {
+				assert.Nil(t, stream.Send(&pingv1.CumSumRequest{Number: int64(i)}))
+				assert.Equal(t, clientRecorder.Counts(), [2]int{i + 1, i})
+				_, err := stream.Receive()
+				assert.Nil(t, err)
+				assert.Equal(t, clientRecorder.Counts(), [2]int{i + 1, i + 1})
+			}
+			assert.Nil(t, stream.CloseRequest())
+			_, err := stream.Receive()
+			assert.True(t, errors.Is(err, io.EOF))
+			assert.Nil(t, stream.CloseResponse())
+			close(done)
+			polling.Wait()
+			assert.Equal(t, clientRecorder.Counts(), [2]int{messages, messages})
+			assert.Equal(t, handlerRecorder.Counts(), [2]int{messages, messages})
+		})
+	}
+}
+
+func TestInterceptorsOrdering(t *testing.T) {
+	t.Parallel()
+	// run sends one unary or bidi RPC through interceptors A, B, C, and D,
+	// nesting B and C inside a composed interceptor, and returns what the
+	// client and handler interceptors observed.
+	run := func(t *testing.T, call func(pingv1connect.PingServiceClient)) (client, handler []string) {
+		t.Helper()
+		var clientLog, handlerLog orderLog
+		onion := func(log *orderLog) connect.Option {
+			return connect.WithInterceptors(
+				&orderRecorder{name: "A", log: log},
+				connect.Interceptors(
+					&orderRecorder{name: "B", log: log},
+					nil,
+					connect.Interceptors(&orderRecorder{name: "C", log: log}),
+				),
+				&orderRecorder{name: "D", log: log},
+			)
+		}
+		mux := http.NewServeMux()
+		mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}, onion(&handlerLog)))
+		server := memhttptest.NewServer(t, mux)
+		call(pingv1connect.NewPingServiceClient(server.Client(), server.URL(), onion(&clientLog)))
+		return clientLog.events(), handlerLog.events()
+	}
+	t.Run("unary", func(t *testing.T) {
+		t.Parallel()
+		client, handler := run(t, func(client pingv1connect.PingServiceClient) {
+			_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Number: 1}))
+			assert.Nil(t, err)
+		})
+		want := []string{
+			"A request", "B request", "C request", "D request",
+			"D response", "C response", "B response", "A response",
+		}
+		assert.Equal(t, client, want)
+		assert.Equal(t, handler, want)
+	})
+	t.Run("stream", func(t *testing.T) {
+		t.Parallel()
+		client, handler := run(t, func(client pingv1connect.PingServiceClient) {
+			stream := client.CumSum(context.Background())
+			assert.Nil(t, stream.Send(&pingv1.CumSumRequest{Number: 1}))
+			_, err := stream.Receive()
+			assert.Nil(t, err)
+			assert.Nil(t, stream.CloseRequest())
+			_, err = stream.Receive()
+			assert.True(t, errors.Is(err, io.EOF))
+			assert.Nil(t, stream.CloseResponse())
+		})
+		// Clients send requests and receive responses, so the outermost
+		// interceptor sends first and receives last.
+		assert.Equal(t, client, []string{
+			"A open", "B open", "C open", "D open",
+			"A send", "B send", "C send", "D send",
+			"D receive", "C receive", "B receive", "A receive",
+		})
+		// Handlers receive requests and send responses, so it's the reverse.
+		assert.Equal(t, handler, []string{
+			"A request", "B request", "C request", "D request",
+			"A receive", "B receive", "C receive", "D receive",
+			"D send", "C send", "B send", "A send",
+			"D return", "C return", "B return", "A return",
+		})
+	})
+}
+
+func TestInterceptorFor(t *testing.T) {
+	t.Parallel()
+	// Only the streaming procedures that take client messages match.
+	matches := func(spec connect.Spec) bool {
+		return spec.Procedure == pingv1connect.PingServiceSumProcedure ||
+			spec.Procedure == pingv1connect.PingServiceCumSumProcedure
+	}
+	var clientLog, handlerLog orderLog
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(
+		pingServer{},
+		connect.WithInterceptors(connect.InterceptorFor(matches, &orderRecorder{name: "A", log: &handlerLog})),
+	))
+	server := memhttptest.NewServer(t, mux)
+	client := pingv1connect.NewPingServiceClient(
+		server.Client(),
+		server.URL(),
+		connect.WithInterceptors(connect.InterceptorFor(matches, &orderRecorder{name: "A", log: &clientLog})),
+	)
+	ctx := context.Background()
+
+	_, err := client.Ping(ctx, connect.NewRequest(&pingv1.PingRequest{Number: 1}))
+	assert.Nil(t, err)
+	countUp, err := client.CountUp(ctx, connect.NewRequest(&pingv1.CountUpRequest{Number: 1}))
+	assert.Nil(t, err)
+	for countUp.Receive() {
+		assert.Equal(t, countUp.Msg().GetNumber(), 1)
+	}
+	assert.Nil(t, countUp.Err())
+	assert.Nil(t, countUp.Close())
+	assert.Equal(t, clientLog.events(), nil)
+	assert.Equal(t, handlerLog.events(), nil)
+
+	sum := client.Sum(ctx)
+	assert.Nil(t, sum.Send(&pingv1.SumRequest{Number: 2}))
+	response, err := sum.CloseAndReceive()
+	assert.Nil(t, err)
+	assert.Equal(t, response.Msg.GetSum(), 2)
+	assert.Equal(t, clientLog.events(), []string{"A open", "A send", "A receive"})
+	assert.Equal(t, handlerLog.events(), []string{"A request", "A receive", "A send", "A return"})
+}
+
+// messageCountRecorder is a streaming interceptor that tracks the sent and
+// received message counts of the most recent stream.
+type messageCountRecorder struct {
+	mu   sync.Mutex
+	conn any
+}
+
+func (r *messageCountRecorder) Counts() [2]int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.conn == nil {
+		return [2]int{}
+	}
+	sent, received, ok := connect.MessageCounts(r.conn)
+	if !ok {
+		return [2]int{-1, -1}
+	}
+	return [2]int{sent, received}
+}
+
+func (r *messageCountRecorder) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return next
+}
+
+func (r *messageCountRecorder) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return func(ctx context.Context, spec connect.Spec) connect.StreamingClientConn {
+		conn := next(ctx, spec)
+		r.record(conn)
+		return conn
+	}
+}
+
+func (r *messageCountRecorder) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return func(ctx context.Context, conn connect.StreamingHandlerConn) error {
+		r.record(conn)
+		return next(ctx, conn)
+	}
+}
+
+func (r *messageCountRecorder) record(conn any) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.conn = conn
+}
+
 // headerInterceptor makes it easier to write interceptors that inspect or
 // mutate HTTP headers. It applies the same logic to unary and streaming
 // procedures, wrapping the send or receive side of the stream as appropriate.
@@ -390,3 +793,164 @@ func (h *httpMethodChecker) WrapStreamingHandler(handlerFunc connect.StreamingHa
 		return handlerFunc(ctx, conn)
 	}
 }
+
+// peerRecorder is an interceptor that records the Peer of each RPC.
+type peerRecorder struct {
+	mu    sync.Mutex
+	peers []connect.Peer
+}
+
+func (r *peerRecorder) Peers() []connect.Peer {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.peers
+}
+
+func (r *peerRecorder) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		r.record(req.Peer())
+		return next(ctx, req)
+	}
+}
+
+func (r *peerRecorder) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return func(ctx context.Context, spec connect.Spec) connect.StreamingClientConn {
+		conn := next(ctx, spec)
+		r.record(conn.Peer())
+		return conn
+	}
+}
+
+func (r *peerRecorder) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return func(ctx context.Context, conn connect.StreamingHandlerConn) error {
+		r.record(conn.Peer())
+		return next(ctx, conn)
+	}
+}
+
+func (r *peerRecorder) record(peer connect.Peer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.peers = append(r.peers, peer)
+}
+
+// orderLog collects the events orderRecorders observe.
+type orderLog struct {
+	mu  sync.Mutex
+	log []string
+}
+
+func (l *orderLog) add(name, event string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.log = append(l.log, name+" "+event)
+}
+
+func (l *orderLog) events() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.log
+}
+
+// orderRecorder logs when it sees each stage of an RPC. Received messages
+// are logged once they've been received, so that the log shows the order in
+// which interceptors see them.
+type orderRecorder struct {
+	name string
+	log  *orderLog
+}
+
+func (r *orderRecorder) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		r.log.add(r.name, "request")
+		res, err := next(ctx, req)
+		r.log.add(r.name, "response")
+		return res, err
+	}
+}
+
+func (r *orderRecorder) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return func(ctx context.Context, spec connect.Spec) connect.StreamingClientConn {
+		r.log.add(r.name, "open")
+		return &orderRecordingClientConn{StreamingClientConn: next(ctx, spec), recorder: r}
+	}
+}
+
+func (r *orderRecorder) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return func(ctx context.Context, conn connect.StreamingHandlerConn) error {
+		r.log.add(r.name, "request")
+		err := next(ctx, &orderRecordingHandlerConn{StreamingHandlerConn: conn, recorder: r})
+		r.log.add(r.name, "return")
+		return err
+	}
+}
+
+type orderRecordingClientConn struct {
+	connect.StreamingClientConn
+
+	recorder *orderRecorder
+}
+
+func (c *orderRecordingClientConn) Send(msg any) error {
+	c.recorder.log.add(c.recorder.name, "send")
+	return c.StreamingClientConn.Send(msg)
+}
+
+func (c *orderRecordingClientConn) Receive(msg any) error {
+	err := c.StreamingClientConn.Receive(msg)
+	if err == nil {
+		c.recorder.log.add(c.recorder.name, "receive")
+	}
+	return err
+}
+
+type orderRecordingHandlerConn struct {
+	connect.StreamingHandlerConn
+
+	recorder *orderRecorder
+}
+
+func (c *orderRecordingHandlerConn) Send(msg any) error {
+	c.recorder.log.add(c.recorder.name, "send")
+	return c.StreamingHandlerConn.Send(msg)
+}
+
+func (c *orderRecordingHandlerConn) Receive(msg any) error {
+	err := c.StreamingHandlerConn.Receive(msg)
+	if err == nil {
+		c.recorder.log.add(c.recorder.name, "receive")
+	}
+	return err
+}
+
+// completedPeerRecorder records each RPC's Peer once the response headers
+// have arrived: clients record it after unary calls return and when streams
+// are closed, and handlers as soon as they're called.
+type completedPeerRecorder struct {
+	peerRecorder
+}
+
+func (r *completedPeerRecorder) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		res, err := next(ctx, req)
+		r.record(req.Peer())
+		return res, err
+	}
+}
+
+func (r *completedPeerRecorder) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return func(ctx context.Context, spec connect.Spec) connect.StreamingClientConn {
+		return &peerRecordingClientConn{StreamingClientConn: next(ctx, spec), recorder: r}
+	}
+}
+
+type peerRecordingClientConn struct {
+	connect.StreamingClientConn
+
+	recorder *completedPeerRecorder
+}
+
+func (c *peerRecordingClientConn) CloseResponse() error {
+	c.recorder.record(c.Peer())
+	return c.StreamingClientConn.CloseResponse()
+}
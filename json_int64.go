@@ -0,0 +1,261 @@
+// Copyright 2021-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// maxSafeJSONInteger is the largest integer JavaScript numbers represent
+// exactly, Number.MAX_SAFE_INTEGER.
+const maxSafeJSONInteger = 1<<53 - 1
+
+// JSONInt64Encoding controls how the JSON codecs represent 64-bit integer
+// fields (int64, uint64, sint64, fixed64, and sfixed64, along with the
+// google.protobuf.Int64Value and UInt64Value wrappers). See
+// [WithJSONInt64Encoding].
+type JSONInt64Encoding uint8
+
+const (
+	// JSONInt64String encodes 64-bit integers as strings, as the standard
+	// Protobuf JSON mapping requires. This is the default.
+	JSONInt64String JSONInt64Encoding = iota
+	// JSONInt64NumberIfSafe encodes 64-bit integers as numbers when
+	// JavaScript can represent them exactly (their magnitude is at most
+	// 2^53-1), and as strings otherwise.
+	JSONInt64NumberIfSafe
+	// JSONInt64Number always encodes 64-bit integers as numbers. Peers that
+	// parse JSON numbers as doubles lose precision for values above 2^53-1.
+	JSONInt64Number
+)
+
+func (e JSONInt64Encoding) String() string {
+	switch e {
+	case JSONInt64String:
+		return "string"
+	case JSONInt64NumberIfSafe:
+		return "number_if_safe"
+	case JSONInt64Number:
+		return "number"
+	}
+	return fmt.Sprintf("json_int64_encoding_%d", e)
+}
+
+// rewriteJSONInt64s re-encodes the 64-bit integers in data, the protojson
+// encoding of a message with the given descriptor. Everything else is copied
+// through unchanged, so field order is preserved.
+func rewriteJSONInt64s(data []byte, desc protoreflect.MessageDescriptor, encoding JSONInt64Encoding) ([]byte, error) {
+	if encoding == JSONInt64String {
+		return data, nil
+	}
+	var out bytes.Buffer
+	out.Grow(len(data))
+	rewriter := jsonInt64Rewriter{encoding: encoding, out: &out}
+	if err := rewriter.message(data, desc); err != nil {
+		return nil, fmt.Errorf("re-encode 64-bit integers: %w", err)
+	}
+	return out.Bytes(), nil
+}
+
+type jsonInt64Rewriter struct {
+	encoding JSONInt64Encoding
+	out      *bytes.Buffer
+}
+
+func (r *jsonInt64Rewriter) message(data []byte, desc protoreflect.MessageDescriptor) error {
+	switch desc.FullName() {
+	case "google.protobuf.Int64Value", "google.protobuf.UInt64Value":
+		return r.integer(data)
+	}
+	if wellKnownJSON(desc) {
+		// The other well-known types have special JSON mappings, which don't
+		// include 64-bit integer fields (google.protobuf.Any holds a message
+		// we can't resolve here).
+		r.out.Write(data)
+		return nil
+	}
+	fields := desc.Fields()
+	return r.object(data, func(key string, value []byte) error {
+		field := fields.ByJSONName(key)
+		if field == nil {
+			field = fields.ByTextName(key)
+		}
+		if field == nil {
+			r.out.Write(value)
+			return nil
+		}
+		return r.field(value, field)
+	})
+}
+
+func (r *jsonInt64Rewriter) field(data []byte, field protoreflect.FieldDescriptor) error {
+	switch {
+	case field.IsMap():
+		mapValue := field.MapValue()
+		return r.object(data, func(_ string, value []byte) error {
+			return r.singular(value, mapValue)
+		})
+	case field.IsList():
+		return r.array(data, func(value []byte) error {
+			return r.singular(value, field)
+		})
+	default:
+		return r.singular(data, field)
+	}
+}
+
+func (r *jsonInt64Rewriter) singular(data []byte, field protoreflect.FieldDescriptor) error {
+	if bytes.Equal(data, []byte("null")) {
+		r.out.Write(data)
+		return nil
+	}
+	switch field.Kind() {
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind,
+		protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return r.integer(data)
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return r.message(data, field.Message())
+	default:
+		r.out.Write(data)
+		return nil
+	}
+}
+
+// integer writes a quoted 64-bit integer as a number, if the encoding calls
+// for it.
+func (r *jsonInt64Rewriter) integer(data []byte) error {
+	var text string
+	if len(data) == 0 || data[0] != '"' {
+		r.out.Write(data) // already a number
+		return nil
+	}
+	if err := json.Unmarshal(data, &text); err != nil {
+		return err
+	}
+	if !isJSONInteger(text) || (r.encoding == JSONInt64NumberIfSafe && !isSafeJSONInteger(text)) {
+		r.out.Write(data)
+		return nil
+	}
+	r.out.WriteString(text)
+	return nil
+}
+
+func (r *jsonInt64Rewriter) object(data []byte, each func(key string, value []byte) error) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if err := expectJSONDelim(decoder, '{'); err != nil {
+		return err
+	}
+	r.out.WriteByte('{')
+	for i := 0; decoder.More(); i++ {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		key, ok := token.(string)
+		if !ok {
+			return fmt.Errorf("unexpected object key %v", token)
+		}
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err != nil {
+			return err
+		}
+		if i > 0 {
+			r.out.WriteByte(',')
+		}
+		encodedKey, err := json.Marshal(key)
+		if err != nil {
+			return err
+		}
+		r.out.Write(encodedKey)
+		r.out.WriteByte(':')
+		if err := each(key, value); err != nil {
+			return err
+		}
+	}
+	r.out.WriteByte('}')
+	return expectJSONDelim(decoder, '}')
+}
+
+func (r *jsonInt64Rewriter) array(data []byte, each func(value []byte) error) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if err := expectJSONDelim(decoder, '['); err != nil {
+		return err
+	}
+	r.out.WriteByte('[')
+	for i := 0; decoder.More(); i++ {
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err != nil {
+			return err
+		}
+		if i > 0 {
+			r.out.WriteByte(',')
+		}
+		if err := each(value); err != nil {
+			return err
+		}
+	}
+	r.out.WriteByte(']')
+	return expectJSONDelim(decoder, ']')
+}
+
+func expectJSONDelim(decoder *json.Decoder, want json.Delim) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != want {
+		return fmt.Errorf("expected %v, got %v", want, token)
+	}
+	return nil
+}
+
+// isJSONInteger reports whether text is a decimal 64-bit integer, and so safe
+// to write unquoted.
+func isJSONInteger(text string) bool {
+	if _, err := strconv.ParseInt(text, 10, 64); err == nil {
+		return true
+	}
+	_, err := strconv.ParseUint(text, 10, 64)
+	return err == nil
+}
+
+// isSafeJSONInteger reports whether the decimal integer text fits in
+// JavaScript's safe integer range.
+func isSafeJSONInteger(text string) bool {
+	if value, err := strconv.ParseInt(text, 10, 64); err == nil {
+		return value >= -maxSafeJSONInteger && value <= maxSafeJSONInteger
+	}
+	return false // out of int64 range, so also out of the safe range
+}
+
+// wellKnownJSON reports whether desc is a well-known type with its own JSON
+// mapping, rather than a JSON object of its fields.
+func wellKnownJSON(desc protoreflect.MessageDescriptor) bool {
+	if desc.ParentFile() == nil || desc.ParentFile().Package() != "google.protobuf" {
+		return false
+	}
+	switch desc.Name() {
+	case "Any", "Timestamp", "Duration", "FieldMask", "Struct", "Value", "ListValue",
+		"Empty", "BoolValue", "BytesValue", "DoubleValue", "FloatValue",
+		"Int32Value", "StringValue", "UInt32Value":
+		return true
+	}
+	return false
+}
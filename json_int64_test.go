@@ -0,0 +1,218 @@
+// Copyright 2021-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"testing"
+
+	"connectrpc.com/connect/internal/assert"
+	pingv1 "connectrpc.com/connect/internal/gen/connect/ping/v1"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// newInt64sDescriptor describes a message with 64-bit integers in every
+// position the JSON mapping cares about.
+func newInt64sDescriptor(t *testing.T) protoreflect.MessageDescriptor {
+	t.Helper()
+	field := func(name string, number int32, kind descriptorpb.FieldDescriptorProto_Type, label descriptorpb.FieldDescriptorProto_Label) *descriptorpb.FieldDescriptorProto {
+		return &descriptorpb.FieldDescriptorProto{
+			Name:     proto.String(name),
+			JsonName: proto.String(name),
+			Number:   proto.Int32(number),
+			Type:     kind.Enum(),
+			Label:    label.Enum(),
+		}
+	}
+	optional := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL
+	repeated := descriptorpb.FieldDescriptorProto_LABEL_REPEATED
+	message := func(name string, number int32, typeName string, label descriptorpb.FieldDescriptorProto_Label) *descriptorpb.FieldDescriptorProto {
+		f := field(name, number, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE, label)
+		f.TypeName = proto.String(typeName)
+		return f
+	}
+	file := &descriptorpb.FileDescriptorProto{
+		Name:       proto.String("connect/test/int64s.proto"),
+		Package:    proto.String("connect.test"),
+		Syntax:     proto.String("proto3"),
+		Dependency: []string{"google/protobuf/wrappers.proto"},
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Int64s"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				field("signed", 1, descriptorpb.FieldDescriptorProto_TYPE_INT64, optional),
+				field("unsigned", 2, descriptorpb.FieldDescriptorProto_TYPE_UINT64, optional),
+				field("list", 3, descriptorpb.FieldDescriptorProto_TYPE_SINT64, repeated),
+				message("map", 4, ".connect.test.Int64s.MapEntry", repeated),
+				message("nested", 5, ".connect.test.Int64s", optional),
+				message("wrapped", 6, ".google.protobuf.Int64Value", optional),
+				field("text", 7, descriptorpb.FieldDescriptorProto_TYPE_STRING, optional),
+			},
+			NestedType: []*descriptorpb.DescriptorProto{{
+				Name: proto.String("MapEntry"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("key", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, optional),
+					field("value", 2, descriptorpb.FieldDescriptorProto_TYPE_FIXED64, optional),
+				},
+				Options: &descriptorpb.MessageOptions{MapEntry: proto.Bool(true)},
+			}},
+		}},
+	}
+	_ = wrapperspb.Int64(0) // register google/protobuf/wrappers.proto
+	fd, err := protodesc.NewFile(file, protoregistry.GlobalFiles)
+	assert.Nil(t, err)
+	return fd.Messages().Get(0)
+}
+
+// compactJSON removes the whitespace protojson randomly adds.
+func compactJSON(t *testing.T, data []byte) string {
+	t.Helper()
+	var compacted bytes.Buffer
+	assert.Nil(t, json.Compact(&compacted, data))
+	return compacted.String()
+}
+
+func TestJSONInt64Encoding(t *testing.T) {
+	t.Parallel()
+	desc := newInt64sDescriptor(t)
+	fields := desc.Fields()
+	newMessage := func(signed int64, unsigned uint64) *dynamicpb.Message {
+		msg := dynamicpb.NewMessage(desc)
+		msg.Set(fields.ByName("signed"), protoreflect.ValueOfInt64(signed))
+		msg.Set(fields.ByName("unsigned"), protoreflect.ValueOfUint64(unsigned))
+		list := msg.Mutable(fields.ByName("list")).List()
+		list.Append(protoreflect.ValueOfInt64(signed))
+		list.Append(protoreflect.ValueOfInt64(-signed))
+		entries := msg.Mutable(fields.ByName("map")).Map()
+		entries.Set(protoreflect.ValueOfString("key").MapKey(), protoreflect.ValueOfUint64(unsigned))
+		nested := dynamicpb.NewMessage(desc)
+		nested.Set(fields.ByName("signed"), protoreflect.ValueOfInt64(signed))
+		msg.Set(fields.ByName("nested"), protoreflect.ValueOfMessage(nested))
+		msg.Set(fields.ByName("wrapped"), protoreflect.ValueOfMessage(wrapperspb.Int64(signed).ProtoReflect()))
+		// Strings that look like integers are left alone.
+		msg.Set(fields.ByName("text"), protoreflect.ValueOfString("42"))
+		return msg
+	}
+	const (
+		maxSafe = 1<<53 - 1
+		minSafe = -maxSafe
+	)
+	testCases := []struct {
+		name     string
+		encoding JSONInt64Encoding
+		signed   int64
+		unsigned uint64
+		want     string
+	}{
+		{
+			name:     "string",
+			encoding: JSONInt64String,
+			signed:   maxSafe,
+			unsigned: maxSafe,
+			want:     `{"signed":"9007199254740991","unsigned":"9007199254740991","list":["9007199254740991","-9007199254740991"],"map":{"key":"9007199254740991"},"nested":{"signed":"9007199254740991"},"wrapped":"9007199254740991","text":"42"}`,
+		},
+		{
+			name:     "number_if_safe/max_safe",
+			encoding: JSONInt64NumberIfSafe,
+			signed:   maxSafe,
+			unsigned: maxSafe,
+			want:     `{"signed":9007199254740991,"unsigned":9007199254740991,"list":[9007199254740991,-9007199254740991],"map":{"key":9007199254740991},"nested":{"signed":9007199254740991},"wrapped":9007199254740991,"text":"42"}`,
+		},
+		{
+			name:     "number_if_safe/min_safe",
+			encoding: JSONInt64NumberIfSafe,
+			signed:   minSafe,
+			unsigned: 0,
+			want:     `{"signed":-9007199254740991,"list":[-9007199254740991,9007199254740991],"map":{"key":0},"nested":{"signed":-9007199254740991},"wrapped":-9007199254740991,"text":"42"}`,
+		},
+		{
+			name:     "number_if_safe/2^53",
+			encoding: JSONInt64NumberIfSafe,
+			signed:   1 << 53,
+			unsigned: 1 << 53,
+			want:     `{"signed":"9007199254740992","unsigned":"9007199254740992","list":["9007199254740992","-9007199254740992"],"map":{"key":"9007199254740992"},"nested":{"signed":"9007199254740992"},"wrapped":"9007199254740992","text":"42"}`,
+		},
+		{
+			name:     "number/2^53+1",
+			encoding: JSONInt64Number,
+			signed:   1<<53 + 1,
+			unsigned: math.MaxUint64,
+			want:     `{"signed":9007199254740993,"unsigned":18446744073709551615,"list":[9007199254740993,-9007199254740993],"map":{"key":18446744073709551615},"nested":{"signed":9007199254740993},"wrapped":9007199254740993,"text":"42"}`,
+		},
+		{
+			name:     "number/extremes",
+			encoding: JSONInt64Number,
+			signed:   math.MinInt64 + 1,
+			unsigned: math.MaxUint64,
+			want:     `{"signed":-9223372036854775807,"unsigned":18446744073709551615,"list":[-9223372036854775807,9223372036854775807],"map":{"key":18446744073709551615},"nested":{"signed":-9223372036854775807},"wrapped":-9223372036854775807,"text":"42"}`,
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+			msg := newMessage(testCase.signed, testCase.unsigned)
+			for _, codec := range []Codec{
+				&protoJSONCodec{name: codecNameJSON, int64Encoding: testCase.encoding},
+				&stableJSONCodec{protoJSONCodec{name: codecNameJSON, int64Encoding: testCase.encoding}},
+			} {
+				data, err := codec.Marshal(msg)
+				assert.Nil(t, err)
+				if stable, ok := codec.(stableCodec); ok {
+					data, err = stable.MarshalStable(msg)
+					assert.Nil(t, err)
+				}
+				assert.Equal(t, compactJSON(t, data), testCase.want)
+				appended, err := codec.(marshalAppender).MarshalAppend([]byte("prefix"), msg)
+				assert.Nil(t, err)
+				assert.Equal(t, string(appended[:6]), "prefix")
+				assert.Equal(t, compactJSON(t, appended[6:]), testCase.want)
+				// Decoding is lossless, whatever the representation.
+				decoded := dynamicpb.NewMessage(desc)
+				assert.Nil(t, codec.Unmarshal(data, decoded))
+				assert.True(t, proto.Equal(decoded, msg))
+			}
+		})
+	}
+	t.Run("options", func(t *testing.T) {
+		t.Parallel()
+		clientConfig, err := newClientConfig("http://localhost/connect.ping.v1.PingService/Ping", []ClientOption{
+			WithProtoJSON(),
+			WithJSONInt64Encoding(JSONInt64Number),
+		})
+		assert.Nil(t, err)
+		data, marshalErr := clientConfig.Codec.Marshal(&pingv1.PingRequest{Number: 1 << 60})
+		assert.Nil(t, marshalErr)
+		assert.Equal(t, compactJSON(t, data), `{"number":1152921504606846976}`)
+		handlerConfig := newHandlerConfig("/connect.ping.v1.PingService/Ping", StreamTypeUnary, []HandlerOption{
+			WithStableJSON(),
+			WithJSONInt64Encoding(JSONInt64NumberIfSafe),
+		})
+		for _, name := range []string{codecNameJSON, codecNameJSONCharsetUTF8} {
+			data, marshalErr := handlerConfig.Codecs[name].Marshal(&pingv1.PingResponse{Number: 1 << 60})
+			assert.Nil(t, marshalErr)
+			assert.Equal(t, string(data), `{"number":"1152921504606846976"}`)
+			data, marshalErr = handlerConfig.Codecs[name].Marshal(&pingv1.PingResponse{Number: 42})
+			assert.Nil(t, marshalErr)
+			assert.Equal(t, string(data), `{"number":42}`)
+		}
+	})
+}
@@ -0,0 +1,128 @@
+// Copyright 2021-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// maxHeaderBytesInterceptor rejects RPCs whose metadata is larger than a
+// limit. Handlers check request headers; clients check response headers and
+// trailers, including trailers sent in the body of streaming responses.
+type maxHeaderBytesInterceptor struct {
+	limit int
+}
+
+func (i *maxHeaderBytesInterceptor) WrapUnary(next UnaryFunc) UnaryFunc {
+	return func(ctx context.Context, request AnyRequest) (AnyResponse, error) {
+		if !request.Spec().IsClient {
+			if err := i.check("request headers", request.Header()); err != nil {
+				return nil, err
+			}
+			return next(ctx, request)
+		}
+		response, err := next(ctx, request)
+		if err != nil {
+			var connectErr *Error
+			if errors.As(err, &connectErr) {
+				if err := i.check("error metadata", connectErr.Meta()); err != nil {
+					return nil, err
+				}
+			}
+			return nil, err
+		}
+		if err := i.check("response headers", response.Header()); err != nil {
+			return nil, err
+		}
+		if err := i.check("response trailers", response.Trailer()); err != nil {
+			return nil, err
+		}
+		return response, nil
+	}
+}
+
+func (i *maxHeaderBytesInterceptor) WrapStreamingClient(next StreamingClientFunc) StreamingClientFunc {
+	return func(ctx context.Context, spec Spec) StreamingClientConn {
+		return &maxHeaderBytesStreamingClientConn{
+			StreamingClientConn: next(ctx, spec),
+			interceptor:         i,
+		}
+	}
+}
+
+func (i *maxHeaderBytesInterceptor) WrapStreamingHandler(next StreamingHandlerFunc) StreamingHandlerFunc {
+	return func(ctx context.Context, conn StreamingHandlerConn) error {
+		if err := i.check("request headers", conn.RequestHeader()); err != nil {
+			return err
+		}
+		return next(ctx, conn)
+	}
+}
+
+func (i *maxHeaderBytesInterceptor) check(what string, header http.Header) *Error {
+	if size := headerBytes(header); size > i.limit {
+		return errorf(CodeResourceExhausted, "%s are %d bytes, exceeding the limit of %d bytes", what, size, i.limit)
+	}
+	return nil
+}
+
+// maxHeaderBytesStreamingClientConn checks the response headers with the
+// first message, and the trailers once the stream ends.
+type maxHeaderBytesStreamingClientConn struct {
+	StreamingClientConn
+
+	interceptor *maxHeaderBytesInterceptor
+	checkHeader sync.Once
+	headerErr   *Error
+}
+
+func (c *maxHeaderBytesStreamingClientConn) Receive(msg any) error {
+	err := c.StreamingClientConn.Receive(msg)
+	c.checkHeader.Do(func() {
+		c.headerErr = c.interceptor.check("response headers", c.StreamingClientConn.ResponseHeader())
+	})
+	if c.headerErr != nil {
+		return c.headerErr
+	}
+	if err != nil && errors.Is(err, io.EOF) {
+		if trailerErr := c.interceptor.check("response trailers", c.StreamingClientConn.ResponseTrailer()); trailerErr != nil {
+			return trailerErr
+		}
+	} else if connectErr, ok := asError(err); ok {
+		if metaErr := c.interceptor.check("error metadata", connectErr.Meta()); metaErr != nil {
+			return metaErr
+		}
+	}
+	return err
+}
+
+func (c *maxHeaderBytesStreamingClientConn) Unwrap() StreamingClientConn {
+	return c.StreamingClientConn
+}
+
+// headerBytes approximates the size of header on the wire.
+func headerBytes(header http.Header) int {
+	var size int
+	for key, values := range header {
+		for _, value := range values {
+			size += len(key) + len(value)
+		}
+	}
+	return size
+}
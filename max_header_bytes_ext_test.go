@@ -0,0 +1,195 @@
+// Copyright 2021-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	connect "connectrpc.com/connect"
+	"connectrpc.com/connect/internal/assert"
+	pingv1 "connectrpc.com/connect/internal/gen/connect/ping/v1"
+	"connectrpc.com/connect/internal/gen/connect/ping/v1/pingv1connect"
+	"connectrpc.com/connect/internal/memhttp/memhttptest"
+)
+
+func TestWithMaxHeaderBytes(t *testing.T) {
+	t.Parallel()
+	const (
+		limit      = 2048
+		bigHeader  = "X-Big"
+		metadataIn = "X-Response-Metadata"
+	)
+	big := strings.Repeat("a", limit)
+	// The server sends metadata as large as the client asks for, in the
+	// response headers, the trailers, or an error.
+	server := &pluggablePingServer{
+		ping: func(_ context.Context, request *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+			response := connect.NewResponse(&pingv1.PingResponse{})
+			switch request.Header().Get(metadataIn) {
+			case "header":
+				response.Header().Set(bigHeader, big)
+			case "trailer":
+				response.Trailer().Set(bigHeader, big)
+			case "error":
+				err := connect.NewError(connect.CodeAborted, errors.New("oops"))
+				err.Meta().Set(bigHeader, big)
+				return nil, err
+			}
+			return response, nil
+		},
+		countUp: func(_ context.Context, request *connect.Request[pingv1.CountUpRequest], stream *connect.ServerStream[pingv1.CountUpResponse]) error {
+			switch request.Header().Get(metadataIn) {
+			case "header":
+				stream.ResponseHeader().Set(bigHeader, big)
+			case "trailer":
+				stream.ResponseTrailer().Set(bigHeader, big)
+			case "error":
+				if err := stream.Send(&pingv1.CountUpResponse{Number: 1}); err != nil {
+					return err
+				}
+				err := connect.NewError(connect.CodeAborted, errors.New("oops"))
+				err.Meta().Set(bigHeader, big)
+				return err
+			}
+			return stream.Send(&pingv1.CountUpResponse{Number: 1})
+		},
+		cumSum: func(_ context.Context, stream *connect.BidiStream[pingv1.CumSumRequest, pingv1.CumSumResponse]) error {
+			_, err := stream.Receive()
+			return err
+		},
+	}
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(server, connect.WithMaxHeaderBytes(limit)))
+	httpServer := memhttptest.NewServer(t, mux)
+	protocols := []struct {
+		name string
+		opts []connect.ClientOption
+	}{
+		{name: "connect"},
+		{name: "grpc", opts: []connect.ClientOption{connect.WithGRPC()}},
+		{name: "grpcweb", opts: []connect.ClientOption{connect.WithGRPCWeb()}},
+	}
+	for _, protocol := range protocols {
+		t.Run(protocol.name, func(t *testing.T) {
+			t.Parallel()
+			t.Run("handler", func(t *testing.T) {
+				t.Parallel()
+				client := pingv1connect.NewPingServiceClient(httpServer.Client(), httpServer.URL(), protocol.opts...)
+				request := connect.NewRequest(&pingv1.PingRequest{})
+				_, err := client.Ping(context.Background(), request)
+				assert.Nil(t, err)
+				request.Header().Set(bigHeader, big)
+				_, err = client.Ping(context.Background(), request)
+				assert.Equal(t, connect.CodeOf(err), connect.CodeResourceExhausted)
+
+				countUp := connect.NewRequest(&pingv1.CountUpRequest{})
+				countUp.Header().Set(bigHeader, big)
+				stream, err := client.CountUp(context.Background(), countUp)
+				assert.Nil(t, err)
+				assert.False(t, stream.Receive())
+				assert.Equal(t, connect.CodeOf(stream.Err()), connect.CodeResourceExhausted)
+				assert.Nil(t, stream.Close())
+
+				bidi := client.CumSum(context.Background())
+				bidi.RequestHeader().Set(bigHeader, big)
+				_ = bidi.Send(&pingv1.CumSumRequest{})
+				_, err = bidi.Receive()
+				assert.Equal(t, connect.CodeOf(err), connect.CodeResourceExhausted)
+				assert.Nil(t, bidi.CloseRequest())
+				assert.Nil(t, bidi.CloseResponse())
+			})
+			for _, where := range []string{"header", "trailer", "error"} {
+				t.Run("client/"+where, func(t *testing.T) {
+					t.Parallel()
+					// Without the option, the client accepts the metadata.
+					unlimited := pingv1connect.NewPingServiceClient(httpServer.Client(), httpServer.URL(), protocol.opts...)
+					client := pingv1connect.NewPingServiceClient(
+						httpServer.Client(),
+						httpServer.URL(),
+						append(protocol.opts, connect.WithMaxHeaderBytes(limit))...,
+					)
+					request := connect.NewRequest(&pingv1.PingRequest{})
+					request.Header().Set(metadataIn, where)
+					_, err := unlimited.Ping(context.Background(), request)
+					if where == "error" {
+						assert.Equal(t, connect.CodeOf(err), connect.CodeAborted)
+					} else {
+						assert.Nil(t, err)
+					}
+					_, err = client.Ping(context.Background(), request)
+					assert.Equal(t, connect.CodeOf(err), connect.CodeResourceExhausted)
+
+					countUp := connect.NewRequest(&pingv1.CountUpRequest{})
+					countUp.Header().Set(metadataIn, where)
+					stream, err := client.CountUp(context.Background(), countUp)
+					assert.Nil(t, err)
+					for stream.Receive() { //nolint:revive
+					}
+					assert.Equal(t, connect.CodeOf(stream.Err()), connect.CodeResourceExhausted)
+					assert.Nil(t, stream.Close())
+				})
+			}
+		})
+	}
+	t.Run("unlimited", func(t *testing.T) {
+		t.Parallel()
+		mux := http.NewServeMux()
+		mux.Handle(pingv1connect.NewPingServiceHandler(server, connect.WithMaxHeaderBytes(0)))
+		httpServer := memhttptest.NewServer(t, mux)
+		client := pingv1connect.NewPingServiceClient(httpServer.Client(), httpServer.URL(), connect.WithMaxHeaderBytes(-1))
+		request := connect.NewRequest(&pingv1.PingRequest{})
+		request.Header().Set(bigHeader, big)
+		request.Header().Set(metadataIn, "trailer")
+		_, err := client.Ping(context.Background(), request)
+		assert.Nil(t, err)
+	})
+	t.Run("last_wins", func(t *testing.T) {
+		t.Parallel()
+		// A later zero clears an earlier limit, for handlers and clients.
+		mux := http.NewServeMux()
+		mux.Handle(pingv1connect.NewPingServiceHandler(
+			server,
+			connect.WithMaxHeaderBytes(1),
+			connect.WithMaxHeaderBytes(0),
+		))
+		httpServer := memhttptest.NewServer(t, mux)
+		client := pingv1connect.NewPingServiceClient(
+			httpServer.Client(),
+			httpServer.URL(),
+			connect.WithMaxHeaderBytes(1),
+			connect.WithMaxHeaderBytes(0),
+		)
+		request := connect.NewRequest(&pingv1.PingRequest{})
+		request.Header().Set(bigHeader, big)
+		request.Header().Set(metadataIn, "header")
+		_, err := client.Ping(context.Background(), request)
+		assert.Nil(t, err)
+		// A later limit replaces an earlier one.
+		client = pingv1connect.NewPingServiceClient(
+			httpServer.Client(),
+			httpServer.URL(),
+			connect.WithMaxHeaderBytes(0),
+			connect.WithMaxHeaderBytes(limit),
+		)
+		request = connect.NewRequest(&pingv1.PingRequest{})
+		request.Header().Set(metadataIn, "header")
+		_, err = client.Ping(context.Background(), request)
+		assert.Equal(t, connect.CodeOf(err), connect.CodeResourceExhausted)
+	})
+}
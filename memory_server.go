@@ -0,0 +1,62 @@
+// Copyright 2021-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"net/http"
+
+	"connectrpc.com/connect/internal/memhttp"
+)
+
+// InMemoryServer serves an [http.Handler] over in-memory pipes rather than a
+// network socket, so tests can exercise clients and handlers end to end
+// without binding a port. It speaks HTTP/2 without TLS, so it supports every
+// protocol and stream type, including bidirectional streaming and HTTP
+// trailers.
+//
+// Unlike [net/http/httptest.Server], InMemoryServer never involves the
+// kernel's networking stack, so it's faster and works in sandboxes without
+// network access. Only clients returned by its Client method can reach it.
+type InMemoryServer struct {
+	server *memhttp.Server
+}
+
+// NewInMemoryServer starts serving the handler in memory. Callers must Close
+// the server when they're done with it.
+func NewInMemoryServer(handler http.Handler) *InMemoryServer {
+	return &InMemoryServer{server: memhttp.NewServer(handler)}
+}
+
+// Client returns an HTTP/2 client that sends requests to the server. Callers
+// may reconfigure the returned client without affecting other clients.
+func (s *InMemoryServer) Client() *http.Client {
+	return s.server.Client()
+}
+
+// URL returns the server's base URL. It isn't reachable over the network, so
+// it's only meaningful to clients returned by the Client method.
+func (s *InMemoryServer) URL() string {
+	return s.server.URL()
+}
+
+// Close stops the server from accepting new connections, waiting a few seconds
+// for active RPCs to finish.
+func (s *InMemoryServer) Close() error {
+	if err := s.server.Cleanup(); err != nil {
+		_ = s.server.Close()
+		return err
+	}
+	return nil
+}
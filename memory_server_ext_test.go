@@ -0,0 +1,90 @@
+// Copyright 2021-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+
+	connect "connectrpc.com/connect"
+	"connectrpc.com/connect/internal/assert"
+	pingv1 "connectrpc.com/connect/internal/gen/connect/ping/v1"
+	"connectrpc.com/connect/internal/gen/connect/ping/v1/pingv1connect"
+)
+
+func TestInMemoryServer(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}))
+	server := connect.NewInMemoryServer(mux)
+	t.Cleanup(func() {
+		assert.Nil(t, server.Close())
+	})
+	protocols := []struct {
+		name string
+		opts []connect.ClientOption
+	}{
+		{name: "connect"},
+		{name: "grpc", opts: []connect.ClientOption{connect.WithGRPC()}},
+		{name: "grpcweb", opts: []connect.ClientOption{connect.WithGRPCWeb()}},
+	}
+	for _, protocol := range protocols {
+		t.Run(protocol.name, func(t *testing.T) {
+			t.Parallel()
+			client := pingv1connect.NewPingServiceClient(server.Client(), server.URL(), protocol.opts...)
+			t.Run("unary", func(t *testing.T) {
+				t.Parallel()
+				response, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Number: 42}))
+				assert.Nil(t, err)
+				assert.Equal(t, response.Msg.GetNumber(), 42)
+			})
+			t.Run("bidi", func(t *testing.T) {
+				t.Parallel()
+				stream := client.CumSum(context.Background())
+				// Full duplex: each response arrives before the next request is
+				// sent.
+				for i, want := range []int64{1, 3, 6} {
+					assert.Nil(t, stream.Send(&pingv1.CumSumRequest{Number: int64(i + 1)}))
+					response, err := stream.Receive()
+					assert.Nil(t, err)
+					assert.Equal(t, response.GetSum(), want)
+				}
+				assert.Nil(t, stream.CloseRequest())
+				_, err := stream.Receive()
+				assert.True(t, errors.Is(err, io.EOF))
+				assert.Equal(t, stream.ResponseHeader().Get(handlerHeader), headerValue)
+				assert.Equal(t, stream.ResponseTrailer().Get(handlerTrailer), trailerValue)
+				assert.Nil(t, stream.CloseResponse())
+			})
+		})
+	}
+}
+
+func TestInMemoryServerClose(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}))
+	server := connect.NewInMemoryServer(mux)
+	client := pingv1connect.NewPingServiceClient(server.Client(), server.URL())
+	_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+	assert.Nil(t, err)
+	assert.Nil(t, server.Close())
+	client = pingv1connect.NewPingServiceClient(server.Client(), server.URL())
+	_, err = client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+	assert.Equal(t, connect.CodeOf(err), connect.CodeUnavailable)
+}
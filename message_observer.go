@@ -0,0 +1,138 @@
+// Copyright 2021-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+)
+
+// messageObserverInterceptor passes every message sent or received to a pair
+// of callbacks. It sees the same message values as the application, so
+// nothing is decoded or encoded twice.
+type messageObserverInterceptor struct {
+	onReceive func(context.Context, Spec, any)
+	onSend    func(context.Context, Spec, any)
+}
+
+func (i *messageObserverInterceptor) WrapUnary(next UnaryFunc) UnaryFunc {
+	return func(ctx context.Context, request AnyRequest) (AnyResponse, error) {
+		spec := request.Spec()
+		if spec.IsClient {
+			i.send(ctx, spec, request.Any())
+		} else {
+			i.receive(ctx, spec, request.Any())
+		}
+		response, err := next(ctx, request)
+		if err != nil || response == nil {
+			return response, err
+		}
+		if spec.IsClient {
+			i.receive(ctx, spec, response.Any())
+		} else {
+			i.send(ctx, spec, response.Any())
+		}
+		return response, nil
+	}
+}
+
+func (i *messageObserverInterceptor) WrapStreamingClient(next StreamingClientFunc) StreamingClientFunc {
+	return func(ctx context.Context, spec Spec) StreamingClientConn {
+		return &messageObserverClientConn{
+			StreamingClientConn: next(ctx, spec),
+			ctx:                 ctx,
+			interceptor:         i,
+		}
+	}
+}
+
+func (i *messageObserverInterceptor) WrapStreamingHandler(next StreamingHandlerFunc) StreamingHandlerFunc {
+	return func(ctx context.Context, conn StreamingHandlerConn) error {
+		return next(ctx, &messageObserverHandlerConn{
+			StreamingHandlerConn: conn,
+			ctx:                  ctx,
+			interceptor:          i,
+		})
+	}
+}
+
+func (i *messageObserverInterceptor) receive(ctx context.Context, spec Spec, msg any) {
+	if i.onReceive != nil && msg != nil {
+		i.onReceive(ctx, spec, msg)
+	}
+}
+
+func (i *messageObserverInterceptor) send(ctx context.Context, spec Spec, msg any) {
+	if i.onSend != nil && msg != nil {
+		i.onSend(ctx, spec, msg)
+	}
+}
+
+// messageObserverClientConn reports each request message once it's sent and
+// each response message once it's received.
+type messageObserverClientConn struct {
+	StreamingClientConn
+
+	ctx         context.Context //nolint:containedctx
+	interceptor *messageObserverInterceptor
+}
+
+func (c *messageObserverClientConn) Send(msg any) error {
+	if err := c.StreamingClientConn.Send(msg); err != nil {
+		return err
+	}
+	c.interceptor.send(c.ctx, c.Spec(), msg)
+	return nil
+}
+
+func (c *messageObserverClientConn) Receive(msg any) error {
+	if err := c.StreamingClientConn.Receive(msg); err != nil {
+		return err
+	}
+	c.interceptor.receive(c.ctx, c.Spec(), msg)
+	return nil
+}
+
+func (c *messageObserverClientConn) Unwrap() StreamingClientConn {
+	return c.StreamingClientConn
+}
+
+// messageObserverHandlerConn reports each request message once it's received
+// and each response message once it's sent.
+type messageObserverHandlerConn struct {
+	StreamingHandlerConn
+
+	ctx         context.Context //nolint:containedctx
+	interceptor *messageObserverInterceptor
+}
+
+func (c *messageObserverHandlerConn) Receive(msg any) error {
+	if err := c.StreamingHandlerConn.Receive(msg); err != nil {
+		return err
+	}
+	c.interceptor.receive(c.ctx, c.Spec(), msg)
+	return nil
+}
+
+func (c *messageObserverHandlerConn) Send(msg any) error {
+	if err := c.StreamingHandlerConn.Send(msg); err != nil {
+		return err
+	}
+	c.interceptor.send(c.ctx, c.Spec(), msg)
+	return nil
+}
+
+func (c *messageObserverHandlerConn) Unwrap() StreamingHandlerConn {
+	return c.StreamingHandlerConn
+}
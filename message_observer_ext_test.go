@@ -0,0 +1,158 @@
+// Copyright 2021-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"testing"
+
+	connect "connectrpc.com/connect"
+	"connectrpc.com/connect/internal/assert"
+	pingv1 "connectrpc.com/connect/internal/gen/connect/ping/v1"
+	"connectrpc.com/connect/internal/gen/connect/ping/v1/pingv1connect"
+	"connectrpc.com/connect/internal/memhttp/memhttptest"
+)
+
+func TestWithMessageObserver(t *testing.T) {
+	t.Parallel()
+	server := &pluggablePingServer{
+		ping: func(_ context.Context, request *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+			return connect.NewResponse(&pingv1.PingResponse{Number: request.Msg.GetNumber()}), nil
+		},
+		cumSum: func(_ context.Context, stream *connect.BidiStream[pingv1.CumSumRequest, pingv1.CumSumResponse]) error {
+			var sum int64
+			for {
+				msg, err := stream.Receive()
+				if errors.Is(err, io.EOF) {
+					return nil
+				} else if err != nil {
+					return err
+				}
+				sum += msg.GetNumber()
+				if err := stream.Send(&pingv1.CumSumResponse{Sum: sum}); err != nil {
+					return err
+				}
+			}
+		},
+	}
+	handlerLog := &messageLog{}
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(server, handlerLog.option()))
+	httpServer := memhttptest.NewServer(t, mux)
+	for _, protocol := range []struct {
+		name string
+		opts []connect.ClientOption
+	}{
+		{name: "connect"},
+		{name: "grpc", opts: []connect.ClientOption{connect.WithGRPC()}},
+		{name: "grpcweb", opts: []connect.ClientOption{connect.WithGRPCWeb()}},
+	} {
+		t.Run(protocol.name+"/unary", func(t *testing.T) {
+			handlerLog.reset()
+			clientLog := &messageLog{}
+			client := pingv1connect.NewPingServiceClient(
+				httpServer.Client(),
+				httpServer.URL(),
+				append(protocol.opts, clientLog.option())...,
+			)
+			response, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Number: 7}))
+			assert.Nil(t, err)
+			assert.Equal(t, response.Msg.GetNumber(), 7)
+			assert.Equal(t, clientLog.entries(), []string{"send Ping 7", "receive Ping 7"})
+			assert.Equal(t, handlerLog.entries(), []string{"receive Ping 7", "send Ping 7"})
+		})
+		t.Run(protocol.name+"/bidi", func(t *testing.T) {
+			handlerLog.reset()
+			clientLog := &messageLog{}
+			client := pingv1connect.NewPingServiceClient(
+				httpServer.Client(),
+				httpServer.URL(),
+				append(protocol.opts, clientLog.option())...,
+			)
+			stream := client.CumSum(context.Background())
+			for i, number := range []int64{1, 2, 3} {
+				assert.Nil(t, stream.Send(&pingv1.CumSumRequest{Number: number}))
+				msg, err := stream.Receive()
+				assert.Nil(t, err)
+				// The handler still receives every message.
+				assert.Equal(t, msg.GetSum(), int64((i+1)*(i+2)/2))
+			}
+			assert.Nil(t, stream.CloseRequest())
+			_, err := stream.Receive()
+			assert.ErrorIs(t, err, io.EOF)
+			assert.Nil(t, stream.CloseResponse())
+			want := []string{
+				"send CumSum 1", "receive CumSum 1",
+				"send CumSum 2", "receive CumSum 3",
+				"send CumSum 3", "receive CumSum 6",
+			}
+			assert.Equal(t, clientLog.entries(), want)
+			want = []string{
+				"receive CumSum 1", "send CumSum 1",
+				"receive CumSum 2", "send CumSum 3",
+				"receive CumSum 3", "send CumSum 6",
+			}
+			assert.Equal(t, handlerLog.entries(), want)
+		})
+	}
+}
+
+// messageLog records the messages seen by WithMessageObserver.
+type messageLog struct {
+	mu  sync.Mutex
+	log []string
+}
+
+func (l *messageLog) option() connect.Option {
+	return connect.WithMessageObserver(
+		func(_ context.Context, spec connect.Spec, message any) { l.add("receive", spec, message) },
+		func(_ context.Context, spec connect.Spec, message any) { l.add("send", spec, message) },
+	)
+}
+
+func (l *messageLog) add(direction string, spec connect.Spec, message any) {
+	var number int64
+	switch msg := message.(type) {
+	case *pingv1.PingRequest:
+		number = msg.GetNumber()
+	case *pingv1.PingResponse:
+		number = msg.GetNumber()
+	case *pingv1.CumSumRequest:
+		number = msg.GetNumber()
+	case *pingv1.CumSumResponse:
+		number = msg.GetSum()
+	}
+	method := spec.Procedure[len(pingv1connect.PingServiceName)+2:]
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.log = append(l.log, fmt.Sprintf("%s %s %d", direction, method, number))
+}
+
+func (l *messageLog) entries() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.log...)
+}
+
+func (l *messageLog) reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.log = nil
+}
@@ -0,0 +1,83 @@
+// Copyright 2021-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"net/http"
+)
+
+// A Mux dispatches requests for many procedures, each served by its own
+// handler, from a single [http.Handler]. It's meant for services built at
+// runtime, where procedures are registered one at a time, but it also accepts
+// the path and handler returned by generated service constructors.
+//
+// Unlike a plain [http.ServeMux], a Mux rejects requests for unregistered
+// paths with an RPC error in the format the client expects, coded
+// [CodeUnimplemented]. Unary Connect errors are sent with an HTTP 404 status,
+// as [http.ServeMux] would, which Connect clients also read as
+// CodeUnimplemented. Options passed to [NewMux] configure those errors and are also
+// available to handler constructors through HandlerOptions, so that every
+// procedure shares one configuration.
+//
+// Mux is safe to use concurrently.
+type Mux struct {
+	mux         *http.ServeMux
+	options     []HandlerOption
+	errorWriter *ErrorWriter
+}
+
+// NewMux constructs an empty Mux. The options apply to all procedures
+// constructed with the Mux's HandlerOptions.
+func NewMux(options ...HandlerOption) *Mux {
+	errorWriter := NewErrorWriter(options...)
+	// The Mux only writes errors for unknown paths.
+	errorWriter.statusMapper = func(Code) int { return http.StatusNotFound }
+	return &Mux{
+		mux:         http.NewServeMux(),
+		options:     options,
+		errorWriter: errorWriter,
+	}
+}
+
+// Handle registers the handler for a path. The path may be a procedure, such
+// as "/acme.foo.v1.FooService/Bar", or a service prefix ending in a slash,
+// like the paths returned by generated service constructors. As with
+// [http.ServeMux], registering the same path twice panics.
+func (m *Mux) Handle(path string, handler http.Handler) {
+	m.mux.Handle(path, handler)
+}
+
+// HandlerOptions returns the Mux's shared options followed by any extra
+// options. Pass them to handler constructors to configure procedures
+// consistently:
+//
+//	mux := connect.NewMux(connect.WithInterceptors(auth))
+//	mux.Handle(procedure, connect.NewUnaryHandler(procedure, fn, mux.HandlerOptions()...))
+func (m *Mux) HandlerOptions(extra ...HandlerOption) []HandlerOption {
+	options := make([]HandlerOption, 0, len(m.options)+len(extra))
+	options = append(options, m.options...)
+	return append(options, extra...)
+}
+
+// ServeHTTP implements [http.Handler].
+func (m *Mux) ServeHTTP(responseWriter http.ResponseWriter, request *http.Request) {
+	handler, pattern := m.mux.Handler(request)
+	if pattern == "" {
+		err := errorf(CodeUnimplemented, "%s is not implemented", request.URL.Path)
+		_ = m.errorWriter.Write(responseWriter, request, err)
+		return
+	}
+	handler.ServeHTTP(responseWriter, request)
+}
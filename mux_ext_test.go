@@ -0,0 +1,107 @@
+// Copyright 2021-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	connect "connectrpc.com/connect"
+	"connectrpc.com/connect/internal/assert"
+	pingv1 "connectrpc.com/connect/internal/gen/connect/ping/v1"
+	"connectrpc.com/connect/internal/gen/connect/ping/v1/pingv1connect"
+	"connectrpc.com/connect/internal/memhttp/memhttptest"
+)
+
+func TestMux(t *testing.T) {
+	t.Parallel()
+	// The shared interceptor tags every response with the procedure it served.
+	tag := connect.UnaryInterceptorFunc(func(next connect.UnaryFunc) connect.UnaryFunc {
+		return func(ctx context.Context, request connect.AnyRequest) (connect.AnyResponse, error) {
+			response, err := next(ctx, request)
+			if err == nil {
+				response.Header().Set("Served-By", request.Spec().Procedure)
+			}
+			return response, err
+		}
+	})
+	mux := connect.NewMux(connect.WithInterceptors(tag))
+	mux.Handle(pingv1connect.PingServicePingProcedure, connect.NewUnaryHandler(
+		pingv1connect.PingServicePingProcedure,
+		func(_ context.Context, request *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+			return connect.NewResponse(&pingv1.PingResponse{Number: request.Msg.GetNumber()}), nil
+		},
+		mux.HandlerOptions()...,
+	))
+	mux.Handle(pingv1connect.PingServiceFailProcedure, connect.NewUnaryHandler(
+		pingv1connect.PingServiceFailProcedure,
+		func(_ context.Context, request *connect.Request[pingv1.FailRequest]) (*connect.Response[pingv1.FailResponse], error) {
+			return connect.NewResponse(&pingv1.FailResponse{}), nil
+		},
+		mux.HandlerOptions()...,
+	))
+	server := memhttptest.NewServer(t, mux)
+	for _, protocol := range []struct {
+		name string
+		opts []connect.ClientOption
+	}{
+		{name: "connect"},
+		{name: "grpc", opts: []connect.ClientOption{connect.WithGRPC()}},
+		{name: "grpcweb", opts: []connect.ClientOption{connect.WithGRPCWeb()}},
+	} {
+		t.Run(protocol.name, func(t *testing.T) {
+			t.Parallel()
+			client := pingv1connect.NewPingServiceClient(server.Client(), server.URL(), protocol.opts...)
+			ping, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Number: 42}))
+			assert.Nil(t, err)
+			assert.Equal(t, ping.Msg.GetNumber(), 42)
+			assert.Equal(t, ping.Header().Get("Served-By"), pingv1connect.PingServicePingProcedure)
+			fail, err := client.Fail(context.Background(), connect.NewRequest(&pingv1.FailRequest{}))
+			assert.Nil(t, err)
+			assert.Equal(t, fail.Header().Get("Served-By"), pingv1connect.PingServiceFailProcedure)
+			stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{Number: 1}))
+			assert.Nil(t, err)
+			assert.False(t, stream.Receive())
+			assert.Equal(t, connect.CodeOf(stream.Err()), connect.CodeUnimplemented)
+			assert.Nil(t, stream.Close())
+		})
+	}
+	t.Run("not_found", func(t *testing.T) {
+		t.Parallel()
+		request, err := http.NewRequestWithContext(
+			context.Background(),
+			http.MethodPost,
+			server.URL()+"/connect.ping.v1.PingService/Missing",
+			strings.NewReader("{}"),
+		)
+		assert.Nil(t, err)
+		request.Header.Set("Content-Type", "application/json")
+		response, err := server.Client().Do(request)
+		assert.Nil(t, err)
+		defer response.Body.Close()
+		assert.Equal(t, response.StatusCode, http.StatusNotFound)
+		assert.Equal(t, response.Header.Get("Content-Type"), "application/json")
+		var wireErr struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		}
+		assert.Nil(t, json.NewDecoder(response.Body).Decode(&wireErr))
+		assert.Equal(t, wireErr.Code, connect.CodeUnimplemented.String())
+		assert.Equal(t, wireErr.Message, "/connect.ping.v1.PingService/Missing is not implemented")
+	})
+}
@@ -19,6 +19,11 @@ import (
 	"context"
 	"io"
 	"net/http"
+	"sync"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"google.golang.org/protobuf/proto"
 )
 
 // A ClientOption configures a [Client].
@@ -35,8 +40,11 @@ type ClientOption interface {
 // preferred, and the last registered algorithm is the most preferred.
 //
 // It's safe to use this option liberally: servers will ignore any
-// compression algorithms they don't support. To compress requests, pair this
-// option with [WithSendCompression]. To remove support for a
+// compression algorithms they don't support. Accepting an algorithm doesn't
+// compress requests: clients advertise every accepted algorithm (in the
+// Grpc-Accept-Encoding header, with gRPC and gRPC-Web) whether or not they
+// compress what they send. To compress requests, pair this option with
+// [WithSendCompression]. To remove support for a
 // previously-registered compression algorithm, use WithAcceptCompression with
 // nil decompressor and compressor constructors.
 //
@@ -71,19 +79,206 @@ func WithGRPCWeb() ClientOption {
 	return &grpcOption{web: true}
 }
 
+// WithGRPCWebTrailers controls where gRPC-Web clients look for trailers, which
+// carry the RPC's status. The gRPC-Web specification sends trailers in a frame
+// at the end of the response body, but some servers send them as HTTP trailers
+// instead. Force one location or the other for servers that send
+// misleading trailers in both places.
+//
+// By default, clients use [GRPCWebTrailersAuto]. This option has no effect
+// unless the client uses [WithGRPCWeb].
+func WithGRPCWebTrailers(mode GRPCWebTrailerMode) ClientOption {
+	return &grpcWebTrailersOption{mode: mode}
+}
+
+// WithHTTP3 tells the client that its [HTTPClient] uses HTTP/3, typically via a
+// QUIC round tripper from a third-party package. The Connect protocol works
+// unchanged over HTTP/3, including bidirectional streaming: it never relies
+// on HTTP trailers, since unary responses carry trailers as prefixed headers
+// and streaming responses send them in the final message of the body.
+//
+// The gRPC protocols are another matter. HTTP/3 round trippers don't all
+// surface HTTP trailers, so with this option gRPC-Web clients only read
+// trailers from the response body, as if configured with
+// [GRPCWebTrailersBody], unless [WithGRPCWebTrailers] chooses otherwise. gRPC
+// can't work without HTTP trailers, so clients using [WithGRPC] over HTTP/3
+// need a round tripper that surfaces them: with one that doesn't, every RPC
+// fails because the response is missing its status.
+func WithHTTP3() ClientOption {
+	return &http3Option{}
+}
+
+// WithMaxResponseBytes limits the size of each response message the client
+// will accept. It's the client-only counterpart to [WithReadMaxBytes]: the
+// limit applies to each message in a server stream and to the single message
+// in a unary response. Connect checks both the size declared by the message
+// envelope and the size after decompression, so a server can't force the
+// client to buffer more than the limit. Oversized messages fail the call with
+// [CodeResourceExhausted].
+//
+// Setting WithMaxResponseBytes to zero allows any message size. By default,
+// clients accept responses of any size.
+func WithMaxResponseBytes(maxBytes int) ClientOption {
+	return &readMaxBytesOption{Max: maxBytes}
+}
+
+// WithMaxConcurrentCalls sheds load locally by limiting how many calls the
+// client has in flight. Once the limit is reached, new calls fail immediately
+// with [CodeResourceExhausted] without contacting the server. Unary calls hold
+// their slot until they return, and streaming calls hold theirs until
+// CloseResponse is called (directly, or by closing the stream), so callers
+// must always close streams.
+//
+// The limit is shared by every client constructed with the same option, so
+// passing it to a generated service client limits calls across all its
+// methods. To wait for a slot rather than failing immediately, use
+// [WithMaxConcurrentCallsWait].
+//
+// By default, clients don't limit concurrent calls.
+func WithMaxConcurrentCalls(limit int) ClientOption {
+	return WithInterceptors(newCallLimitInterceptor(limit, 0))
+}
+
+// WithMaxConcurrentCallsWait is like [WithMaxConcurrentCalls], but calls
+// made while the limit is reached wait up to the supplied timeout for a slot
+// to free up before failing with [CodeResourceExhausted]. Calls whose
+// contexts end while waiting fail with [CodeCanceled] or
+// [CodeDeadlineExceeded].
+func WithMaxConcurrentCallsWait(limit int, timeout time.Duration) ClientOption {
+	return WithInterceptors(newCallLimitInterceptor(limit, timeout))
+}
+
 // WithProtoJSON configures a client to send JSON-encoded data instead of
 // binary Protobuf. It uses the standard Protobuf JSON mapping as implemented
 // by [google.golang.org/protobuf/encoding/protojson]: fields are named using
 // lowerCamelCase, zero values are omitted, missing required fields are errors,
 // enums are emitted as strings, etc.
 func WithProtoJSON() ClientOption {
-	return WithCodec(&protoJSONCodec{codecNameJSON})
+	return WithCodec(&protoJSONCodec{name: codecNameJSON})
+}
+
+// WithStableJSON configures clients and handlers to marshal JSON with stable
+// output: the same message always produces the same bytes, which makes
+// request and response bodies safe to hash (for example, to derive
+// idempotency keys). As with [WithProtoJSON], it uses the standard Protobuf
+// JSON mapping, and it doesn't change how JSON is unmarshaled. Map keys are
+// sorted, and the whitespace that protojson randomly inserts is removed.
+//
+// When applied to a client, WithStableJSON also configures the client to send
+// JSON-encoded requests. When applied to a handler, it replaces the default
+// JSON codecs, so that responses to JSON requests are stable.
+func WithStableJSON() Option {
+	return &stableJSONOption{}
+}
+
+// WithRequestSigner lets clients sign each request's body, for example by
+// setting a header containing an HMAC of the body. The sign function runs
+// after all interceptors, once the request message has been marshaled and
+// compressed, just before the request is sent. It receives the exact bytes of
+// the HTTP request body, including any compression and, for gRPC and
+// streaming protocols, the message envelope, and may modify the request
+// headers. If sign returns an error, the call fails without contacting the
+// server; errors that aren't [*Error]s are coded as [CodeInternal].
+//
+// Only requests sent as a single body can be signed: unary and
+// server-streaming calls. Client-streaming and bidirectional calls send their
+// headers before any messages, so they're never signed. GET requests have no
+// body, so sign receives an empty body. To sign the message before
+// compression and framing, use [WithUncompressedRequestSigner] instead.
+//
+// By default, requests aren't signed.
+func WithRequestSigner(sign func(ctx context.Context, body []byte, header http.Header) error) ClientOption {
+	return &requestSignerOption{signer: &requestSigner{sign: sign}}
+}
+
+// WithUncompressedRequestSigner is like [WithRequestSigner], but sign receives
+// the marshaled request message before compression and without any envelope.
+// Servers verifying the signature must decompress and unwrap the message
+// first, but the signature doesn't depend on the compression settings. For GET
+// requests, sign receives the message carried in the URL.
+func WithUncompressedRequestSigner(sign func(ctx context.Context, body []byte, header http.Header) error) ClientOption {
+	return &requestSignerOption{signer: &requestSigner{sign: sign, uncompressed: true}}
+}
+
+// WithRequestMutator configures the client to call mutate with each HTTP
+// request just before it's sent, so that it can adjust fields other than
+// headers: for example, to set the Host or add query parameters for routing.
+// The function runs after the protocol headers are set, any request signer
+// has run, and the Host header (if any) has been copied to the request's Host
+// field, so it can override all of them. If it returns an error, the call
+// fails without sending anything: errors other than *[Error] have
+// [CodeInternal].
+//
+// The request is shared with the rest of the call, so mutate must not replace
+// the body or its context. Changing the method, the URL's path, or the protocol
+// headers breaks the RPC protocol, and changing signed headers or the body
+// invalidates signatures. By default, requests are sent as built.
+func WithRequestMutator(mutate func(*http.Request) error) ClientOption {
+	return &requestMutatorOption{mutate: mutate}
+}
+
+// WithDisableKeepAlives configures the client to close each connection once
+// its call is done rather than keeping it open for later calls. It suits
+// short-lived programs, such as command-line tools, that shouldn't leave idle
+// sockets behind when they exit. Every call pays for a new connection
+// (including a TLS handshake), so long-running programs should leave
+// connections pooled.
+//
+// The option sets the Close field of each HTTP request, which the transports
+// in net/http and golang.org/x/net/http2 honor. Over HTTP/1.1, that only
+// affects this client's own connections. HTTP/2 multiplexes calls from every
+// client sharing a transport over the same connection, and Request.Close
+// marks that whole connection as not reusable: other clients' calls then need
+// new connections too. Give clients using this option over HTTP/2 their own
+// transport. Streaming calls keep their connection until the stream ends.
+// Custom transports that ignore Request.Close should be configured directly,
+// as with the DisableKeepAlives field of [net/http.Transport]. By default,
+// connections are reused.
+func WithDisableKeepAlives() ClientOption {
+	return &disableKeepAlivesOption{}
+}
+
+// WithUserAgent sets the User-Agent header the client sends with every
+// request, so servers can identify the calling application. If appendDefault
+// is true, the library's default User-Agent (which includes the connect-go
+// and Go versions) follows userAgent, separated by a space: for example,
+// "billing/1.2 connect-go/1.19.0 (go1.22.4)". With gRPC-Web, clients also
+// send the value as X-User-Agent.
+//
+// A User-Agent header set on an individual request takes precedence. If
+// userAgent is empty, clients send the default.
+func WithUserAgent(userAgent string, appendDefault bool) ClientOption {
+	return &userAgentOption{UserAgent: userAgent, AppendDefault: appendDefault}
+}
+
+// WithRetry adds an interceptor that automatically retries failed calls
+// according to the supplied [RetryPolicy]. Between attempts, the client waits
+// with exponential backoff and jitter, honoring any Retry-After header sent
+// with the error. The client gives up early rather than begin an attempt that
+// would start after the context's deadline.
+//
+// Only calls whose request can be replayed are retried: unary calls, and
+// server-streaming calls that fail before receiving any response messages.
+// Client-streaming and bidirectional calls are never retried. Procedures must
+// also be safe to call more than once, so calls are only retried if the
+// procedure's [IdempotencyLevel] isn't [IdempotencyUnknown]; use
+// [WithIdempotency] to declare it.
+//
+// By default, clients don't retry.
+func WithRetry(policy RetryPolicy) ClientOption {
+	return &retryOption{policy: policy}
 }
 
 // WithSendCompression configures the client to use the specified algorithm to
 // compress request messages. If the algorithm has not been registered using
 // [WithAcceptCompression], the client will return errors at runtime.
 //
+// If the server rejects a unary request because it doesn't support the
+// algorithm, the client sends the request again uncompressed. After that, the
+// same [Client] sends all requests, including streams, uncompressed. Each
+// Client learns this separately: other Clients built with this option, such
+// as the other methods of a generated service client, still try compressing.
+//
 // Because some servers don't support compression, clients default to sending
 // uncompressed requests.
 func WithSendCompression(name string) ClientOption {
@@ -131,11 +326,225 @@ func WithCompression(
 	}
 }
 
+// WithResponseCompression configures handlers to compress responses with the
+// named algorithm, independently of how requests are compressed. For example,
+// a handler streaming large responses in reply to small requests can compress
+// only the responses, and "identity" disables response compression even when
+// clients compress their requests. The algorithm must be registered with
+// [WithCompression] (gzip is registered by default).
+//
+// Responses are only compressed with algorithms the client accepts, so
+// handlers fall back to the usual negotiation for clients that don't accept
+// the named algorithm. By default, handlers compress responses the same way
+// as the request or, for uncompressed requests, with the first algorithm the
+// client accepts.
+func WithResponseCompression(name string) HandlerOption {
+	return &responseCompressionOption{Name: name}
+}
+
+// WithDisableCompression configures handlers to never compress responses, no
+// matter which algorithms the client accepts. This protects endpoints that
+// mix secrets with attacker-controlled data from compression side channels
+// such as BREACH. It takes precedence over [WithResponseCompression] and
+// [WithCompression], regardless of the order of the options. Handlers still
+// advertise and decompress the registered algorithms, so compressed requests
+// are read as usual.
+func WithDisableCompression() HandlerOption {
+	return &disableCompressionOption{}
+}
+
+// WithErrorReporter registers a function that observes every error returned
+// by a handler or its interceptors, including panics converted to errors by
+// [WithRecover], just before the error is sent to the client. It's called
+// once per failing RPC, for all stream types. The error is always a *[Error]
+// with the code, message, details, and metadata the client will receive:
+// errors without a code are reported as [CodeUnknown], just as they're sent on
+// the wire. Reporters are often used for logging and metrics, and must be safe
+// to call concurrently.
+//
+// Repeated WithErrorReporter options are all called, in the order they're
+// applied. Errors produced before the handler runs, like those caused by
+// malformed requests, aren't reported.
+func WithErrorReporter(report func(ctx context.Context, spec Spec, err error)) HandlerOption {
+	return &errorReporterOption{report: report}
+}
+
+// WithMethodTimeout limits how long handlers may run, keyed by procedure name
+// (for example, "/acme.foo.v1.FooService/Bar"). When an RPC's procedure is in
+// the map, its context is canceled once the timeout elapses and the client
+// receives [CodeDeadlineExceeded], provided the handler respects context
+// cancellation. Timeouts sent by clients still apply, so the shorter of the
+// two deadlines wins. Procedures missing from the map, or mapped to a
+// non-positive duration, aren't limited.
+//
+// Since HandlerOptions apply to every procedure in a generated service
+// handler, a single map can configure all of its methods.
+func WithMethodTimeout(timeouts map[string]time.Duration) HandlerOption {
+	copied := make(map[string]time.Duration, len(timeouts))
+	for procedure, timeout := range timeouts {
+		copied[procedure] = timeout
+	}
+	return &methodTimeoutOption{timeouts: copied}
+}
+
+// WithSendTimeout limits how long a handler's call to Send may block while
+// writing one message to the client and flushing it. A Send that takes longer,
+// usually because the client is reading very slowly, fails with
+// [CodeDeadlineExceeded]. The stream can't be used after that, so handlers
+// should return the error. The timeout applies to each message separately,
+// not to the whole RPC; see [WithMethodTimeout] for that.
+//
+// The timeout relies on write deadlines, so it only applies when the
+// [http.ResponseWriter] supports them (as the standard library's do). By
+// default, sends don't time out.
+func WithSendTimeout(timeout time.Duration) HandlerOption {
+	return &sendTimeoutOption{timeout: timeout}
+}
+
+// WithFirstMessageTimeout limits how long streaming handlers wait for the
+// client's first message, so that clients can't tie up handlers by opening
+// streams and then sending nothing, or trickling in the first message. If
+// the message doesn't arrive in time, Receive fails with
+// [CodeDeadlineExceeded], which handlers should return to end the stream.
+// Once the first message arrives, later messages may take as long as they
+// like: this isn't a deadline for the RPC, which [WithMethodTimeout] sets.
+// Slow request headers are the HTTP server's concern: see
+// [http.Server.ReadHeaderTimeout].
+//
+// The timeout applies to streaming RPCs and, since they're framed the same
+// way, to unary gRPC and gRPC-Web RPCs. It relies on read deadlines, so it only
+// applies when the [http.ResponseWriter] supports them (as the standard
+// library's do). By default, handlers wait as long as the RPC's deadline
+// allows.
+func WithFirstMessageTimeout(timeout time.Duration) HandlerOption {
+	return &firstMessageTimeoutOption{timeout: timeout}
+}
+
+// WithAutoFlush controls whether streaming handlers flush each response
+// message to the client as it's sent, which they do by default. Disabling
+// auto-flush lets handlers that send many small messages batch them into
+// fewer writes: messages stay buffered until the handler calls
+// [ServerStream.Flush] or [BidiStream.Flush], until [WithFlushThreshold]
+// messages are waiting, or until the handler returns. The HTTP server may
+// still write its buffer out when it fills.
+func WithAutoFlush(enabled bool) HandlerOption {
+	return &autoFlushOption{enabled: enabled}
+}
+
+// WithFlushThreshold sets how many response messages streaming handlers
+// buffer before flushing, when auto-flush is disabled with [WithAutoFlush].
+// Handlers may still flush earlier with [ServerStream.Flush]. By default,
+// there's no threshold, so buffered messages wait for an explicit flush.
+func WithFlushThreshold(messages int) HandlerOption {
+	return &flushThresholdOption{messages: messages}
+}
+
 // WithHandlerOptions composes multiple HandlerOptions into one.
 func WithHandlerOptions(options ...HandlerOption) HandlerOption {
 	return &handlerOptionsOption{options}
 }
 
+// WithHTTPStatusMapper overrides the HTTP status codes handlers use for
+// errors in unary Connect RPCs. By default, Connect maps each [Code] to the
+// status documented in the protocol specification. The supplied function only
+// changes the HTTP status line: the error code in the response body is
+// unchanged and remains authoritative, so Connect clients see the same error
+// regardless of the status.
+//
+// If the function returns anything other than a 4xx or 5xx status (zero, for
+// example), the default status is used. This option has
+// no effect on streaming Connect RPCs or on the gRPC and gRPC-Web protocols,
+// all of which send errors with an HTTP 200 status.
+func WithHTTPStatusMapper(mapper func(Code) int) HandlerOption {
+	return &httpStatusMapperOption{mapper: mapper}
+}
+
+// WithConnectErrorFields adds extra top-level fields to the JSON bodies of
+// errors in unary Connect RPCs: for example, a request ID that a browser
+// client expects alongside the code and message. The supplied function
+// receives the request context and the error being sent, and returns the
+// fields to add. Each value is encoded with [encoding/json].
+//
+// The standard "code", "message", and "details" fields can't be overridden,
+// so Connect clients still decode the same error. If the function returns
+// nil or an empty map, or if any of the fields can't be encoded, the body is
+// unchanged. This option has no effect on
+// streaming Connect RPCs or on the gRPC and gRPC-Web protocols, which send
+// errors in trailers or end-of-stream messages.
+func WithConnectErrorFields(fields func(ctx context.Context, err *Error) map[string]any) HandlerOption {
+	return &connectErrorFieldsOption{fields: fields}
+}
+
+// WithNewlineDelimitedJSON lets streaming Connect handlers respond with
+// newline-delimited JSON (JSONL) instead of the length-prefixed streaming
+// envelope. It's useful for tools that can consume a stream of JSON objects
+// but can't parse the binary envelope.
+//
+// Handlers use JSONL only when the request is JSON-encoded and its Accept
+// header includes application/jsonl. The response then has the
+// application/jsonl Content-Type, each message is compacted and written as
+// one uncompressed line, and the stream ends with a line holding the usual end-of-stream
+// message under an "endStream" key:
+//
+//	{"number":"1"}
+//	{"number":"2"}
+//	{"endStream":{"error":{"code":"unavailable","message":"try later"}}}
+//
+// Requests still use the standard streaming envelope. This option has no
+// effect on unary RPCs or on the gRPC and gRPC-Web protocols.
+func WithNewlineDelimitedJSON() HandlerOption {
+	return &newlineDelimitedJSONOption{}
+}
+
+// WithResponseTrailers adds an interceptor that calls the supplied function
+// after the handler returns, but before the response trailers are sent. The
+// function receives the trailers and the handler's error, if any, so it can
+// add metadata that depends on the outcome of the RPC: for example, a
+// Server-Timing trailer. For unary RPCs that fail, it receives the error's
+// metadata instead, since there's no response.
+//
+// Like all trailers, the ones set here reach clients as HTTP trailers with
+// gRPC and as part of the body with gRPC-Web and streaming Connect. Unary
+// Connect responses send trailers as headers prefixed with "Trailer-", and
+// send error metadata as plain headers. The function must be safe to call
+// concurrently.
+func WithResponseTrailers(set func(ctx context.Context, spec Spec, trailer http.Header, err error)) HandlerOption {
+	return WithInterceptors(&responseTrailerInterceptor{set: set})
+}
+
+// WithResponseValidator adds an interceptor that validates each message a
+// handler sends, before it's serialized. Unary RPCs validate their response
+// once, and streaming RPCs validate every message passed to Send. If the
+// function returns an error, the message isn't sent and the RPC fails with
+// [CodeInternal] instead, since an invalid response is a server bug. The
+// function must be safe to call concurrently.
+//
+// The validator only sees the messages that pass through it, so any
+// interceptors registered before this option can still modify responses after
+// they're validated.
+func WithResponseValidator(validate func(ctx context.Context, spec Spec, message any) error) HandlerOption {
+	return WithInterceptors(&responseValidatorInterceptor{validate: validate})
+}
+
+// WithValidation adds an interceptor that checks each request message a
+// handler receives, typically against protovalidate rules, so that handlers
+// don't have to. Unary RPCs validate their request before the handler runs,
+// and streaming RPCs validate every message as it's received. Invalid
+// messages fail the RPC with [CodeInvalidArgument] and a google.rpc.BadRequest
+// error detail listing the violations; the handler never sees them. If the
+// validator itself fails, the RPC fails with [CodeInternal]. Messages that
+// aren't Protobuf messages aren't validated. The validator must be safe to
+// call concurrently.
+func WithValidation(validator Validator) HandlerOption {
+	return WithInterceptors(&validationInterceptor{validator: validator})
+}
+
+// WithDrainer adds an interceptor that stops handlers from serving RPCs once
+// the [Drainer] starts draining. See [Drainer] for details.
+func WithDrainer(drainer *Drainer) HandlerOption {
+	return WithInterceptors(&drainInterceptor{drainer: drainer})
+}
+
 // WithRecover adds an interceptor that recovers from panics. The supplied
 // function receives the context, [Spec], request headers, and the recovered
 // value (which may be nil). It must return an error to send back to the
@@ -151,7 +560,75 @@ func WithHandlerOptions(options ...HandlerOption) HandlerOption {
 // RPC-specific data during panics and send a more detailed error to
 // clients.
 func WithRecover(handle func(context.Context, Spec, http.Header, any) error) HandlerOption {
-	return WithInterceptors(&recoverHandlerInterceptor{handle: handle})
+	return WithInterceptors(&recoverHandlerInterceptor{
+		handle: func(ctx context.Context, spec Spec, header http.Header, panicValue any, _ []byte) error {
+			return handle(ctx, spec, header, panicValue)
+		},
+	})
+}
+
+// WithPanicHandling configures what handlers do when the RPC implementation or
+// an interceptor panics. [PanicRethrow] lets the panic propagate,
+// [PanicRecoverToInternal] sends clients a [CodeInternal] error, and
+// [PanicCustom] sends clients an error of your choosing. If the option is
+// used more than once, the last use wins.
+//
+// Panics are recovered outside all of the handler's interceptors, so panics
+// in interceptors are handled too, but interceptors never see the panic or
+// the error that replaces it. As with [WithRecover], panics with
+// [http.ErrAbortHandler] always propagate.
+//
+// By default, handlers let panics propagate.
+func WithPanicHandling(handling PanicHandling) HandlerOption {
+	return &panicHandlingOption{handling: handling}
+}
+
+// RequireHeaders adds an interceptor that rejects requests missing any of the
+// named headers, or sending them with an empty value, before the handler runs.
+// Streaming RPCs are checked once, when the stream starts. Rejected RPCs fail
+// with the supplied code; if it isn't a valid [Code], they fail with
+// [CodeInvalidArgument].
+func RequireHeaders(code Code, names ...string) HandlerOption {
+	return WithInterceptors(newRequireHeadersInterceptor(code, names))
+}
+
+// WithRejectUnknownJSON configures handlers to reject JSON requests that
+// contain fields missing from the Protobuf schema, failing the RPC with
+// [CodeInvalidArgument]. By default, handlers ignore unknown fields, so
+// clients with a newer version of the schema can still call older servers.
+//
+// This option only affects how the built-in JSON codecs (including the one
+// registered by [WithStableJSON]) unmarshal requests. Binary Protobuf
+// requests, custom codecs, and clients are unaffected.
+func WithRejectUnknownJSON() HandlerOption {
+	return &rejectUnknownJSONOption{}
+}
+
+// WithJSONInt64Encoding configures how the built-in JSON codecs (including
+// the one registered by [WithStableJSON]) marshal 64-bit integers. The
+// standard Protobuf JSON mapping encodes them as strings, since JavaScript
+// can't represent every 64-bit integer as a number; [JSONInt64NumberIfSafe]
+// and [JSONInt64Number] relax that for consumers that expect numbers.
+//
+// Unmarshaling is unchanged: the JSON codecs always accept both numbers and
+// strings, and decode integers of any size exactly. Binary Protobuf and custom
+// codecs are unaffected. By default, 64-bit integers are encoded as strings.
+func WithJSONInt64Encoding(encoding JSONInt64Encoding) Option {
+	return &jsonInt64EncodingOption{encoding: encoding}
+}
+
+// WithEmitDefaultValues configures the built-in JSON codecs (including the one
+// registered by [WithStableJSON]) to marshal fields set to their zero value,
+// such as 0, false, and "", which the Protobuf JSON mapping otherwise omits.
+// It maps to protojson's EmitDefaultValues, so unset message fields and
+// fields with explicit presence are still omitted when unset. This suits
+// consumers that expect every field to be present.
+//
+// Only marshaling is affected: the JSON codecs always accept both forms.
+// Binary Protobuf and custom codecs are unaffected. By default, zero values
+// are omitted.
+func WithEmitDefaultValues() Option {
+	return &emitDefaultValuesOption{}
 }
 
 // WithRequireConnectProtocolHeader configures the Handler to require requests
@@ -166,6 +643,15 @@ func WithRequireConnectProtocolHeader() HandlerOption {
 	return &requireConnectProtocolHeaderOption{}
 }
 
+// WithoutProcedureValidation allows handlers for procedures that don't have
+// the "/package.Service/Method" shape of Protobuf methods. By default, the
+// handler constructors panic if the procedure is malformed, so that typos
+// surface at startup rather than as 404s at runtime. Use this option for
+// custom routing schemes: for example, procedures served under a path prefix.
+func WithoutProcedureValidation() HandlerOption {
+	return &skipProcedureValidationOption{}
+}
+
 // WithConditionalHandlerOptions allows procedures in the same service to have
 // different configurations: for example, one procedure may need a much larger
 // WithReadMaxBytes setting than the others.
@@ -230,6 +716,120 @@ func WithCodec(codec Codec) Option {
 	return &codecOption{Codec: codec}
 }
 
+// WithCodecAliases registers a codec with a handler under its own name and
+// each of the aliases, so that clients may choose it with any of them. For
+// example, registering a JSON codec with the alias "vnd.acme+json" lets
+// unary Connect handlers accept both "application/json" and
+// "application/vnd.acme+json" requests. Responses always use the codec's
+// canonical name, as returned by its Name method, and so does [Peer].
+//
+// Empty aliases are ignored, and registering a codec with an empty name is a
+// no-op. As with [WithCodec], an alias that matches another codec's name
+// replaces that codec.
+func WithCodecAliases(codec Codec, aliases ...string) HandlerOption {
+	return &codecAliasesOption{codec: codec, aliases: aliases}
+}
+
+// WithBytesCodec registers a codec that sends and receives already-serialized
+// [RawMessage] values, without marshaling or unmarshaling them. It's meant for
+// proxies and other intermediaries that forward messages without knowing their
+// schema.
+//
+// The codec is registered under the supplied name, which should match the
+// serialization the bytes actually use: for example, "proto" for binary
+// Protobuf or "json" for JSON. Peers see the same Content-Type they would with
+// the standard codec of that name, so they can't tell the difference. As with
+// [WithCodec], a codec named "proto" replaces the default Protobuf codec.
+// Messages other than RawMessage, including the protocol-specific messages
+// used to send gRPC errors, fall back to the standard Protobuf binary encoding.
+func WithBytesCodec(name string) Option {
+	return WithCodec(&bytesCodec{name: name})
+}
+
+// WithProtoMarshalOptions configures how the binary Protobuf codec marshals
+// messages. For example, Deterministic makes the output reproducible, which
+// helps when messages are hashed or cached by their bytes. UseCachedSize is
+// only safe if nothing modifies messages between the Size call that cached
+// their size and sending them: see [proto.MarshalOptions].
+//
+// The options apply to the default Protobuf codec, and not to codecs supplied
+// with [WithCodec]. Stable marshaling, as used for Connect GET requests, is
+// always deterministic. By default, the codec uses the zero
+// proto.MarshalOptions.
+func WithProtoMarshalOptions(options proto.MarshalOptions) Option {
+	return &protoMarshalOptionsOption{Options: options}
+}
+
+// WithProtoUnmarshalOptions configures how the binary Protobuf codec
+// unmarshals messages: for example, to resolve extensions from a registry
+// other than [google.golang.org/protobuf/reflect/protoregistry.GlobalTypes] or to limit recursion. As with
+// [WithProtoMarshalOptions], the options apply only to the default Protobuf
+// codec. By default, the codec uses the zero proto.UnmarshalOptions.
+func WithProtoUnmarshalOptions(options proto.UnmarshalOptions) Option {
+	return &protoUnmarshalOptionsOption{Options: options}
+}
+
+// WithProtoText registers a codec that encodes messages using the Protobuf
+// text format, as implemented by
+// [google.golang.org/protobuf/encoding/prototext]. The text format is meant for
+// humans, so it's useful when debugging or writing integration tests but
+// shouldn't be used in production. To make diffs readable, the codec's output
+// is multi-line and stable.
+//
+// The codec is named "prototext", so it uses the Content-Types
+// "application/prototext" for unary Connect RPCs, "application/connect+prototext"
+// for streaming Connect RPCs, and "application/grpc+prototext" for gRPC. When
+// applied to a client, WithProtoText also configures the client to send
+// text-encoded requests. Handlers don't support the text format by default.
+func WithProtoText() Option {
+	return WithCodec(&protoTextCodec{})
+}
+
+// WithBrotli registers brotli compression, under the name "br", with a client
+// or handler. It uses [github.com/andybalholm/brotli] at the default quality
+// level.
+//
+// Handlers with brotli enabled compress responses with brotli when clients ask
+// for it, and continue to support gzip for clients that don't. Clients with
+// brotli enabled prefer it over gzip when asking servers to compress
+// responses, but still send uncompressed requests by default: pair this option
+// with WithSendCompression("br") to compress requests.
+func WithBrotli() Option {
+	return &compressionOption{
+		Name: compressionBrotli,
+		CompressionPool: newCompressionPool(
+			func() Decompressor { return &brotliDecompressor{brotli.NewReader(http.NoBody)} },
+			func() Compressor { return brotli.NewWriter(io.Discard) },
+		),
+	}
+}
+
+// WithGzipLevel configures the gzip compressor registered by default with
+// clients and handlers to use the given compression level, which must be
+// between [gzip.HuffmanOnly] and [gzip.BestCompression]. Use [gzip.BestSpeed]
+// to save CPU on large responses, or [gzip.BestCompression] to save bandwidth
+// when CPU is cheap. By default, gzip uses [gzip.DefaultCompression].
+//
+// If the level is invalid, clients return an error from every call and
+// handlers panic when they're constructed. WithGzipLevel only tunes gzip if
+// it's still registered: it has no effect if [WithCompression] or
+// [WithAcceptCompression] has removed gzip.
+func WithGzipLevel(level int) Option {
+	if _, err := gzip.NewWriterLevel(io.Discard, level); err != nil {
+		return &gzipLevelOption{err: errorf(CodeUnknown, "invalid gzip compression level %d", level)}
+	}
+	return &gzipLevelOption{
+		pool: newCompressionPool(
+			func() Decompressor { return &gzip.Reader{} },
+			func() Compressor {
+				// We've already checked the level, so this can't fail.
+				writer, _ := gzip.NewWriterLevel(io.Discard, level)
+				return writer
+			},
+		),
+	}
+}
+
 // WithCompressMinBytes sets a minimum size threshold for compression:
 // regardless of compressor configuration, messages smaller than the configured
 // minimum are sent uncompressed.
@@ -241,6 +841,25 @@ func WithCompressMinBytes(minBytes int) Option {
 	return &compressMinBytesOption{Min: minBytes}
 }
 
+// WithCompressionHeuristic skips compressing messages that compress poorly,
+// such as images or data that's already compressed. Before compressing each
+// message, connect compresses its first sampleBytes bytes: if the sample's
+// compression ratio (its uncompressed size divided by its compressed size) is
+// less than minRatio, the message is sent uncompressed. For example, a
+// minRatio of 1.25 requires the sample to shrink by at least a fifth.
+// Messages no larger than the sample are compressed once and judged by the
+// result.
+//
+// The heuristic trades a little CPU for each compressible message (the
+// compressed sample is thrown away) against the cost of compressing entire
+// incompressible ones, so it's most useful for large messages. Sampling a few
+// kilobytes is usually enough. By default, and if sampleBytes isn't positive,
+// there's no heuristic and every message at least as large as
+// [WithCompressMinBytes] is compressed.
+func WithCompressionHeuristic(sampleBytes int, minRatio float64) Option {
+	return &compressionHeuristicOption{SampleBytes: sampleBytes, MinRatio: minRatio}
+}
+
 // WithReadMaxBytes limits the performance impact of pathologically large
 // messages sent by the other party. For handlers, WithReadMaxBytes limits the size
 // of a message that the client can send. For clients, WithReadMaxBytes limits the
@@ -270,6 +889,53 @@ func WithSendMaxBytes(maxBytes int) Option {
 	return &sendMaxBytesOption{Max: maxBytes}
 }
 
+// WithBufferPool configures clients and handlers to borrow the buffers they
+// read and write messages with from the supplied pool, rather than from a
+// pool of their own. Sharing one pool between many clients and handlers
+// lets them reuse each other's buffers, which cuts allocations in processes
+// that create clients often or serve many procedures.
+//
+// The pool holds *[bytes.Buffer] values: anything else it returns is ignored,
+// and its New function may be nil. Buffers are reset before they're returned
+// to the pool, and buffers that have grown larger than 8 MiB are left for the
+// garbage collector. They're returned once the message they hold has been
+// sent or unmarshaled, including when an RPC fails, so [Codec]
+// implementations must not keep references to the data passed to Unmarshal.
+// The built-in codecs copy any data they retain.
+//
+// Calling WithBufferPool with nil is a no-op. By default, each client and
+// handler has its own pool.
+func WithBufferPool(pool *sync.Pool) Option {
+	return &bufferPoolOption{Pool: pool}
+}
+
+// WithMaxHeaderBytes limits the total size of RPC metadata, counted as the
+// lengths of all header keys and values. Handlers reject requests whose
+// headers exceed the limit. Clients reject responses whose headers or
+// trailers exceed it, including the trailers that the Connect and gRPC-Web
+// protocols send in the body of streaming responses, and errors whose
+// metadata exceeds it. Rejected RPCs fail with [CodeResourceExhausted].
+//
+// The limit applies on top of any limits enforced by [http.Server] and the
+// HTTP client's transport, which only see HTTP headers. Setting maxBytes to
+// zero or less allows metadata of any size, which is the default. If the
+// option is used more than once, the last limit applies.
+func WithMaxHeaderBytes(maxBytes int) Option {
+	return &maxHeaderBytesOption{Max: maxBytes}
+}
+
+// WithWireStats registers a function that receives [WireStats] for each RPC.
+// It's called once per call, after the call completes: for clients, when the
+// response is closed, and for handlers, after the response has been written.
+// Stats are reported for failed calls too, and cover every message sent and
+// received before the failure.
+//
+// Registering multiple functions calls each of them in order. The supplied
+// functions must be safe to call concurrently.
+func WithWireStats(report func(WireStats)) Option {
+	return &wireStatsOption{report: report}
+}
+
 // WithIdempotency declares the idempotency of the procedure. This can determine
 // whether a procedure call can safely be retried, and may affect which request
 // modalities are allowed for a given procedure call.
@@ -294,6 +960,13 @@ func WithIdempotency(idempotencyLevel IdempotencyLevel) Option {
 // reverse proxies, and browsers' built-in caching. Note, however, that servers
 // don't automatically set any cache headers; you can set cache headers using
 // interceptors or by adding headers in individual procedure implementations.
+// To make conditional requests and reuse responses in the client, see
+// [WithResponseCache].
+//
+// Requests that can't be sent as GETs, because their URL would be too long
+// (see [WithHTTPGetMaxURLSize]) or because the codec doesn't support stable
+// marshaling, are sent as POSTs instead, unless fallback is disabled with
+// [WithHTTPGetMaxURLSize].
 //
 // By default, all requests are made as HTTP POSTs.
 func WithHTTPGet() ClientOption {
@@ -351,6 +1024,95 @@ func WithInterceptors(interceptors ...Interceptor) Option {
 	return &interceptorsOption{interceptors}
 }
 
+// WithRequestID adds an interceptor that gives every RPC a request ID, carried
+// in the named header. Use [RequestIDFromContext] to retrieve the ID, for
+// example to include it in logs.
+//
+// Handlers use the ID sent by the client or, if there isn't one, call gen to
+// create a new one. Either way, the ID is added to the context and echoed in
+// the response headers (or in the error metadata, for failed unary RPCs).
+// Clients send the ID from the request headers, if the caller set one, or
+// from the context, so handlers that call other services propagate their
+// inbound ID. Otherwise, clients call gen to create one.
+//
+// WithRequestID only reads and writes the named header, so it's safe to use
+// alongside tracing instrumentation. If gen is nil, IDs are 32 random
+// hexadecimal characters.
+func WithRequestID(header string, gen func() string) Option {
+	return WithInterceptors(newRequestIDInterceptor(header, gen))
+}
+
+// WithMessageObserver adds an interceptor that shows every message an RPC
+// sends and receives to the supplied callbacks, which is useful for audit
+// logs and debugging. Unlike request and response bodies seen by HTTP
+// middleware, the messages are already decoded: the callbacks receive the
+// same values the application sends or receives, so nothing is decoded
+// twice. Clients send requests and receive responses; handlers do the
+// reverse.
+//
+// Streaming messages are observed after each successful Send or Receive, and
+// unary messages as they pass through the interceptor chain. Messages that
+// fail to send or arrive aren't observed. Either callback may be nil. The
+// callbacks must not modify or retain the messages, since the application may
+// reuse them, and must be safe to call concurrently.
+func WithMessageObserver(
+	onReceive func(ctx context.Context, spec Spec, message any),
+	onSend func(ctx context.Context, spec Spec, message any),
+) Option {
+	return WithInterceptors(&messageObserverInterceptor{onReceive: onReceive, onSend: onSend})
+}
+
+// WithMaxStreamMessages limits the number of messages each streaming call may
+// send and receive, counted separately: maxSend bounds the messages passed to
+// Send, and maxReceive bounds the messages returned by Receive. Clients send
+// requests and receive responses; handlers do the reverse. Once a limit is
+// reached, further Sends fail without sending anything, and the next message
+// received makes Receive fail, in both cases with [CodeResourceExhausted].
+// Handlers that return the error end the call with that code.
+//
+// A limit of zero (or less) leaves that direction unbounded. Unary calls
+// aren't affected. By default, streams may carry any number of messages.
+func WithMaxStreamMessages(maxSend, maxReceive int) Option {
+	return WithInterceptors(&streamMessageLimitInterceptor{maxSend: maxSend, maxReceive: maxReceive})
+}
+
+// WithClock sets the [Clock] that clients and handlers use for timeouts and
+// deadlines. It's meant for tests, which can supply a fake clock and advance
+// it rather than wait for deadlines to pass. Deadlines set with the context
+// package are still measured with the real clock: only the deadlines connect
+// sets itself, like those of handlers, follow the fake one. A nil clock is
+// ignored. By default, clients and handlers use the real clock.
+func WithClock(clock Clock) Option {
+	return &clockOption{clock: clock}
+}
+
+// WithStreamKeepalive keeps quiet streams alive with pings, so that NAT
+// gateways and load balancers don't drop them, and detects peers that have
+// gone away without closing the connection. Whenever a stream has sent
+// nothing for interval, it sends an empty keepalive message, which the peer
+// discards. If a stream waiting to receive hears nothing for the peer's
+// interval plus timeout, the call fails with [CodeUnavailable]. If timeout
+// isn't positive, it defaults to 20 seconds.
+//
+// Keepalives are an extension to the Connect, gRPC, and gRPC-Web protocols
+// that only connect-go implements. Clients offer them by sending their
+// interval in milliseconds in a Connect-Keepalive-Ms request header, and
+// handlers accept by sending their own interval in the same response header.
+// Pings are empty envelopes with the 0x40 flag set, which the protocols
+// leave unused; peers only send them once both sides have agreed, so other
+// implementations never see them. Both the client and the handler must
+// enable keepalives, and other clients and servers ignore the offer. Neither
+// side pings until the handler sends its headers, so handlers that may stay
+// quiet at the start of a stream should call Flush on their [ServerStream] or
+// [BidiStream]. Keepalives only apply to streaming calls over HTTP/2 and
+// later.
+//
+// Transports can also keep connections alive with HTTP/2 pings; see
+// [HTTP2Settings]. By default, streams don't send keepalives.
+func WithStreamKeepalive(interval, timeout time.Duration) Option {
+	return &streamKeepaliveOption{interval: interval, timeout: timeout}
+}
+
 // WithOptions composes multiple Options into one.
 func WithOptions(options ...Option) Option {
 	return &optionsOption{options}
@@ -419,6 +1181,82 @@ func (o *codecOption) applyToHandler(config *handlerConfig) {
 	config.Codecs[o.Codec.Name()] = o.Codec
 }
 
+type codecAliasesOption struct {
+	codec   Codec
+	aliases []string
+}
+
+func (o *codecAliasesOption) applyToHandler(config *handlerConfig) {
+	if o.codec == nil || o.codec.Name() == "" {
+		return
+	}
+	WithCodec(o.codec).applyToHandler(config)
+	for _, alias := range o.aliases {
+		if alias != "" {
+			config.Codecs[alias] = o.codec
+		}
+	}
+}
+
+type retryOption struct {
+	policy RetryPolicy
+}
+
+func (o *retryOption) applyToClient(config *clientConfig) {
+	interceptor := newRetryInterceptor(o.policy)
+	interceptor.clock = func() Clock { return config.Clock }
+	WithInterceptors(interceptor).applyToClient(config)
+}
+
+type clockOption struct {
+	clock Clock
+}
+
+func (o *clockOption) applyToClient(config *clientConfig) {
+	if o.clock != nil {
+		config.Clock = o.clock
+	}
+}
+
+func (o *clockOption) applyToHandler(config *handlerConfig) {
+	if o.clock != nil {
+		config.Clock = o.clock
+	}
+}
+
+type streamKeepaliveOption struct {
+	interval time.Duration
+	timeout  time.Duration
+}
+
+func (o *streamKeepaliveOption) applyToClient(config *clientConfig) {
+	config.KeepaliveInterval, config.KeepaliveTimeout = o.settings()
+}
+
+func (o *streamKeepaliveOption) applyToHandler(config *handlerConfig) {
+	config.KeepaliveInterval, config.KeepaliveTimeout = o.settings()
+}
+
+func (o *streamKeepaliveOption) settings() (time.Duration, time.Duration) {
+	if o.timeout <= 0 {
+		return o.interval, defaultKeepaliveTimeout
+	}
+	return o.interval, o.timeout
+}
+
+type stableJSONOption struct{}
+
+func (o *stableJSONOption) applyToClient(config *clientConfig) {
+	WithCodec(&stableJSONCodec{protoJSONCodec{name: codecNameJSON}}).applyToClient(config)
+}
+
+func (o *stableJSONOption) applyToHandler(config *handlerConfig) {
+	WithHandlerOptions(
+		WithCodec(&stableJSONCodec{protoJSONCodec{name: codecNameJSON}}),
+		WithCodec(&stableJSONCodec{protoJSONCodec{name: codecNameJSONCharsetUTF8}}),
+	).applyToHandler(config)
+}
+
 type compressionOption struct {
 	Name            string
 	CompressionPool *compressionPool
@@ -452,6 +1290,35 @@ func (o *compressionOption) apply(configuredNames *[]string, configuredPools map
 	*configuredNames = append(*configuredNames, o.Name)
 }
 
+type gzipLevelOption struct {
+	pool *compressionPool
+	err  *Error
+}
+
+func (o *gzipLevelOption) applyToClient(config *clientConfig) {
+	if o.err != nil {
+		config.OptionErr = o.err
+		return
+	}
+	o.apply(config.CompressionPools)
+}
+
+func (o *gzipLevelOption) applyToHandler(config *handlerConfig) {
+	if o.err != nil {
+		panic("connect: " + o.err.Message()) //nolint:forbidigo
+	}
+	o.apply(config.CompressionPools)
+}
+
+func (o *gzipLevelOption) apply(configuredPools map[string]*compressionPool) {
+	// Replace the gzip pool without changing gzip's place in the preference
+	// order, and without registering gzip again if an earlier option removed
+	// it.
+	if _, ok := configuredPools[compressionGzip]; ok {
+		configuredPools[compressionGzip] = o.pool
+	}
+}
+
 type compressMinBytesOption struct {
 	Min int
 }
@@ -464,6 +1331,19 @@ func (o *compressMinBytesOption) applyToHandler(config *handlerConfig) {
 	config.CompressMinBytes = o.Min
 }
 
+type compressionHeuristicOption struct {
+	SampleBytes int
+	MinRatio    float64
+}
+
+func (o *compressionHeuristicOption) applyToClient(config *clientConfig) {
+	config.CompressionHeuristic = compressionHeuristic(*o)
+}
+
+func (o *compressionHeuristicOption) applyToHandler(config *handlerConfig) {
+	config.CompressionHeuristic = compressionHeuristic(*o)
+}
+
 type readMaxBytesOption struct {
 	Max int
 }
@@ -476,6 +1356,18 @@ func (o *readMaxBytesOption) applyToHandler(config *handlerConfig) {
 	config.ReadMaxBytes = o.Max
 }
 
+type maxHeaderBytesOption struct {
+	Max int
+}
+
+func (o *maxHeaderBytesOption) applyToClient(config *clientConfig) {
+	config.MaxHeaderBytes = o.Max
+}
+
+func (o *maxHeaderBytesOption) applyToHandler(config *handlerConfig) {
+	config.MaxHeaderBytes = o.Max
+}
+
 type sendMaxBytesOption struct {
 	Max int
 }
@@ -498,12 +1390,153 @@ func (o *handlerOptionsOption) applyToHandler(config *handlerConfig) {
 	}
 }
 
+type rejectUnknownJSONOption struct{}
+
+func (o *rejectUnknownJSONOption) applyToHandler(config *handlerConfig) {
+	config.RejectUnknownJSON = true
+}
+
+type jsonInt64EncodingOption struct {
+	encoding JSONInt64Encoding
+}
+
+func (o *jsonInt64EncodingOption) applyToClient(config *clientConfig) {
+	config.JSONInt64Encoding = o.encoding
+}
+
+func (o *jsonInt64EncodingOption) applyToHandler(config *handlerConfig) {
+	config.JSONInt64Encoding = o.encoding
+}
+
+type emitDefaultValuesOption struct{}
+
+func (o *emitDefaultValuesOption) applyToClient(config *clientConfig) {
+	config.EmitDefaultJSONValues = true
+}
+
+func (o *emitDefaultValuesOption) applyToHandler(config *handlerConfig) {
+	config.EmitDefaultJSONValues = true
+}
+
+type protoMarshalOptionsOption struct {
+	Options proto.MarshalOptions
+}
+
+func (o *protoMarshalOptionsOption) applyToClient(config *clientConfig) {
+	config.ProtoMarshalOptions = &o.Options
+}
+
+func (o *protoMarshalOptionsOption) applyToHandler(config *handlerConfig) {
+	config.ProtoMarshalOptions = &o.Options
+}
+
+type protoUnmarshalOptionsOption struct {
+	Options proto.UnmarshalOptions
+}
+
+func (o *protoUnmarshalOptionsOption) applyToClient(config *clientConfig) {
+	config.ProtoUnmarshalOptions = &o.Options
+}
+
+func (o *protoUnmarshalOptionsOption) applyToHandler(config *handlerConfig) {
+	config.ProtoUnmarshalOptions = &o.Options
+}
+
+type skipProcedureValidationOption struct{}
+
+func (o *skipProcedureValidationOption) applyToHandler(config *handlerConfig) {
+	config.SkipProcedureValidation = true
+}
+
 type requireConnectProtocolHeaderOption struct{}
 
 func (o *requireConnectProtocolHeaderOption) applyToHandler(config *handlerConfig) {
 	config.RequireConnectProtocolHeader = true
 }
 
+type errorReporterOption struct {
+	report func(context.Context, Spec, error)
+}
+
+func (o *errorReporterOption) applyToHandler(config *handlerConfig) {
+	if o.report == nil {
+		return
+	}
+	current := config.ErrorReporter
+	if current == nil {
+		config.ErrorReporter = o.report
+		return
+	}
+	config.ErrorReporter = func(ctx context.Context, spec Spec, err error) {
+		current(ctx, spec, err)
+		o.report(ctx, spec, err)
+	}
+}
+
+type methodTimeoutOption struct {
+	timeouts map[string]time.Duration
+}
+
+func (o *methodTimeoutOption) applyToHandler(config *handlerConfig) {
+	if timeout, ok := o.timeouts[config.Procedure]; ok {
+		config.Timeout = timeout
+	}
+}
+
+type firstMessageTimeoutOption struct {
+	timeout time.Duration
+}
+
+func (o *firstMessageTimeoutOption) applyToHandler(config *handlerConfig) {
+	config.FirstMessageTimeout = o.timeout
+}
+
+type autoFlushOption struct {
+	enabled bool
+}
+
+func (o *autoFlushOption) applyToHandler(config *handlerConfig) {
+	config.ManualFlush = !o.enabled
+}
+
+type flushThresholdOption struct {
+	messages int
+}
+
+func (o *flushThresholdOption) applyToHandler(config *handlerConfig) {
+	config.FlushThreshold = o.messages
+}
+
+type sendTimeoutOption struct {
+	timeout time.Duration
+}
+
+func (o *sendTimeoutOption) applyToHandler(config *handlerConfig) {
+	config.SendTimeout = o.timeout
+}
+
+type httpStatusMapperOption struct {
+	mapper func(Code) int
+}
+
+func (o *httpStatusMapperOption) applyToHandler(config *handlerConfig) {
+	config.HTTPStatusMapper = o.mapper
+}
+
+type connectErrorFieldsOption struct {
+	fields func(context.Context, *Error) map[string]any
+}
+
+func (o *connectErrorFieldsOption) applyToHandler(config *handlerConfig) {
+	config.ConnectErrorFields = o.fields
+}
+
+type newlineDelimitedJSONOption struct{}
+
+func (o *newlineDelimitedJSONOption) applyToHandler(config *handlerConfig) {
+	config.NewlineDelimitedJSON = true
+}
+
 type idempotencyOption struct {
 	idempotencyLevel IdempotencyLevel
 }
@@ -524,6 +1557,21 @@ func (o *grpcOption) applyToClient(config *clientConfig) {
 	config.Protocol = &protocolGRPC{web: o.web}
 }
 
+type grpcWebTrailersOption struct {
+	mode GRPCWebTrailerMode
+}
+
+func (o *grpcWebTrailersOption) applyToClient(config *clientConfig) {
+	config.GRPCWebTrailers = o.mode
+	config.GRPCWebTrailersSet = true
+}
+
+type http3Option struct{}
+
+func (o *http3Option) applyToClient(config *clientConfig) {
+	config.HTTP3 = true
+}
+
 type enableGet struct{}
 
 func (o *enableGet) applyToClient(config *clientConfig) {
@@ -544,14 +1592,60 @@ func (o *enableGet) applyToClient(config *clientConfig) {
 //
 // If fallback is set to true and the URL would be longer than the configured
 // maximum value, the request will be sent as an HTTP POST instead. If fallback
-// is set to false, the request will fail with [CodeResourceExhausted].
+// is set to false, the request will fail with [CodeResourceExhausted]. A
+// maximum of zero or less allows URLs of any size.
 //
-// By default, Connect-protocol clients with GET requests enabled may send a
-// URL of any size.
+// By default, Connect-protocol clients with GET requests enabled send URLs of
+// up to 4096 bytes, and fall back to POST for larger requests.
 func WithHTTPGetMaxURLSize(bytes int, fallback bool) ClientOption {
 	return &getURLMaxBytes{Max: bytes, Fallback: fallback}
 }
 
+// WithResponseCache stores the responses to HTTP GET requests in the supplied
+// [Cache], keyed by procedure and request message. When the server set an
+// Etag on a stored response, later calls send it in an If-None-Match header
+// and a 304 Not Modified is answered from the cache, so the caller receives
+// the stored message without seeing an error. Responses without an Etag, or
+// with Cache-Control: no-store, aren't stored.
+//
+// The cache only applies to Connect-protocol clients configured with
+// [WithHTTPGet] and [IdempotencyNoSideEffects], and it's shared by every
+// caller of the client: don't use it for responses that vary by request
+// header, such as per-user data. Callers that set If-None-Match themselves
+// bypass the cache and receive [NewNotModifiedError] errors as usual.
+//
+// By default, clients don't cache responses.
+func WithResponseCache(cache Cache) ClientOption {
+	return &responseCacheOption{cache: cache}
+}
+
+// WithHandlerResponseCache stores handlers' responses in the supplied [Cache]
+// and answers repeated requests from it for up to ttl, without calling the
+// procedure's implementation. Interceptors still run for every request. If
+// ttl is zero or negative, responses don't expire, though the cache may still
+// evict them. Responses are stored in binary Protobuf; errors and responses
+// with Cache-Control: no-store aren't stored. If several identical requests
+// miss the cache at once, only one calls the implementation and the others
+// wait for its response.
+//
+// The cache only applies to unary procedures marked
+// [IdempotencyNoSideEffects] (see [WithIdempotency]). By default, requests
+// are keyed by procedure and deterministically marshaled request message. If
+// responses depend on anything else, such as the caller's identity, supply a
+// key function: it receives the marshaled message and returns the key, or an
+// empty string to skip the cache for that request. Keys are always scoped to
+// the procedure.
+//
+// By default, handlers don't cache responses.
+func WithHandlerResponseCache(cache Cache, key func(ctx context.Context, spec Spec, message []byte) string, ttl time.Duration) HandlerOption {
+	return &handlerResponseCacheOption{cache: &handlerResponseCache{
+		cache:    cache,
+		key:      key,
+		ttl:      ttl,
+		inflight: make(map[string]chan struct{}),
+	}}
+}
+
 type getURLMaxBytes struct {
 	Max      int
 	Fallback bool
@@ -562,6 +1656,78 @@ func (o *getURLMaxBytes) applyToClient(config *clientConfig) {
 	config.GetUseFallback = o.Fallback
 }
 
+type requestSignerOption struct {
+	signer *requestSigner
+}
+
+func (o *requestSignerOption) applyToClient(config *clientConfig) {
+	config.RequestSigner = o.signer
+}
+
+type requestMutatorOption struct {
+	mutate func(*http.Request) error
+}
+
+func (o *requestMutatorOption) applyToClient(config *clientConfig) {
+	config.RequestMutator = o.mutate
+}
+
+type disableKeepAlivesOption struct{}
+
+func (o *disableKeepAlivesOption) applyToClient(config *clientConfig) {
+	config.DisableKeepAlives = true
+}
+
+type userAgentOption struct {
+	UserAgent     string
+	AppendDefault bool
+}
+
+func (o *userAgentOption) applyToClient(config *clientConfig) {
+	config.UserAgent = o.UserAgent
+	config.UserAgentAppendDefault = o.AppendDefault
+}
+
+type bufferPoolOption struct {
+	Pool *sync.Pool
+}
+
+func (o *bufferPoolOption) applyToClient(config *clientConfig) {
+	if o.Pool != nil {
+		config.BufferPool = newSharedBufferPool(o.Pool)
+	}
+}
+
+func (o *bufferPoolOption) applyToHandler(config *handlerConfig) {
+	if o.Pool != nil {
+		config.BufferPool = newSharedBufferPool(o.Pool)
+	}
+}
+
+type handlerResponseCacheOption struct {
+	cache *handlerResponseCache
+}
+
+func (o *handlerResponseCacheOption) applyToHandler(config *handlerConfig) {
+	config.ResponseCache = o.cache
+}
+
+type responseCacheOption struct {
+	cache Cache
+}
+
+func (o *responseCacheOption) applyToClient(config *clientConfig) {
+	config.ResponseCache = o.cache
+}
+
+type panicHandlingOption struct {
+	handling PanicHandling
+}
+
+func (o *panicHandlingOption) applyToHandler(config *handlerConfig) {
+	config.PanicHandling = o.handling
+}
+
 type interceptorsOption struct {
 	Interceptors []Interceptor
 }
@@ -603,6 +1769,45 @@ func (o *optionsOption) applyToHandler(config *handlerConfig) {
 	}
 }
 
+type wireStatsOption struct {
+	report func(WireStats)
+}
+
+func (o *wireStatsOption) applyToClient(config *clientConfig) {
+	config.WireStats = o.chainWith(config.WireStats)
+}
+
+func (o *wireStatsOption) applyToHandler(config *handlerConfig) {
+	config.WireStats = o.chainWith(config.WireStats)
+}
+
+func (o *wireStatsOption) chainWith(current func(WireStats)) func(WireStats) {
+	if o.report == nil {
+		return current
+	}
+	if current == nil {
+		return o.report
+	}
+	return func(stats WireStats) {
+		current(stats)
+		o.report(stats)
+	}
+}
+
+type responseCompressionOption struct {
+	Name string
+}
+
+func (o *responseCompressionOption) applyToHandler(config *handlerConfig) {
+	config.ResponseCompressionName = o.Name
+}
+
+type disableCompressionOption struct{}
+
+func (o *disableCompressionOption) applyToHandler(config *handlerConfig) {
+	config.DisableCompression = true
+}
+
 type sendCompressionOption struct {
 	Name string
 }
@@ -627,8 +1832,8 @@ func withProtoBinaryCodec() Option {
 
 func withProtoJSONCodecs() HandlerOption {
 	return WithHandlerOptions(
-		WithCodec(&protoJSONCodec{codecNameJSON}),
-		WithCodec(&protoJSONCodec{codecNameJSONCharsetUTF8}),
+		WithCodec(&protoJSONCodec{name: codecNameJSON}),
+		WithCodec(&protoJSONCodec{name: codecNameJSONCharsetUTF8}),
 	)
 }
 
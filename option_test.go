@@ -0,0 +1,119 @@
+// Copyright 2021-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"testing"
+
+	"connectrpc.com/connect/internal/assert"
+)
+
+func TestGroupedOptionsOrdering(t *testing.T) {
+	t.Parallel()
+	// Each interceptor records its name when it runs, and each codec is
+	// registered under the same name so that the last one wins.
+	newRecorder := func() (*[]string, func(string) Interceptor) {
+		var calls []string
+		return &calls, func(name string) Interceptor {
+			return UnaryInterceptorFunc(func(next UnaryFunc) UnaryFunc {
+				return func(ctx context.Context, request AnyRequest) (AnyResponse, error) {
+					calls = append(calls, name)
+					return next(ctx, request)
+				}
+			})
+		}
+	}
+	runChain := func(t *testing.T, interceptor Interceptor) {
+		t.Helper()
+		assert.NotNil(t, interceptor)
+		unary := interceptor.WrapUnary(func(context.Context, AnyRequest) (AnyResponse, error) {
+			return nil, nil //nolint:nilnil
+		})
+		_, err := unary(context.Background(), NewRequest(&struct{}{}))
+		assert.Nil(t, err)
+	}
+	codec := func(label string) Codec {
+		return &labeledCodec{Codec: &protoBinaryCodec{}, label: label}
+	}
+
+	t.Run("client", func(t *testing.T) {
+		t.Parallel()
+		flatCalls, flatInterceptor := newRecorder()
+		flat, err := newClientConfig("http://localhost/pkg.Service/Method", []ClientOption{
+			WithInterceptors(flatInterceptor("a")),
+			WithCodec(codec("first")),
+			WithInterceptors(flatInterceptor("b"), flatInterceptor("c")),
+			WithCodec(codec("second")),
+			WithInterceptors(flatInterceptor("d")),
+		})
+		assert.Nil(t, err)
+		bundledCalls, bundledInterceptor := newRecorder()
+		bundled, err := newClientConfig("http://localhost/pkg.Service/Method", []ClientOption{
+			WithClientOptions(
+				WithInterceptors(bundledInterceptor("a")),
+				WithCodec(codec("first")),
+			),
+			WithClientOptions(
+				WithInterceptors(bundledInterceptor("b"), bundledInterceptor("c")),
+				WithClientOptions(WithCodec(codec("second"))),
+			),
+			WithInterceptors(bundledInterceptor("d")),
+		})
+		assert.Nil(t, err)
+		runChain(t, flat.Interceptor)
+		runChain(t, bundled.Interceptor)
+		assert.Equal(t, *flatCalls, []string{"a", "b", "c", "d"})
+		assert.Equal(t, *bundledCalls, *flatCalls)
+		assert.Equal(t, flat.Codec.(*labeledCodec).label, "second")    //nolint:forcetypeassert
+		assert.Equal(t, bundled.Codec.(*labeledCodec).label, "second") //nolint:forcetypeassert
+	})
+	t.Run("handler", func(t *testing.T) {
+		t.Parallel()
+		flatCalls, flatInterceptor := newRecorder()
+		flat := newHandlerConfig("/pkg.Service/Method", StreamTypeUnary, []HandlerOption{
+			WithInterceptors(flatInterceptor("a")),
+			WithCodec(codec("first")),
+			WithInterceptors(flatInterceptor("b"), flatInterceptor("c")),
+			WithCodec(codec("second")),
+			WithInterceptors(flatInterceptor("d")),
+		})
+		bundledCalls, bundledInterceptor := newRecorder()
+		bundled := newHandlerConfig("/pkg.Service/Method", StreamTypeUnary, []HandlerOption{
+			WithHandlerOptions(
+				WithInterceptors(bundledInterceptor("a")),
+				WithCodec(codec("first")),
+			),
+			WithHandlerOptions(
+				WithInterceptors(bundledInterceptor("b"), bundledInterceptor("c")),
+				WithHandlerOptions(WithCodec(codec("second"))),
+			),
+			WithInterceptors(bundledInterceptor("d")),
+		})
+		runChain(t, flat.Interceptor)
+		runChain(t, bundled.Interceptor)
+		assert.Equal(t, *flatCalls, []string{"a", "b", "c", "d"})
+		assert.Equal(t, *bundledCalls, *flatCalls)
+		assert.Equal(t, flat.Codecs[codecNameProto].(*labeledCodec).label, "second")    //nolint:forcetypeassert
+		assert.Equal(t, bundled.Codecs[codecNameProto].(*labeledCodec).label, "second") //nolint:forcetypeassert
+	})
+}
+
+// labeledCodec wraps a Codec so tests can tell registrations apart.
+type labeledCodec struct {
+	Codec
+
+	label string
+}
@@ -15,9 +15,49 @@
 package connect
 
 import (
+	"fmt"
 	"strings"
 )
 
+// validateProcedure checks that procedure has the "/package.Service/Method"
+// shape of a Protobuf method's path. The package is optional, as it is in
+// Protobuf.
+func validateProcedure(procedure string) error {
+	rest, ok := strings.CutPrefix(procedure, "/")
+	if !ok {
+		return fmt.Errorf("procedure %q doesn't start with a slash", procedure)
+	}
+	service, method, ok := strings.Cut(rest, "/")
+	if !ok {
+		return fmt.Errorf("procedure %q doesn't have a method", procedure)
+	}
+	for _, name := range strings.Split(service, ".") {
+		if !isProtoIdentifier(name) {
+			return fmt.Errorf("procedure %q has an invalid service name %q", procedure, service)
+		}
+	}
+	if !isProtoIdentifier(method) {
+		return fmt.Errorf("procedure %q has an invalid method name %q", procedure, method)
+	}
+	return nil
+}
+
+// isProtoIdentifier reports whether name is a valid Protobuf identifier.
+func isProtoIdentifier(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, char := range name {
+		switch {
+		case char == '_', 'a' <= char && char <= 'z', 'A' <= char && char <= 'Z':
+		case '0' <= char && char <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
 // extractProtoPath returns the trailing portion of the URL's path,
 // corresponding to the Protobuf package, service, and method. It always starts
 // with a slash. Within connect, we use this as (1) Spec.Procedure and (2) the
@@ -59,3 +59,34 @@ func assertExtractedProtoPath(tb testing.TB, inputURL, expectPath string) {
 		expectPath,
 	)
 }
+
+func TestValidateProcedure(t *testing.T) {
+	t.Parallel()
+	for _, procedure := range []string{
+		"/foo.user.v1.UserService/GetUser",
+		"/UserService/GetUser",
+		"/foo_bar.v1.User_Service/Get_User2",
+		"/_private.Service/_Method",
+	} {
+		assert.Nil(t, validateProcedure(procedure), assert.Sprintf("procedure %q", procedure))
+	}
+	for _, procedure := range []string{
+		"",
+		"/",
+		"foo.user.v1.UserService/GetUser",
+		"/foo.user.v1.UserService",
+		"/foo.user.v1.UserService/",
+		"//GetUser",
+		"/foo.user.v1.UserService/GetUser/",
+		"/api/foo.user.v1.UserService/GetUser",
+		"/foo..UserService/GetUser",
+		"/.foo.UserService/GetUser",
+		"/foo.user.v1.UserService./GetUser",
+		"/foo.user.v1.UserService/Get User",
+		"/foo.user.v1.UserService/Get-User",
+		"/foo.user.1v.UserService/GetUser",
+		"/foo.user.v1.UserService/GetUser?x=1",
+	} {
+		assert.NotNil(t, validateProcedure(procedure), assert.Sprintf("procedure %q", procedure))
+	}
+}
@@ -24,6 +24,7 @@ import (
 	"net/url"
 	"sort"
 	"strings"
+	"time"
 )
 
 // The names of the Connect, gRPC, and gRPC-Web protocols (as exposed by
@@ -35,6 +36,7 @@ const (
 )
 
 const (
+	headerAccept          = "Accept"
 	headerContentType     = "Content-Type"
 	headerContentEncoding = "Content-Encoding"
 	headerContentLength   = "Content-Length"
@@ -46,7 +48,44 @@ const (
 	discardLimit = 1024 * 1024 * 4 // 4MiB
 )
 
-var errNoTimeout = errors.New("no timeout")
+var (
+	errNoTimeout = errors.New("no timeout")
+	// errProtocolViolation is wrapped by errors describing malformed data from
+	// the peer: bad envelope flags, truncated envelopes, and the like.
+	errProtocolViolation = errors.New("protocol violation")
+)
+
+// IsProtocolViolation checks whether the error was caused by the peer
+// breaking the Connect, gRPC, or gRPC-Web protocol (for example, by sending
+// an envelope with invalid flags or a truncated message), as opposed to an
+// error returned by application code or a networking failure.
+//
+// Protocol violations keep the codes they've always had, usually
+// [CodeInternal] or [CodeInvalidArgument], so this is useful mostly for
+// monitoring: it separates wire corruption and misbehaving peers from
+// ordinary RPC errors with the same code.
+func IsProtocolViolation(err error) bool {
+	return errors.Is(err, errProtocolViolation)
+}
+
+// protocolError marks an error as a protocol violation without changing its
+// message.
+type protocolError struct {
+	err error
+}
+
+func (e *protocolError) Error() string {
+	return e.err.Error()
+}
+
+func (e *protocolError) Unwrap() []error {
+	return []error{e.err, errProtocolViolation}
+}
+
+// protocolErrorf is errorf for protocol violations.
+func protocolErrorf(c Code, template string, args ...any) *Error {
+	return NewError(c, &protocolError{err: fmt.Errorf(template, args...)})
+}
 
 // A Protocol defines the HTTP semantics to use when sending and receiving
 // messages. It ties together codecs, compressors, and net/http to produce
@@ -78,11 +117,22 @@ type protocolHandlerParams struct {
 	Codecs                       readOnlyCodecs
 	CompressionPools             readOnlyCompressionPools
 	CompressMinBytes             int
+	CompressionHeuristic         compressionHeuristic
 	BufferPool                   *bufferPool
 	ReadMaxBytes                 int
 	SendMaxBytes                 int
 	RequireConnectProtocolHeader bool
 	IdempotencyLevel             IdempotencyLevel
+	WireStats                    func(WireStats)
+	HTTPStatusMapper             func(Code) int
+	NewlineDelimitedJSON         bool
+	ConnectErrorFields           func(context.Context, *Error) map[string]any
+	SendTimeout                  time.Duration
+	FirstMessageTimeout          time.Duration
+	ManualFlush                  bool
+	FlushThreshold               int
+	Clock                        Clock
+	ResponseCompressionName      string
 }
 
 // Handler is the server side of a protocol. HTTP handlers typically support
@@ -117,23 +167,46 @@ type protocolHandler interface {
 // Protocol implementations should take care to use the supplied Spec rather
 // than constructing their own, since new fields may have been added.
 type protocolClientParams struct {
-	CompressionName  string
-	CompressionPools readOnlyCompressionPools
-	Codec            Codec
-	CompressMinBytes int
-	HTTPClient       HTTPClient
-	URL              *url.URL
-	BufferPool       *bufferPool
-	ReadMaxBytes     int
-	SendMaxBytes     int
-	EnableGet        bool
-	GetURLMaxBytes   int
-	GetUseFallback   bool
+	CompressionName      string
+	CompressionPools     readOnlyCompressionPools
+	Codec                Codec
+	CompressMinBytes     int
+	CompressionHeuristic compressionHeuristic
+	HTTPClient           HTTPClient
+	URL                  *url.URL
+	BufferPool           *bufferPool
+	ReadMaxBytes         int
+	SendMaxBytes         int
+	EnableGet            bool
+	GetURLMaxBytes       int
+	GetUseFallback       bool
+	WireStats            func(WireStats)
+	GRPCWebTrailers      GRPCWebTrailerMode
+	RequestSigner        *requestSigner
+	RequestMutator       func(*http.Request) error
+	DisableKeepAlives    bool
+	UserAgent            string
+	UserAgentAppend      bool
+	Clock                Clock
+	KeepaliveInterval    time.Duration
+	KeepaliveTimeout     time.Duration
 	// The gRPC family of protocols always needs access to a Protobuf codec to
 	// marshal and unmarshal errors.
 	Protobuf Codec
 }
 
+// userAgent returns the User-Agent clients send, given the protocol's default.
+func (p *protocolClientParams) userAgent(defaultUserAgent string) string {
+	switch {
+	case p.UserAgent == "":
+		return defaultUserAgent
+	case p.UserAgentAppend:
+		return p.UserAgent + " " + defaultUserAgent
+	default:
+		return p.UserAgent
+	}
+}
+
 // Client is the client side of a protocol. HTTP clients typically use a single
 // protocol, codec, and compressor to send requests.
 type protocolClient interface {
@@ -192,6 +265,17 @@ func (hc *errorTranslatingHandlerConnCloser) getHTTPMethod() string {
 	return http.MethodPost
 }
 
+func (hc *errorTranslatingHandlerConnCloser) flush() error {
+	if flusher, ok := hc.handlerConnCloser.(interface{ flush() error }); ok {
+		return hc.fromWire(flusher.flush())
+	}
+	return nil
+}
+
+func (hc *errorTranslatingHandlerConnCloser) Unwrap() StreamingHandlerConn {
+	return hc.handlerConnCloser
+}
+
 // errorTranslatingClientConn wraps a StreamingClientConn to make sure that we always
 // return coded errors from clients.
 //
@@ -207,7 +291,12 @@ func (cc *errorTranslatingClientConn) Send(msg any) error {
 }
 
 func (cc *errorTranslatingClientConn) Receive(msg any) error {
-	return cc.fromWire(cc.streamingClientConn.Receive(msg))
+	err := cc.streamingClientConn.Receive(msg)
+	if err == io.EOF { //nolint:errorlint
+		// Callers compare against io.EOF directly, so don't wrap it.
+		return err
+	}
+	return cc.fromWire(err)
 }
 
 func (cc *errorTranslatingClientConn) CloseRequest() error {
@@ -222,6 +311,10 @@ func (cc *errorTranslatingClientConn) onRequestSend(fn func(*http.Request)) {
 	cc.streamingClientConn.onRequestSend(fn)
 }
 
+func (cc *errorTranslatingClientConn) Unwrap() StreamingClientConn {
+	return cc.streamingClientConn
+}
+
 // wrapHandlerConnWithCodedErrors ensures that we (1) automatically code
 // context-related errors correctly when writing them to the network, and (2)
 // return *Errors from all exported APIs.
@@ -298,10 +391,12 @@ func discard(reader io.Reader) (int64, error) {
 
 // negotiateCompression determines and validates the request compression and
 // response compression using the available compressors and protocol-specific
-// Content-Encoding and Accept-Encoding headers.
+// Content-Encoding and Accept-Encoding headers. If the handler prefers a
+// response compression and the client accepts it, it's used regardless of how
+// the request is compressed.
 func negotiateCompression( //nolint:nonamedreturns
 	availableCompressors readOnlyCompressionPools,
-	sent, accept string,
+	sent, accept, preferred string,
 ) (requestCompression, responseCompression string, clientVisibleErr *Error) {
 	requestCompression = compressionIdentity
 	if sent != "" && sent != compressionIdentity {
@@ -325,6 +420,16 @@ func negotiateCompression( //nolint:nonamedreturns
 	// Support asymmetric compression. This logic follows
 	// https://github.com/grpc/grpc/blob/master/doc/compression.md and common
 	// sense.
+	if preferred == compressionIdentity {
+		return requestCompression, compressionIdentity, nil
+	}
+	if preferred != "" && availableCompressors.Contains(preferred) {
+		for _, name := range strings.FieldsFunc(accept, isCommaOrSpace) {
+			if name == preferred {
+				return requestCompression, preferred, nil
+			}
+		}
+	}
 	responseCompression = requestCompression
 	// If we're not already planning to compress the response, check whether the
 	// client requested a compression algorithm we support.
@@ -50,6 +50,8 @@ const (
 	connectUnaryContentTypePrefix     = "application/"
 	connectUnaryContentTypeJSON       = connectUnaryContentTypePrefix + codecNameJSON
 	connectStreamingContentTypePrefix = "application/connect+"
+	connectStreamingContentTypeJSONL  = "application/jsonl"
+	connectStreamingEndStreamJSONKey  = "endStream"
 
 	connectUnaryEncodingQueryParameter    = "encoding"
 	connectUnaryMessageQueryParameter     = "message"
@@ -95,7 +97,8 @@ func (*protocolConnect) NewHandler(params *protocolHandlerParams) protocolHandle
 func (*protocolConnect) NewClient(params *protocolClientParams) (protocolClient, error) {
 	return &connectClient{
 		protocolClientParams: *params,
-		peer:                 newPeerFromURL(params.URL, ProtocolConnect),
+		peer:                 newPeerFromURL(params.URL, ProtocolConnect, params.Codec, params.CompressionName),
+		userAgent:            params.userAgent(defaultConnectUserAgent),
 	}, nil
 }
 
@@ -114,7 +117,7 @@ func (h *connectHandler) ContentTypes() map[string]struct{} {
 	return h.accept
 }
 
-func (*connectHandler) SetTimeout(request *http.Request) (context.Context, context.CancelFunc, error) {
+func (h *connectHandler) SetTimeout(request *http.Request) (context.Context, context.CancelFunc, error) {
 	timeout := getHeaderCanonical(request.Header, connectHeaderTimeout)
 	if timeout == "" {
 		return request.Context(), nil, nil
@@ -126,8 +129,12 @@ func (*connectHandler) SetTimeout(request *http.Request) (context.Context, conte
 	if err != nil {
 		return nil, nil, errorf(CodeInvalidArgument, "parse timeout: %w", err)
 	}
-	ctx, cancel := context.WithTimeout(
+	if millis < 0 {
+		return nil, nil, errorf(CodeInvalidArgument, "parse timeout: %q is negative", timeout)
+	}
+	ctx, cancel := withClockTimeout(
 		request.Context(),
+		h.Clock,
 		time.Duration(millis)*time.Millisecond,
 	)
 	return ctx, cancel, nil
@@ -170,6 +177,7 @@ func (h *connectHandler) NewConn(
 		h.CompressionPools,
 		contentEncoding,
 		acceptEncoding,
+		h.ResponseCompressionName,
 	)
 	if failed == nil {
 		failed = checkServerStreamsCanFlush(h.Spec, responseWriter)
@@ -210,6 +218,24 @@ func (h *connectHandler) NewConn(
 	if failed == nil && codec == nil {
 		failed = errorf(CodeInvalidArgument, "invalid message encoding: %q", codecName)
 	}
+	if codec != nil && codec.Name() != codecName {
+		// The client used one of the codec's aliases, but responses always use
+		// its canonical name.
+		codecName = codec.Name()
+		contentType = connectContentTypeFromCodecName(h.Spec.StreamType, codecName)
+	}
+	// Handlers may opt into newline-delimited JSON responses for streaming
+	// clients that can't parse the binary envelope.
+	newlineDelimited := failed == nil &&
+		h.NewlineDelimitedJSON &&
+		h.Spec.StreamType != StreamTypeUnary &&
+		codecName == codecNameJSON &&
+		connectAcceptsNewlineDelimitedJSON(request.Header)
+	if newlineDelimited {
+		// Without envelopes, there's no way to mark messages as compressed.
+		responseCompression = compressionIdentity
+		contentType = connectStreamingContentTypeJSONL
+	}
 
 	// Write any remaining headers here:
 	// (1) any writes to the stream will implicitly send the headers, so we
@@ -233,11 +259,16 @@ func (h *connectHandler) NewConn(
 	}
 	header[acceptCompressionHeader] = []string{h.CompressionPools.CommaSeparatedNames()}
 
+	stats := newWireStatsCounter(h.Spec, h.WireStats)
 	var conn handlerConnCloser
 	peer := Peer{
-		Addr:     request.RemoteAddr,
-		Protocol: ProtocolConnect,
-		Query:    query,
+		Addr:                request.RemoteAddr,
+		Protocol:            ProtocolConnect,
+		Codec:               codecName,
+		Query:               connectApplicationQuery(query),
+		NetAddr:             newPeerNetAddr(request),
+		RequestCompression:  peerCompression(requestCompression),
+		ResponseCompression: peerCompression(responseCompression),
 	}
 	if h.Spec.StreamType == StreamTypeUnary {
 		conn = &connectUnaryHandlerConn{
@@ -246,15 +277,18 @@ func (h *connectHandler) NewConn(
 			request:        request,
 			responseWriter: responseWriter,
 			marshaler: connectUnaryMarshaler{
-				ctx:              ctx,
-				sender:           writeSender{writer: responseWriter},
-				codec:            codec,
-				compressMinBytes: h.CompressMinBytes,
-				compressionName:  responseCompression,
-				compressionPool:  h.CompressionPools.Get(responseCompression),
-				bufferPool:       h.BufferPool,
-				header:           responseWriter.Header(),
-				sendMaxBytes:     h.SendMaxBytes,
+				ctx:                  ctx,
+				sender:               writeSender{writer: responseWriter},
+				codec:                codec,
+				compressMinBytes:     h.CompressMinBytes,
+				compressionHeuristic: h.CompressionHeuristic,
+				compressionName:      responseCompression,
+				compressionPool:      h.CompressionPools.Get(responseCompression),
+				bufferPool:           h.BufferPool,
+				header:               responseWriter.Header(),
+				sendMaxBytes:         h.SendMaxBytes,
+				stats:                stats,
+				setContentLength:     true,
 			},
 			unmarshaler: connectUnaryUnmarshaler{
 				ctx:             ctx,
@@ -263,8 +297,14 @@ func (h *connectHandler) NewConn(
 				compressionPool: h.CompressionPools.Get(requestCompression),
 				bufferPool:      h.BufferPool,
 				readMaxBytes:    h.ReadMaxBytes,
+				stats:           stats,
 			},
 			responseTrailer: make(http.Header),
+			stats:           stats,
+			statusMapper:    h.HTTPStatusMapper,
+			errorFields:     h.ConnectErrorFields,
+			sendTimeout:     h.SendTimeout,
+			serverDeadlines: newServerDeadlines(request),
 		}
 	} else {
 		conn = &connectStreamingHandlerConn{
@@ -274,13 +314,16 @@ func (h *connectHandler) NewConn(
 			responseWriter: responseWriter,
 			marshaler: connectStreamingMarshaler{
 				envelopeWriter: envelopeWriter{
-					ctx:              ctx,
-					sender:           writeSender{responseWriter},
-					codec:            codec,
-					compressMinBytes: h.CompressMinBytes,
-					compressionPool:  h.CompressionPools.Get(responseCompression),
-					bufferPool:       h.BufferPool,
-					sendMaxBytes:     h.SendMaxBytes,
+					ctx:                  ctx,
+					sender:               writeSender{responseWriter},
+					codec:                codec,
+					compressMinBytes:     h.CompressMinBytes,
+					compressionHeuristic: h.CompressionHeuristic,
+					compressionPool:      h.CompressionPools.Get(responseCompression),
+					bufferPool:           h.BufferPool,
+					sendMaxBytes:         h.SendMaxBytes,
+					stats:                stats,
+					newlineDelimited:     newlineDelimited,
 				},
 			},
 			unmarshaler: connectStreamingUnmarshaler{
@@ -291,9 +334,19 @@ func (h *connectHandler) NewConn(
 					compressionPool: h.CompressionPools.Get(requestCompression),
 					bufferPool:      h.BufferPool,
 					readMaxBytes:    h.ReadMaxBytes,
+					stats:           stats,
 				},
 			},
 			responseTrailer: make(http.Header),
+			stats:           stats,
+			flusher: &responseFlusher{
+				responseWriter: responseWriter,
+				manual:         h.ManualFlush,
+				threshold:      h.FlushThreshold,
+			},
+			sendTimeout:         h.SendTimeout,
+			firstMessageTimeout: h.FirstMessageTimeout,
+			serverDeadlines:     newServerDeadlines(request),
 		}
 	}
 	conn = wrapHandlerConnWithCodedErrors(conn)
@@ -309,7 +362,8 @@ func (h *connectHandler) NewConn(
 type connectClient struct {
 	protocolClientParams
 
-	peer Peer
+	peer      Peer
+	userAgent string
 }
 
 func (c *connectClient) Peer() Peer {
@@ -320,7 +374,7 @@ func (c *connectClient) WriteRequestHeader(streamType StreamType, header http.He
 	// We know these header keys are in canonical form, so we can bypass all the
 	// checks in Header.Set.
 	if getHeaderCanonical(header, headerUserAgent) == "" {
-		header[headerUserAgent] = []string{defaultConnectUserAgent}
+		header[headerUserAgent] = []string{c.userAgent}
 	}
 	header[connectHeaderProtocolVersion] = []string{connectProtocolVersion}
 	header[headerContentType] = []string{
@@ -351,8 +405,8 @@ func (c *connectClient) NewConn(
 	spec Spec,
 	header http.Header,
 ) streamingClientConn {
-	if deadline, ok := ctx.Deadline(); ok {
-		millis := int64(time.Until(deadline) / time.Millisecond)
+	if timeout, ok := timeUntilDeadline(ctx); ok {
+		millis := int64(timeout / time.Millisecond)
 		if millis > 0 {
 			encoded := strconv.FormatInt(millis, 10 /* base */)
 			if len(encoded) <= 10 {
@@ -361,6 +415,10 @@ func (c *connectClient) NewConn(
 		}
 	}
 	duplexCall := newDuplexHTTPCall(ctx, c.HTTPClient, c.URL, spec, header)
+	duplexCall.signer = c.RequestSigner
+	duplexCall.mutator = c.RequestMutator
+	duplexCall.request.Close = c.DisableKeepAlives
+	stats := newWireStatsCounter(spec, c.WireStats)
 	var conn streamingClientConn
 	if spec.StreamType == StreamTypeUnary {
 		unaryConn := &connectUnaryClientConn{
@@ -371,15 +429,17 @@ func (c *connectClient) NewConn(
 			bufferPool:       c.BufferPool,
 			marshaler: connectUnaryRequestMarshaler{
 				connectUnaryMarshaler: connectUnaryMarshaler{
-					ctx:              ctx,
-					sender:           duplexCall,
-					codec:            c.Codec,
-					compressMinBytes: c.CompressMinBytes,
-					compressionName:  c.CompressionName,
-					compressionPool:  c.CompressionPools.Get(c.CompressionName),
-					bufferPool:       c.BufferPool,
-					header:           duplexCall.Header(),
-					sendMaxBytes:     c.SendMaxBytes,
+					ctx:                  ctx,
+					sender:               duplexCall,
+					codec:                c.Codec,
+					compressMinBytes:     c.CompressMinBytes,
+					compressionHeuristic: c.CompressionHeuristic,
+					compressionName:      c.CompressionName,
+					compressionPool:      c.CompressionPools.Get(c.CompressionName),
+					bufferPool:           c.BufferPool,
+					header:               duplexCall.Header(),
+					sendMaxBytes:         c.SendMaxBytes,
+					stats:                stats,
 				},
 			},
 			unmarshaler: connectUnaryUnmarshaler{
@@ -388,9 +448,11 @@ func (c *connectClient) NewConn(
 				codec:        c.Codec,
 				bufferPool:   c.BufferPool,
 				readMaxBytes: c.ReadMaxBytes,
+				stats:        stats,
 			},
 			responseHeader:  make(http.Header),
 			responseTrailer: make(http.Header),
+			stats:           stats,
 		}
 		if spec.IdempotencyLevel == IdempotencyNoSideEffects {
 			unaryConn.marshaler.enableGet = c.EnableGet
@@ -404,6 +466,7 @@ func (c *connectClient) NewConn(
 		conn = unaryConn
 		duplexCall.SetValidateResponse(unaryConn.validateResponse)
 	} else {
+		duplexCall.offerKeepalive(c.Clock, c.KeepaliveInterval, c.KeepaliveTimeout)
 		streamingConn := &connectStreamingClientConn{
 			spec:             spec,
 			peer:             c.Peer(),
@@ -413,13 +476,15 @@ func (c *connectClient) NewConn(
 			codec:            c.Codec,
 			marshaler: connectStreamingMarshaler{
 				envelopeWriter: envelopeWriter{
-					ctx:              ctx,
-					sender:           duplexCall,
-					codec:            c.Codec,
-					compressMinBytes: c.CompressMinBytes,
-					compressionPool:  c.CompressionPools.Get(c.CompressionName),
-					bufferPool:       c.BufferPool,
-					sendMaxBytes:     c.SendMaxBytes,
+					ctx:                  ctx,
+					sender:               duplexCall,
+					codec:                c.Codec,
+					compressMinBytes:     c.CompressMinBytes,
+					compressionHeuristic: c.CompressionHeuristic,
+					compressionPool:      c.CompressionPools.Get(c.CompressionName),
+					bufferPool:           c.BufferPool,
+					sendMaxBytes:         c.SendMaxBytes,
+					stats:                stats,
 				},
 			},
 			unmarshaler: connectStreamingUnmarshaler{
@@ -429,10 +494,12 @@ func (c *connectClient) NewConn(
 					codec:        c.Codec,
 					bufferPool:   c.BufferPool,
 					readMaxBytes: c.ReadMaxBytes,
+					stats:        stats,
 				},
 			},
 			responseHeader:  make(http.Header),
 			responseTrailer: make(http.Header),
+			stats:           stats,
 		}
 		conn = streamingConn
 		duplexCall.SetValidateResponse(streamingConn.validateResponse)
@@ -441,6 +508,8 @@ func (c *connectClient) NewConn(
 }
 
 type connectUnaryClientConn struct {
+	messageCounts
+
 	spec             Spec
 	peer             Peer
 	duplexCall       *duplexHTTPCall
@@ -450,6 +519,10 @@ type connectUnaryClientConn struct {
 	unmarshaler      connectUnaryUnmarshaler
 	responseHeader   http.Header
 	responseTrailer  http.Header
+	stats            *wireStatsCounter
+	// responseCompression is set by validateResponse, so it's only safe to
+	// read once the response is ready.
+	responseCompression string
 }
 
 func (cc *connectUnaryClientConn) Spec() Spec {
@@ -457,13 +530,18 @@ func (cc *connectUnaryClientConn) Spec() Spec {
 }
 
 func (cc *connectUnaryClientConn) Peer() Peer {
-	return cc.peer
+	peer := cc.peer
+	if cc.duplexCall.ResponseReady() {
+		peer.ResponseCompression = cc.responseCompression
+	}
+	return peer
 }
 
 func (cc *connectUnaryClientConn) Send(msg any) error {
 	if err := cc.marshaler.Marshal(msg); err != nil {
 		return err
 	}
+	cc.countSent(msg)
 	return nil // must be a literal nil: nil *Error is a non-nil error
 }
 
@@ -472,7 +550,7 @@ func (cc *connectUnaryClientConn) RequestHeader() http.Header {
 }
 
 func (cc *connectUnaryClientConn) CloseRequest() error {
-	return cc.duplexCall.CloseWrite()
+	return cc.duplexCall.CloseRequest()
 }
 
 func (cc *connectUnaryClientConn) Receive(msg any) error {
@@ -482,6 +560,7 @@ func (cc *connectUnaryClientConn) Receive(msg any) error {
 	if err := cc.unmarshaler.Unmarshal(msg); err != nil {
 		return err
 	}
+	cc.countReceived()
 	return nil // must be a literal nil: nil *Error is a non-nil error
 }
 
@@ -496,6 +575,7 @@ func (cc *connectUnaryClientConn) ResponseTrailer() http.Header {
 }
 
 func (cc *connectUnaryClientConn) CloseResponse() error {
+	defer cc.stats.finish()
 	return cc.duplexCall.CloseRead()
 }
 
@@ -537,6 +617,7 @@ func (cc *connectUnaryClientConn) validateResponse(response *http.Response) *Err
 		)
 	}
 	cc.unmarshaler.compressionPool = cc.compressionPools.Get(compression)
+	cc.responseCompression = peerCompression(compression)
 	if response.StatusCode != http.StatusOK {
 		unmarshaler := connectUnaryUnmarshaler{
 			ctx:             cc.unmarshaler.ctx,
@@ -567,6 +648,8 @@ func (cc *connectUnaryClientConn) validateResponse(response *http.Response) *Err
 }
 
 type connectStreamingClientConn struct {
+	messageCounts
+
 	spec             Spec
 	peer             Peer
 	duplexCall       *duplexHTTPCall
@@ -577,6 +660,10 @@ type connectStreamingClientConn struct {
 	unmarshaler      connectStreamingUnmarshaler
 	responseHeader   http.Header
 	responseTrailer  http.Header
+	stats            *wireStatsCounter
+	// responseCompression is set by validateResponse, so it's only safe to
+	// read once the response is ready.
+	responseCompression string
 }
 
 func (cc *connectStreamingClientConn) Spec() Spec {
@@ -584,13 +671,18 @@ func (cc *connectStreamingClientConn) Spec() Spec {
 }
 
 func (cc *connectStreamingClientConn) Peer() Peer {
-	return cc.peer
+	peer := cc.peer
+	if cc.duplexCall.ResponseReady() {
+		peer.ResponseCompression = cc.responseCompression
+	}
+	return peer
 }
 
 func (cc *connectStreamingClientConn) Send(msg any) error {
 	if err := cc.marshaler.Marshal(msg); err != nil {
 		return err
 	}
+	cc.countSent(msg)
 	return nil // must be a literal nil: nil *Error is a non-nil error
 }
 
@@ -599,7 +691,7 @@ func (cc *connectStreamingClientConn) RequestHeader() http.Header {
 }
 
 func (cc *connectStreamingClientConn) CloseRequest() error {
-	return cc.duplexCall.CloseWrite()
+	return cc.duplexCall.CloseRequest()
 }
 
 func (cc *connectStreamingClientConn) Receive(msg any) error {
@@ -608,6 +700,7 @@ func (cc *connectStreamingClientConn) Receive(msg any) error {
 	}
 	err := cc.unmarshaler.Unmarshal(msg)
 	if err == nil {
+		cc.countReceived()
 		return nil
 	}
 	// See if the server sent an explicit error in the end-of-stream message.
@@ -622,10 +715,16 @@ func (cc *connectStreamingClientConn) Receive(msg any) error {
 		_ = cc.duplexCall.CloseWrite()
 		return serverErr
 	}
+	if errors.Is(err, errSpecialEnvelope) {
+		// The server ended the stream cleanly. Return a bare io.EOF, so callers
+		// can compare it directly.
+		_ = cc.duplexCall.CloseWrite()
+		return io.EOF
+	}
 	// If the error is EOF but not from a last message, we want to return
 	// io.ErrUnexpectedEOF instead.
-	if errors.Is(err, io.EOF) && !errors.Is(err, errSpecialEnvelope) {
-		err = errorf(CodeInternal, "protocol error: %w", io.ErrUnexpectedEOF)
+	if errors.Is(err, io.EOF) {
+		err = protocolErrorf(CodeInternal, "protocol error: %w", io.ErrUnexpectedEOF)
 	}
 	// There's no error in the trailers, so this was probably an error
 	// converting the bytes to a message, an error reading from the network, or
@@ -646,6 +745,7 @@ func (cc *connectStreamingClientConn) ResponseTrailer() http.Header {
 }
 
 func (cc *connectStreamingClientConn) CloseResponse() error {
+	defer cc.stats.finish()
 	return cc.duplexCall.CloseRead()
 }
 
@@ -676,11 +776,14 @@ func (cc *connectStreamingClientConn) validateResponse(response *http.Response)
 		)
 	}
 	cc.unmarshaler.compressionPool = cc.compressionPools.Get(compression)
+	cc.responseCompression = peerCompression(compression)
 	mergeHeaders(cc.responseHeader, response.Header)
 	return nil
 }
 
 type connectUnaryHandlerConn struct {
+	messageCounts
+
 	spec            Spec
 	peer            Peer
 	request         *http.Request
@@ -688,6 +791,11 @@ type connectUnaryHandlerConn struct {
 	marshaler       connectUnaryMarshaler
 	unmarshaler     connectUnaryUnmarshaler
 	responseTrailer http.Header
+	stats           *wireStatsCounter
+	statusMapper    func(Code) int
+	errorFields     func(context.Context, *Error) map[string]any
+	sendTimeout     time.Duration
+	serverDeadlines serverDeadlines
 }
 
 func (hc *connectUnaryHandlerConn) Spec() Spec {
@@ -702,6 +810,7 @@ func (hc *connectUnaryHandlerConn) Receive(msg any) error {
 	if err := hc.unmarshaler.Unmarshal(msg); err != nil {
 		return err
 	}
+	hc.countReceived()
 	return nil // must be a literal nil: nil *Error is a non-nil error
 }
 
@@ -710,10 +819,24 @@ func (hc *connectUnaryHandlerConn) RequestHeader() http.Header {
 }
 
 func (hc *connectUnaryHandlerConn) Send(msg any) error {
+	if hc.sendTimeout > 0 {
+		return sendWithTimeout(hc.responseWriter, hc.sendTimeout, hc.serverDeadlines.write, func() error {
+			if err := hc.send(msg); err != nil {
+				return err
+			}
+			flusher := responseFlusher{responseWriter: hc.responseWriter}
+			return flusher.flush()
+		})
+	}
+	return hc.send(msg)
+}
+
+func (hc *connectUnaryHandlerConn) send(msg any) error {
 	hc.mergeResponseHeader(nil /* error */)
 	if err := hc.marshaler.Marshal(msg); err != nil {
 		return err
 	}
+	hc.countSent(msg)
 	return nil // must be a literal nil: nil *Error is a non-nil error
 }
 
@@ -726,11 +849,12 @@ func (hc *connectUnaryHandlerConn) ResponseTrailer() http.Header {
 }
 
 func (hc *connectUnaryHandlerConn) Close(err error) error {
+	defer hc.stats.finish()
 	if !hc.marshaler.wroteHeader {
 		hc.mergeResponseHeader(err)
 		// If the handler received a GET request and the resource hasn't changed,
 		// return a 304.
-		if len(hc.peer.Query) > 0 && IsNotModifiedError(err) {
+		if hc.request.Method == http.MethodGet && IsNotModifiedError(err) {
 			hc.responseWriter.WriteHeader(http.StatusNotModified)
 			return hc.request.Body.Close()
 		}
@@ -740,12 +864,14 @@ func (hc *connectUnaryHandlerConn) Close(err error) error {
 	}
 	// In unary Connect, errors always use application/json.
 	setHeaderCanonical(hc.responseWriter.Header(), headerContentType, connectUnaryContentTypeJSON)
-	hc.responseWriter.WriteHeader(connectCodeToHTTP(CodeOf(err)))
-	data, marshalErr := json.Marshal(newConnectWireError(err))
+	data, marshalErr := hc.marshalError(err)
 	if marshalErr != nil {
+		hc.responseWriter.WriteHeader(hc.httpStatus(CodeOf(err)))
 		_ = hc.request.Body.Close()
-		return errorf(CodeInternal, "marshal error: %w", err)
+		return errorf(CodeInternal, "marshal error: %w", marshalErr)
 	}
+	setHeaderCanonical(hc.responseWriter.Header(), headerContentLength, strconv.Itoa(len(data)))
+	hc.responseWriter.WriteHeader(hc.httpStatus(CodeOf(err)))
 	if _, writeErr := hc.responseWriter.Write(data); writeErr != nil {
 		_ = hc.request.Body.Close()
 		return writeErr
@@ -753,6 +879,54 @@ func (hc *connectUnaryHandlerConn) Close(err error) error {
 	return hc.request.Body.Close()
 }
 
+// marshalError encodes the error's JSON body, adding any fields from
+// [WithConnectErrorFields]. The canonical code, message, and details always
+// come from the error itself.
+func (hc *connectUnaryHandlerConn) marshalError(err error) ([]byte, error) {
+	wire := newConnectWireError(err)
+	data, marshalErr := json.Marshal(wire)
+	if marshalErr != nil || hc.errorFields == nil {
+		return data, marshalErr
+	}
+	connectErr, _ := asError(wrapIfUncoded(err))
+	fields := hc.errorFields(hc.request.Context(), connectErr)
+	if len(fields) == 0 {
+		return data, nil
+	}
+	withFields, fieldsErr := addConnectErrorFields(data, fields)
+	if fieldsErr != nil {
+		// A field that can't be encoded shouldn't cost the client the error
+		// itself, so send the canonical body alone.
+		return data, nil
+	}
+	return withFields, nil
+}
+
+// addConnectErrorFields adds fields to an encoded error, skipping any with
+// the names of canonical fields.
+func addConnectErrorFields(data []byte, fields map[string]any) ([]byte, error) {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(data, &object); err != nil {
+		return nil, err
+	}
+	for key, value := range fields {
+		switch key {
+		case "code", "message", "details":
+			continue
+		}
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("marshal error field %q: %w", key, err)
+		}
+		object[key] = raw
+	}
+	return json.Marshal(object)
+}
+
+func (hc *connectUnaryHandlerConn) httpStatus(code Code) int {
+	return mapConnectCodeToHTTP(hc.statusMapper, code)
+}
+
 func (hc *connectUnaryHandlerConn) getHTTPMethod() string {
 	return hc.request.Method
 }
@@ -776,6 +950,8 @@ func (hc *connectUnaryHandlerConn) mergeResponseHeader(err error) {
 }
 
 type connectStreamingHandlerConn struct {
+	messageCounts
+
 	spec            Spec
 	peer            Peer
 	request         *http.Request
@@ -783,6 +959,12 @@ type connectStreamingHandlerConn struct {
 	marshaler       connectStreamingMarshaler
 	unmarshaler     connectStreamingUnmarshaler
 	responseTrailer http.Header
+	stats           *wireStatsCounter
+	flusher         *responseFlusher
+	sendTimeout     time.Duration
+	// firstMessageTimeout bounds the wait for the first request message.
+	firstMessageTimeout time.Duration
+	serverDeadlines     serverDeadlines
 }
 
 func (hc *connectStreamingHandlerConn) Spec() Spec {
@@ -794,11 +976,21 @@ func (hc *connectStreamingHandlerConn) Peer() Peer {
 }
 
 func (hc *connectStreamingHandlerConn) Receive(msg any) error {
+	if hc.firstMessageTimeout > 0 && hc.receivedMessages() == 0 {
+		return receiveWithTimeout(hc.responseWriter, hc.firstMessageTimeout, hc.serverDeadlines.read, func() error {
+			return hc.receive(msg)
+		})
+	}
+	return hc.receive(msg)
+}
+
+func (hc *connectStreamingHandlerConn) receive(msg any) error {
 	if err := hc.unmarshaler.Unmarshal(msg); err != nil {
 		// Clients may not send end-of-stream metadata, so we don't need to handle
 		// errSpecialEnvelope.
 		return err
 	}
+	hc.countReceived()
 	return nil // must be a literal nil: nil *Error is a non-nil error
 }
 
@@ -807,10 +999,36 @@ func (hc *connectStreamingHandlerConn) RequestHeader() http.Header {
 }
 
 func (hc *connectStreamingHandlerConn) Send(msg any) error {
-	defer flushResponseWriter(hc.responseWriter)
+	send := func() error {
+		if err := hc.send(msg); err != nil {
+			return err
+		}
+		hc.flusher.sent()
+		return nil
+	}
+	if hc.sendTimeout > 0 {
+		return sendWithTimeout(hc.responseWriter, hc.sendTimeout, hc.serverDeadlines.write, send)
+	}
+	return send()
+}
+
+func (hc *connectStreamingHandlerConn) flush() error {
+	if hc.sendTimeout > 0 {
+		return sendWithTimeout(hc.responseWriter, hc.sendTimeout, hc.serverDeadlines.write, hc.flusher.flush)
+	}
+	return hc.flusher.flush()
+}
+
+func (hc *connectStreamingHandlerConn) send(msg any) error {
+	if err := hc.request.Context().Err(); err != nil {
+		// The client has disconnected (or the deadline has passed), so writing
+		// would at best fill a buffer no one reads.
+		return wrapIfContextError(err)
+	}
 	if err := hc.marshaler.Marshal(msg); err != nil {
 		return err
 	}
+	hc.countSent(msg)
 	return nil // must be a literal nil: nil *Error is a non-nil error
 }
 
@@ -823,6 +1041,7 @@ func (hc *connectStreamingHandlerConn) ResponseTrailer() http.Header {
 }
 
 func (hc *connectStreamingHandlerConn) Close(err error) error {
+	defer hc.stats.finish()
 	defer flushResponseWriter(hc.responseWriter)
 	if err := hc.marshaler.MarshalEndStream(err, hc.responseTrailer); err != nil {
 		_ = hc.request.Body.Close()
@@ -855,7 +1074,17 @@ func (m *connectStreamingMarshaler) MarshalEndStream(err error, trailer http.Hea
 			mergeNonProtocolHeaders(end.Trailer, connectErr.meta)
 		}
 	}
-	data, marshalErr := json.Marshal(end)
+	var data []byte
+	var marshalErr error
+	if m.newlineDelimited {
+		// Wrap the end-of-stream message so that clients can distinguish it from
+		// the preceding messages.
+		data, marshalErr = json.Marshal(map[string]*connectEndStreamMessage{
+			connectStreamingEndStreamJSONKey: end,
+		})
+	} else {
+		data, marshalErr = json.Marshal(end)
+	}
 	if marshalErr != nil {
 		return errorf(CodeInternal, "marshal end stream: %w", marshalErr)
 	}
@@ -887,7 +1116,7 @@ func (u *connectStreamingUnmarshaler) Unmarshal(message any) *Error {
 	u.last.Data = nil // don't keep a reference to it
 	defer u.bufferPool.Put(data)
 	if !env.IsSet(connectFlagEnvelopeEndStream) {
-		return errorf(CodeInternal, "protocol error: invalid envelope flags %d", env.Flags)
+		return protocolErrorf(CodeInternal, "protocol error: invalid envelope flags %d", env.Flags)
 	}
 	var end connectEndStreamMessage
 	if err := json.Unmarshal(data.Bytes(), &end); err != nil {
@@ -914,21 +1143,26 @@ func (u *connectStreamingUnmarshaler) EndStreamError() *Error {
 }
 
 type connectUnaryMarshaler struct {
-	ctx              context.Context //nolint:containedctx
-	sender           messageSender
-	codec            Codec
-	compressMinBytes int
-	compressionName  string
-	compressionPool  *compressionPool
-	bufferPool       *bufferPool
-	header           http.Header
-	sendMaxBytes     int
-	wroteHeader      bool
+	ctx                  context.Context //nolint:containedctx
+	sender               messageSender
+	codec                Codec
+	compressMinBytes     int
+	compressionHeuristic compressionHeuristic
+	compressionName      string
+	compressionPool      *compressionPool
+	bufferPool           *bufferPool
+	header               http.Header
+	sendMaxBytes         int
+	stats                *wireStatsCounter
+	wroteHeader          bool
+	// setContentLength adds a Content-Length header to responses, which are
+	// fully buffered before they're written.
+	setContentLength bool
 }
 
 func (m *connectUnaryMarshaler) Marshal(message any) *Error {
 	if message == nil {
-		return m.write(nil)
+		return m.write(nil, 0)
 	}
 	var data []byte
 	var err error
@@ -941,28 +1175,40 @@ func (m *connectUnaryMarshaler) Marshal(message any) *Error {
 	if err != nil {
 		return errorf(CodeInternal, "marshal message: %w", err)
 	}
+	recordUncompressedRequest(m.sender, data)
 	uncompressed := bytes.NewBuffer(data)
 	defer m.bufferPool.Put(uncompressed)
 	if len(data) < m.compressMinBytes || m.compressionPool == nil {
-		if m.sendMaxBytes > 0 && len(data) > m.sendMaxBytes {
-			return NewError(CodeResourceExhausted, fmt.Errorf("message size %d exceeds sendMaxBytes %d", len(data), m.sendMaxBytes))
-		}
-		return m.write(data)
+		return m.writeUncompressed(data)
 	}
 	compressed := m.bufferPool.Get()
 	defer m.bufferPool.Put(compressed)
-	if err := m.compressionPool.Compress(compressed, uncompressed); err != nil {
-		return err
+	ok, compressErr := m.compressionPool.compressIfWorthwhile(compressed, uncompressed, m.compressionHeuristic, m.bufferPool)
+	if compressErr != nil {
+		return compressErr
+	}
+	if !ok {
+		return m.writeUncompressed(data)
 	}
 	if m.sendMaxBytes > 0 && compressed.Len() > m.sendMaxBytes {
 		return NewError(CodeResourceExhausted, fmt.Errorf("compressed message size %d exceeds sendMaxBytes %d", compressed.Len(), m.sendMaxBytes))
 	}
 	setHeaderCanonical(m.header, connectUnaryHeaderCompression, m.compressionName)
-	return m.write(compressed.Bytes())
+	return m.write(compressed.Bytes(), len(data))
+}
+
+func (m *connectUnaryMarshaler) writeUncompressed(data []byte) *Error {
+	if m.sendMaxBytes > 0 && len(data) > m.sendMaxBytes {
+		return NewError(CodeResourceExhausted, fmt.Errorf("message size %d exceeds sendMaxBytes %d", len(data), m.sendMaxBytes))
+	}
+	return m.write(data, len(data))
 }
 
-func (m *connectUnaryMarshaler) write(data []byte) *Error {
+func (m *connectUnaryMarshaler) write(data []byte, uncompressedSize int) *Error {
 	m.wroteHeader = true
+	if m.setContentLength {
+		setHeaderCanonical(m.header, headerContentLength, strconv.Itoa(len(data)))
+	}
 	payload := bytes.NewReader(data)
 	if _, err := m.sender.Send(payload); err != nil {
 		err = wrapIfContextError(err)
@@ -971,9 +1217,16 @@ func (m *connectUnaryMarshaler) write(data []byte) *Error {
 		}
 		return errorf(CodeUnknown, "write message: %w", err)
 	}
+	m.stats.sent(len(data), uncompressedSize)
 	return nil
 }
 
+// defaultGetURLMaxBytes is the longest URL a client sends in a GET request,
+// unless configured otherwise with WithHTTPGetMaxURLSize. Longer requests are
+// sent as POSTs. It's comfortably below the request line limits of common
+// proxies and CDNs.
+const defaultGetURLMaxBytes = 4096
+
 type connectUnaryRequestMarshaler struct {
 	connectUnaryMarshaler
 
@@ -1007,6 +1260,7 @@ func (m *connectUnaryRequestMarshaler) marshalWithGet(message any) *Error {
 			return errorf(CodeInternal, "marshal message stable: %w", err)
 		}
 	}
+	recordUncompressedRequest(m.sender, data)
 	isTooBig := m.sendMaxBytes > 0 && len(data) > m.sendMaxBytes
 	if isTooBig && m.compressionPool == nil {
 		return NewError(CodeResourceExhausted, fmt.Errorf(
@@ -1019,11 +1273,12 @@ func (m *connectUnaryRequestMarshaler) marshalWithGet(message any) *Error {
 		url := m.buildGetURL(data, false /* compressed */)
 		if m.getURLMaxBytes <= 0 || len(url.String()) < m.getURLMaxBytes {
 			m.writeWithGet(url)
+			m.stats.sent(len(data), len(data))
 			return nil
 		}
 		if m.compressionPool == nil {
 			if m.getUseFallback {
-				return m.write(data)
+				return m.write(data, len(data))
 			}
 			return NewError(CodeResourceExhausted, fmt.Errorf(
 				"url size %d exceeds getURLMaxBytes %d: enabling request compression may help",
@@ -1046,11 +1301,12 @@ func (m *connectUnaryRequestMarshaler) marshalWithGet(message any) *Error {
 	url := m.buildGetURL(compressed.Bytes(), true /* compressed */)
 	if m.getURLMaxBytes <= 0 || len(url.String()) < m.getURLMaxBytes {
 		m.writeWithGet(url)
+		m.stats.sent(compressed.Len(), len(data))
 		return nil
 	}
 	if m.getUseFallback {
 		setHeaderCanonical(m.header, connectUnaryHeaderCompression, m.compressionName)
-		return m.write(compressed.Bytes())
+		return m.write(compressed.Bytes(), len(data))
 	}
 	return NewError(CodeResourceExhausted, fmt.Errorf("compressed url size %d exceeds getURLMaxBytes %d", len(url.String()), m.getURLMaxBytes))
 }
@@ -1090,6 +1346,7 @@ type connectUnaryUnmarshaler struct {
 	bufferPool      *bufferPool
 	alreadyRead     bool
 	readMaxBytes    int
+	stats           *wireStatsCounter
 }
 
 func (u *connectUnaryUnmarshaler) Unmarshal(message any) *Error {
@@ -1110,6 +1367,7 @@ func (u *connectUnaryUnmarshaler) UnmarshalFunc(message any, unmarshal func([]by
 	// ReadFrom ignores io.EOF, so any error here is real.
 	bytesRead, err := data.ReadFrom(reader)
 	if err != nil {
+		u.stats.received(bytesRead)
 		err = wrapIfMaxBytesError(err, "read first %d bytes of message", bytesRead)
 		err = wrapIfContextDone(u.ctx, err)
 		if connectErr, ok := asError(err); ok {
@@ -1120,11 +1378,13 @@ func (u *connectUnaryUnmarshaler) UnmarshalFunc(message any, unmarshal func([]by
 	if u.readMaxBytes > 0 && bytesRead > int64(u.readMaxBytes) {
 		// Attempt to read to end in order to allow connection re-use
 		discardedBytes, err := io.Copy(io.Discard, u.reader)
+		u.stats.received(bytesRead + discardedBytes)
 		if err != nil {
 			return errorf(CodeResourceExhausted, "message is larger than configured max %d - unable to determine message size: %w", u.readMaxBytes, err)
 		}
 		return errorf(CodeResourceExhausted, "message size %d is larger than configured max %d", bytesRead+discardedBytes, u.readMaxBytes)
 	}
+	u.stats.received(bytesRead)
 	if data.Len() > 0 && u.compressionPool != nil {
 		decompressed := u.bufferPool.Get()
 		defer u.bufferPool.Put(decompressed)
@@ -1133,6 +1393,7 @@ func (u *connectUnaryUnmarshaler) UnmarshalFunc(message any, unmarshal func([]by
 		}
 		data = decompressed
 	}
+	u.stats.receivedUncompressed(data.Len())
 	if err := unmarshal(data.Bytes(), message); err != nil {
 		return errorf(CodeInvalidArgument, "unmarshal message: %w", err)
 	}
@@ -1147,13 +1408,21 @@ func (d *connectWireDetail) MarshalJSON() ([]byte, error) {
 		// lets proxies w/o protobuf descriptors preserve human-readable details.
 		return []byte(d.wireJSON), nil
 	}
+	// The Connect protocol sends bare type names, which peers resolve using the
+	// default prefix. Any other prefix would be lost, so we send the full URL
+	// instead: UnmarshalJSON keeps types containing a slash as-is.
+	typeURL := d.pbAny.GetTypeUrl()
+	typeName := typeNameFromURL(typeURL)
+	if typeURL != typeName && typeURL != defaultAnyResolverPrefix+typeName {
+		typeName = typeURL
+	}
 	wire := struct {
 		Type  string          `json:"type"`
 		Value string          `json:"value"`
 		Debug json.RawMessage `json:"debug,omitempty"`
 	}{
-		Type:  typeNameFromURL(d.pbAny.GetTypeUrl()),
-		Value: base64.RawStdEncoding.EncodeToString(d.pbAny.GetValue()),
+		Type:  typeName,
+		Value: EncodeBinaryHeader(d.pbAny.GetValue()),
 	}
 	// Try to produce debug info, but expect failure when we don't have
 	// descriptors.
@@ -1266,6 +1535,19 @@ type connectEndStreamMessage struct {
 	Trailer http.Header       `json:"metadata,omitempty"`
 }
 
+// mapConnectCodeToHTTP returns the HTTP status chosen by a mapper set with
+// WithHTTPStatusMapper. If the mapper is nil or doesn't return an error
+// status, it falls back to the default mapping: anything else would tell
+// clients the RPC succeeded, or fail to parse at all.
+func mapConnectCodeToHTTP(mapper func(Code) int, code Code) int {
+	if mapper != nil {
+		if status := mapper(code); status >= 400 && status <= 599 {
+			return status
+		}
+	}
+	return connectCodeToHTTP(code)
+}
+
 func connectCodeToHTTP(code Code) int {
 	// Return literals rather than named constants from the HTTP package to make
 	// it easier to compare this function to the Connect specification.
@@ -1314,6 +1596,20 @@ func connectCodecFromContentType(streamType StreamType, contentType string) stri
 	return strings.TrimPrefix(contentType, connectStreamingContentTypePrefix)
 }
 
+// connectAcceptsNewlineDelimitedJSON reports whether the client listed
+// newline-delimited JSON in its Accept header.
+func connectAcceptsNewlineDelimitedJSON(header http.Header) bool {
+	for _, value := range header[headerAccept] {
+		for _, mediaType := range strings.Split(value, ",") {
+			mediaType, _, _ = strings.Cut(mediaType, ";")
+			if strings.EqualFold(strings.TrimSpace(mediaType), connectStreamingContentTypeJSONL) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func connectContentTypeFromCodecName(streamType StreamType, name string) string {
 	if streamType == StreamTypeUnary {
 		return connectUnaryContentTypePrefix + name
@@ -1332,10 +1628,25 @@ func binaryQueryValueReader(data string) io.Reader {
 	stringReader := strings.NewReader(data)
 	if len(data)%4 != 0 {
 		// Data definitely isn't padded.
-		return base64.NewDecoder(base64.RawURLEncoding, stringReader)
+		return &base64QueryValueReader{base64.NewDecoder(base64.RawURLEncoding, stringReader)}
 	}
 	// Data is padded, or no padding was necessary.
-	return base64.NewDecoder(base64.URLEncoding, stringReader)
+	return &base64QueryValueReader{base64.NewDecoder(base64.URLEncoding, stringReader)}
+}
+
+// base64QueryValueReader reports malformed base64 as the client's fault,
+// rather than as an unknown error reading the message.
+type base64QueryValueReader struct {
+	decoder io.Reader
+}
+
+func (r *base64QueryValueReader) Read(data []byte) (int, error) {
+	n, err := r.decoder.Read(data)
+	var corrupt base64.CorruptInputError
+	if errors.As(err, &corrupt) {
+		return n, errorf(CodeInvalidArgument, "invalid base64 in %s parameter: %w", connectUnaryMessageQueryParameter, err)
+	}
+	return n, err
 }
 
 // queryValueReader creates a reader for a string that may be URL-safe base64
@@ -1426,6 +1737,27 @@ func connectValidateStreamResponseContentType(requestCodecName string, streamTyp
 	return nil
 }
 
+// connectApplicationQuery returns the query parameters that aren't reserved by
+// the Connect protocol, or nil if there aren't any.
+func connectApplicationQuery(query url.Values) url.Values {
+	var application url.Values
+	for key, values := range query {
+		switch key {
+		case connectUnaryEncodingQueryParameter,
+			connectUnaryMessageQueryParameter,
+			connectUnaryBase64QueryParameter,
+			connectUnaryCompressionQueryParameter,
+			connectUnaryConnectQueryParameter:
+			continue
+		}
+		if application == nil {
+			application = make(url.Values, len(query))
+		}
+		application[key] = values
+	}
+	return application
+}
+
 func connectCheckProtocolVersion(request *http.Request, required bool) *Error {
 	switch request.Method {
 	case http.MethodGet:
@@ -95,6 +95,40 @@ func TestConnectErrorDetailMarshalingNoDescriptor(t *testing.T) {
 	assert.Equal(t, string(encoded), raw)
 }
 
+func TestConnectErrorDetailMarshalingPrefix(t *testing.T) {
+	t.Parallel()
+	second := durationpb.New(time.Second)
+	testCases := []struct {
+		name     string
+		prefix   string
+		wireType string
+	}{
+		{name: "default", prefix: "type.googleapis.com", wireType: "google.protobuf.Duration"},
+		{name: "custom", prefix: "example.com/types", wireType: "example.com/types/google.protobuf.Duration"},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+			detail, err := NewErrorDetailWithPrefix(second, testCase.prefix)
+			assert.Nil(t, err)
+			data, err := json.Marshal((*connectWireDetail)(detail))
+			assert.Nil(t, err)
+			var wire struct {
+				Type string `json:"type"`
+			}
+			assert.Nil(t, json.Unmarshal(data, &wire))
+			assert.Equal(t, wire.Type, testCase.wireType)
+
+			var unmarshaled connectWireDetail
+			assert.Nil(t, json.Unmarshal(data, &unmarshaled))
+			assert.Equal(t, (*ErrorDetail)(&unmarshaled).TypeURL(), detail.TypeURL())
+			value, err := (*ErrorDetail)(&unmarshaled).Value()
+			assert.Nil(t, err)
+			assert.Equal(t, value, proto.Message(second))
+		})
+	}
+}
+
 func TestConnectEndOfResponseCanonicalTrailers(t *testing.T) {
 	t.Parallel()
 
@@ -52,7 +52,7 @@ const (
 )
 
 var (
-	errTrailersWithoutGRPCStatus = fmt.Errorf("protocol error: no %s trailer: %w", grpcHeaderStatus, io.ErrUnexpectedEOF)
+	errTrailersWithoutGRPCStatus error = &protocolError{err: fmt.Errorf("protocol error: no %s trailer: %w", grpcHeaderStatus, io.ErrUnexpectedEOF)}
 
 	// defaultGrpcUserAgent follows
 	// https://github.com/grpc/grpc/blob/master/doc/PROTOCOL-HTTP2.md#user-agents:
@@ -72,6 +72,26 @@ var (
 	}
 )
 
+// GRPCWebTrailerMode controls where gRPC-Web clients look for trailers, which
+// carry the RPC's status. See [WithGRPCWebTrailers].
+type GRPCWebTrailerMode int
+
+const (
+	// GRPCWebTrailersAuto is the default mode. It reads trailers from the
+	// trailers frame at the end of the response body, as the gRPC-Web
+	// specification requires, and falls back to HTTP trailers if the body
+	// doesn't contain a trailers frame.
+	GRPCWebTrailersAuto GRPCWebTrailerMode = 0
+
+	// GRPCWebTrailersBody only reads trailers from the response body. HTTP
+	// trailers are ignored.
+	GRPCWebTrailersBody GRPCWebTrailerMode = 1
+
+	// GRPCWebTrailersHTTP only reads HTTP trailers. A trailers frame in the
+	// response body still ends the stream, but its contents are ignored.
+	GRPCWebTrailersHTTP GRPCWebTrailerMode = 2
+)
+
 type protocolGRPC struct {
 	web bool
 }
@@ -98,14 +118,15 @@ func (g *protocolGRPC) NewHandler(params *protocolHandlerParams) protocolHandler
 
 // NewClient implements protocol, so it must return an interface.
 func (g *protocolGRPC) NewClient(params *protocolClientParams) (protocolClient, error) {
-	peer := newPeerFromURL(params.URL, ProtocolGRPC)
+	peer := newPeerFromURL(params.URL, ProtocolGRPC, params.Codec, params.CompressionName)
 	if g.web {
-		peer = newPeerFromURL(params.URL, ProtocolGRPCWeb)
+		peer = newPeerFromURL(params.URL, ProtocolGRPCWeb, params.Codec, params.CompressionName)
 	}
 	return &grpcClient{
 		protocolClientParams: *params,
 		web:                  g.web,
 		peer:                 peer,
+		userAgent:            params.userAgent(defaultGrpcUserAgent),
 	}, nil
 }
 
@@ -124,7 +145,7 @@ func (g *grpcHandler) ContentTypes() map[string]struct{} {
 	return g.accept
 }
 
-func (*grpcHandler) SetTimeout(request *http.Request) (context.Context, context.CancelFunc, error) {
+func (g *grpcHandler) SetTimeout(request *http.Request) (context.Context, context.CancelFunc, error) {
 	timeout, err := grpcParseTimeout(getHeaderCanonical(request.Header, grpcHeaderTimeout))
 	if err != nil && !errors.Is(err, errNoTimeout) {
 		// Errors here indicate that the client sent an invalid timeout header, so
@@ -134,7 +155,7 @@ func (*grpcHandler) SetTimeout(request *http.Request) (context.Context, context.
 		// err wraps errNoTimeout, nothing to do.
 		return request.Context(), nil, nil //nolint:nilerr
 	}
-	ctx, cancel := context.WithTimeout(request.Context(), timeout)
+	ctx, cancel := withClockTimeout(request.Context(), g.Clock, timeout)
 	return ctx, cancel, nil
 }
 
@@ -154,6 +175,7 @@ func (g *grpcHandler) NewConn(
 		g.CompressionPools,
 		getHeaderCanonical(request.Header, grpcHeaderCompression),
 		getHeaderCanonical(request.Header, grpcHeaderAcceptCompression),
+		g.ResponseCompressionName,
 	)
 	if failed == nil {
 		failed = checkServerStreamsCanFlush(g.Spec, responseWriter)
@@ -166,43 +188,65 @@ func (g *grpcHandler) NewConn(
 	//
 	// Since we know that these header keys are already in canonical form, we can
 	// skip the normalization in Header.Set.
+	contentType := getHeaderCanonical(request.Header, headerContentType)
+	codecName := grpcCodecFromContentType(g.web, contentType)
+	codec := g.Codecs.Get(codecName) // handler.go guarantees this is not nil
+	if codec.Name() != codecName {
+		// The client used one of the codec's aliases, but responses always use
+		// its canonical name.
+		codecName = codec.Name()
+		contentType = grpcContentTypeFromCodecName(g.web, codecName)
+	}
 	header := responseWriter.Header()
-	header[headerContentType] = []string{getHeaderCanonical(request.Header, headerContentType)}
+	header[headerContentType] = []string{contentType}
 	header[grpcHeaderAcceptCompression] = []string{g.CompressionPools.CommaSeparatedNames()}
 	if responseCompression != compressionIdentity {
 		header[grpcHeaderCompression] = []string{responseCompression}
 	}
-
-	codecName := grpcCodecFromContentType(g.web, getHeaderCanonical(request.Header, headerContentType))
-	codec := g.Codecs.Get(codecName) // handler.go guarantees this is not nil
 	protocolName := ProtocolGRPC
 	if g.web {
 		protocolName = ProtocolGRPCWeb
 	}
+	stats := newWireStatsCounter(g.Spec, g.WireStats)
 	conn := wrapHandlerConnWithCodedErrors(&grpcHandlerConn{
 		spec: g.Spec,
 		peer: Peer{
-			Addr:     request.RemoteAddr,
-			Protocol: protocolName,
+			Addr:                request.RemoteAddr,
+			Protocol:            protocolName,
+			Codec:               codecName,
+			NetAddr:             newPeerNetAddr(request),
+			RequestCompression:  peerCompression(requestCompression),
+			ResponseCompression: peerCompression(responseCompression),
 		},
 		web:        g.web,
 		bufferPool: g.BufferPool,
 		protobuf:   g.Codecs.Protobuf(), // for errors
 		marshaler: grpcMarshaler{
 			envelopeWriter: envelopeWriter{
-				ctx:              ctx,
-				sender:           writeSender{writer: responseWriter},
-				compressionPool:  g.CompressionPools.Get(responseCompression),
-				codec:            codec,
-				compressMinBytes: g.CompressMinBytes,
-				bufferPool:       g.BufferPool,
-				sendMaxBytes:     g.SendMaxBytes,
+				ctx:                  ctx,
+				sender:               writeSender{writer: responseWriter},
+				compressionPool:      g.CompressionPools.Get(responseCompression),
+				codec:                codec,
+				compressMinBytes:     g.CompressMinBytes,
+				compressionHeuristic: g.CompressionHeuristic,
+				bufferPool:           g.BufferPool,
+				sendMaxBytes:         g.SendMaxBytes,
+				stats:                stats,
 			},
 		},
 		responseWriter:  responseWriter,
 		responseHeader:  make(http.Header),
 		responseTrailer: make(http.Header),
-		request:         request,
+		stats:           stats,
+		flusher: &responseFlusher{
+			responseWriter: responseWriter,
+			manual:         g.ManualFlush,
+			threshold:      g.FlushThreshold,
+		},
+		sendTimeout:         g.SendTimeout,
+		request:             request,
+		firstMessageTimeout: g.FirstMessageTimeout,
+		serverDeadlines:     newServerDeadlines(request),
 		unmarshaler: grpcUnmarshaler{
 			envelopeReader: envelopeReader{
 				ctx:             ctx,
@@ -211,6 +255,7 @@ func (g *grpcHandler) NewConn(
 				compressionPool: g.CompressionPools.Get(requestCompression),
 				bufferPool:      g.BufferPool,
 				readMaxBytes:    g.ReadMaxBytes,
+				stats:           stats,
 			},
 			web: g.web,
 		},
@@ -226,8 +271,9 @@ func (g *grpcHandler) NewConn(
 type grpcClient struct {
 	protocolClientParams
 
-	web  bool
-	peer Peer
+	web       bool
+	peer      Peer
+	userAgent string
 }
 
 func (g *grpcClient) Peer() Peer {
@@ -238,14 +284,14 @@ func (g *grpcClient) WriteRequestHeader(_ StreamType, header http.Header) {
 	// We know these header keys are in canonical form, so we can bypass all the
 	// checks in Header.Set.
 	if getHeaderCanonical(header, headerUserAgent) == "" {
-		header[headerUserAgent] = []string{defaultGrpcUserAgent}
+		header[headerUserAgent] = []string{g.userAgent}
 	}
 	if g.web && getHeaderCanonical(header, headerXUserAgent) == "" {
 		// The gRPC-Web pseudo-specification seems to require X-User-Agent rather
 		// than User-Agent for all clients, even if they're not browser-based. This
 		// is very odd for a backend client, so we'll split the difference and set
 		// both.
-		header[headerXUserAgent] = []string{defaultGrpcUserAgent}
+		header[headerXUserAgent] = []string{g.userAgent}
 	}
 	header[headerContentType] = []string{grpcContentTypeFromCodecName(g.web, g.Codec.Name())}
 	// gRPC handles compression on a per-message basis, so we don't want to
@@ -270,8 +316,8 @@ func (g *grpcClient) NewConn(
 	spec Spec,
 	header http.Header,
 ) streamingClientConn {
-	if deadline, ok := ctx.Deadline(); ok {
-		encodedDeadline := grpcEncodeTimeout(time.Until(deadline))
+	if timeout, ok := timeUntilDeadline(ctx); ok {
+		encodedDeadline := grpcEncodeTimeout(timeout)
 		header[grpcHeaderTimeout] = []string{encodedDeadline}
 	}
 	duplexCall := newDuplexHTTPCall(
@@ -281,6 +327,13 @@ func (g *grpcClient) NewConn(
 		spec,
 		header,
 	)
+	duplexCall.signer = g.RequestSigner
+	duplexCall.mutator = g.RequestMutator
+	duplexCall.request.Close = g.DisableKeepAlives
+	if spec.StreamType != StreamTypeUnary {
+		duplexCall.offerKeepalive(g.Clock, g.KeepaliveInterval, g.KeepaliveTimeout)
+	}
+	stats := newWireStatsCounter(spec, g.WireStats)
 	conn := &grpcClientConn{
 		spec:             spec,
 		peer:             g.Peer(),
@@ -290,13 +343,15 @@ func (g *grpcClient) NewConn(
 		protobuf:         g.Protobuf,
 		marshaler: grpcMarshaler{
 			envelopeWriter: envelopeWriter{
-				ctx:              ctx,
-				sender:           duplexCall,
-				compressionPool:  g.CompressionPools.Get(g.CompressionName),
-				codec:            g.Codec,
-				compressMinBytes: g.CompressMinBytes,
-				bufferPool:       g.BufferPool,
-				sendMaxBytes:     g.SendMaxBytes,
+				ctx:                  ctx,
+				sender:               duplexCall,
+				compressionPool:      g.CompressionPools.Get(g.CompressionName),
+				codec:                g.Codec,
+				compressMinBytes:     g.CompressMinBytes,
+				compressionHeuristic: g.CompressionHeuristic,
+				bufferPool:           g.BufferPool,
+				sendMaxBytes:         g.SendMaxBytes,
+				stats:                stats,
 			},
 		},
 		unmarshaler: grpcUnmarshaler{
@@ -306,29 +361,48 @@ func (g *grpcClient) NewConn(
 				codec:        g.Codec,
 				bufferPool:   g.BufferPool,
 				readMaxBytes: g.ReadMaxBytes,
+				stats:        stats,
 			},
 		},
 		responseHeader:  make(http.Header),
 		responseTrailer: make(http.Header),
+		stats:           stats,
 	}
 	duplexCall.SetValidateResponse(conn.validateResponse)
+	conn.readTrailers = grpcReadHTTPTrailers
 	if g.web {
 		conn.unmarshaler.web = true
-		conn.readTrailers = func(unmarshaler *grpcUnmarshaler, _ *duplexHTTPCall) http.Header {
-			return unmarshaler.WebTrailer()
-		}
-	} else {
-		conn.readTrailers = func(_ *grpcUnmarshaler, call *duplexHTTPCall) http.Header {
-			// To access HTTP trailers, we need to read the body to EOF.
-			_, _ = discard(call)
-			return call.ResponseTrailer()
+		switch g.GRPCWebTrailers {
+		case GRPCWebTrailersBody:
+			conn.readTrailers = grpcReadWebTrailers
+		case GRPCWebTrailersHTTP:
+			// Already reading HTTP trailers.
+		default:
+			conn.readTrailers = func(unmarshaler *grpcUnmarshaler, call *duplexHTTPCall) http.Header {
+				if trailer := grpcReadWebTrailers(unmarshaler, call); trailer != nil {
+					return trailer
+				}
+				return grpcReadHTTPTrailers(unmarshaler, call)
+			}
 		}
 	}
 	return wrapClientConnWithCodedErrors(conn)
 }
 
+func grpcReadHTTPTrailers(_ *grpcUnmarshaler, call *duplexHTTPCall) http.Header {
+	// To access HTTP trailers, we need to read the body to EOF.
+	_, _ = discard(call)
+	return call.ResponseTrailer()
+}
+
+func grpcReadWebTrailers(unmarshaler *grpcUnmarshaler, _ *duplexHTTPCall) http.Header {
+	return unmarshaler.WebTrailer()
+}
+
 // grpcClientConn works for both gRPC and gRPC-Web.
 type grpcClientConn struct {
+	messageCounts
+
 	spec             Spec
 	peer             Peer
 	duplexCall       *duplexHTTPCall
@@ -340,6 +414,10 @@ type grpcClientConn struct {
 	responseHeader   http.Header
 	responseTrailer  http.Header
 	readTrailers     func(*grpcUnmarshaler, *duplexHTTPCall) http.Header
+	stats            *wireStatsCounter
+	// responseCompression is set by validateResponse, so it's only safe to
+	// read once the response is ready.
+	responseCompression string
 }
 
 func (cc *grpcClientConn) Spec() Spec {
@@ -347,13 +425,18 @@ func (cc *grpcClientConn) Spec() Spec {
 }
 
 func (cc *grpcClientConn) Peer() Peer {
-	return cc.peer
+	peer := cc.peer
+	if cc.duplexCall.ResponseReady() {
+		peer.ResponseCompression = cc.responseCompression
+	}
+	return peer
 }
 
 func (cc *grpcClientConn) Send(msg any) error {
 	if err := cc.marshaler.Marshal(msg); err != nil {
 		return err
 	}
+	cc.countSent(msg)
 	return nil // must be a literal nil: nil *Error is a non-nil error
 }
 
@@ -362,7 +445,7 @@ func (cc *grpcClientConn) RequestHeader() http.Header {
 }
 
 func (cc *grpcClientConn) CloseRequest() error {
-	return cc.duplexCall.CloseWrite()
+	return cc.duplexCall.CloseRequest()
 }
 
 func (cc *grpcClientConn) Receive(msg any) error {
@@ -371,6 +454,7 @@ func (cc *grpcClientConn) Receive(msg any) error {
 	}
 	err := cc.unmarshaler.Unmarshal(msg)
 	if err == nil {
+		cc.countReceived()
 		return nil
 	}
 	mergeHeaders(
@@ -390,8 +474,8 @@ func (cc *grpcClientConn) Receive(msg any) error {
 		// Try to read the status out of the headers.
 		serverErr := grpcErrorFromTrailer(cc.protobuf, cc.responseHeader)
 		if serverErr == nil {
-			// Status says "OK". So return original error (io.EOF).
-			return err
+			// Status says "OK", so the stream ended cleanly.
+			return io.EOF
 		}
 		serverErr.meta = cc.responseHeader.Clone()
 		return serverErr
@@ -413,10 +497,15 @@ func (cc *grpcClientConn) Receive(msg any) error {
 		_ = cc.duplexCall.CloseWrite()
 		return serverErr
 	}
+	_ = cc.duplexCall.CloseWrite()
+	if errors.Is(err, io.EOF) {
+		// Without an error in the trailers, the stream ended cleanly. Return a
+		// bare io.EOF, so callers can compare it directly.
+		return io.EOF
+	}
 	// This was probably an error converting the bytes to a message or an error
 	// reading from the network. We're going to return it to the
 	// user, but we also want to close writes so Send errors out.
-	_ = cc.duplexCall.CloseWrite()
 	return err
 }
 
@@ -431,6 +520,7 @@ func (cc *grpcClientConn) ResponseTrailer() http.Header {
 }
 
 func (cc *grpcClientConn) CloseResponse() error {
+	defer cc.stats.finish()
 	return cc.duplexCall.CloseRead()
 }
 
@@ -450,10 +540,13 @@ func (cc *grpcClientConn) validateResponse(response *http.Response) *Error {
 	}
 	compression := getHeaderCanonical(response.Header, grpcHeaderCompression)
 	cc.unmarshaler.compressionPool = cc.compressionPools.Get(compression)
+	cc.responseCompression = peerCompression(compression)
 	return nil
 }
 
 type grpcHandlerConn struct {
+	messageCounts
+
 	spec            Spec
 	peer            Peer
 	web             bool
@@ -464,8 +557,15 @@ type grpcHandlerConn struct {
 	responseHeader  http.Header
 	responseTrailer http.Header
 	wroteToBody     bool
+	receivedEOF     bool // read the whole request body
 	request         *http.Request
 	unmarshaler     grpcUnmarshaler
+	stats           *wireStatsCounter
+	flusher         *responseFlusher
+	sendTimeout     time.Duration
+	// firstMessageTimeout bounds the wait for the first request message.
+	firstMessageTimeout time.Duration
+	serverDeadlines     serverDeadlines
 }
 
 func (hc *grpcHandlerConn) Spec() Spec {
@@ -477,9 +577,22 @@ func (hc *grpcHandlerConn) Peer() Peer {
 }
 
 func (hc *grpcHandlerConn) Receive(msg any) error {
+	if hc.firstMessageTimeout > 0 && hc.receivedMessages() == 0 {
+		return receiveWithTimeout(hc.responseWriter, hc.firstMessageTimeout, hc.serverDeadlines.read, func() error {
+			return hc.receive(msg)
+		})
+	}
+	return hc.receive(msg)
+}
+
+func (hc *grpcHandlerConn) receive(msg any) error {
 	if err := hc.unmarshaler.Unmarshal(msg); err != nil {
+		if errors.Is(err, io.EOF) {
+			hc.receivedEOF = true
+		}
 		return err // already coded
 	}
+	hc.countReceived()
 	return nil // must be a literal nil: nil *Error is a non-nil error
 }
 
@@ -488,7 +601,38 @@ func (hc *grpcHandlerConn) RequestHeader() http.Header {
 }
 
 func (hc *grpcHandlerConn) Send(msg any) error {
-	defer flushResponseWriter(hc.responseWriter)
+	send := func() error {
+		if err := hc.send(msg); err != nil {
+			return err
+		}
+		hc.flusher.sent()
+		return nil
+	}
+	if hc.sendTimeout > 0 {
+		return sendWithTimeout(hc.responseWriter, hc.sendTimeout, hc.serverDeadlines.write, send)
+	}
+	return send()
+}
+
+func (hc *grpcHandlerConn) flush() error {
+	// Flushing sends the headers, so merge the user's headers first and give up
+	// on a trailers-only response.
+	if !hc.wroteToBody {
+		mergeHeaders(hc.responseWriter.Header(), hc.responseHeader)
+		hc.wroteToBody = true
+	}
+	if hc.sendTimeout > 0 {
+		return sendWithTimeout(hc.responseWriter, hc.sendTimeout, hc.serverDeadlines.write, hc.flusher.flush)
+	}
+	return hc.flusher.flush()
+}
+
+func (hc *grpcHandlerConn) send(msg any) error {
+	if err := hc.request.Context().Err(); err != nil {
+		// The client has disconnected (or the deadline has passed), so writing
+		// would at best fill a buffer no one reads.
+		return wrapIfContextError(err)
+	}
 	if !hc.wroteToBody {
 		mergeHeaders(hc.responseWriter.Header(), hc.responseHeader)
 		hc.wroteToBody = true
@@ -496,6 +640,7 @@ func (hc *grpcHandlerConn) Send(msg any) error {
 	if err := hc.marshaler.Marshal(msg); err != nil {
 		return err
 	}
+	hc.countSent(msg)
 	return nil // must be a literal nil: nil *Error is a non-nil error
 }
 
@@ -508,6 +653,7 @@ func (hc *grpcHandlerConn) ResponseTrailer() http.Header {
 }
 
 func (hc *grpcHandlerConn) Close(err error) (retErr error) {
+	defer hc.stats.finish()
 	defer func() {
 		// We don't want to copy unread portions of the body to /dev/null here: if
 		// the client hasn't closed the request body, we'll block until the server
@@ -520,7 +666,19 @@ func (hc *grpcHandlerConn) Close(err error) (retErr error) {
 			retErr = closeErr
 		}
 	}()
-	defer flushResponseWriter(hc.responseWriter)
+	// If we haven't written to the body and there are no custom headers, we
+	// may be able to send a "trailers-only" response, with the trailing
+	// metadata in the headers. Strict gRPC clients expect it to be a single
+	// HEADERS frame that ends the stream, so we mustn't flush the headers
+	// before the handler returns. Ending the stream also stops clients from
+	// sending, though, so gRPC only sends trailers-only responses once the
+	// request body has been read; gRPC-Web has no trailers to fall back on.
+	trailersOnly := !hc.wroteToBody && len(hc.responseHeader) == 0 && (hc.web || hc.receivedEOF)
+	defer func() {
+		if !trailersOnly || !hc.receivedEOF {
+			flushResponseWriter(hc.responseWriter)
+		}
+	}()
 	// If we haven't written the headers yet, do so.
 	if !hc.wroteToBody {
 		mergeHeaders(hc.responseWriter.Header(), hc.responseHeader)
@@ -534,10 +692,9 @@ func (hc *grpcHandlerConn) Close(err error) (retErr error) {
 	)
 	mergeHeaders(mergedTrailers, hc.responseTrailer)
 	grpcErrorToTrailer(mergedTrailers, hc.protobuf, err)
-	if hc.web && !hc.wroteToBody && len(hc.responseHeader) == 0 {
-		// We're using gRPC-Web, we haven't yet written to the body, and there are no
-		// custom headers. That means we can send a "trailers-only" response and send
-		// trailing metadata as HTTP headers (instead of as trailers).
+	if trailersOnly {
+		// Over HTTP/2, net/http sends headers with no body and no trailers as a
+		// single HEADERS frame that ends the stream.
 		mergeHeaders(hc.responseWriter.Header(), mergedTrailers)
 		return nil
 	}
@@ -549,11 +706,8 @@ func (hc *grpcHandlerConn) Close(err error) (retErr error) {
 		}
 		return nil // must be a literal nil: nil *Error is a non-nil error
 	}
-	// We're using standard gRPC. Even if we haven't written to the body and
-	// we're sending a "trailers-only" response, we must send trailing metadata
-	// as HTTP trailers. (If we had frame-level control of the HTTP/2 layer, we
-	// could send trailers-only responses as a single HEADER frame and no DATA
-	// frames, but net/http doesn't expose APIs that low-level.)
+	// We're using standard gRPC and we've already sent the headers, so we send
+	// trailing metadata as HTTP trailers.
 	//
 	// In net/http's ResponseWriter API, we send HTTP trailers by writing to the
 	// headers map with a special prefix. This prefixing is an implementation
@@ -619,7 +773,7 @@ func (u *grpcUnmarshaler) Unmarshal(message any) *Error {
 	u.last.Data = nil // don't keep a reference to it
 	defer u.bufferPool.Put(data)
 	if !u.web || !env.IsSet(grpcFlagEnvelopeTrailer) {
-		return errorf(CodeInternal, "protocol error: invalid envelope flags %d", env.Flags)
+		return protocolErrorf(CodeInternal, "protocol error: invalid envelope flags %d", env.Flags)
 	}
 
 	// Per the gRPC-Web specification, trailers should be encoded as an HTTP/1
@@ -632,7 +786,7 @@ func (u *grpcUnmarshaler) Unmarshal(message any) *Error {
 	mimeReader := textproto.NewReader(bufferedReader)
 	mimeHeader, mimeErr := mimeReader.ReadMIMEHeader()
 	if mimeErr != nil {
-		return errorf(
+		return protocolErrorf(
 			CodeInternal,
 			"gRPC-Web protocol error: trailers invalid: %w",
 			mimeErr,
@@ -688,7 +842,9 @@ func grpcValidateResponse(
 //
 // A nil error is only returned when a grpc-status key IS present, but it
 // indicates a code of zero (no error). If no grpc-status key is present, this
-// returns a non-nil *Error that wraps errTrailersWithoutGRPCStatus.
+// returns a non-nil *Error that wraps errTrailersWithoutGRPCStatus. Details
+// come from the google.rpc.Status in the grpc-status-details-bin key, if it's
+// present and valid; a malformed value is ignored.
 func grpcErrorFromTrailer(protobuf Codec, trailer http.Header) *Error {
 	codeHeader := getHeaderCanonical(trailer, grpcHeaderStatus)
 	if codeHeader == "" {
@@ -707,23 +863,26 @@ func grpcErrorFromTrailer(protobuf Codec, trailer http.Header) *Error {
 
 	code, err := strconv.ParseUint(codeHeader, 10 /* base */, 32 /* bitsize */)
 	if err != nil {
-		return errorf(CodeUnknown, "protocol error: invalid error code %q", codeHeader)
+		return protocolErrorf(CodeUnknown, "protocol error: invalid error code %q", codeHeader)
 	}
 	message, err := grpcPercentDecode(getHeaderCanonical(trailer, grpcHeaderMessage))
 	if err != nil {
-		return errorf(CodeInternal, "protocol error: invalid error message %q", message)
+		return protocolErrorf(CodeInternal, "protocol error: invalid error message %q", message)
 	}
 	retErr := NewWireError(Code(code), errors.New(message))
 
 	detailsBinaryEncoded := getHeaderCanonical(trailer, grpcHeaderDetails)
 	if len(detailsBinaryEncoded) > 0 {
+		// The details are optional extras, so if they're malformed we ignore
+		// them rather than hide the server's code and message behind a
+		// protocol error.
 		detailsBinary, err := DecodeBinaryHeader(detailsBinaryEncoded)
 		if err != nil {
-			return errorf(CodeInternal, "server returned invalid grpc-status-details-bin trailer: %w", err)
+			return retErr
 		}
 		var status statusv1.Status
 		if err := protobuf.Unmarshal(detailsBinary, &status); err != nil {
-			return errorf(CodeInternal, "server returned invalid protobuf for error details: %w", err)
+			return retErr
 		}
 		for _, d := range status.GetDetails() {
 			retErr.details = append(retErr.details, &ErrorDetail{pbAny: d})
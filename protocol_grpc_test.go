@@ -15,11 +15,13 @@
 package connect
 
 import (
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"math"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"strings"
 	"testing"
 	"testing/quick"
@@ -27,7 +29,12 @@ import (
 	"unicode/utf8"
 
 	"connectrpc.com/connect/internal/assert"
+	statusv1 "connectrpc.com/connect/internal/gen/connectext/grpc/status/v1"
 	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
 )
 
 func TestGRPCHandlerSender(t *testing.T) {
@@ -196,6 +203,70 @@ func TestGRPCWebTrailerMarshalling(t *testing.T) {
 	marshalled := responseWriter.Body.String()
 	assert.Equal(t, marshalled, "grpc-message: Foo\r\ngrpc-status: 0\r\nuser-provided: bar\r\n")
 }
+func TestGRPCErrorFromTrailerDetails(t *testing.T) {
+	t.Parallel()
+	first, err := anypb.New(wrapperspb.String("first"))
+	assert.Nil(t, err)
+	second, err := anypb.New(durationpb.New(time.Second))
+	assert.Nil(t, err)
+	status, err := proto.Marshal(&statusv1.Status{
+		Code:    int32(CodeFailedPrecondition),
+		Message: "from status",
+		Details: []*anypb.Any{first, second},
+	})
+	assert.Nil(t, err)
+	newTrailer := func(details string) http.Header {
+		trailer := http.Header{}
+		trailer.Set(grpcHeaderStatus, strconv.Itoa(int(CodeFailedPrecondition)))
+		trailer.Set(grpcHeaderMessage, "from headers")
+		if details != "" {
+			trailer.Set(grpcHeaderDetails, details)
+		}
+		return trailer
+	}
+	t.Run("unpadded", func(t *testing.T) {
+		t.Parallel()
+		// grpc-go omits base64 padding.
+		connectErr := grpcErrorFromTrailer(&protoBinaryCodec{}, newTrailer(base64.RawStdEncoding.EncodeToString(status)))
+		assert.NotNil(t, connectErr)
+		assert.Equal(t, connectErr.Code(), CodeFailedPrecondition)
+		assert.Equal(t, connectErr.Message(), "from status")
+		details := connectErr.Details()
+		assert.Equal(t, len(details), 2)
+		value, err := details[0].Value()
+		assert.Nil(t, err)
+		assert.True(t, proto.Equal(value, wrapperspb.String("first")))
+		value, err = details[1].Value()
+		assert.Nil(t, err)
+		assert.True(t, proto.Equal(value, durationpb.New(time.Second)))
+	})
+	t.Run("padded", func(t *testing.T) {
+		t.Parallel()
+		err := grpcErrorFromTrailer(&protoBinaryCodec{}, newTrailer(base64.StdEncoding.EncodeToString(status)))
+		assert.NotNil(t, err)
+		assert.Equal(t, len(err.Details()), 2)
+	})
+	malformed := []struct {
+		name    string
+		details string
+	}{
+		{name: "invalid_base64", details: "not*base64!"},
+		{name: "invalid_protobuf", details: base64.RawStdEncoding.EncodeToString([]byte{0xff, 0xff, 0xff})},
+	}
+	for _, testCase := range malformed {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+			// Malformed details are ignored, leaving the code and message from
+			// the other trailers.
+			err := grpcErrorFromTrailer(&protoBinaryCodec{}, newTrailer(testCase.details))
+			assert.NotNil(t, err)
+			assert.Equal(t, err.Code(), CodeFailedPrecondition)
+			assert.Equal(t, err.Message(), "from headers")
+			assert.Zero(t, len(err.Details()))
+		})
+	}
+}
+
 func BenchmarkGRPCPercentEncoding(b *testing.B) {
 	input := "Hello, 世界"
 	want := "Hello, %E4%B8%96%E7%95%8C"
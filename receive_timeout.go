@@ -0,0 +1,48 @@
+// Copyright 2021-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"time"
+)
+
+// receiveWithTimeout calls receive, which reads one message from the request.
+// If the message doesn't arrive within timeout, it fails with
+// CodeDeadlineExceeded. Afterwards, it restores serverDeadline, the read
+// deadline from the server's ReadTimeout (zero if there isn't one). Response
+// writers that don't support read deadlines receive without one.
+func receiveWithTimeout(responseWriter http.ResponseWriter, timeout time.Duration, serverDeadline time.Time, receive func() error) error {
+	controller := http.NewResponseController(responseWriter)
+	deadline := time.Now().Add(timeout)
+	if !serverDeadline.IsZero() && serverDeadline.Before(deadline) {
+		deadline = serverDeadline
+	}
+	if err := controller.SetReadDeadline(deadline); err != nil {
+		return receive()
+	}
+	// Put back the server's deadline, so that later messages can take as long
+	// as it allows.
+	defer func() {
+		_ = controller.SetReadDeadline(serverDeadline)
+	}()
+	err := receive()
+	if err != nil && errors.Is(err, os.ErrDeadlineExceeded) {
+		return errorf(CodeDeadlineExceeded, "no message received within %v: %w", timeout, err)
+	}
+	return err
+}
@@ -0,0 +1,145 @@
+// Copyright 2021-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	connect "connectrpc.com/connect"
+	"connectrpc.com/connect/internal/assert"
+	pingv1 "connectrpc.com/connect/internal/gen/connect/ping/v1"
+	"connectrpc.com/connect/internal/gen/connect/ping/v1/pingv1connect"
+	"connectrpc.com/connect/internal/memhttp/memhttptest"
+)
+
+func TestWithFirstMessageTimeout(t *testing.T) {
+	t.Parallel()
+	const timeout = 50 * time.Millisecond
+	receiveErrs := make(chan error, 1)
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(&pluggablePingServer{
+		ping: func(_ context.Context, request *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+			return connect.NewResponse(&pingv1.PingResponse{Number: request.Msg.GetNumber()}), nil
+		},
+		sum: func(_ context.Context, stream *connect.ClientStream[pingv1.SumRequest]) (*connect.Response[pingv1.SumResponse], error) {
+			var sum int64
+			for stream.Receive() {
+				sum += stream.Msg().GetNumber()
+			}
+			if err := stream.Err(); err != nil {
+				receiveErrs <- err
+				return nil, err
+			}
+			return connect.NewResponse(&pingv1.SumResponse{Sum: sum}), nil
+		},
+	}, connect.WithFirstMessageTimeout(timeout)))
+	server := memhttptest.NewServer(t, mux)
+	for _, protocol := range []struct {
+		name string
+		opts []connect.ClientOption
+	}{
+		{name: "connect"},
+		{name: "grpc", opts: []connect.ClientOption{connect.WithGRPC()}},
+		{name: "grpcweb", opts: []connect.ClientOption{connect.WithGRPCWeb()}},
+	} {
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL(), protocol.opts...)
+		t.Run(protocol.name+"/slow_start", func(t *testing.T) {
+			stream := client.Sum(context.Background())
+			// Open the stream, but hold back the first message.
+			assert.Nil(t, stream.Send(nil))
+			select {
+			case err := <-receiveErrs:
+				assert.Equal(t, connect.CodeOf(err), connect.CodeDeadlineExceeded)
+				assert.True(t, strings.Contains(err.Error(), "no message received within 50ms"))
+			case <-time.After(5 * time.Second):
+				t.Fatal("handler didn't time out")
+			}
+			if err := stream.Send(&pingv1.SumRequest{Number: 1}); err != nil {
+				assert.True(t, errors.Is(err, io.EOF))
+			}
+			_, err := stream.CloseAndReceive()
+			assert.Equal(t, connect.CodeOf(err), connect.CodeDeadlineExceeded)
+		})
+		t.Run(protocol.name+"/slow_later_messages", func(t *testing.T) {
+			stream := client.Sum(context.Background())
+			assert.Nil(t, stream.Send(&pingv1.SumRequest{Number: 1}))
+			// Only the first message is bounded.
+			time.Sleep(3 * timeout)
+			assert.Nil(t, stream.Send(&pingv1.SumRequest{Number: 2}))
+			response, err := stream.CloseAndReceive()
+			assert.Nil(t, err)
+			assert.Equal(t, response.Msg.GetSum(), 3)
+		})
+	}
+	t.Run("grpc_unary", func(t *testing.T) {
+		// Unary gRPC requests are bounded too, but arrive promptly.
+		client := pingv1connect.NewPingServiceClient(server.Client(), server.URL(), connect.WithGRPC())
+		response, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Number: 1}))
+		assert.Nil(t, err)
+		assert.Equal(t, response.Msg.GetNumber(), 1)
+	})
+}
+
+func TestWithFirstMessageTimeoutRestoresServerDeadline(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}, connect.WithFirstMessageTimeout(time.Minute)))
+	for _, testCase := range []struct {
+		name        string
+		readTimeout time.Duration
+	}{
+		{name: "server_timeout", readTimeout: time.Hour},
+		{name: "no_server_timeout"},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+			server, writers := newDeadlineRecordingServer(t, &http.Server{ReadTimeout: testCase.readTimeout}, mux) //nolint:gosec
+			for _, protocol := range []struct {
+				name string
+				opts []connect.ClientOption
+			}{
+				{name: "connect"},
+				{name: "grpc", opts: []connect.ClientOption{connect.WithGRPC()}},
+				{name: "grpcweb", opts: []connect.ClientOption{connect.WithGRPCWeb()}},
+			} {
+				t.Run(protocol.name, func(t *testing.T) {
+					client := pingv1connect.NewPingServiceClient(server.Client(), server.URL(), protocol.opts...)
+					start := time.Now()
+					stream := client.Sum(context.Background())
+					assert.Nil(t, stream.Send(&pingv1.SumRequest{Number: 1}))
+					assert.Nil(t, stream.Send(&pingv1.SumRequest{Number: 2}))
+					response, err := stream.CloseAndReceive()
+					assert.Nil(t, err)
+					assert.Equal(t, response.Msg.GetSum(), 3)
+					// The handler put back the deadline from the server's ReadTimeout,
+					// or cleared its own if the server has none.
+					deadline, _ := (<-writers).deadlines()
+					if testCase.readTimeout == 0 {
+						assert.True(t, deadline.IsZero())
+						return
+					}
+					assert.False(t, deadline.Before(start.Add(testCase.readTimeout)))
+					assert.False(t, deadline.After(time.Now().Add(testCase.readTimeout)))
+				})
+			}
+		})
+	}
+}
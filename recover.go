@@ -16,16 +16,56 @@ package connect
 
 import (
 	"context"
+	"errors"
 	"net/http"
+	"runtime/debug"
 )
 
+// errHandlerPanicked is sent to clients by [PanicRecoverToInternal]. It
+// doesn't include the panic value, which may not be safe to share.
+var errHandlerPanicked = errors.New("handler panicked")
+
+// PanicHandling describes what a handler does when the RPC implementation
+// panics: the panic keeps propagating, or it's recovered and turned into an
+// error for the client. Use it with [WithPanicHandling].
+type PanicHandling struct {
+	// handle is nil when panics propagate.
+	handle func(ctx context.Context, panicValue any, stack []byte) error
+}
+
+// PanicRethrow lets panics propagate out of the handler, so that they reach
+// the [http.Server] or whatever supervises it. This is the default.
+func PanicRethrow() PanicHandling {
+	return PanicHandling{}
+}
+
+// PanicRecoverToInternal recovers from panics and sends clients an error with
+// [CodeInternal].
+func PanicRecoverToInternal() PanicHandling {
+	return PanicHandling{
+		handle: func(context.Context, any, []byte) error {
+			return NewError(CodeInternal, errHandlerPanicked)
+		},
+	}
+}
+
+// PanicCustom recovers from panics and sends clients the error returned by
+// handle. The function receives the recovered value and the stack trace of
+// the panicking goroutine, and must be safe to call concurrently.
+func PanicCustom(handle func(ctx context.Context, panicValue any, stack []byte) error) PanicHandling {
+	if handle == nil {
+		return PanicRecoverToInternal()
+	}
+	return PanicHandling{handle: handle}
+}
+
 // recoverHandlerInterceptor lets handlers trap panics, perform side effects
 // (like emitting logs or metrics), and present a friendlier error message to
 // clients.
 type recoverHandlerInterceptor struct {
 	Interceptor
 
-	handle func(context.Context, Spec, http.Header, any) error
+	handle func(ctx context.Context, spec Spec, header http.Header, panicValue any, stack []byte) error
 }
 
 func (i *recoverHandlerInterceptor) WrapUnary(next UnaryFunc) UnaryFunc {
@@ -39,7 +79,7 @@ func (i *recoverHandlerInterceptor) WrapUnary(next UnaryFunc) UnaryFunc {
 				if r == http.ErrAbortHandler { //nolint:errorlint,goerr113
 					panic(r) //nolint:forbidigo
 				}
-				retErr = i.handle(ctx, req.Spec(), req.Header(), r)
+				retErr = i.handle(ctx, req.Spec(), req.Header(), r, debug.Stack())
 			}
 		}()
 		res, err := next(ctx, req)
@@ -55,7 +95,7 @@ func (i *recoverHandlerInterceptor) WrapStreamingHandler(next StreamingHandlerFu
 				if r == http.ErrAbortHandler { //nolint:errorlint,goerr113
 					panic(r) //nolint:forbidigo
 				}
-				retErr = i.handle(ctx, conn.Spec(), conn.RequestHeader(), r)
+				retErr = i.handle(ctx, conn.Spec(), conn.RequestHeader(), r, debug.Stack())
 			}
 		}()
 		err := next(ctx, conn)
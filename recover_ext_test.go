@@ -16,8 +16,12 @@ package connect_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
 	"testing"
 
 	connect "connectrpc.com/connect"
@@ -103,3 +107,89 @@ func TestWithRecover(t *testing.T) {
 	assert.Nil(t, err)
 	assertNotHandled(drainStream(stream))
 }
+
+func TestWithPanicHandling(t *testing.T) {
+	t.Parallel()
+	newClient := func(t *testing.T, opts ...connect.HandlerOption) pingv1connect.PingServiceClient {
+		t.Helper()
+		mux := http.NewServeMux()
+		mux.Handle(pingv1connect.NewPingServiceHandler(&panicPingServer{panicWith: 42}, opts...))
+		server := memhttptest.NewServer(t, mux)
+		return pingv1connect.NewPingServiceClient(server.Client(), server.URL())
+	}
+	countUp := func(t *testing.T, client pingv1connect.PingServiceClient) error {
+		t.Helper()
+		stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{}))
+		assert.Nil(t, err)
+		defer stream.Close()
+		assert.True(t, stream.Receive())
+		assert.False(t, stream.Receive())
+		return stream.Err()
+	}
+	t.Run("recover_to_internal", func(t *testing.T) {
+		t.Parallel()
+		client := newClient(t, connect.WithPanicHandling(connect.PanicRecoverToInternal()))
+		_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+		assert.Equal(t, connect.CodeOf(err), connect.CodeInternal)
+		var connectErr *connect.Error
+		assert.True(t, errors.As(err, &connectErr))
+		assert.Equal(t, connectErr.Message(), "handler panicked")
+		assert.Equal(t, connect.CodeOf(countUp(t, client)), connect.CodeInternal)
+	})
+	t.Run("custom", func(t *testing.T) {
+		t.Parallel()
+		var stacks atomic.Int32
+		client := newClient(t, connect.WithPanicHandling(connect.PanicCustom(
+			func(_ context.Context, panicValue any, stack []byte) error {
+				if strings.Contains(string(stack), "panicPingServer") {
+					stacks.Add(1)
+				}
+				return connect.NewError(connect.CodeFailedPrecondition, fmt.Errorf("panic: %v", panicValue))
+			},
+		)))
+		_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+		assert.Equal(t, connect.CodeOf(err), connect.CodeFailedPrecondition)
+		var connectErr *connect.Error
+		assert.True(t, errors.As(err, &connectErr))
+		assert.Equal(t, connectErr.Message(), "panic: 42")
+		assert.Equal(t, connect.CodeOf(countUp(t, client)), connect.CodeFailedPrecondition)
+		assert.Equal(t, stacks.Load(), 2)
+	})
+	t.Run("interceptor_panics", func(t *testing.T) {
+		t.Parallel()
+		panicky := connect.UnaryInterceptorFunc(func(connect.UnaryFunc) connect.UnaryFunc {
+			return func(context.Context, connect.AnyRequest) (connect.AnyResponse, error) {
+				panic("interceptor") //nolint:forbidigo
+			}
+		})
+		client := newClient(t,
+			connect.WithInterceptors(panicky),
+			connect.WithPanicHandling(connect.PanicRecoverToInternal()),
+		)
+		_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+		assert.Equal(t, connect.CodeOf(err), connect.CodeInternal)
+	})
+	t.Run("rethrow", func(t *testing.T) {
+		t.Parallel()
+		// The last option wins, so this handler doesn't recover.
+		_, handler := pingv1connect.NewPingServiceHandler(
+			&panicPingServer{panicWith: 42},
+			connect.WithPanicHandling(connect.PanicRecoverToInternal()),
+			connect.WithPanicHandling(connect.PanicRethrow()),
+		)
+		request := httptest.NewRequest(
+			http.MethodPost,
+			pingv1connect.PingServicePingProcedure,
+			strings.NewReader("{}"),
+		)
+		request.Header.Set("Content-Type", "application/json")
+		recovered := func() (recovered any) {
+			defer func() {
+				recovered = recover()
+			}()
+			handler.ServeHTTP(httptest.NewRecorder(), request)
+			return nil
+		}()
+		assert.Equal(t, recovered, any(42))
+	})
+}
@@ -0,0 +1,161 @@
+// Copyright 2021-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+type requestIDContextKey struct{}
+
+// RequestIDFromContext returns the request ID stored in the context by
+// [WithRequestID], if any.
+func RequestIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(requestIDContextKey{}).(string)
+	return id, ok && id != ""
+}
+
+// requestIDInterceptor makes sure that every RPC carries a request ID. Clients
+// send the caller's ID or generate one, and handlers use the client's ID or
+// generate one and echo it in the response metadata.
+type requestIDInterceptor struct {
+	header   string
+	generate func() string
+}
+
+func newRequestIDInterceptor(header string, generate func() string) *requestIDInterceptor {
+	if generate == nil {
+		generate = newRandomRequestID
+	}
+	return &requestIDInterceptor{
+		header:   http.CanonicalHeaderKey(header),
+		generate: generate,
+	}
+}
+
+func (i *requestIDInterceptor) WrapUnary(next UnaryFunc) UnaryFunc {
+	return func(ctx context.Context, request AnyRequest) (AnyResponse, error) {
+		if request.Spec().IsClient {
+			ctx, id := i.clientID(ctx, request.Header())
+			request.Header().Set(i.header, id)
+			return next(ctx, request)
+		}
+		ctx, id := i.handlerID(ctx, request.Header())
+		response, err := next(ctx, request)
+		if err != nil {
+			// Code the error the same way the handler will, so there's somewhere to
+			// put the ID.
+			err = wrapIfUncoded(err)
+			if connectErr, ok := asError(err); ok {
+				connectErr.Meta().Set(i.header, id)
+			}
+			return nil, err
+		}
+		if response != nil {
+			response.Header().Set(i.header, id)
+		}
+		return response, nil
+	}
+}
+
+func (i *requestIDInterceptor) WrapStreamingClient(next StreamingClientFunc) StreamingClientFunc {
+	return func(ctx context.Context, spec Spec) StreamingClientConn {
+		// Stream headers are only available once the connection exists, and
+		// callers may set them until the first Send, so we wait until then to
+		// check for an ID set by the caller.
+		ctx, id := i.clientID(ctx, nil)
+		return &requestIDClientConn{
+			StreamingClientConn: next(ctx, spec),
+			header:              i.header,
+			id:                  id,
+		}
+	}
+}
+
+func (i *requestIDInterceptor) WrapStreamingHandler(next StreamingHandlerFunc) StreamingHandlerFunc {
+	return func(ctx context.Context, conn StreamingHandlerConn) error {
+		ctx, id := i.handlerID(ctx, conn.RequestHeader())
+		conn.ResponseHeader().Set(i.header, id)
+		return next(ctx, conn)
+	}
+}
+
+// clientID picks the ID for an outbound request. An ID already in the headers
+// wins, followed by one in the context (for example, from an inbound request
+// to a handler that's now calling another service).
+func (i *requestIDInterceptor) clientID(ctx context.Context, header http.Header) (context.Context, string) {
+	id := header.Get(i.header)
+	if id == "" {
+		if fromContext, ok := RequestIDFromContext(ctx); ok {
+			return ctx, fromContext
+		}
+		id = i.generate()
+	}
+	return context.WithValue(ctx, requestIDContextKey{}, id), id
+}
+
+// handlerID picks the ID for an inbound request, never replacing one sent by
+// the client.
+func (i *requestIDInterceptor) handlerID(ctx context.Context, header http.Header) (context.Context, string) {
+	id := header.Get(i.header)
+	if id == "" {
+		id = i.generate()
+	}
+	return context.WithValue(ctx, requestIDContextKey{}, id), id
+}
+
+// requestIDClientConn adds the request ID to the stream's headers as they're
+// sent, unless the caller has already set one.
+type requestIDClientConn struct {
+	StreamingClientConn
+
+	header     string
+	id         string
+	headerDone bool
+}
+
+func (c *requestIDClientConn) Send(msg any) error {
+	c.setHeader()
+	return c.StreamingClientConn.Send(msg)
+}
+
+func (c *requestIDClientConn) CloseRequest() error {
+	// Streams that don't send any messages send their headers on close.
+	c.setHeader()
+	return c.StreamingClientConn.CloseRequest()
+}
+
+func (c *requestIDClientConn) Unwrap() StreamingClientConn {
+	return c.StreamingClientConn
+}
+
+func (c *requestIDClientConn) setHeader() {
+	if c.headerDone {
+		return
+	}
+	c.headerDone = true
+	if c.RequestHeader().Get(c.header) == "" {
+		c.RequestHeader().Set(c.header, c.id)
+	}
+}
+
+func newRandomRequestID() string {
+	var id [16]byte
+	_, _ = rand.Read(id[:])
+	return hex.EncodeToString(id[:])
+}
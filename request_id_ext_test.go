@@ -0,0 +1,203 @@
+// Copyright 2021-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	connect "connectrpc.com/connect"
+	"connectrpc.com/connect/internal/assert"
+	pingv1 "connectrpc.com/connect/internal/gen/connect/ping/v1"
+	"connectrpc.com/connect/internal/gen/connect/ping/v1/pingv1connect"
+	"connectrpc.com/connect/internal/memhttp/memhttptest"
+)
+
+// requestIDPingServer reports the request ID it finds in the context in
+// each response, along with the traceparent header.
+type requestIDPingServer struct {
+	pingv1connect.UnimplementedPingServiceHandler
+}
+
+func (requestIDPingServer) Ping(
+	ctx context.Context,
+	request *connect.Request[pingv1.PingRequest],
+) (*connect.Response[pingv1.PingResponse], error) {
+	id, _ := connect.RequestIDFromContext(ctx)
+	response := connect.NewResponse(&pingv1.PingResponse{Text: id})
+	response.Header().Set("Traceparent", request.Header().Get("Traceparent"))
+	return response, nil
+}
+
+func (requestIDPingServer) Fail(
+	context.Context,
+	*connect.Request[pingv1.FailRequest],
+) (*connect.Response[pingv1.FailResponse], error) {
+	return nil, errors.New("oh no")
+}
+
+func (requestIDPingServer) CountUp(
+	ctx context.Context,
+	_ *connect.Request[pingv1.CountUpRequest],
+	stream *connect.ServerStream[pingv1.CountUpResponse],
+) error {
+	id, _ := connect.RequestIDFromContext(ctx)
+	return stream.Send(&pingv1.CountUpResponse{Number: int64(len(id))})
+}
+
+func (requestIDPingServer) Sum(
+	ctx context.Context,
+	_ *connect.ClientStream[pingv1.SumRequest],
+) (*connect.Response[pingv1.SumResponse], error) {
+	id, _ := connect.RequestIDFromContext(ctx)
+	return connect.NewResponse(&pingv1.SumResponse{Sum: int64(len(id))}), nil
+}
+
+func TestWithRequestID(t *testing.T) {
+	t.Parallel()
+	const header = "X-Request-Id"
+	generator := func(id string) func() string {
+		return func() string { return id }
+	}
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(
+		requestIDPingServer{},
+		connect.WithRequestID(header, generator("server-id")),
+	))
+	server := memhttptest.NewServer(t, mux)
+	protocols := []struct {
+		name string
+		opts []connect.ClientOption
+	}{
+		{name: "connect"},
+		{name: "grpc", opts: []connect.ClientOption{connect.WithGRPC()}},
+		{name: "grpcweb", opts: []connect.ClientOption{connect.WithGRPCWeb()}},
+	}
+	for _, protocol := range protocols {
+		t.Run(protocol.name, func(t *testing.T) {
+			t.Parallel()
+			plainClient := pingv1connect.NewPingServiceClient(server.Client(), server.URL(), protocol.opts...)
+			idClient := pingv1connect.NewPingServiceClient(
+				server.Client(),
+				server.URL(),
+				append(protocol.opts, connect.WithRequestID(header, generator("client-id")))...,
+			)
+			t.Run("generated_by_handler", func(t *testing.T) {
+				t.Parallel()
+				response, err := plainClient.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+				assert.Nil(t, err)
+				assert.Equal(t, response.Msg.GetText(), "server-id")
+				assert.Equal(t, response.Header().Get(header), "server-id")
+			})
+			t.Run("generated_by_client", func(t *testing.T) {
+				t.Parallel()
+				request := connect.NewRequest(&pingv1.PingRequest{})
+				request.Header().Set("Traceparent", "00-trace-span-01")
+				response, err := idClient.Ping(context.Background(), request)
+				assert.Nil(t, err)
+				assert.Equal(t, response.Msg.GetText(), "client-id")
+				assert.Equal(t, response.Header().Get(header), "client-id")
+				assert.Equal(t, response.Header().Get("Traceparent"), "00-trace-span-01")
+			})
+			t.Run("preserves_caller_id", func(t *testing.T) {
+				t.Parallel()
+				request := connect.NewRequest(&pingv1.PingRequest{})
+				request.Header().Set(header, "caller-id")
+				response, err := idClient.Ping(context.Background(), request)
+				assert.Nil(t, err)
+				assert.Equal(t, response.Msg.GetText(), "caller-id")
+				assert.Equal(t, response.Header().Get(header), "caller-id")
+			})
+			t.Run("propagates_context_id", func(t *testing.T) {
+				t.Parallel()
+				// A handler calling another service should reuse its inbound
+				// request's ID rather than generate a new one.
+				const procedure = "/test.v1.Service/Forward"
+				forward := func(ctx context.Context, request *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+					response, err := idClient.Ping(ctx, connect.NewRequest(request.Msg))
+					if err != nil {
+						return nil, err
+					}
+					return connect.NewResponse(response.Msg), nil
+				}
+				forwardMux := http.NewServeMux()
+				forwardMux.Handle(procedure, connect.NewUnaryHandler(
+					procedure,
+					forward,
+					connect.WithRequestID(header, generator("inbound-id")),
+				))
+				forwardServer := memhttptest.NewServer(t, forwardMux)
+				response, err := connect.NewClient[pingv1.PingRequest, pingv1.PingResponse](
+					forwardServer.Client(),
+					forwardServer.URL()+procedure,
+					protocol.opts...,
+				).CallUnary(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+				assert.Nil(t, err)
+				assert.Equal(t, response.Msg.GetText(), "inbound-id")
+			})
+			t.Run("error_metadata", func(t *testing.T) {
+				t.Parallel()
+				_, err := idClient.Fail(context.Background(), connect.NewRequest(&pingv1.FailRequest{}))
+				var connectErr *connect.Error
+				assert.True(t, errors.As(err, &connectErr))
+				assert.Equal(t, connectErr.Code(), connect.CodeUnknown)
+				assert.Equal(t, connectErr.Meta().Get(header), "client-id")
+			})
+			t.Run("server_stream", func(t *testing.T) {
+				t.Parallel()
+				stream, err := idClient.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{}))
+				assert.Nil(t, err)
+				assert.True(t, stream.Receive())
+				assert.Equal(t, stream.Msg().GetNumber(), int64(len("client-id")))
+				assert.Equal(t, stream.ResponseHeader().Get(header), "client-id")
+				assert.False(t, stream.Receive())
+				assert.Nil(t, stream.Err())
+				assert.Nil(t, stream.Close())
+			})
+			t.Run("client_stream_preserves_caller_id", func(t *testing.T) {
+				t.Parallel()
+				stream := idClient.Sum(context.Background())
+				stream.RequestHeader().Set(header, "caller-stream-id")
+				assert.Nil(t, stream.Send(&pingv1.SumRequest{Number: 1}))
+				response, err := stream.CloseAndReceive()
+				assert.Nil(t, err)
+				assert.Equal(t, response.Msg.GetSum(), int64(len("caller-stream-id")))
+				assert.Equal(t, response.Header().Values(header), []string{"caller-stream-id"})
+			})
+			t.Run("client_stream_without_messages", func(t *testing.T) {
+				t.Parallel()
+				response, err := idClient.Sum(context.Background()).CloseAndReceive()
+				assert.Nil(t, err)
+				assert.Equal(t, response.Msg.GetSum(), int64(len("client-id")))
+				assert.Equal(t, response.Header().Get(header), "client-id")
+			})
+			t.Run("server_stream_preserves_caller_id", func(t *testing.T) {
+				t.Parallel()
+				request := connect.NewRequest(&pingv1.CountUpRequest{})
+				request.Header().Set(header, "caller-stream-id")
+				stream, err := idClient.CountUp(context.Background(), request)
+				assert.Nil(t, err)
+				assert.True(t, stream.Receive())
+				assert.Equal(t, stream.Msg().GetNumber(), int64(len("caller-stream-id")))
+				assert.Equal(t, stream.ResponseHeader().Values(header), []string{"caller-stream-id"})
+				assert.False(t, stream.Receive())
+				assert.Nil(t, stream.Err())
+				assert.Nil(t, stream.Close())
+			})
+		})
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2021-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+)
+
+// requestSigner holds the function configured with [WithRequestSigner] or
+// [WithUncompressedRequestSigner].
+type requestSigner struct {
+	sign func(ctx context.Context, body []byte, header http.Header) error
+	// uncompressed signs the marshaled message rather than the request body.
+	uncompressed bool
+}
+
+// signRequest signs a request that's about to be sent in a single body. If
+// signing fails, the call fails without sending anything.
+func (d *duplexHTTPCall) signRequest(payload messagePayload) error {
+	if d.signer == nil {
+		return nil
+	}
+	var body []byte
+	switch {
+	case d.signer.uncompressed:
+		body = d.uncompressedBody
+		d.uncompressedBody = nil // don't keep a reference to it
+	case payload != nil && payload.Len() > 0:
+		buffer := bytes.NewBuffer(make([]byte, 0, payload.Len()))
+		if _, err := payload.WriteTo(buffer); err != nil {
+			return d.failRequest(errorf(CodeInternal, "read request body to sign: %w", err))
+		}
+		if _, err := payload.Seek(0, io.SeekStart); err != nil {
+			return d.failRequest(errorf(CodeInternal, "rewind request body after signing: %w", err))
+		}
+		body = buffer.Bytes()
+	}
+	if err := d.signer.sign(d.ctx, body, d.request.Header); err != nil {
+		if connectErr, ok := asError(err); ok {
+			return d.failRequest(connectErr)
+		}
+		return d.failRequest(errorf(CodeInternal, "sign request: %w", err))
+	}
+	return nil
+}
+
+// failRequest gives up on the request before it's sent, so that attempts to
+// read the response see err rather than blocking.
+func (d *duplexHTTPCall) failRequest(err *Error) error {
+	d.responseErr = err
+	close(d.responseReady)
+	return err
+}
+
+// recordUncompressedRequest gives the marshaled request message to signers
+// that sign it before compression. The sender only needs the data until the
+// message is sent.
+func recordUncompressedRequest(sender messageSender, data []byte) {
+	if call, ok := sender.(*duplexHTTPCall); ok && call.signer != nil && call.signer.uncompressed {
+		call.uncompressedBody = data
+	}
+}
@@ -0,0 +1,194 @@
+// Copyright 2021-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	connect "connectrpc.com/connect"
+	"connectrpc.com/connect/internal/assert"
+	pingv1 "connectrpc.com/connect/internal/gen/connect/ping/v1"
+	"connectrpc.com/connect/internal/gen/connect/ping/v1/pingv1connect"
+	"connectrpc.com/connect/internal/memhttp/memhttptest"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestWithRequestSigner(t *testing.T) {
+	t.Parallel()
+	const signatureHeader = "X-Signature"
+	key := []byte("secret")
+	signature := func(body []byte) string {
+		mac := hmac.New(sha256.New, key)
+		mac.Write(body)
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+	sign := func(_ context.Context, body []byte, header http.Header) error {
+		header.Set(signatureHeader, signature(body))
+		return nil
+	}
+	// The server verifies signatures of the raw request body. Streams from
+	// clients aren't signed, and reading their whole body up front would block.
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}))
+	server := memhttptest.NewServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		want := r.Header.Get(signatureHeader)
+		if want == "" {
+			mux.ServeHTTP(w, r)
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if want != signature(body) {
+			http.Error(w, "bad signature", http.StatusForbidden)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		mux.ServeHTTP(w, r)
+	}))
+	request := &pingv1.PingRequest{Number: 42, Text: strings.Repeat("signed ", 100)}
+	protocols := []struct {
+		name string
+		opts []connect.ClientOption
+	}{
+		{name: "connect"},
+		{name: "grpc", opts: []connect.ClientOption{connect.WithGRPC()}},
+		{name: "grpcweb", opts: []connect.ClientOption{connect.WithGRPCWeb()}},
+	}
+	for _, protocol := range protocols {
+		t.Run(protocol.name, func(t *testing.T) {
+			t.Parallel()
+			for _, compressed := range []bool{false, true} {
+				opts := protocol.opts
+				if compressed {
+					opts = append(opts, connect.WithSendGzip())
+				}
+				newClient := func(opts ...connect.ClientOption) pingv1connect.PingServiceClient {
+					return pingv1connect.NewPingServiceClient(server.Client(), server.URL(), opts...)
+				}
+				t.Run(fmt.Sprintf("compressed=%t", compressed), func(t *testing.T) {
+					t.Parallel()
+					var signed atomic.Int32
+					client := newClient(append(opts, connect.WithRequestSigner(
+						func(ctx context.Context, body []byte, header http.Header) error {
+							signed.Add(1)
+							assert.NotZero(t, len(body))
+							return sign(ctx, body, header)
+						},
+					))...)
+					response, err := client.Ping(context.Background(), connect.NewRequest(request))
+					assert.Nil(t, err)
+					assert.Equal(t, response.Msg.GetNumber(), request.GetNumber())
+					stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{Number: 2}))
+					assert.Nil(t, err)
+					for stream.Receive() { //nolint:revive
+					}
+					assert.Nil(t, stream.Err())
+					assert.Nil(t, stream.Close())
+					assert.Equal(t, signed.Load(), 2)
+
+					// Client and bidi streams send headers before the body.
+					bidi := client.CumSum(context.Background())
+					assert.Nil(t, bidi.Send(&pingv1.CumSumRequest{Number: 1}))
+					_, err = bidi.Receive()
+					assert.Nil(t, err)
+					assert.Nil(t, bidi.CloseRequest())
+					assert.Nil(t, bidi.CloseResponse())
+					assert.Equal(t, signed.Load(), 2)
+				})
+				t.Run(fmt.Sprintf("uncompressed_signer/compressed=%t", compressed), func(t *testing.T) {
+					t.Parallel()
+					want, err := proto.Marshal(request)
+					assert.Nil(t, err)
+					var got []byte
+					client := newClient(append(opts, connect.WithUncompressedRequestSigner(
+						func(_ context.Context, body []byte, _ http.Header) error {
+							got = bytes.Clone(body)
+							return nil
+						},
+					))...)
+					_, err = client.Ping(context.Background(), connect.NewRequest(request))
+					assert.Nil(t, err)
+					assert.Equal(t, got, want)
+				})
+			}
+			t.Run("mismatch", func(t *testing.T) {
+				t.Parallel()
+				client := pingv1connect.NewPingServiceClient(server.Client(), server.URL(), append(protocol.opts, connect.WithRequestSigner(
+					func(_ context.Context, body []byte, header http.Header) error {
+						header.Set(signatureHeader, signature(append(body, 0)))
+						return nil
+					},
+				))...)
+				_, err := client.Ping(context.Background(), connect.NewRequest(request))
+				assert.Equal(t, connect.CodeOf(err), connect.CodePermissionDenied)
+			})
+			t.Run("error", func(t *testing.T) {
+				t.Parallel()
+				var signErr error
+				client := pingv1connect.NewPingServiceClient(server.Client(), server.URL(), append(protocol.opts, connect.WithRequestSigner(
+					func(context.Context, []byte, http.Header) error {
+						return signErr
+					},
+				))...)
+				signErr = errors.New("no key")
+				_, err := client.Ping(context.Background(), connect.NewRequest(request))
+				assert.Equal(t, connect.CodeOf(err), connect.CodeInternal)
+				signErr = connect.NewError(connect.CodeUnauthenticated, errors.New("key expired"))
+				_, err = client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{Number: 1}))
+				assert.Equal(t, connect.CodeOf(err), connect.CodeUnauthenticated)
+			})
+		})
+	}
+	t.Run("get", func(t *testing.T) {
+		t.Parallel()
+		want, err := proto.Marshal(request)
+		assert.Nil(t, err)
+		for _, uncompressed := range []bool{false, true} {
+			var got []byte
+			signer := func(_ context.Context, body []byte, _ http.Header) error {
+				got = bytes.Clone(body)
+				return nil
+			}
+			option := connect.WithRequestSigner(signer)
+			if uncompressed {
+				option = connect.WithUncompressedRequestSigner(signer)
+			}
+			client := pingv1connect.NewPingServiceClient(server.Client(), server.URL(), connect.WithHTTPGet(), option)
+			unaryRequest := connect.NewRequest(request)
+			_, err := client.Ping(context.Background(), unaryRequest)
+			assert.Nil(t, err)
+			assert.Equal(t, unaryRequest.HTTPMethod(), http.MethodGet)
+			if uncompressed {
+				assert.Equal(t, got, want)
+			} else {
+				assert.Zero(t, len(got))
+			}
+		}
+	})
+}
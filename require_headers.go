@@ -0,0 +1,73 @@
+// Copyright 2021-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"net/http"
+)
+
+// requireHeadersInterceptor rejects inbound RPCs that don't carry a non-empty
+// value for each of a fixed set of request headers.
+type requireHeadersInterceptor struct {
+	Interceptor
+
+	code  Code
+	names []string
+}
+
+func newRequireHeadersInterceptor(code Code, names []string) *requireHeadersInterceptor {
+	if code < minCode || code > maxCode {
+		code = CodeInvalidArgument
+	}
+	canonical := make([]string, len(names))
+	for i, name := range names {
+		canonical[i] = http.CanonicalHeaderKey(name)
+	}
+	return &requireHeadersInterceptor{
+		code:  code,
+		names: canonical,
+	}
+}
+
+func (i *requireHeadersInterceptor) WrapUnary(next UnaryFunc) UnaryFunc {
+	return func(ctx context.Context, req AnyRequest) (AnyResponse, error) {
+		if req.Spec().IsClient {
+			return next(ctx, req)
+		}
+		if err := i.check(req.Header()); err != nil {
+			return nil, err
+		}
+		return next(ctx, req)
+	}
+}
+
+func (i *requireHeadersInterceptor) WrapStreamingHandler(next StreamingHandlerFunc) StreamingHandlerFunc {
+	return func(ctx context.Context, conn StreamingHandlerConn) error {
+		if err := i.check(conn.RequestHeader()); err != nil {
+			return err
+		}
+		return next(ctx, conn)
+	}
+}
+
+func (i *requireHeadersInterceptor) check(header http.Header) *Error {
+	for _, name := range i.names {
+		if header.Get(name) == "" {
+			return errorf(i.code, "missing required header %q", name)
+		}
+	}
+	return nil
+}
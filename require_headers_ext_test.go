@@ -0,0 +1,115 @@
+// Copyright 2021-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	connect "connectrpc.com/connect"
+	"connectrpc.com/connect/internal/assert"
+	pingv1 "connectrpc.com/connect/internal/gen/connect/ping/v1"
+	"connectrpc.com/connect/internal/gen/connect/ping/v1/pingv1connect"
+	"connectrpc.com/connect/internal/memhttp/memhttptest"
+)
+
+func TestRequireHeaders(t *testing.T) {
+	t.Parallel()
+	const tenantHeader = "X-Tenant-Id"
+	newClient := func(t *testing.T, code connect.Code) pingv1connect.PingServiceClient {
+		t.Helper()
+		mux := http.NewServeMux()
+		mux.Handle(pingv1connect.NewPingServiceHandler(
+			pingServer{},
+			connect.RequireHeaders(code, "x-tenant-id"),
+		))
+		server := memhttptest.NewServer(t, mux)
+		return pingv1connect.NewPingServiceClient(server.Client(), server.URL())
+	}
+	testCases := []struct {
+		name    string
+		header  http.Header
+		code    connect.Code
+		wantErr connect.Code
+	}{
+		{name: "present", header: http.Header{tenantHeader: []string{"acme"}}},
+		{name: "absent", wantErr: connect.CodeInvalidArgument},
+		{name: "empty", header: http.Header{tenantHeader: []string{""}}, wantErr: connect.CodeInvalidArgument},
+		{name: "configured_code", code: connect.CodeUnauthenticated, wantErr: connect.CodeUnauthenticated},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+			client := newClient(t, testCase.code)
+			assertErr := func(t *testing.T, err error) {
+				t.Helper()
+				if testCase.wantErr == 0 {
+					assert.Nil(t, err)
+					return
+				}
+				assert.NotNil(t, err)
+				assert.Equal(t, connect.CodeOf(err), testCase.wantErr)
+				var connectErr *connect.Error
+				if assert.True(t, errors.As(err, &connectErr)) {
+					assert.Equal(t, connectErr.Message(), `missing required header "X-Tenant-Id"`)
+				}
+			}
+			t.Run("unary", func(t *testing.T) {
+				t.Parallel()
+				request := connect.NewRequest(&pingv1.PingRequest{Number: 42})
+				addHeaders(request.Header(), testCase.header)
+				_, err := client.Ping(context.Background(), request)
+				assertErr(t, err)
+			})
+			t.Run("server_stream", func(t *testing.T) {
+				t.Parallel()
+				request := connect.NewRequest(&pingv1.CountUpRequest{Number: 2})
+				addHeaders(request.Header(), testCase.header)
+				stream, err := client.CountUp(context.Background(), request)
+				assert.Nil(t, err)
+				var count int
+				for stream.Receive() {
+					count++
+				}
+				assertErr(t, stream.Err())
+				if testCase.wantErr == 0 {
+					assert.Equal(t, count, 2)
+				} else {
+					assert.Zero(t, count)
+				}
+				assert.Nil(t, stream.Close())
+			})
+			t.Run("client_stream", func(t *testing.T) {
+				t.Parallel()
+				stream := client.Sum(context.Background())
+				addHeaders(stream.RequestHeader(), testCase.header)
+				_ = stream.Send(&pingv1.SumRequest{Number: 1})
+				response, err := stream.CloseAndReceive()
+				assertErr(t, err)
+				if testCase.wantErr == 0 {
+					assert.Equal(t, response.Msg.GetSum(), int64(1))
+				}
+			})
+		})
+	}
+}
+
+func addHeaders(into, from http.Header) {
+	for key, values := range from {
+		into[key] = append(into[key], values...)
+	}
+}
@@ -0,0 +1,372 @@
+// Copyright 2021-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"container/list"
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	headerETag         = "Etag"
+	headerIfNoneMatch  = "If-None-Match"
+	headerCacheControl = "Cache-Control"
+)
+
+// CachedResponse is a response stored in a [Cache]. The message is encoded
+// with the client's [Codec], or in binary Protobuf by handlers.
+type CachedResponse struct {
+	ETag    string
+	Header  http.Header
+	Trailer http.Header
+	Message []byte
+	// Expires is when the response goes stale. If zero, it never does.
+	Expires time.Time
+}
+
+func (r *CachedResponse) expired(now time.Time) bool {
+	return !r.Expires.IsZero() && !now.Before(r.Expires)
+}
+
+// A Cache stores responses to unary RPCs. Clients store responses to HTTP
+// GET requests, so that they can make conditional requests and reuse the
+// stored response when the server replies with a 304 Not Modified (see
+// [WithResponseCache]). Handlers store their own responses and answer
+// repeated requests without calling the implementation (see
+// [WithHandlerResponseCache]).
+//
+// Implementations must be safe to call concurrently.
+type Cache interface {
+	// Get returns the response stored for the key, if any.
+	Get(key string) (*CachedResponse, bool)
+	// Set stores a response for the key, replacing any previous response.
+	Set(key string, response *CachedResponse)
+}
+
+// MemoryCache is an in-memory [Cache] that evicts the least recently used
+// responses once it's full. Expired responses are dropped when they're next
+// looked up.
+type MemoryCache struct {
+	maxEntries int
+
+	mu      sync.Mutex
+	order   *list.List // of *memoryCacheEntry, most recently used first
+	entries map[string]*list.Element
+}
+
+type memoryCacheEntry struct {
+	key      string
+	response *CachedResponse
+}
+
+// NewMemoryCache constructs a [MemoryCache] holding at most maxEntries
+// responses. If maxEntries is zero or negative, the cache is unbounded.
+func NewMemoryCache(maxEntries int) *MemoryCache {
+	return &MemoryCache{
+		maxEntries: maxEntries,
+		order:      list.New(),
+		entries:    make(map[string]*list.Element),
+	}
+}
+
+// Get implements [Cache].
+func (c *MemoryCache) Get(key string) (*CachedResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry, _ := element.Value.(*memoryCacheEntry)
+	if entry.response.expired(time.Now()) {
+		c.order.Remove(element)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	return entry.response, true
+}
+
+// Set implements [Cache].
+func (c *MemoryCache) Set(key string, response *CachedResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.entries[key]; ok {
+		entry, _ := element.Value.(*memoryCacheEntry)
+		entry.response = response
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&memoryCacheEntry{key: key, response: response})
+	for c.maxEntries > 0 && c.order.Len() > c.maxEntries {
+		oldest := c.order.Back()
+		entry, _ := c.order.Remove(oldest).(*memoryCacheEntry)
+		delete(c.entries, entry.key)
+	}
+}
+
+// Len returns the number of responses in the cache.
+func (c *MemoryCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// newResponseCacheFunc wraps a client's innermost UnaryFunc with conditional
+// GET requests. It needs the response type to rebuild cached responses, so
+// unlike most client features it can't be an Interceptor. Calls that can't be
+// made with GET are passed through untouched.
+func newResponseCacheFunc[Res any](config *clientConfig, spec Spec, next UnaryFunc) UnaryFunc {
+	codec, ok := config.Codec.(stableCodec)
+	if !ok || config.ResponseCache == nil || !config.EnableGet || spec.IdempotencyLevel != IdempotencyNoSideEffects {
+		return next
+	}
+	if _, ok := config.Protocol.(*protocolConnect); !ok {
+		return next
+	}
+	cache := config.ResponseCache
+	return func(ctx context.Context, request AnyRequest) (AnyResponse, error) {
+		if request.Header().Get(headerIfNoneMatch) != "" {
+			// The caller is making its own conditional request and expects to see
+			// the 304.
+			return next(ctx, request)
+		}
+		data, err := codec.MarshalStable(request.Any())
+		if err != nil {
+			// Let the call itself report the error.
+			return next(ctx, request)
+		}
+		key := responseCacheKey(config.URL, codec.Name(), data)
+		cached, hit := cache.Get(key)
+		if hit {
+			request.Header().Set(headerIfNoneMatch, cached.ETag)
+			defer request.Header().Del(headerIfNoneMatch)
+		}
+		response, err := next(ctx, request)
+		if hit && IsNotModifiedError(err) {
+			return cachedResponse[Res](config, spec, cache, key, cached, err)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if request.HTTPMethod() != http.MethodGet {
+			// The URL was too long, so the client fell back to POST.
+			return response, nil
+		}
+		etag := response.Header().Get(headerETag)
+		if etag == "" || hasNoStore(response.Header()) {
+			return response, nil
+		}
+		message, err := config.Codec.Marshal(response.Any())
+		if err != nil {
+			return response, nil //nolint:nilerr // failing to cache isn't an RPC error
+		}
+		cache.Set(key, &CachedResponse{
+			ETag:    etag,
+			Header:  response.Header().Clone(),
+			Trailer: response.Trailer().Clone(),
+			Message: message,
+		})
+		return response, nil
+	}
+}
+
+// cachedResponse rebuilds a response from the cache after the server
+// replies with a 304. As RFC 9111 requires, headers in the 304 replace the
+// stored ones.
+func cachedResponse[Res any](
+	config *clientConfig,
+	spec Spec,
+	cache Cache,
+	key string,
+	cached *CachedResponse,
+	notModified error,
+) (*Response[Res], error) {
+	header := cached.Header.Clone()
+	if connectErr, ok := asError(notModified); ok {
+		for name, values := range connectErr.Meta() {
+			header[name] = values
+		}
+	}
+	var msg Res
+	if err := config.Initializer.maybe(spec, &msg); err != nil {
+		return nil, err
+	}
+	if err := config.Codec.Unmarshal(cached.Message, &msg); err != nil {
+		return nil, errorf(CodeInternal, "unmarshal cached response: %w", err)
+	}
+	etag := header.Get(headerETag)
+	if etag == "" {
+		etag = cached.ETag
+	}
+	cache.Set(key, &CachedResponse{
+		ETag:    etag,
+		Header:  header.Clone(),
+		Trailer: cached.Trailer,
+		Message: cached.Message,
+	})
+	return &Response[Res]{
+		Msg:     &msg,
+		header:  header,
+		trailer: cached.Trailer.Clone(),
+	}, nil
+}
+
+// responseCacheKey identifies a GET request by its URL and message, in
+// roughly the form the Connect protocol sends it.
+func responseCacheKey(procedureURL *url.URL, codecName string, message []byte) string {
+	var key strings.Builder
+	key.WriteString(procedureURL.String())
+	key.WriteString("?encoding=")
+	key.WriteString(url.QueryEscape(codecName))
+	key.WriteString("&message=")
+	key.WriteString(base64.RawURLEncoding.EncodeToString(message))
+	return key.String()
+}
+
+// handlerResponseCache answers repeated requests to side-effect-free unary
+// procedures from a [Cache]. Concurrent misses for the same key are
+// coalesced, so only one of them calls the implementation.
+type handlerResponseCache struct {
+	cache Cache
+	key   func(ctx context.Context, spec Spec, message []byte) string
+	ttl   time.Duration
+
+	mu       sync.Mutex
+	inflight map[string]chan struct{}
+}
+
+// newHandlerResponseCacheFunc wraps a handler's implementation with the
+// cache. Like the client cache, it needs the response type to rebuild cached
+// responses, so it can't be an Interceptor. Interceptors still run for every
+// call, so authentication and logging aren't bypassed.
+func newHandlerResponseCacheFunc[Res any](config *handlerConfig, next UnaryFunc) UnaryFunc {
+	responseCache := config.ResponseCache
+	if responseCache == nil || config.IdempotencyLevel != IdempotencyNoSideEffects {
+		return next
+	}
+	codec, ok := newReadOnlyCodecs(config.Codecs).Protobuf().(stableCodec)
+	if !ok {
+		return next
+	}
+	clock := config.Clock
+	return func(ctx context.Context, request AnyRequest) (AnyResponse, error) {
+		data, err := codec.MarshalStable(request.Any())
+		if err != nil {
+			return next(ctx, request)
+		}
+		key := request.Spec().Procedure + "?message=" + base64.RawURLEncoding.EncodeToString(data)
+		if responseCache.key != nil {
+			custom := responseCache.key(ctx, request.Spec(), data)
+			if custom == "" {
+				return next(ctx, request)
+			}
+			key = request.Spec().Procedure + "?key=" + custom
+		}
+		for {
+			if cached, ok := responseCache.cache.Get(key); ok && !cached.expired(clock.Now()) {
+				var msg Res
+				if err := config.Initializer.maybe(request.Spec(), &msg); err != nil {
+					return nil, err
+				}
+				if err := codec.Unmarshal(cached.Message, &msg); err != nil {
+					return nil, errorf(CodeInternal, "unmarshal cached response: %w", err)
+				}
+				return &Response[Res]{
+					Msg:     &msg,
+					header:  cached.Header.Clone(),
+					trailer: cached.Trailer.Clone(),
+				}, nil
+			}
+			responseCache.mu.Lock()
+			if wait, ok := responseCache.inflight[key]; ok {
+				responseCache.mu.Unlock()
+				select {
+				case <-wait:
+					// Look again: if the call failed, its response wasn't stored and
+					// another caller takes over.
+					continue
+				case <-ctx.Done():
+					return nil, wrapIfContextError(ctx.Err())
+				}
+			}
+			done := make(chan struct{})
+			responseCache.inflight[key] = done
+			responseCache.mu.Unlock()
+			return responseCache.fill(ctx, request, key, done, codec, clock, next)
+		}
+	}
+}
+
+// fill calls next for a key that no other caller is filling, storing a
+// successful response. The key is released even if next panics, so that
+// waiting callers take over rather than block until their deadlines.
+func (c *handlerResponseCache) fill(
+	ctx context.Context,
+	request AnyRequest,
+	key string,
+	done chan struct{},
+	codec Codec,
+	clock Clock,
+	next UnaryFunc,
+) (AnyResponse, error) {
+	defer func() {
+		c.mu.Lock()
+		delete(c.inflight, key)
+		close(done)
+		c.mu.Unlock()
+	}()
+	response, err := next(ctx, request)
+	if err == nil {
+		c.store(key, response, codec, clock.Now())
+	}
+	return response, err
+}
+
+func (c *handlerResponseCache) store(key string, response AnyResponse, codec Codec, now time.Time) {
+	if response == nil || hasNoStore(response.Header()) {
+		return
+	}
+	message, err := codec.Marshal(response.Any())
+	if err != nil {
+		return
+	}
+	cached := &CachedResponse{
+		Header:  response.Header().Clone(),
+		Trailer: response.Trailer().Clone(),
+		Message: message,
+	}
+	if c.ttl > 0 {
+		cached.Expires = now.Add(c.ttl)
+	}
+	c.cache.Set(key, cached)
+}
+
+func hasNoStore(header http.Header) bool {
+	for _, value := range header.Values(headerCacheControl) {
+		for _, directive := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(directive), "no-store") {
+				return true
+			}
+		}
+	}
+	return false
+}
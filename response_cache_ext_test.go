@@ -0,0 +1,346 @@
+// Copyright 2021-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	connect "connectrpc.com/connect"
+	"connectrpc.com/connect/internal/assert"
+	"connectrpc.com/connect/internal/clocktest"
+	pingv1 "connectrpc.com/connect/internal/gen/connect/ping/v1"
+	"connectrpc.com/connect/internal/gen/connect/ping/v1/pingv1connect"
+	"connectrpc.com/connect/internal/memhttp/memhttptest"
+)
+
+// cachingPingServer serves versioned responses with an Etag, answering
+// conditional requests for the current version with a 304.
+type cachingPingServer struct {
+	pingv1connect.UnimplementedPingServiceHandler
+
+	mu           sync.Mutex
+	version      int
+	cacheControl string
+	conditions   []string // If-None-Match of each request
+	notModified  int
+}
+
+func (s *cachingPingServer) Ping(
+	_ context.Context,
+	request *connect.Request[pingv1.PingRequest],
+) (*connect.Response[pingv1.PingResponse], error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	etag := fmt.Sprintf(`"%d-v%d"`, request.Msg.GetNumber(), s.version)
+	condition := request.Header().Get("If-None-Match")
+	s.conditions = append(s.conditions, condition)
+	if request.HTTPMethod() == http.MethodGet && condition == etag {
+		s.notModified++
+		return nil, connect.NewNotModifiedError(http.Header{"Etag": []string{etag}})
+	}
+	response := connect.NewResponse(&pingv1.PingResponse{
+		Number: request.Msg.GetNumber(),
+		Text:   fmt.Sprintf("v%d", s.version),
+	})
+	response.Header().Set("Etag", etag)
+	response.Header().Set("Cache-Control", s.cacheControl)
+	response.Trailer().Set(handlerTrailer, trailerValue)
+	return response, nil
+}
+
+func (s *cachingPingServer) bump() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.version++
+}
+
+func (s *cachingPingServer) lastCondition() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conditions[len(s.conditions)-1]
+}
+
+func (s *cachingPingServer) notModifiedCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.notModified
+}
+
+func TestWithResponseCache(t *testing.T) {
+	t.Parallel()
+	newClient := func(t *testing.T, server *cachingPingServer, opts ...connect.ClientOption) (pingv1connect.PingServiceClient, *connect.MemoryCache) {
+		t.Helper()
+		mux := http.NewServeMux()
+		mux.Handle(pingv1connect.NewPingServiceHandler(server))
+		httpServer := memhttptest.NewServer(t, mux)
+		cache := connect.NewMemoryCache(0)
+		opts = append([]connect.ClientOption{connect.WithHTTPGet(), connect.WithResponseCache(cache)}, opts...)
+		return pingv1connect.NewPingServiceClient(httpServer.Client(), httpServer.URL(), opts...), cache
+	}
+	ping := func(t *testing.T, client pingv1connect.PingServiceClient, number int64) *connect.Response[pingv1.PingResponse] {
+		t.Helper()
+		request := connect.NewRequest(&pingv1.PingRequest{Number: number})
+		response, err := client.Ping(context.Background(), request)
+		assert.Nil(t, err)
+		assert.Equal(t, request.HTTPMethod(), http.MethodGet)
+		// The conditional header is the cache's business, not the caller's.
+		assert.Zero(t, request.Header().Get("If-None-Match"))
+		return response
+	}
+	t.Run("miss_then_hit", func(t *testing.T) {
+		t.Parallel()
+		server := &cachingPingServer{cacheControl: "max-age=60"}
+		client, cache := newClient(t, server)
+		response := ping(t, client, 42)
+		assert.Zero(t, server.lastCondition())
+		assert.Equal(t, response.Msg.GetText(), "v0")
+		assert.Equal(t, response.Header().Get("Etag"), `"42-v0"`)
+		assert.Equal(t, response.Header().Get("Cache-Control"), "max-age=60")
+		assert.Equal(t, cache.Len(), 1)
+
+		response = ping(t, client, 42)
+		assert.Equal(t, server.lastCondition(), `"42-v0"`)
+		assert.Equal(t, server.notModifiedCount(), 1)
+		assert.Equal(t, response.Msg.GetNumber(), int64(42))
+		assert.Equal(t, response.Msg.GetText(), "v0")
+		assert.Equal(t, response.Header().Get("Etag"), `"42-v0"`)
+		assert.Equal(t, response.Header().Get("Cache-Control"), "max-age=60")
+		assert.Equal(t, response.Trailer().Get(handlerTrailer), trailerValue)
+
+		// A different message is a different resource.
+		response = ping(t, client, 7)
+		assert.Zero(t, server.lastCondition())
+		assert.Equal(t, response.Msg.GetNumber(), int64(7))
+		assert.Equal(t, cache.Len(), 2)
+	})
+	t.Run("stale_etag", func(t *testing.T) {
+		t.Parallel()
+		server := &cachingPingServer{}
+		client, cache := newClient(t, server)
+		ping(t, client, 1)
+		server.bump()
+		response := ping(t, client, 1)
+		assert.Equal(t, server.lastCondition(), `"1-v0"`)
+		assert.Equal(t, server.notModifiedCount(), 0)
+		assert.Equal(t, response.Msg.GetText(), "v1")
+		assert.Equal(t, response.Header().Get("Etag"), `"1-v1"`)
+		// The cache now validates against the new version.
+		response = ping(t, client, 1)
+		assert.Equal(t, server.lastCondition(), `"1-v1"`)
+		assert.Equal(t, server.notModifiedCount(), 1)
+		assert.Equal(t, response.Msg.GetText(), "v1")
+		assert.Equal(t, cache.Len(), 1)
+	})
+	t.Run("no_store", func(t *testing.T) {
+		t.Parallel()
+		server := &cachingPingServer{cacheControl: "private, no-store"}
+		client, cache := newClient(t, server)
+		ping(t, client, 1)
+		ping(t, client, 1)
+		assert.Zero(t, server.lastCondition())
+		assert.Equal(t, cache.Len(), 0)
+	})
+	t.Run("caller_condition", func(t *testing.T) {
+		t.Parallel()
+		server := &cachingPingServer{}
+		client, _ := newClient(t, server)
+		ping(t, client, 1)
+		request := connect.NewRequest(&pingv1.PingRequest{Number: 1})
+		request.Header().Set("If-None-Match", `"1-v0"`)
+		_, err := client.Ping(context.Background(), request)
+		assert.True(t, connect.IsNotModifiedError(err))
+	})
+	t.Run("post", func(t *testing.T) {
+		t.Parallel()
+		server := &cachingPingServer{}
+		client, cache := newClient(t, server, connect.WithGRPC())
+		request := connect.NewRequest(&pingv1.PingRequest{Number: 1})
+		_, err := client.Ping(context.Background(), request)
+		assert.Nil(t, err)
+		assert.Equal(t, request.HTTPMethod(), http.MethodPost)
+		assert.Equal(t, cache.Len(), 0)
+	})
+}
+
+func TestMemoryCache(t *testing.T) {
+	t.Parallel()
+	cache := connect.NewMemoryCache(2)
+	cache.Set("a", &connect.CachedResponse{ETag: "a"})
+	cache.Set("b", &connect.CachedResponse{ETag: "b"})
+	_, ok := cache.Get("a")
+	assert.True(t, ok)
+	// b is now the least recently used.
+	cache.Set("c", &connect.CachedResponse{ETag: "c"})
+	assert.Equal(t, cache.Len(), 2)
+	_, ok = cache.Get("b")
+	assert.False(t, ok)
+	response, ok := cache.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, response.ETag, "a")
+	cache.Set("c", &connect.CachedResponse{ETag: "c2"})
+	response, ok = cache.Get("c")
+	assert.True(t, ok)
+	assert.Equal(t, response.ETag, "c2")
+	assert.Equal(t, cache.Len(), 2)
+}
+
+func TestMemoryCacheExpiry(t *testing.T) {
+	t.Parallel()
+	cache := connect.NewMemoryCache(0)
+	cache.Set("stale", &connect.CachedResponse{Expires: time.Now().Add(-time.Second)})
+	cache.Set("fresh", &connect.CachedResponse{Expires: time.Now().Add(time.Hour)})
+	cache.Set("forever", &connect.CachedResponse{})
+	_, ok := cache.Get("stale")
+	assert.False(t, ok)
+	_, ok = cache.Get("fresh")
+	assert.True(t, ok)
+	_, ok = cache.Get("forever")
+	assert.True(t, ok)
+	assert.Equal(t, cache.Len(), 2)
+}
+
+func TestWithHandlerResponseCache(t *testing.T) {
+	t.Parallel()
+	const ttl = 200 * time.Millisecond
+	// newServer counts calls to the implementations. Ping has no side effects,
+	// so it's cached; Sum is a client stream, so it isn't.
+	newServer := func(t *testing.T, delay time.Duration, opts ...connect.HandlerOption) (pingv1connect.PingServiceClient, *atomic.Int32) {
+		t.Helper()
+		var calls atomic.Int32
+		server := &pluggablePingServer{
+			ping: func(_ context.Context, request *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+				if calls.Add(1) == 1 && request.Msg.GetText() == "panic" {
+					panic("first call panics")
+				}
+				time.Sleep(delay)
+				if request.Msg.GetNumber() < 0 {
+					return nil, connect.NewError(connect.CodeInvalidArgument, nil)
+				}
+				response := connect.NewResponse(&pingv1.PingResponse{Number: request.Msg.GetNumber()})
+				response.Header().Set("Ping-Header", "header")
+				response.Trailer().Set("Ping-Trailer", "trailer")
+				if request.Msg.GetText() == "no-store" {
+					response.Header().Set("Cache-Control", "no-store")
+				}
+				return response, nil
+			},
+		}
+		mux := http.NewServeMux()
+		mux.Handle(pingv1connect.NewPingServiceHandler(server, opts...))
+		httpServer := memhttptest.NewServer(t, mux)
+		return pingv1connect.NewPingServiceClient(httpServer.Client(), httpServer.URL()), &calls
+	}
+	ping := func(t *testing.T, client pingv1connect.PingServiceClient, number int64, text string) {
+		t.Helper()
+		response, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Number: number, Text: text}))
+		assert.Nil(t, err)
+		assert.Equal(t, response.Msg.GetNumber(), number)
+		assert.Equal(t, response.Header().Get("Ping-Header"), "header")
+		assert.Equal(t, response.Trailer().Get("Ping-Trailer"), "trailer")
+	}
+	t.Run("repeat_served_from_cache", func(t *testing.T) {
+		t.Parallel()
+		client, calls := newServer(t, 0, connect.WithHandlerResponseCache(connect.NewMemoryCache(0), nil, ttl))
+		ping(t, client, 1, "")
+		ping(t, client, 1, "")
+		assert.Equal(t, calls.Load(), 1)
+		ping(t, client, 2, "")
+		assert.Equal(t, calls.Load(), 2)
+		time.Sleep(ttl)
+		ping(t, client, 1, "")
+		assert.Equal(t, calls.Load(), 3)
+	})
+	t.Run("errors_and_no_store_not_cached", func(t *testing.T) {
+		t.Parallel()
+		client, calls := newServer(t, 0, connect.WithHandlerResponseCache(connect.NewMemoryCache(0), nil, ttl))
+		for range 2 {
+			_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Number: -1}))
+			assert.Equal(t, connect.CodeOf(err), connect.CodeInvalidArgument)
+		}
+		assert.Equal(t, calls.Load(), 2)
+		ping(t, client, 1, "no-store")
+		ping(t, client, 1, "no-store")
+		assert.Equal(t, calls.Load(), 4)
+	})
+	t.Run("custom_key", func(t *testing.T) {
+		t.Parallel()
+		// Every request shares one key, so the first response answers them all.
+		key := func(context.Context, connect.Spec, []byte) string { return "everyone" }
+		client, calls := newServer(t, 0, connect.WithHandlerResponseCache(connect.NewMemoryCache(0), key, ttl))
+		ping(t, client, 1, "")
+		response, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Number: 2}))
+		assert.Nil(t, err)
+		assert.Equal(t, response.Msg.GetNumber(), 1)
+		assert.Equal(t, calls.Load(), 1)
+	})
+	t.Run("panic_releases_key", func(t *testing.T) {
+		t.Parallel()
+		client, calls := newServer(
+			t,
+			0,
+			connect.WithHandlerResponseCache(connect.NewMemoryCache(0), nil, ttl),
+			connect.WithRecover(func(context.Context, connect.Spec, http.Header, any) error {
+				return connect.NewError(connect.CodeInternal, errors.New("handler panicked"))
+			}),
+		)
+		_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Number: 1, Text: "panic"}))
+		assert.Equal(t, connect.CodeOf(err), connect.CodeInternal)
+		// The panicking call mustn't leave later callers waiting for it.
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		response, err := client.Ping(ctx, connect.NewRequest(&pingv1.PingRequest{Number: 1, Text: "panic"}))
+		assert.Nil(t, err)
+		assert.Equal(t, response.Msg.GetNumber(), 1)
+		assert.Equal(t, calls.Load(), 2)
+	})
+	t.Run("clock", func(t *testing.T) {
+		t.Parallel()
+		clock := clocktest.NewClock(time.Now())
+		client, calls := newServer(
+			t,
+			0,
+			connect.WithHandlerResponseCache(connect.NewMemoryCache(0), nil, time.Hour),
+			connect.WithClock(clock),
+		)
+		ping(t, client, 1, "")
+		clock.Advance(59 * time.Minute)
+		ping(t, client, 1, "")
+		assert.Equal(t, calls.Load(), 1)
+		clock.Advance(time.Minute)
+		ping(t, client, 1, "")
+		assert.Equal(t, calls.Load(), 2)
+	})
+	t.Run("concurrent_misses_coalesced", func(t *testing.T) {
+		t.Parallel()
+		client, calls := newServer(t, 50*time.Millisecond, connect.WithHandlerResponseCache(connect.NewMemoryCache(0), nil, 0))
+		var wg sync.WaitGroup
+		for range 10 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				ping(t, client, 7, "")
+			}()
+		}
+		wg.Wait()
+		assert.Equal(t, calls.Load(), 1)
+	})
+}
@@ -0,0 +1,58 @@
+// Copyright 2021-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"net/http"
+)
+
+// responseTrailerInterceptor calls a function just before a handler's
+// response trailers are serialized, once the outcome of the RPC is known.
+type responseTrailerInterceptor struct {
+	Interceptor
+
+	set func(context.Context, Spec, http.Header, error)
+}
+
+func (i *responseTrailerInterceptor) WrapUnary(next UnaryFunc) UnaryFunc {
+	return func(ctx context.Context, req AnyRequest) (AnyResponse, error) {
+		if req.Spec().IsClient {
+			return next(ctx, req)
+		}
+		res, err := next(ctx, req)
+		if err != nil {
+			// Unary errors are sent without a response, so the error's metadata
+			// stands in for its trailers.
+			err = wrapIfUncoded(err)
+			if connectErr, ok := asError(err); ok {
+				i.set(ctx, req.Spec(), connectErr.Meta(), err)
+			}
+			return nil, err
+		}
+		if res != nil {
+			i.set(ctx, req.Spec(), res.Trailer(), nil)
+		}
+		return res, nil
+	}
+}
+
+func (i *responseTrailerInterceptor) WrapStreamingHandler(next StreamingHandlerFunc) StreamingHandlerFunc {
+	return func(ctx context.Context, conn StreamingHandlerConn) error {
+		err := next(ctx, conn)
+		i.set(ctx, conn.Spec(), conn.ResponseTrailer(), err)
+		return err
+	}
+}
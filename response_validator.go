@@ -0,0 +1,73 @@
+// Copyright 2021-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+)
+
+// responseValidatorInterceptor checks each message a handler sends before
+// it's serialized, replacing invalid responses with a [CodeInternal] error.
+type responseValidatorInterceptor struct {
+	Interceptor
+
+	validate func(context.Context, Spec, any) error
+}
+
+func (i *responseValidatorInterceptor) WrapUnary(next UnaryFunc) UnaryFunc {
+	return func(ctx context.Context, req AnyRequest) (AnyResponse, error) {
+		if req.Spec().IsClient {
+			return next(ctx, req)
+		}
+		res, err := next(ctx, req)
+		if err != nil || res == nil {
+			return res, err
+		}
+		if err := i.validate(ctx, req.Spec(), res.Any()); err != nil {
+			return nil, errorf(CodeInternal, "invalid response: %w", err)
+		}
+		return res, nil
+	}
+}
+
+func (i *responseValidatorInterceptor) WrapStreamingHandler(next StreamingHandlerFunc) StreamingHandlerFunc {
+	return func(ctx context.Context, conn StreamingHandlerConn) error {
+		return next(ctx, &responseValidatorConn{
+			StreamingHandlerConn: conn,
+			ctx:                  ctx,
+			validate:             i.validate,
+		})
+	}
+}
+
+// responseValidatorConn validates each message before sending it. A rejected
+// message isn't sent, and the error is returned to the handler.
+type responseValidatorConn struct {
+	StreamingHandlerConn
+
+	ctx      context.Context //nolint:containedctx
+	validate func(context.Context, Spec, any) error
+}
+
+func (c *responseValidatorConn) Send(msg any) error {
+	if err := c.validate(c.ctx, c.Spec(), msg); err != nil {
+		return errorf(CodeInternal, "invalid response: %w", err)
+	}
+	return c.StreamingHandlerConn.Send(msg)
+}
+
+func (c *responseValidatorConn) Unwrap() StreamingHandlerConn {
+	return c.StreamingHandlerConn
+}
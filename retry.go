@@ -0,0 +1,324 @@
+// Copyright 2021-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRetryMaxAttempts    = 3
+	defaultRetryInitialBackoff = 100 * time.Millisecond
+	defaultRetryMaxBackoff     = 5 * time.Second
+	defaultRetryMultiplier     = 2
+	defaultRetryJitter         = 0.2
+
+	headerRetryAfter = "Retry-After"
+)
+
+// RetryPolicy configures the automatic retries enabled by [WithRetry]. The
+// zero value is a reasonable default: up to three attempts, retrying
+// [CodeUnavailable] errors with exponential backoff starting at 100
+// milliseconds.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts, including the original
+	// call. If zero, it defaults to 3. Set it to 1 to disable retries.
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry. If zero, it defaults
+	// to 100 milliseconds.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between attempts. If zero, it defaults to 5
+	// seconds.
+	MaxBackoff time.Duration
+	// Multiplier is the factor by which the delay grows after each retry. If
+	// zero, it defaults to 2.
+	Multiplier float64
+	// Jitter randomizes each delay by up to the given fraction in either
+	// direction: a jitter of 0.2 turns a 100 millisecond delay into one between
+	// 80 and 120 milliseconds. If zero, it defaults to 0.2. Set it to a
+	// negative value to disable jitter.
+	Jitter float64
+	// RetryableCodes lists the error codes that trigger a retry. If empty, only
+	// CodeUnavailable is retried.
+	RetryableCodes []Code
+}
+
+// retryInterceptor retries unary and server-streaming calls. Unary requests
+// are already in memory and server-streaming calls send a single message
+// before receiving anything, so both can be replayed. Client and
+// bidirectional streams are never retried, and neither are procedures that
+// haven't declared an IdempotencyLevel: a failure like a lost connection
+// doesn't tell us whether the server acted on the request.
+type retryInterceptor struct {
+	policy RetryPolicy
+	// clock returns the client's Clock. It's a function because the client's
+	// options may set the clock after the retry policy.
+	clock func() Clock
+}
+
+func newRetryInterceptor(policy RetryPolicy) *retryInterceptor {
+	if policy.MaxAttempts == 0 {
+		policy.MaxAttempts = defaultRetryMaxAttempts
+	}
+	if policy.InitialBackoff <= 0 {
+		policy.InitialBackoff = defaultRetryInitialBackoff
+	}
+	if policy.MaxBackoff <= 0 {
+		policy.MaxBackoff = defaultRetryMaxBackoff
+	}
+	if policy.Multiplier <= 0 {
+		policy.Multiplier = defaultRetryMultiplier
+	}
+	switch {
+	case policy.Jitter == 0:
+		policy.Jitter = defaultRetryJitter
+	case policy.Jitter < 0:
+		policy.Jitter = 0
+	case policy.Jitter > 1:
+		policy.Jitter = 1
+	}
+	if len(policy.RetryableCodes) == 0 {
+		policy.RetryableCodes = []Code{CodeUnavailable}
+	}
+	return &retryInterceptor{
+		policy: policy,
+		clock:  func() Clock { return realClock{} },
+	}
+}
+
+func (i *retryInterceptor) WrapUnary(next UnaryFunc) UnaryFunc {
+	return func(ctx context.Context, request AnyRequest) (AnyResponse, error) {
+		if spec := request.Spec(); !spec.IsClient || spec.IdempotencyLevel == IdempotencyUnknown {
+			return next(ctx, request)
+		}
+		for attempt := 1; ; attempt++ {
+			response, err := next(ctx, request)
+			if err == nil {
+				return response, nil
+			}
+			if waitErr := i.wait(ctx, attempt, err); waitErr != nil {
+				return nil, waitErr
+			}
+		}
+	}
+}
+
+func (i *retryInterceptor) WrapStreamingClient(next StreamingClientFunc) StreamingClientFunc {
+	return func(ctx context.Context, spec Spec) StreamingClientConn {
+		conn := next(ctx, spec)
+		if spec.StreamType != StreamTypeServer || spec.IdempotencyLevel == IdempotencyUnknown {
+			return conn
+		}
+		return &retryStreamingClientConn{
+			StreamingClientConn: conn,
+			ctx:                 ctx,
+			next:                next,
+			interceptor:         i,
+		}
+	}
+}
+
+func (i *retryInterceptor) WrapStreamingHandler(next StreamingHandlerFunc) StreamingHandlerFunc {
+	return next
+}
+
+// wait decides whether the call should be retried after the supplied attempt
+// failed with err. If it should, wait blocks until it's time for the next
+// attempt and returns nil. Otherwise, it returns the error the call should
+// fail with.
+func (i *retryInterceptor) wait(ctx context.Context, attempt int, err error) error {
+	if attempt >= i.policy.MaxAttempts || !i.isRetryable(err) {
+		return err
+	}
+	clock := i.clock()
+	delay := i.backoff(attempt)
+	if retryAfter, ok := parseRetryAfter(err, clock.Now()); ok && retryAfter > delay {
+		delay = retryAfter
+	}
+	if remaining, ok := timeUntilDeadline(ctx); ok && remaining < delay {
+		// The next attempt can't finish before the deadline, so there's no
+		// point in making it.
+		return err
+	}
+	return wrapIfContextError(sleep(ctx, clock, delay))
+}
+
+func (i *retryInterceptor) isRetryable(err error) bool {
+	code := CodeOf(err)
+	for _, retryable := range i.policy.RetryableCodes {
+		if code == retryable {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff returns the jittered delay before the retry following the supplied
+// attempt.
+func (i *retryInterceptor) backoff(attempt int) time.Duration {
+	delay := float64(i.policy.InitialBackoff) * math.Pow(i.policy.Multiplier, float64(attempt-1))
+	delay = math.Min(delay, float64(i.policy.MaxBackoff))
+	if i.policy.Jitter > 0 {
+		delay *= 1 + i.policy.Jitter*(2*rand.Float64()-1) //nolint:gosec
+	}
+	return time.Duration(delay)
+}
+
+// parseRetryAfter extracts the Retry-After header from an error's metadata.
+// It supports both delay-seconds and HTTP-date values, measuring dates from
+// now.
+func parseRetryAfter(err error, now time.Time) (time.Duration, bool) {
+	connectErr, ok := asError(err)
+	if !ok {
+		return 0, false
+	}
+	value := getHeaderCanonical(connectErr.Meta(), headerRetryAfter)
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.ParseInt(value, 10 /* base */, 64 /* bitsize */); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return date.Sub(now), true
+	}
+	return 0, false
+}
+
+// retryStreamingClientConn replays a server-streaming call if it fails before
+// receiving any messages.
+type retryStreamingClientConn struct {
+	StreamingClientConn
+
+	ctx         context.Context //nolint:containedctx
+	next        StreamingClientFunc
+	interceptor *retryInterceptor
+
+	mu       sync.Mutex
+	request  any
+	sent     bool
+	closed   bool
+	received bool
+	attempt  int
+}
+
+func (c *retryStreamingClientConn) Send(msg any) error {
+	c.mu.Lock()
+	c.request = msg
+	c.sent = true
+	conn := c.StreamingClientConn
+	c.mu.Unlock()
+	return conn.Send(msg)
+}
+
+func (c *retryStreamingClientConn) CloseRequest() error {
+	c.mu.Lock()
+	c.closed = true
+	conn := c.StreamingClientConn
+	c.mu.Unlock()
+	return conn.CloseRequest()
+}
+
+func (c *retryStreamingClientConn) Receive(msg any) error {
+	for {
+		err := c.current().Receive(msg)
+		if err == nil {
+			c.mu.Lock()
+			c.received = true
+			c.mu.Unlock()
+			return nil
+		}
+		if errors.Is(err, io.EOF) || !c.canReplay() {
+			return err
+		}
+		c.mu.Lock()
+		c.attempt++
+		attempt := c.attempt
+		c.mu.Unlock()
+		if waitErr := c.interceptor.wait(c.ctx, attempt, err); waitErr != nil {
+			return waitErr
+		}
+		if replayErr := c.replay(); replayErr != nil {
+			return replayErr
+		}
+	}
+}
+
+func (c *retryStreamingClientConn) current() StreamingClientConn {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.StreamingClientConn
+}
+
+// canReplay reports whether the request has been fully sent and nothing has
+// been received, so the call can be made again from scratch.
+func (c *retryStreamingClientConn) canReplay() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.sent && c.closed && !c.received
+}
+
+// replay abandons the current attempt and sends the request again on a new
+// connection, carrying over any request headers set by the caller.
+func (c *retryStreamingClientConn) replay() error {
+	c.mu.Lock()
+	previous := c.StreamingClientConn
+	request := c.request
+	c.mu.Unlock()
+	_ = previous.CloseResponse()
+	conn := c.next(c.ctx, previous.Spec())
+	header := conn.RequestHeader()
+	for key, values := range previous.RequestHeader() {
+		// Keep the fresh protocol headers, like timeouts, computed for the new
+		// attempt.
+		if _, ok := header[key]; !ok {
+			header[key] = values
+		}
+	}
+	c.mu.Lock()
+	c.StreamingClientConn = conn
+	c.mu.Unlock()
+	if err := conn.Send(request); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return conn.CloseRequest()
+}
+
+func (c *retryStreamingClientConn) ResponseHeader() http.Header {
+	return c.current().ResponseHeader()
+}
+
+func (c *retryStreamingClientConn) ResponseTrailer() http.Header {
+	return c.current().ResponseTrailer()
+}
+
+func (c *retryStreamingClientConn) CloseResponse() error {
+	return c.current().CloseResponse()
+}
+
+func (c *retryStreamingClientConn) Unwrap() StreamingClientConn {
+	return c.current()
+}
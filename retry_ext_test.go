@@ -0,0 +1,229 @@
+// Copyright 2021-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	connect "connectrpc.com/connect"
+	"connectrpc.com/connect/internal/assert"
+	pingv1 "connectrpc.com/connect/internal/gen/connect/ping/v1"
+	"connectrpc.com/connect/internal/gen/connect/ping/v1/pingv1connect"
+	"connectrpc.com/connect/internal/memhttp/memhttptest"
+)
+
+// flakyPingServer fails the first failures calls to each method with code,
+// then behaves normally.
+type flakyPingServer struct {
+	pingv1connect.UnimplementedPingServiceHandler
+
+	failures   int64
+	code       connect.Code
+	retryAfter string
+	// failMidStream makes CountUp fail after sending its first message.
+	failMidStream bool
+
+	attempts atomic.Int64
+	headers  atomic.Int64
+}
+
+func (s *flakyPingServer) fail(header http.Header) error {
+	attempt := s.attempts.Add(1)
+	if header.Get("Test-Header") == "value" {
+		s.headers.Add(1)
+	}
+	if attempt > s.failures {
+		return nil
+	}
+	err := connect.NewError(s.code, errors.New("transient failure"))
+	if s.retryAfter != "" {
+		err.Meta().Set("Retry-After", s.retryAfter)
+	}
+	return err
+}
+
+func (s *flakyPingServer) Ping(
+	_ context.Context,
+	request *connect.Request[pingv1.PingRequest],
+) (*connect.Response[pingv1.PingResponse], error) {
+	if err := s.fail(request.Header()); err != nil {
+		return nil, err
+	}
+	return connect.NewResponse(&pingv1.PingResponse{Number: request.Msg.GetNumber()}), nil
+}
+
+func (s *flakyPingServer) Sum(
+	_ context.Context,
+	stream *connect.ClientStream[pingv1.SumRequest],
+) (*connect.Response[pingv1.SumResponse], error) {
+	var sum int64
+	for stream.Receive() {
+		sum += stream.Msg().GetNumber()
+	}
+	if err := s.fail(stream.RequestHeader()); err != nil {
+		return nil, err
+	}
+	return connect.NewResponse(&pingv1.SumResponse{Sum: sum}), nil
+}
+
+func (s *flakyPingServer) CountUp(
+	_ context.Context,
+	request *connect.Request[pingv1.CountUpRequest],
+	stream *connect.ServerStream[pingv1.CountUpResponse],
+) error {
+	if s.failMidStream {
+		s.attempts.Add(1)
+		if err := stream.Send(&pingv1.CountUpResponse{Number: 1}); err != nil {
+			return err
+		}
+		return connect.NewError(s.code, errors.New("transient failure"))
+	}
+	if err := s.fail(request.Header()); err != nil {
+		return err
+	}
+	for i := int64(1); i <= request.Msg.GetNumber(); i++ {
+		if err := stream.Send(&pingv1.CountUpResponse{Number: i}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestWithRetry(t *testing.T) {
+	t.Parallel()
+	policy := connect.RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     5 * time.Millisecond,
+	}
+	newClient := func(t *testing.T, pinger *flakyPingServer, opts ...connect.ClientOption) pingv1connect.PingServiceClient {
+		t.Helper()
+		mux := http.NewServeMux()
+		mux.Handle(pingv1connect.NewPingServiceHandler(pinger))
+		server := memhttptest.NewServer(t, mux)
+		return pingv1connect.NewPingServiceClient(server.Client(), server.URL(), opts...)
+	}
+	protocols := []struct {
+		name string
+		opts []connect.ClientOption
+	}{
+		{name: "connect"},
+		{name: "grpc", opts: []connect.ClientOption{connect.WithGRPC()}},
+		{name: "grpcweb", opts: []connect.ClientOption{connect.WithGRPCWeb()}},
+	}
+	for _, protocol := range protocols {
+		clientOpts := append([]connect.ClientOption{connect.WithRetry(policy)}, protocol.opts...)
+		// CountUp doesn't declare an idempotency level, so it's only retried
+		// with these options.
+		idempotentOpts := append([]connect.ClientOption{connect.WithIdempotency(connect.IdempotencyIdempotent)}, clientOpts...)
+		t.Run(protocol.name, func(t *testing.T) {
+			t.Parallel()
+			t.Run("unary_recovers", func(t *testing.T) {
+				t.Parallel()
+				pinger := &flakyPingServer{failures: 2, code: connect.CodeUnavailable}
+				client := newClient(t, pinger, clientOpts...)
+				request := connect.NewRequest(&pingv1.PingRequest{Number: 42})
+				request.Header().Set("Test-Header", "value")
+				response, err := client.Ping(context.Background(), request)
+				assert.Nil(t, err)
+				assert.Equal(t, response.Msg.GetNumber(), 42)
+				assert.Equal(t, pinger.attempts.Load(), 3)
+				assert.Equal(t, pinger.headers.Load(), 3)
+			})
+			t.Run("unary_exhausted", func(t *testing.T) {
+				t.Parallel()
+				pinger := &flakyPingServer{failures: 5, code: connect.CodeUnavailable}
+				client := newClient(t, pinger, clientOpts...)
+				_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+				assert.Equal(t, connect.CodeOf(err), connect.CodeUnavailable)
+				assert.Equal(t, pinger.attempts.Load(), 3)
+			})
+			t.Run("unary_not_retryable", func(t *testing.T) {
+				t.Parallel()
+				pinger := &flakyPingServer{failures: 1, code: connect.CodeInternal}
+				client := newClient(t, pinger, clientOpts...)
+				_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+				assert.Equal(t, connect.CodeOf(err), connect.CodeInternal)
+				assert.Equal(t, pinger.attempts.Load(), 1)
+			})
+			t.Run("unary_retry_after_past_deadline", func(t *testing.T) {
+				t.Parallel()
+				pinger := &flakyPingServer{failures: 1, code: connect.CodeUnavailable, retryAfter: "60"}
+				client := newClient(t, pinger, clientOpts...)
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancel()
+				_, err := client.Ping(ctx, connect.NewRequest(&pingv1.PingRequest{}))
+				assert.Equal(t, connect.CodeOf(err), connect.CodeUnavailable)
+				assert.Equal(t, pinger.attempts.Load(), 1)
+			})
+			t.Run("server_stream_recovers", func(t *testing.T) {
+				t.Parallel()
+				pinger := &flakyPingServer{failures: 2, code: connect.CodeUnavailable}
+				client := newClient(t, pinger, idempotentOpts...)
+				request := connect.NewRequest(&pingv1.CountUpRequest{Number: 3})
+				request.Header().Set("Test-Header", "value")
+				stream, err := client.CountUp(context.Background(), request)
+				assert.Nil(t, err)
+				var got []int64
+				for stream.Receive() {
+					got = append(got, stream.Msg().GetNumber())
+				}
+				assert.Nil(t, stream.Err())
+				assert.Nil(t, stream.Close())
+				assert.Equal(t, got, []int64{1, 2, 3})
+				assert.Equal(t, pinger.attempts.Load(), 3)
+				assert.Equal(t, pinger.headers.Load(), 3)
+			})
+			t.Run("server_stream_mid_stream_failure", func(t *testing.T) {
+				t.Parallel()
+				pinger := &flakyPingServer{code: connect.CodeUnavailable, failMidStream: true}
+				client := newClient(t, pinger, idempotentOpts...)
+				stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{Number: 3}))
+				assert.Nil(t, err)
+				assert.True(t, stream.Receive())
+				assert.False(t, stream.Receive())
+				assert.Equal(t, connect.CodeOf(stream.Err()), connect.CodeUnavailable)
+				assert.Nil(t, stream.Close())
+				assert.Equal(t, pinger.attempts.Load(), 1)
+			})
+			t.Run("unknown_idempotency_not_retried", func(t *testing.T) {
+				t.Parallel()
+				pinger := &flakyPingServer{failures: 1, code: connect.CodeUnavailable}
+				client := newClient(t, pinger, clientOpts...)
+				stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{Number: 3}))
+				assert.Nil(t, err)
+				assert.False(t, stream.Receive())
+				assert.Equal(t, connect.CodeOf(stream.Err()), connect.CodeUnavailable)
+				assert.Nil(t, stream.Close())
+				assert.Equal(t, pinger.attempts.Load(), 1)
+			})
+			t.Run("client_stream_not_retried", func(t *testing.T) {
+				t.Parallel()
+				pinger := &flakyPingServer{failures: 1, code: connect.CodeUnavailable}
+				client := newClient(t, pinger, clientOpts...)
+				stream := client.Sum(context.Background())
+				assert.Nil(t, stream.Send(&pingv1.SumRequest{Number: 1}))
+				_, err := stream.CloseAndReceive()
+				assert.Equal(t, connect.CodeOf(err), connect.CodeUnavailable)
+				assert.Equal(t, pinger.attempts.Load(), 1)
+			})
+		})
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2021-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"time"
+)
+
+// sendWithTimeout calls send, which writes one message to the response and
+// usually flushes it to the client. If that takes longer than timeout, it
+// fails with CodeDeadlineExceeded. Afterwards, it restores serverDeadline,
+// the write deadline from the server's WriteTimeout (zero if there isn't
+// one). Response writers that don't support write deadlines send without one.
+func sendWithTimeout(responseWriter http.ResponseWriter, timeout time.Duration, serverDeadline time.Time, send func() error) error {
+	controller := http.NewResponseController(responseWriter)
+	deadline := time.Now().Add(timeout)
+	if !serverDeadline.IsZero() && serverDeadline.Before(deadline) {
+		deadline = serverDeadline
+	}
+	if err := controller.SetWriteDeadline(deadline); err != nil {
+		return send()
+	}
+	// Put back the server's deadline, so that ours doesn't apply to whatever's
+	// written next.
+	defer func() {
+		_ = controller.SetWriteDeadline(serverDeadline)
+	}()
+	err := send()
+	if err != nil && errors.Is(err, os.ErrDeadlineExceeded) {
+		return errorf(CodeDeadlineExceeded, "send timed out after %v: %w", timeout, err)
+	}
+	return err
+}
+
+// serverDeadlines are the read and write deadlines that an [http.Server]'s
+// ReadTimeout and WriteTimeout put on a request. Per-message timeouts replace
+// them while they're in effect, so they need to know what to restore. The
+// server starts its clock a little earlier than the handler, so these are
+// slightly late.
+type serverDeadlines struct {
+	read, write time.Time
+}
+
+func newServerDeadlines(request *http.Request) serverDeadlines {
+	server, ok := request.Context().Value(http.ServerContextKey).(*http.Server)
+	if !ok {
+		return serverDeadlines{}
+	}
+	var deadlines serverDeadlines
+	now := time.Now()
+	if server.ReadTimeout > 0 {
+		deadlines.read = now.Add(server.ReadTimeout)
+	}
+	if server.WriteTimeout > 0 {
+		deadlines.write = now.Add(server.WriteTimeout)
+	}
+	return deadlines
+}
@@ -0,0 +1,304 @@
+// Copyright 2021-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect_test
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	connect "connectrpc.com/connect"
+	"connectrpc.com/connect/internal/assert"
+	pingv1 "connectrpc.com/connect/internal/gen/connect/ping/v1"
+	"connectrpc.com/connect/internal/gen/connect/ping/v1/pingv1connect"
+	"connectrpc.com/connect/internal/memhttp"
+	"connectrpc.com/connect/internal/memhttp/memhttptest"
+)
+
+// stalledResponseWriter behaves like a connection to a client that stops
+// reading: once stalled, writes block until the write deadline passes.
+type stalledResponseWriter struct {
+	http.ResponseWriter
+
+	mu       sync.Mutex
+	deadline time.Time
+	stalled  bool
+	released chan struct{}
+}
+
+func (w *stalledResponseWriter) Write(data []byte) (int, error) {
+	w.mu.Lock()
+	deadline, stalled := w.deadline, w.stalled
+	w.mu.Unlock()
+	if !stalled {
+		return w.ResponseWriter.Write(data)
+	}
+	var expired <-chan time.Time
+	if !deadline.IsZero() {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		expired = timer.C
+	}
+	select {
+	case <-expired:
+		return 0, os.ErrDeadlineExceeded
+	case <-w.released:
+		return 0, http.ErrHandlerTimeout
+	}
+}
+
+func (w *stalledResponseWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	// Let the first flush through, so the client sees the response start.
+	w.mu.Lock()
+	w.stalled = true
+	w.mu.Unlock()
+}
+
+func (w *stalledResponseWriter) SetWriteDeadline(deadline time.Time) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.deadline = deadline
+	return nil
+}
+
+func TestWithSendTimeout(t *testing.T) {
+	t.Parallel()
+	// newClient starts a server whose CountUp handler sends until Send fails,
+	// reporting the error on the returned channel. Writes to the client stall
+	// once the first message is flushed.
+	newClient := func(t *testing.T, opts ...connect.HandlerOption) (pingv1connect.PingServiceClient, <-chan error) {
+		t.Helper()
+		sendErrs := make(chan error, 1)
+		released := make(chan struct{})
+		t.Cleanup(func() { close(released) })
+		mux := http.NewServeMux()
+		mux.Handle(pingv1connect.NewPingServiceHandler(&pluggablePingServer{
+			countUp: func(_ context.Context, _ *connect.Request[pingv1.CountUpRequest], stream *connect.ServerStream[pingv1.CountUpResponse]) error {
+				for i := int64(1); ; i++ {
+					if err := stream.Send(&pingv1.CountUpResponse{Number: i}); err != nil {
+						sendErrs <- err
+						return err
+					}
+				}
+			},
+		}, opts...))
+		server := memhttptest.NewServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mux.ServeHTTP(&stalledResponseWriter{ResponseWriter: w, released: released}, r)
+		}))
+		return pingv1connect.NewPingServiceClient(server.Client(), server.URL()), sendErrs
+	}
+	t.Run("timeout", func(t *testing.T) {
+		t.Parallel()
+		client, sendErrs := newClient(t, connect.WithSendTimeout(20*time.Millisecond))
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		stream, err := client.CountUp(ctx, connect.NewRequest(&pingv1.CountUpRequest{}))
+		assert.Nil(t, err)
+		assert.True(t, stream.Receive())
+		select {
+		case err := <-sendErrs:
+			assert.Equal(t, connect.CodeOf(err), connect.CodeDeadlineExceeded)
+			assert.True(t, strings.Contains(err.Error(), "send timed out"))
+		case <-time.After(5 * time.Second):
+			t.Fatal("send didn't time out")
+		}
+		cancel()
+		_ = stream.Close()
+	})
+	t.Run("no_timeout", func(t *testing.T) {
+		t.Parallel()
+		client, sendErrs := newClient(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		stream, err := client.CountUp(ctx, connect.NewRequest(&pingv1.CountUpRequest{}))
+		assert.Nil(t, err)
+		assert.True(t, stream.Receive())
+		select {
+		case err := <-sendErrs:
+			t.Fatalf("send returned before the client read: %v", err)
+		case <-time.After(50 * time.Millisecond):
+		}
+		cancel()
+		_ = stream.Close()
+	})
+}
+
+func TestWithSendTimeoutSlowClient(t *testing.T) {
+	t.Parallel()
+	const procedure = "/connect.ping.v1.PingService/Slow"
+	for _, protocol := range []struct {
+		name string
+		opts []connect.ClientOption
+	}{
+		{name: "connect"},
+		{name: "grpc", opts: []connect.ClientOption{connect.WithGRPC()}},
+		{name: "grpcweb", opts: []connect.ClientOption{connect.WithGRPCWeb()}},
+	} {
+		t.Run(protocol.name, func(t *testing.T) {
+			t.Parallel()
+			sendErrs := make(chan error, 1)
+			mux := http.NewServeMux()
+			mux.Handle(procedure, connect.NewServerStreamHandler(
+				procedure,
+				func(_ context.Context, _ *connect.Request[pingv1.PingRequest], stream *connect.ServerStream[pingv1.PingResponse]) error {
+					// Large messages fill the transport's buffers quickly.
+					response := &pingv1.PingResponse{Text: strings.Repeat("slow ", 64*1024)}
+					for {
+						if err := stream.Send(response); err != nil {
+							sendErrs <- err
+							return err
+						}
+					}
+				},
+				connect.WithSendTimeout(50*time.Millisecond),
+				// Compression would shrink the messages to almost nothing.
+				connect.WithCompression("gzip", nil, nil),
+			))
+			server := memhttptest.NewServer(t, mux)
+			client := connect.NewClient[pingv1.PingRequest, pingv1.PingResponse](server.Client(), server.URL()+procedure, protocol.opts...)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			stream, err := client.CallServerStream(ctx, connect.NewRequest(&pingv1.PingRequest{}))
+			assert.Nil(t, err)
+			// Read one message, then stop reading until the server gives up.
+			assert.True(t, stream.Receive())
+			select {
+			case err := <-sendErrs:
+				assert.Equal(t, connect.CodeOf(err), connect.CodeDeadlineExceeded)
+			case <-time.After(10 * time.Second):
+				t.Fatal("send didn't time out")
+			}
+			cancel()
+			_ = stream.Close()
+		})
+	}
+}
+
+// deadlineRecordingResponseWriter records the deadlines set on it.
+type deadlineRecordingResponseWriter struct {
+	http.ResponseWriter
+
+	mu            sync.Mutex
+	readDeadline  time.Time
+	writeDeadline time.Time
+}
+
+func (w *deadlineRecordingResponseWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *deadlineRecordingResponseWriter) SetReadDeadline(deadline time.Time) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.readDeadline = deadline
+	return nil
+}
+
+func (w *deadlineRecordingResponseWriter) SetWriteDeadline(deadline time.Time) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.writeDeadline = deadline
+	return nil
+}
+
+func (w *deadlineRecordingResponseWriter) deadlines() (read, write time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.readDeadline, w.writeDeadline
+}
+
+// newDeadlineRecordingServer starts a server for handler that records the
+// deadlines handlers leave on each response, as though the requests came from
+// the supplied http.Server. Use it to check that per-message timeouts restore
+// the server's own deadlines.
+func newDeadlineRecordingServer(t *testing.T, httpServer *http.Server, handler http.Handler) (*memhttp.Server, <-chan *deadlineRecordingResponseWriter) {
+	t.Helper()
+	writers := make(chan *deadlineRecordingResponseWriter, 1)
+	server := memhttptest.NewServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writer := &deadlineRecordingResponseWriter{ResponseWriter: w}
+		ctx := context.WithValue(r.Context(), http.ServerContextKey, httpServer)
+		handler.ServeHTTP(writer, r.WithContext(ctx))
+		writers <- writer
+	}))
+	return server, writers
+}
+
+func TestWithSendTimeoutRestoresServerDeadline(t *testing.T) {
+	t.Parallel()
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}, connect.WithSendTimeout(time.Minute)))
+	for _, testCase := range []struct {
+		name         string
+		writeTimeout time.Duration
+	}{
+		{name: "server_timeout", writeTimeout: time.Hour},
+		{name: "no_server_timeout"},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+			server, writers := newDeadlineRecordingServer(t, &http.Server{WriteTimeout: testCase.writeTimeout}, mux) //nolint:gosec
+			// checkDeadline checks that the handler put back the deadline from the
+			// server's WriteTimeout, or cleared its own if the server has none.
+			checkDeadline := func(t *testing.T, start time.Time) {
+				t.Helper()
+				_, deadline := (<-writers).deadlines()
+				if testCase.writeTimeout == 0 {
+					assert.True(t, deadline.IsZero())
+					return
+				}
+				assert.False(t, deadline.Before(start.Add(testCase.writeTimeout)))
+				assert.False(t, deadline.After(time.Now().Add(testCase.writeTimeout)))
+			}
+			for _, protocol := range []struct {
+				name string
+				opts []connect.ClientOption
+			}{
+				{name: "connect"},
+				{name: "grpc", opts: []connect.ClientOption{connect.WithGRPC()}},
+				{name: "grpcweb", opts: []connect.ClientOption{connect.WithGRPCWeb()}},
+			} {
+				client := pingv1connect.NewPingServiceClient(server.Client(), server.URL(), protocol.opts...)
+				t.Run(protocol.name+"/unary", func(t *testing.T) {
+					start := time.Now()
+					_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Number: 1}))
+					assert.Nil(t, err)
+					checkDeadline(t, start)
+				})
+				t.Run(protocol.name+"/server_stream", func(t *testing.T) {
+					start := time.Now()
+					stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{Number: 2}))
+					assert.Nil(t, err)
+					var received int
+					for stream.Receive() {
+						received++
+					}
+					assert.Nil(t, stream.Err())
+					assert.Equal(t, received, 2)
+					assert.Nil(t, stream.Close())
+					checkDeadline(t, start)
+				})
+			}
+		})
+	}
+}
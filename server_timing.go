@@ -0,0 +1,88 @@
+// Copyright 2021-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// defaultServerTimingTrailer is the trailer [ServerTiming] sets if it isn't
+// given a name.
+const defaultServerTimingTrailer = "Server-Timing"
+
+// ServerTiming returns a handler [Interceptor] that measures how long each
+// RPC takes and reports it to clients in a Server-Timing style trailer, such
+// as "handler;dur=12.345": the duration is in milliseconds. For streaming
+// RPCs, the measurement runs until the handler returns, so it covers the
+// whole stream. If trailerName is empty, the trailer is named Server-Timing.
+//
+// The trailer is added to any values already set, so handlers and other
+// interceptors may report their own metrics in the same trailer. As with
+// [WithResponseTrailers], unary RPCs that fail report the duration in their
+// error's metadata. Clients ignore the interceptor.
+func ServerTiming(trailerName string) Interceptor {
+	if trailerName == "" {
+		trailerName = defaultServerTimingTrailer
+	}
+	return &serverTimingInterceptor{trailerName: trailerName}
+}
+
+type serverTimingInterceptor struct {
+	trailerName string
+}
+
+func (i *serverTimingInterceptor) WrapUnary(next UnaryFunc) UnaryFunc {
+	return func(ctx context.Context, req AnyRequest) (AnyResponse, error) {
+		if req.Spec().IsClient {
+			return next(ctx, req)
+		}
+		start := time.Now()
+		res, err := next(ctx, req)
+		if err != nil {
+			// Unary errors are sent without a response, so the error's metadata
+			// stands in for its trailers.
+			err = wrapIfUncoded(err)
+			if connectErr, ok := asError(err); ok {
+				i.set(connectErr.Meta(), start)
+			}
+			return nil, err
+		}
+		if res != nil {
+			i.set(res.Trailer(), start)
+		}
+		return res, nil
+	}
+}
+
+func (i *serverTimingInterceptor) WrapStreamingClient(next StreamingClientFunc) StreamingClientFunc {
+	return next
+}
+
+func (i *serverTimingInterceptor) WrapStreamingHandler(next StreamingHandlerFunc) StreamingHandlerFunc {
+	return func(ctx context.Context, conn StreamingHandlerConn) error {
+		start := time.Now()
+		err := next(ctx, conn)
+		i.set(conn.ResponseTrailer(), start)
+		return err
+	}
+}
+
+func (i *serverTimingInterceptor) set(trailer http.Header, start time.Time) {
+	millis := float64(time.Since(start)) / float64(time.Millisecond)
+	trailer.Add(i.trailerName, "handler;dur="+strconv.FormatFloat(millis, 'f', 3, 64))
+}
@@ -0,0 +1,145 @@
+// Copyright 2021-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	connect "connectrpc.com/connect"
+	"connectrpc.com/connect/internal/assert"
+	pingv1 "connectrpc.com/connect/internal/gen/connect/ping/v1"
+	"connectrpc.com/connect/internal/gen/connect/ping/v1/pingv1connect"
+	"connectrpc.com/connect/internal/memhttp/memhttptest"
+)
+
+func TestServerTiming(t *testing.T) {
+	t.Parallel()
+	const delay = 20 * time.Millisecond
+	// assertTiming checks that the trailer holds one plausible duration.
+	assertTiming := func(t *testing.T, trailer http.Header, name string) {
+		t.Helper()
+		values := trailer.Values(name)
+		assert.Equal(t, len(values), 1)
+		millis, ok := strings.CutPrefix(values[0], "handler;dur=")
+		assert.True(t, ok)
+		duration, err := strconv.ParseFloat(millis, 64)
+		assert.Nil(t, err)
+		assert.True(t, duration >= float64(delay/time.Millisecond))
+		assert.True(t, duration < float64(time.Minute/time.Millisecond))
+	}
+	server := &pluggablePingServer{
+		ping: func(_ context.Context, request *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+			time.Sleep(delay)
+			if request.Msg.GetNumber() < 0 {
+				return nil, connect.NewError(connect.CodeInvalidArgument, errors.New("negative"))
+			}
+			return connect.NewResponse(&pingv1.PingResponse{Number: request.Msg.GetNumber()}), nil
+		},
+		countUp: func(_ context.Context, request *connect.Request[pingv1.CountUpRequest], stream *connect.ServerStream[pingv1.CountUpResponse]) error {
+			for i := int64(1); i <= request.Msg.GetNumber(); i++ {
+				// The measurement covers the whole stream, not the first message.
+				time.Sleep(delay / time.Duration(request.Msg.GetNumber()))
+				if err := stream.Send(&pingv1.CountUpResponse{Number: i}); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		cumSum: func(_ context.Context, stream *connect.BidiStream[pingv1.CumSumRequest, pingv1.CumSumResponse]) error {
+			var sum int64
+			for {
+				msg, err := stream.Receive()
+				if errors.Is(err, io.EOF) {
+					time.Sleep(delay)
+					return nil
+				} else if err != nil {
+					return err
+				}
+				sum += msg.GetNumber()
+				if err := stream.Send(&pingv1.CumSumResponse{Sum: sum}); err != nil {
+					return err
+				}
+			}
+		},
+	}
+	for _, trailerName := range []string{"", "X-Handler-Timing"} {
+		wantName := trailerName
+		if wantName == "" {
+			wantName = "Server-Timing"
+		}
+		mux := http.NewServeMux()
+		mux.Handle(pingv1connect.NewPingServiceHandler(
+			server,
+			connect.WithInterceptors(connect.ServerTiming(trailerName)),
+		))
+		httpServer := memhttptest.NewServer(t, mux)
+		for _, protocol := range []struct {
+			name string
+			opts []connect.ClientOption
+		}{
+			{name: "connect"},
+			{name: "grpc", opts: []connect.ClientOption{connect.WithGRPC()}},
+			{name: "grpcweb", opts: []connect.ClientOption{connect.WithGRPCWeb()}},
+		} {
+			t.Run(wantName+"/"+protocol.name, func(t *testing.T) {
+				t.Parallel()
+				client := pingv1connect.NewPingServiceClient(httpServer.Client(), httpServer.URL(), protocol.opts...)
+				t.Run("unary", func(t *testing.T) {
+					t.Parallel()
+					response, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Number: 42}))
+					assert.Nil(t, err)
+					assertTiming(t, response.Trailer(), wantName)
+				})
+				t.Run("unary_error", func(t *testing.T) {
+					t.Parallel()
+					_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Number: -1}))
+					var connectErr *connect.Error
+					assert.True(t, errors.As(err, &connectErr))
+					assert.Equal(t, connectErr.Code(), connect.CodeInvalidArgument)
+					assertTiming(t, connectErr.Meta(), wantName)
+				})
+				t.Run("server_stream", func(t *testing.T) {
+					t.Parallel()
+					stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{Number: 4}))
+					assert.Nil(t, err)
+					for stream.Receive() { //nolint:revive
+					}
+					assert.Nil(t, stream.Err())
+					assertTiming(t, stream.ResponseTrailer(), wantName)
+					assert.Nil(t, stream.Close())
+				})
+				t.Run("bidi_stream", func(t *testing.T) {
+					t.Parallel()
+					stream := client.CumSum(context.Background())
+					assert.Nil(t, stream.Send(&pingv1.CumSumRequest{Number: 1}))
+					_, err := stream.Receive()
+					assert.Nil(t, err)
+					assert.Nil(t, stream.CloseRequest())
+					_, err = stream.Receive()
+					assert.NotNil(t, err)
+					assertTiming(t, stream.ResponseTrailer(), wantName)
+					assert.Nil(t, stream.CloseResponse())
+				})
+			})
+		}
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright 2021-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"errors"
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// statusTypeName is the fully-qualified name of google.rpc.Status.
+const statusTypeName = "google.rpc.Status"
+
+// Field numbers of google.rpc.Status and google.protobuf.Any. We access the
+// messages reflectively, so that callers can use any generated (or dynamic)
+// google.rpc.Status type without connect depending on one.
+const (
+	statusCodeField    protoreflect.FieldNumber = 1
+	statusMessageField protoreflect.FieldNumber = 2
+	statusDetailsField protoreflect.FieldNumber = 3
+	anyTypeURLField    protoreflect.FieldNumber = 1
+	anyValueField      protoreflect.FieldNumber = 2
+)
+
+// NewErrorFromStatus converts a google.rpc.Status, such as the statuspb.Status
+// type from google.golang.org/genproto, into an *Error. The error has the
+// status's code and message, and each of the status's details becomes an
+// [ErrorDetail] holding the original bytes. Codes connect doesn't know are
+// converted to [CodeUnknown], as gRPC does.
+//
+// A status with code 0 (OK) doesn't describe an error, so it's converted to
+// nil, as is a nil status. If the message isn't a google.rpc.Status, the
+// returned error has [CodeInternal] and describes the mistake.
+func NewErrorFromStatus(status proto.Message) *Error {
+	if status == nil {
+		return nil
+	}
+	msg := status.ProtoReflect()
+	if !msg.IsValid() {
+		return nil
+	}
+	if name := msg.Descriptor().FullName(); name != statusTypeName {
+		return errorf(CodeInternal, "can't convert %s to an error: not a %s", name, statusTypeName)
+	}
+	fields := msg.Descriptor().Fields()
+	codeField := fields.ByNumber(statusCodeField)
+	messageField := fields.ByNumber(statusMessageField)
+	detailsField := fields.ByNumber(statusDetailsField)
+	if codeField == nil || messageField == nil || detailsField == nil {
+		return errorf(CodeInternal, "can't convert %s to an error: unexpected schema", statusTypeName)
+	}
+	rawCode := msg.Get(codeField).Int()
+	if rawCode == 0 {
+		return nil
+	}
+	code := Code(rawCode) //nolint:gosec // range checked below
+	if rawCode < int64(minCode) || rawCode > int64(maxCode) {
+		code = CodeUnknown
+	}
+	connectErr := NewError(code, errors.New(msg.Get(messageField).String()))
+	details := msg.Get(detailsField).List()
+	for i := range details.Len() {
+		detail := details.Get(i).Message()
+		detailFields := detail.Descriptor().Fields()
+		typeURL, value := detailFields.ByNumber(anyTypeURLField), detailFields.ByNumber(anyValueField)
+		if typeURL == nil || value == nil {
+			continue
+		}
+		connectErr.details = append(connectErr.details, &ErrorDetail{pbAny: &anypb.Any{
+			TypeUrl: detail.Get(typeURL).String(),
+			Value:   detail.Get(value).Bytes(),
+		}})
+	}
+	return connectErr
+}
+
+// ToStatus fills in a google.rpc.Status, such as the statuspb.Status type
+// from google.golang.org/genproto, from the error: its code, its message
+// (without the code prefix that Error adds), and its details. The details
+// are set from the bytes the error already holds, so they aren't marshaled
+// again. Any previous contents of the status are cleared. A nil *Error fills
+// in an OK status.
+//
+// ToStatus returns an error if the message isn't a google.rpc.Status.
+func (e *Error) ToStatus(status proto.Message) error {
+	msg := status.ProtoReflect()
+	if name := msg.Descriptor().FullName(); name != statusTypeName {
+		return fmt.Errorf("can't convert error to %s: not a %s", name, statusTypeName)
+	}
+	fields := msg.Descriptor().Fields()
+	codeField := fields.ByNumber(statusCodeField)
+	messageField := fields.ByNumber(statusMessageField)
+	detailsField := fields.ByNumber(statusDetailsField)
+	if codeField == nil || messageField == nil || detailsField == nil {
+		return fmt.Errorf("can't convert error to %s: unexpected schema", statusTypeName)
+	}
+	proto.Reset(status)
+	if e == nil {
+		return nil
+	}
+	msg.Set(codeField, protoreflect.ValueOfInt32(int32(e.Code()))) //nolint:gosec // No information loss
+	msg.Set(messageField, protoreflect.ValueOfString(e.Message()))
+	if len(e.details) == 0 {
+		return nil
+	}
+	details := msg.Mutable(detailsField).List()
+	for _, detail := range e.details {
+		element := details.NewElement()
+		anyMsg := element.Message()
+		anyFields := anyMsg.Descriptor().Fields()
+		typeURL, value := anyFields.ByNumber(anyTypeURLField), anyFields.ByNumber(anyValueField)
+		if typeURL == nil || value == nil {
+			return fmt.Errorf("can't convert error to %s: unexpected schema", statusTypeName)
+		}
+		anyMsg.Set(typeURL, protoreflect.ValueOfString(detail.pbAny.GetTypeUrl()))
+		anyMsg.Set(value, protoreflect.ValueOfBytes(detail.pbAny.GetValue()))
+		details.Append(element)
+	}
+	return nil
+}
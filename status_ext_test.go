@@ -0,0 +1,167 @@
+// Copyright 2021-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect_test
+
+import (
+	"errors"
+	"testing"
+
+	connect "connectrpc.com/connect"
+	"connectrpc.com/connect/internal/assert"
+	pingv1 "connectrpc.com/connect/internal/gen/connect/ping/v1"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+func TestNewErrorFromStatus(t *testing.T) {
+	t.Parallel()
+	statusType := newStatusType(t)
+	first, err := anypb.New(&pingv1.PingRequest{Number: 42})
+	assert.Nil(t, err)
+	second, err := anypb.New(&pingv1.FailRequest{Code: 7})
+	assert.Nil(t, err)
+	t.Run("details", func(t *testing.T) {
+		t.Parallel()
+		status := newStatus(statusType, int32(connect.CodeFailedPrecondition), "oh no", first, second)
+		connectErr := connect.NewErrorFromStatus(status)
+		assert.NotNil(t, connectErr)
+		assert.Equal(t, connectErr.Code(), connect.CodeFailedPrecondition)
+		assert.Equal(t, connectErr.Message(), "oh no")
+		details := connectErr.Details()
+		assert.Equal(t, len(details), 2)
+		for i, want := range []proto.Message{&pingv1.PingRequest{Number: 42}, &pingv1.FailRequest{Code: 7}} {
+			value, err := details[i].Value()
+			assert.Nil(t, err)
+			assert.Equal(t, value, want)
+		}
+		assert.Equal(t, details[0].Bytes(), first.GetValue())
+	})
+	t.Run("unknown_code", func(t *testing.T) {
+		t.Parallel()
+		connectErr := connect.NewErrorFromStatus(newStatus(statusType, 99, "from the future"))
+		assert.Equal(t, connectErr.Code(), connect.CodeUnknown)
+		assert.Equal(t, connectErr.Message(), "from the future")
+	})
+	t.Run("ok", func(t *testing.T) {
+		t.Parallel()
+		assert.True(t, connect.NewErrorFromStatus(newStatus(statusType, 0, "")) == nil)
+		assert.True(t, connect.NewErrorFromStatus(nil) == nil)
+	})
+	t.Run("not_a_status", func(t *testing.T) {
+		t.Parallel()
+		connectErr := connect.NewErrorFromStatus(&pingv1.PingRequest{})
+		assert.Equal(t, connectErr.Code(), connect.CodeInternal)
+	})
+}
+
+func TestErrorToStatus(t *testing.T) {
+	t.Parallel()
+	statusType := newStatusType(t)
+	t.Run("round_trip", func(t *testing.T) {
+		t.Parallel()
+		first, err := anypb.New(&pingv1.PingRequest{Number: 42})
+		assert.Nil(t, err)
+		second, err := anypb.New(&pingv1.FailRequest{Code: 7})
+		assert.Nil(t, err)
+		original := newStatus(statusType, int32(connect.CodeAborted), "try again", first, second)
+		converted := statusType.New().Interface()
+		assert.Nil(t, connect.NewErrorFromStatus(original).ToStatus(converted))
+		assert.True(t, proto.Equal(converted, original))
+	})
+	t.Run("error", func(t *testing.T) {
+		t.Parallel()
+		connectErr := connect.NewError(connect.CodePermissionDenied, errors.New("go away"))
+		detail, err := connect.NewErrorDetail(&pingv1.PingResponse{Number: 1})
+		assert.Nil(t, err)
+		connectErr.AddDetail(detail)
+		// Existing contents are replaced.
+		status := newStatus(statusType, int32(connect.CodeInternal), "stale")
+		assert.Nil(t, connectErr.ToStatus(status))
+		wantDetail, err := anypb.New(&pingv1.PingResponse{Number: 1})
+		assert.Nil(t, err)
+		want := newStatus(statusType, int32(connect.CodePermissionDenied), "go away", wantDetail)
+		assert.True(t, proto.Equal(status, want))
+	})
+	t.Run("nil", func(t *testing.T) {
+		t.Parallel()
+		status := newStatus(statusType, int32(connect.CodeInternal), "stale")
+		var connectErr *connect.Error
+		assert.Nil(t, connectErr.ToStatus(status))
+		assert.True(t, proto.Equal(status, newStatus(statusType, 0, "")))
+	})
+	t.Run("not_a_status", func(t *testing.T) {
+		t.Parallel()
+		err := connect.NewError(connect.CodeInternal, nil).ToStatus(&pingv1.PingRequest{})
+		assert.NotNil(t, err)
+	})
+}
+
+// newStatusType builds google.rpc.Status from its schema, so the tests don't
+// depend on the generated type in google.golang.org/genproto.
+func newStatusType(t *testing.T) protoreflect.MessageType {
+	t.Helper()
+	file, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:       proto.String("google/rpc/status.proto"),
+		Package:    proto.String("google.rpc"),
+		Dependency: []string{"google/protobuf/any.proto"},
+		Syntax:     proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Status"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				{
+					Name:     proto.String("code"),
+					JsonName: proto.String("code"),
+					Number:   proto.Int32(1),
+					Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+					Type:     descriptorpb.FieldDescriptorProto_TYPE_INT32.Enum(),
+				},
+				{
+					Name:     proto.String("message"),
+					JsonName: proto.String("message"),
+					Number:   proto.Int32(2),
+					Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+					Type:     descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+				},
+				{
+					Name:     proto.String("details"),
+					JsonName: proto.String("details"),
+					Number:   proto.Int32(3),
+					Label:    descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum(),
+					Type:     descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum(),
+					TypeName: proto.String(".google.protobuf.Any"),
+				},
+			},
+		}},
+	}, protoregistry.GlobalFiles)
+	assert.Nil(t, err)
+	return dynamicpb.NewMessageType(file.Messages().Get(0))
+}
+
+func newStatus(statusType protoreflect.MessageType, code int32, message string, details ...*anypb.Any) proto.Message {
+	status := statusType.New()
+	fields := status.Descriptor().Fields()
+	status.Set(fields.ByName("code"), protoreflect.ValueOfInt32(code))
+	status.Set(fields.ByName("message"), protoreflect.ValueOfString(message))
+	list := status.Mutable(fields.ByName("details")).List()
+	for _, detail := range details {
+		list.Append(protoreflect.ValueOfMessage(detail.ProtoReflect()))
+	}
+	return status.Interface()
+}
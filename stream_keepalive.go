@@ -0,0 +1,324 @@
+// Copyright 2021-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// connectHeaderKeepalive carries a peer's keepalive interval in
+	// milliseconds. Clients send it to offer keepalives, and handlers accept by
+	// sending their own interval back in the response headers. It's the same
+	// for every protocol.
+	connectHeaderKeepalive = "Connect-Keepalive-Ms"
+
+	// flagEnvelopeKeepalive marks an empty envelope as a keepalive ping. Peers
+	// that have agreed to keepalives discard pings, so they never reach
+	// applications. The Connect and gRPC protocols leave this bit unused.
+	flagEnvelopeKeepalive = 0b01000000
+
+	defaultKeepaliveTimeout = 20 * time.Second
+)
+
+// keepalivePing is an empty envelope flagged as a ping.
+var keepalivePing = [5]byte{flagEnvelopeKeepalive} //nolint:gochecknoglobals
+
+// keepalivePinger sends a ping whenever a stream has written nothing for an
+// interval. Writes to the stream hold the pinger between hold and release, so
+// pings never land in the middle of a message.
+type keepalivePinger struct {
+	clock    Clock
+	interval time.Duration
+	ping     func() error // called with mu held
+
+	started atomic.Bool
+	stopped atomic.Bool
+
+	mu        sync.Mutex
+	lastWrite time.Time
+}
+
+func newKeepalivePinger(clock Clock, interval time.Duration, ping func() error) *keepalivePinger {
+	return &keepalivePinger{clock: clock, interval: interval, ping: ping}
+}
+
+// hold holds off pings while the caller writes to the stream.
+func (p *keepalivePinger) hold() {
+	p.mu.Lock()
+}
+
+func (p *keepalivePinger) release() {
+	p.lastWrite = p.clock.Now()
+	p.mu.Unlock()
+}
+
+// start begins pinging, once the peer has accepted keepalives. It's a no-op
+// if the pinger has already started.
+func (p *keepalivePinger) start() {
+	if p.started.CompareAndSwap(false, true) {
+		p.clock.AfterFunc(p.interval, p.tick)
+	}
+}
+
+func (p *keepalivePinger) tick() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stopped.Load() {
+		return
+	}
+	now := p.clock.Now()
+	if idle := now.Sub(p.lastWrite); idle < p.interval {
+		p.clock.AfterFunc(p.interval-idle, p.tick)
+		return
+	}
+	if err := p.ping(); err != nil {
+		// The stream is broken, and its next read or write will say why.
+		p.stopped.Store(true)
+		return
+	}
+	p.lastWrite = now
+	p.clock.AfterFunc(p.interval, p.tick)
+}
+
+// stop stops pinging without waiting for a ping in progress, which may be
+// blocked until the caller closes the stream. It's safe to call on a nil
+// pinger.
+func (p *keepalivePinger) stop() {
+	if p != nil {
+		p.stopped.Store(true)
+	}
+}
+
+// close stops pinging, waiting for any ping in progress to finish. It's safe
+// to call on a nil pinger.
+func (p *keepalivePinger) close() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stopped.Store(true)
+}
+
+// keepaliveReader discards the pings in an enveloped stream. If timeout is
+// positive, a read that waits longer than timeout fails with CodeUnavailable:
+// the peer should have pinged long before, so it's presumably gone.
+type keepaliveReader struct {
+	body    io.ReadCloser
+	clock   Clock
+	timeout time.Duration
+	// armed reports whether to time reads. If nil, they're always timed.
+	armed func() bool
+
+	prefix    [5]byte
+	prefixN   int    // bytes of the prefix read so far
+	pending   []byte // prefix of the current message, not yet returned
+	remaining int64  // bytes of the current message not yet returned
+	timedOut  atomic.Bool
+}
+
+func (r *keepaliveReader) Read(data []byte) (int, error) {
+	for {
+		if len(r.pending) > 0 {
+			n := copy(data, r.pending)
+			r.pending = r.pending[n:]
+			return n, nil
+		}
+		if r.remaining > 0 {
+			if int64(len(data)) > r.remaining {
+				data = data[:r.remaining]
+			}
+			n, err := r.read(data)
+			r.remaining -= int64(n)
+			return n, err
+		}
+		n, err := r.read(r.prefix[r.prefixN:])
+		r.prefixN += n
+		if r.prefixN < len(r.prefix) {
+			if err == nil {
+				continue
+			}
+			if r.prefixN > 0 && errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+		// We have a whole prefix. Any error will recur on the next read.
+		r.prefixN = 0
+		size := binary.BigEndian.Uint32(r.prefix[1:])
+		if r.prefix[0] == flagEnvelopeKeepalive && size == 0 {
+			continue
+		}
+		r.pending = r.prefix[:]
+		r.remaining = int64(size)
+	}
+}
+
+func (r *keepaliveReader) Close() error {
+	return r.body.Close()
+}
+
+func (r *keepaliveReader) read(data []byte) (int, error) {
+	if r.timeout > 0 && (r.armed == nil || r.armed()) {
+		// Closing the body is the only way to interrupt a blocked read.
+		stop := r.clock.AfterFunc(r.timeout, func() {
+			r.timedOut.Store(true)
+			_ = r.body.Close()
+		})
+		defer stop()
+	}
+	n, err := r.body.Read(data)
+	if err != nil && r.timedOut.Load() {
+		err = errorf(CodeUnavailable, "keepalive timeout: received nothing from peer for %v", r.timeout)
+	}
+	return n, err
+}
+
+// keepaliveResponseWriter serializes a handler's writes with its pings. A
+// handler can't ping before it sends the response headers, which say that it
+// accepts keepalives, so the first write or flush starts the pinger.
+type keepaliveResponseWriter struct {
+	http.ResponseWriter
+
+	pinger *keepalivePinger
+}
+
+func (w *keepaliveResponseWriter) Write(data []byte) (int, error) {
+	w.pinger.hold()
+	defer w.pinger.release()
+	n, err := w.ResponseWriter.Write(data)
+	w.pinger.start()
+	return n, err
+}
+
+func (w *keepaliveResponseWriter) WriteHeader(statusCode int) {
+	w.pinger.hold()
+	defer w.pinger.release()
+	w.ResponseWriter.WriteHeader(statusCode)
+	w.pinger.start()
+}
+
+func (w *keepaliveResponseWriter) Flush() {
+	_ = w.FlushError()
+}
+
+func (w *keepaliveResponseWriter) FlushError() error {
+	w.pinger.hold()
+	defer w.pinger.release()
+	err := http.NewResponseController(w.ResponseWriter).Flush()
+	w.pinger.start()
+	return err
+}
+
+// Unwrap lets [http.ResponseController] reach the underlying writer.
+func (w *keepaliveResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// acceptKeepalive accepts the keepalives offered by a streaming client,
+// returning the response writer the handler should use and the pinger it
+// must close before it finishes the response. If the client didn't offer
+// keepalives, it returns the response writer unchanged and a nil pinger.
+func (h *Handler) acceptKeepalive(responseWriter http.ResponseWriter, request *http.Request) (http.ResponseWriter, *keepalivePinger) {
+	if h.keepaliveInterval <= 0 || h.spec.StreamType == StreamTypeUnary || request.ProtoMajor < 2 {
+		// Over HTTP/1.1, we can't close the request body to interrupt a blocked
+		// read.
+		return responseWriter, nil
+	}
+	if connectAcceptsNewlineDelimitedJSON(request.Header) {
+		// Newline-delimited responses don't have envelopes to ping with.
+		return responseWriter, nil
+	}
+	if _, ok := responseWriter.(http.Flusher); !ok {
+		return responseWriter, nil
+	}
+	clientInterval, ok := parseKeepaliveInterval(getHeaderCanonical(request.Header, connectHeaderKeepalive))
+	if !ok {
+		return responseWriter, nil
+	}
+	pinger := newKeepalivePinger(h.clock, h.keepaliveInterval, func() error {
+		if _, err := responseWriter.Write(keepalivePing[:]); err != nil {
+			return err
+		}
+		return http.NewResponseController(responseWriter).Flush()
+	})
+	// Until the client sees our response headers, it doesn't know to ping.
+	request.Body = &keepaliveReader{
+		body:    request.Body,
+		clock:   h.clock,
+		timeout: clientInterval + h.keepaliveTimeout,
+		armed:   pinger.started.Load,
+	}
+	setHeaderCanonical(responseWriter.Header(), connectHeaderKeepalive, formatKeepaliveInterval(h.keepaliveInterval))
+	return &keepaliveResponseWriter{ResponseWriter: responseWriter, pinger: pinger}, pinger
+}
+
+// offerKeepalive offers to send keepalives on a streaming call. If the server
+// accepts, startKeepalive starts pinging once the response arrives.
+func (d *duplexHTTPCall) offerKeepalive(clock Clock, interval, timeout time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	setHeaderCanonical(d.request.Header, connectHeaderKeepalive, formatKeepaliveInterval(interval))
+	d.keepaliveTimeout = timeout
+	d.pinger = newKeepalivePinger(clock, interval, func() error {
+		_, err := d.requestBodyWriter.Write(keepalivePing[:])
+		return err
+	})
+}
+
+func (d *duplexHTTPCall) startKeepalive(response *http.Response) {
+	if d.pinger == nil {
+		return
+	}
+	serverInterval, ok := parseKeepaliveInterval(getHeaderCanonical(response.Header, connectHeaderKeepalive))
+	if !ok {
+		// The server doesn't support keepalives, so it would mistake our pings
+		// for the end of the stream.
+		d.pinger.stop()
+		return
+	}
+	response.Body = &keepaliveReader{
+		body:    response.Body,
+		clock:   d.pinger.clock,
+		timeout: serverInterval + d.keepaliveTimeout,
+	}
+	if d.requestBodyWriter != nil {
+		d.pinger.start()
+	}
+}
+
+func formatKeepaliveInterval(interval time.Duration) string {
+	return strconv.FormatInt(max(interval.Milliseconds(), 1), 10 /* base */)
+}
+
+func parseKeepaliveInterval(value string) (time.Duration, bool) {
+	if value == "" || len(value) > 10 {
+		return 0, false
+	}
+	millis, err := strconv.ParseInt(value, 10 /* base */, 64 /* bitsize */)
+	if err != nil || millis <= 0 {
+		return 0, false
+	}
+	return time.Duration(millis) * time.Millisecond, true
+}
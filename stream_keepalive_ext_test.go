@@ -0,0 +1,156 @@
+// Copyright 2021-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	connect "connectrpc.com/connect"
+	"connectrpc.com/connect/internal/assert"
+	pingv1 "connectrpc.com/connect/internal/gen/connect/ping/v1"
+	"connectrpc.com/connect/internal/gen/connect/ping/v1/pingv1connect"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+func TestWithStreamKeepalive(t *testing.T) {
+	t.Parallel()
+	const (
+		natTimeout = 300 * time.Millisecond
+		idle       = 3 * natTimeout
+		interval   = natTimeout / 3
+		timeout    = natTimeout / 3
+	)
+	keepalive := connect.WithStreamKeepalive(interval, timeout)
+	// newServer starts a server whose CumSum handler reports the error that
+	// ended each stream.
+	newServer := func(t *testing.T, opts ...connect.HandlerOption) (*httptest.Server, <-chan error) {
+		t.Helper()
+		errs := make(chan error, 1)
+		mux := http.NewServeMux()
+		mux.Handle(pingv1connect.NewPingServiceHandler(&pluggablePingServer{
+			cumSum: func(_ context.Context, stream *connect.BidiStream[pingv1.CumSumRequest, pingv1.CumSumResponse]) error {
+				var sum int64
+				for {
+					msg, err := stream.Receive()
+					if err != nil {
+						errs <- err
+						if errors.Is(err, io.EOF) {
+							return nil
+						}
+						return err
+					}
+					sum += msg.GetNumber()
+					if err := stream.Send(&pingv1.CumSumResponse{Sum: sum}); err != nil {
+						return err
+					}
+				}
+			},
+		}, opts...))
+		server := httptest.NewServer(h2c.NewHandler(mux, &http2.Server{}))
+		t.Cleanup(server.Close)
+		return server, errs
+	}
+	newStream := func(t *testing.T, proxy *natProxy, opts ...connect.ClientOption) *connect.BidiStreamForClient[pingv1.CumSumRequest, pingv1.CumSumResponse] {
+		t.Helper()
+		// Disable HTTP/2 pings, so that only our keepalives keep the connection
+		// alive.
+		transport := connect.NewHTTP2Transport(connect.HTTP2Settings{AllowHTTP: true, ReadIdleTimeout: -1})
+		t.Cleanup(transport.CloseIdleConnections)
+		client := pingv1connect.NewPingServiceClient(&http.Client{Transport: transport}, proxy.URL(), opts...)
+		stream := client.CumSum(context.Background())
+		t.Cleanup(func() {
+			_ = stream.CloseRequest()
+			_ = stream.CloseResponse()
+		})
+		assert.Nil(t, stream.Send(&pingv1.CumSumRequest{Number: 1}))
+		msg, err := stream.Receive()
+		assert.Nil(t, err)
+		assert.Equal(t, msg.GetSum(), 1)
+		return stream
+	}
+	for _, protocol := range []struct {
+		name string
+		opts []connect.ClientOption
+	}{
+		{name: "connect"},
+		{name: "grpc", opts: []connect.ClientOption{connect.WithGRPC()}},
+		{name: "grpcweb", opts: []connect.ClientOption{connect.WithGRPCWeb()}},
+	} {
+		clientOpts := append([]connect.ClientOption{keepalive}, protocol.opts...)
+		t.Run(protocol.name, func(t *testing.T) {
+			t.Parallel()
+			t.Run("idle_stream_survives", func(t *testing.T) {
+				t.Parallel()
+				server, _ := newServer(t, keepalive)
+				proxy := newNATProxy(t, server.Listener.Addr().String(), natTimeout)
+				stream := newStream(t, proxy, clientOpts...)
+				time.Sleep(idle)
+				// Pings never reach either application.
+				assert.Nil(t, stream.Send(&pingv1.CumSumRequest{Number: 2}))
+				msg, err := stream.Receive()
+				assert.Nil(t, err)
+				assert.Equal(t, msg.GetSum(), 3)
+				assert.Zero(t, proxy.Dropped())
+			})
+			t.Run("not_accepted", func(t *testing.T) {
+				t.Parallel()
+				server, _ := newServer(t)
+				proxy := newNATProxy(t, server.Listener.Addr().String(), 0)
+				stream := newStream(t, proxy, clientOpts...)
+				time.Sleep(3 * interval)
+				// The handler didn't accept keepalives, so the client didn't ping.
+				assert.Nil(t, stream.Send(&pingv1.CumSumRequest{Number: 2}))
+				msg, err := stream.Receive()
+				assert.Nil(t, err)
+				assert.Equal(t, msg.GetSum(), 3)
+				assert.Equal(t, stream.ResponseHeader().Get("Connect-Keepalive-Ms"), "")
+			})
+			t.Run("dead_server_detected", func(t *testing.T) {
+				t.Parallel()
+				server, _ := newServer(t, keepalive)
+				proxy := newNATProxy(t, server.Listener.Addr().String(), 0)
+				stream := newStream(t, proxy, clientOpts...)
+				// The server disappears without closing the connection, so only the
+				// missing pings tell the client that it's gone.
+				proxy.Blackhole()
+				start := time.Now()
+				_, err := stream.Receive()
+				assert.NotNil(t, err)
+				assert.Equal(t, connect.CodeOf(err), connect.CodeUnavailable)
+				assert.True(t, time.Since(start) < 10*time.Second)
+			})
+			t.Run("dead_client_detected", func(t *testing.T) {
+				t.Parallel()
+				server, errs := newServer(t, keepalive)
+				proxy := newNATProxy(t, server.Listener.Addr().String(), 0)
+				newStream(t, proxy, clientOpts...)
+				proxy.Blackhole()
+				select {
+				case err := <-errs:
+					assert.Equal(t, connect.CodeOf(err), connect.CodeUnavailable)
+				case <-time.After(10 * time.Second):
+					t.Fatal("handler didn't notice that the client was gone")
+				}
+			})
+		})
+	}
+}
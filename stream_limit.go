@@ -0,0 +1,103 @@
+// Copyright 2021-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+)
+
+// errTooManyStreams is the error sent to peers over their stream limit.
+var errTooManyStreams = errors.New("too many concurrent streams")
+
+// LimitStreamsPerPeer returns a handler [Interceptor] that limits how many
+// streaming RPCs each peer may have open at once. Streams over the limit are
+// rejected with [CodeResourceExhausted]; a peer may open new streams again as
+// soon as one of its active streams finishes, however it finishes.
+//
+// The keyFn groups peers. If it's nil, peers are grouped by the host in
+// [Peer].Addr, so all connections from one IP address share a limit. Each
+// interceptor keeps its own counts: install the same one on several handlers
+// to limit a peer's streams across all of them. Unary RPCs aren't counted.
+func LimitStreamsPerPeer(maxStreams int, keyFn func(Peer) string) Interceptor {
+	if keyFn == nil {
+		keyFn = peerHost
+	}
+	return &streamLimitInterceptor{
+		max:    maxStreams,
+		keyFn:  keyFn,
+		active: make(map[string]int),
+	}
+}
+
+// streamLimitInterceptor counts each key's active streams.
+type streamLimitInterceptor struct {
+	max   int
+	keyFn func(Peer) string
+
+	mu     sync.Mutex
+	active map[string]int
+}
+
+func (i *streamLimitInterceptor) WrapUnary(next UnaryFunc) UnaryFunc {
+	return next
+}
+
+func (i *streamLimitInterceptor) WrapStreamingClient(next StreamingClientFunc) StreamingClientFunc {
+	return next
+}
+
+func (i *streamLimitInterceptor) WrapStreamingHandler(next StreamingHandlerFunc) StreamingHandlerFunc {
+	return func(ctx context.Context, conn StreamingHandlerConn) error {
+		key := i.keyFn(conn.Peer())
+		if !i.acquire(key) {
+			return NewError(CodeResourceExhausted, errTooManyStreams)
+		}
+		// Deferring the release covers handlers that return errors, handlers
+		// whose contexts are canceled, and handlers that panic.
+		defer i.release(key)
+		return next(ctx, conn)
+	}
+}
+
+func (i *streamLimitInterceptor) acquire(key string) bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.active[key] >= i.max {
+		return false
+	}
+	i.active[key]++
+	return true
+}
+
+func (i *streamLimitInterceptor) release(key string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.active[key]--
+	if i.active[key] <= 0 {
+		// Don't let the map grow with every peer we've ever seen.
+		delete(i.active, key)
+	}
+}
+
+func peerHost(peer Peer) string {
+	host, _, err := net.SplitHostPort(peer.Addr)
+	if err != nil {
+		return peer.Addr
+	}
+	return host
+}
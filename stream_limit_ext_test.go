@@ -0,0 +1,124 @@
+// Copyright 2021-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	connect "connectrpc.com/connect"
+	"connectrpc.com/connect/internal/assert"
+	pingv1 "connectrpc.com/connect/internal/gen/connect/ping/v1"
+	"connectrpc.com/connect/internal/gen/connect/ping/v1/pingv1connect"
+	"connectrpc.com/connect/internal/memhttp/memhttptest"
+)
+
+func TestLimitStreamsPerPeer(t *testing.T) {
+	t.Parallel()
+	const limit = 3
+	// Key by protocol, so each subtest below has a limit of its own.
+	byProtocol := func(peer connect.Peer) string { return peer.Protocol }
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(
+		pingServer{},
+		connect.WithInterceptors(connect.LimitStreamsPerPeer(limit, byProtocol)),
+	))
+	server := memhttptest.NewServer(t, mux)
+	type stream = *connect.BidiStreamForClient[pingv1.CumSumRequest, pingv1.CumSumResponse]
+	// open starts a stream and waits for the handler to respond, so that the
+	// stream is certainly counted.
+	open := func(ctx context.Context, client pingv1connect.PingServiceClient) (stream, error) {
+		stream := client.CumSum(ctx)
+		if err := stream.Send(&pingv1.CumSumRequest{Number: 1}); err != nil && !errors.Is(err, io.EOF) {
+			return stream, err
+		}
+		_, err := stream.Receive()
+		return stream, err
+	}
+	closeStream := func(t *testing.T, stream stream) {
+		t.Helper()
+		assert.Nil(t, stream.CloseRequest())
+		_, err := stream.Receive()
+		assert.ErrorIs(t, err, io.EOF)
+		assert.Nil(t, stream.CloseResponse())
+	}
+	assertRejected := func(t *testing.T, client pingv1connect.PingServiceClient) {
+		t.Helper()
+		stream, err := open(context.Background(), client)
+		assert.Equal(t, connect.CodeOf(err), connect.CodeResourceExhausted)
+		assert.Nil(t, stream.CloseResponse())
+	}
+	protocols := []struct {
+		name string
+		opts []connect.ClientOption
+	}{
+		{name: "connect"},
+		{name: "grpc", opts: []connect.ClientOption{connect.WithGRPC()}},
+		{name: "grpcweb", opts: []connect.ClientOption{connect.WithGRPCWeb()}},
+	}
+	for _, protocol := range protocols {
+		t.Run(protocol.name, func(t *testing.T) {
+			t.Parallel()
+			client := pingv1connect.NewPingServiceClient(server.Client(), server.URL(), protocol.opts...)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			streams := make([]stream, limit)
+			for i := range streams {
+				streamCtx := context.Background()
+				if i == 0 {
+					streamCtx = ctx
+				}
+				var err error
+				streams[i], err = open(streamCtx, client)
+				assert.Nil(t, err)
+			}
+			assertRejected(t, client)
+			// Unary calls aren't limited.
+			_, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{}))
+			assert.Nil(t, err)
+
+			// A clean close frees a slot before the client sees the end of the
+			// stream.
+			closeStream(t, streams[1])
+			streams[1], err = open(context.Background(), client)
+			assert.Nil(t, err)
+			assertRejected(t, client)
+
+			// So does canceling the stream, which makes the handler return an
+			// error. The handler notices asynchronously, so wait for the slot.
+			cancel()
+			assert.Nil(t, streams[0].CloseResponse())
+			deadline := time.Now().Add(5 * time.Second)
+			for {
+				streams[0], err = open(context.Background(), client)
+				if err == nil || time.Now().After(deadline) {
+					break
+				}
+				assert.Equal(t, connect.CodeOf(err), connect.CodeResourceExhausted)
+				assert.Nil(t, streams[0].CloseResponse())
+				time.Sleep(10 * time.Millisecond)
+			}
+			assert.Nil(t, err)
+			assertRejected(t, client)
+			for _, stream := range streams {
+				closeStream(t, stream)
+			}
+		})
+	}
+}
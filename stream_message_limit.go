@@ -0,0 +1,125 @@
+// Copyright 2021-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+)
+
+// streamMessageLimitInterceptor caps the number of messages each streaming
+// call may send and receive. Zero means no limit.
+type streamMessageLimitInterceptor struct {
+	maxSend    int
+	maxReceive int
+}
+
+func (i *streamMessageLimitInterceptor) WrapUnary(next UnaryFunc) UnaryFunc {
+	return next
+}
+
+func (i *streamMessageLimitInterceptor) WrapStreamingClient(next StreamingClientFunc) StreamingClientFunc {
+	return func(ctx context.Context, spec Spec) StreamingClientConn {
+		return &streamMessageLimitClientConn{
+			StreamingClientConn: next(ctx, spec),
+			counter:             streamMessageCounter{limits: i},
+		}
+	}
+}
+
+func (i *streamMessageLimitInterceptor) WrapStreamingHandler(next StreamingHandlerFunc) StreamingHandlerFunc {
+	return func(ctx context.Context, conn StreamingHandlerConn) error {
+		return next(ctx, &streamMessageLimitHandlerConn{
+			StreamingHandlerConn: conn,
+			counter:              streamMessageCounter{limits: i},
+		})
+	}
+}
+
+// streamMessageCounter counts the messages one stream has sent and received.
+// Streams may send and receive concurrently, but not send (or receive)
+// concurrently with themselves, so each count has a single writer.
+type streamMessageCounter struct {
+	limits   *streamMessageLimitInterceptor
+	sent     int
+	received int
+}
+
+// send accounts for a message about to be sent, returning an error if it
+// would exceed the limit.
+func (c *streamMessageCounter) send() error {
+	if c.limits.maxSend > 0 && c.sent >= c.limits.maxSend {
+		return errorf(CodeResourceExhausted, "stream may send at most %d messages", c.limits.maxSend)
+	}
+	c.sent++
+	return nil
+}
+
+// receive accounts for a message that's just been received, returning an
+// error if it exceeds the limit.
+func (c *streamMessageCounter) receive() error {
+	c.received++
+	if c.limits.maxReceive > 0 && c.received > c.limits.maxReceive {
+		return errorf(CodeResourceExhausted, "stream may receive at most %d messages", c.limits.maxReceive)
+	}
+	return nil
+}
+
+type streamMessageLimitClientConn struct {
+	StreamingClientConn
+
+	counter streamMessageCounter
+}
+
+func (c *streamMessageLimitClientConn) Send(msg any) error {
+	if err := c.counter.send(); err != nil {
+		return err
+	}
+	return c.StreamingClientConn.Send(msg)
+}
+
+func (c *streamMessageLimitClientConn) Receive(msg any) error {
+	if err := c.StreamingClientConn.Receive(msg); err != nil {
+		return err
+	}
+	return c.counter.receive()
+}
+
+func (c *streamMessageLimitClientConn) Unwrap() StreamingClientConn {
+	return c.StreamingClientConn
+}
+
+type streamMessageLimitHandlerConn struct {
+	StreamingHandlerConn
+
+	counter streamMessageCounter
+}
+
+func (c *streamMessageLimitHandlerConn) Send(msg any) error {
+	if err := c.counter.send(); err != nil {
+		return err
+	}
+	return c.StreamingHandlerConn.Send(msg)
+}
+
+func (c *streamMessageLimitHandlerConn) Receive(msg any) error {
+	if err := c.StreamingHandlerConn.Receive(msg); err != nil {
+		return err
+	}
+	return c.counter.receive()
+}
+
+func (c *streamMessageLimitHandlerConn) Unwrap() StreamingHandlerConn {
+	return c.StreamingHandlerConn
+}
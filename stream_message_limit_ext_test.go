@@ -0,0 +1,121 @@
+// Copyright 2021-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+
+	connect "connectrpc.com/connect"
+	"connectrpc.com/connect/internal/assert"
+	pingv1 "connectrpc.com/connect/internal/gen/connect/ping/v1"
+	"connectrpc.com/connect/internal/gen/connect/ping/v1/pingv1connect"
+	"connectrpc.com/connect/internal/memhttp"
+	"connectrpc.com/connect/internal/memhttp/memhttptest"
+)
+
+func TestWithMaxStreamMessages(t *testing.T) {
+	t.Parallel()
+	newServer := func(t *testing.T, opts ...connect.HandlerOption) *memhttp.Server {
+		t.Helper()
+		mux := http.NewServeMux()
+		mux.Handle(pingv1connect.NewPingServiceHandler(pingServer{}, opts...))
+		return memhttptest.NewServer(t, mux)
+	}
+	unlimited := newServer(t)
+	limited := newServer(t, connect.WithMaxStreamMessages(3, 2))
+	for _, protocol := range []struct {
+		name string
+		opts []connect.ClientOption
+	}{
+		{name: "connect"},
+		{name: "grpc", opts: []connect.ClientOption{connect.WithGRPC()}},
+		{name: "grpcweb", opts: []connect.ClientOption{connect.WithGRPCWeb()}},
+	} {
+		t.Run(protocol.name, func(t *testing.T) {
+			t.Parallel()
+			t.Run("client_send", func(t *testing.T) {
+				t.Parallel()
+				client := pingv1connect.NewPingServiceClient(
+					unlimited.Client(),
+					unlimited.URL(),
+					append(protocol.opts, connect.WithMaxStreamMessages(2, 0))...,
+				)
+				stream := client.Sum(context.Background())
+				assert.Nil(t, stream.Send(&pingv1.SumRequest{Number: 1}))
+				assert.Nil(t, stream.Send(&pingv1.SumRequest{Number: 2}))
+				err := stream.Send(&pingv1.SumRequest{Number: 3})
+				assert.Equal(t, connect.CodeOf(err), connect.CodeResourceExhausted)
+				assert.Equal(t, err.Error(), "resource_exhausted: stream may send at most 2 messages")
+				// The rejected message was never sent.
+				response, err := stream.CloseAndReceive()
+				assert.Nil(t, err)
+				assert.Equal(t, response.Msg.GetSum(), 3)
+			})
+			t.Run("handler_receive", func(t *testing.T) {
+				t.Parallel()
+				client := pingv1connect.NewPingServiceClient(limited.Client(), limited.URL(), protocol.opts...)
+				stream := client.Sum(context.Background())
+				for number := int64(1); number <= 3; number++ {
+					if err := stream.Send(&pingv1.SumRequest{Number: number}); err != nil {
+						// The handler may fail the call before we finish sending.
+						assert.ErrorIs(t, err, io.EOF)
+						break
+					}
+				}
+				_, err := stream.CloseAndReceive()
+				assert.Equal(t, connect.CodeOf(err), connect.CodeResourceExhausted)
+				assert.Equal(t, err.Error(), "resource_exhausted: stream may receive at most 2 messages")
+			})
+			t.Run("client_receive", func(t *testing.T) {
+				t.Parallel()
+				client := pingv1connect.NewPingServiceClient(
+					unlimited.Client(),
+					unlimited.URL(),
+					append(protocol.opts, connect.WithMaxStreamMessages(0, 3))...,
+				)
+				stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{Number: 5}))
+				assert.Nil(t, err)
+				var numbers []int64
+				for stream.Receive() {
+					numbers = append(numbers, stream.Msg().GetNumber())
+				}
+				assert.Equal(t, numbers, []int64{1, 2, 3})
+				assert.Equal(t, connect.CodeOf(stream.Err()), connect.CodeResourceExhausted)
+				assert.Equal(t, stream.Err().Error(), "resource_exhausted: stream may receive at most 3 messages")
+				assert.Nil(t, stream.Close())
+			})
+			t.Run("handler_send", func(t *testing.T) {
+				t.Parallel()
+				client := pingv1connect.NewPingServiceClient(limited.Client(), limited.URL(), protocol.opts...)
+				stream, err := client.CountUp(context.Background(), connect.NewRequest(&pingv1.CountUpRequest{Number: 5}))
+				assert.Nil(t, err)
+				var numbers []int64
+				for stream.Receive() {
+					numbers = append(numbers, stream.Msg().GetNumber())
+				}
+				assert.Equal(t, numbers, []int64{1, 2, 3})
+				var connectErr *connect.Error
+				assert.True(t, errors.As(stream.Err(), &connectErr))
+				assert.Equal(t, connectErr.Code(), connect.CodeResourceExhausted)
+				assert.Equal(t, connectErr.Message(), "stream may send at most 3 messages")
+				assert.Nil(t, stream.Close())
+			})
+		})
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright 2021-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"context"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// badRequestTypeName is the fully-qualified name of google.rpc.BadRequest, the
+// error detail [WithValidation] attaches to rejected requests.
+const badRequestTypeName = "google.rpc.BadRequest"
+
+// A Validator checks request messages for [WithValidation]. It's typically a
+// small adapter around a rules engine such as protovalidate, which keeps that
+// dependency out of connect.
+type Validator interface {
+	// Validate returns the ways in which msg breaks the rules, if any. A
+	// non-nil error means the message couldn't be validated at all: for
+	// example, because its rules are malformed.
+	Validate(msg proto.Message) ([]FieldViolation, error)
+}
+
+// A FieldViolation describes one invalid field in a request message.
+type FieldViolation struct {
+	// Field is the path to the field, such as "user.emails[0]".
+	Field string
+	// Description explains why the field is invalid.
+	Description string
+}
+
+// validationInterceptor checks each request message a handler receives,
+// rejecting invalid ones with [CodeInvalidArgument].
+type validationInterceptor struct {
+	Interceptor
+
+	validator Validator
+}
+
+func (i *validationInterceptor) WrapUnary(next UnaryFunc) UnaryFunc {
+	return func(ctx context.Context, req AnyRequest) (AnyResponse, error) {
+		if req.Spec().IsClient {
+			return next(ctx, req)
+		}
+		if err := i.validate(req.Any()); err != nil {
+			return nil, err
+		}
+		return next(ctx, req)
+	}
+}
+
+func (i *validationInterceptor) WrapStreamingHandler(next StreamingHandlerFunc) StreamingHandlerFunc {
+	return func(ctx context.Context, conn StreamingHandlerConn) error {
+		return next(ctx, &validationConn{
+			StreamingHandlerConn: conn,
+			interceptor:          i,
+		})
+	}
+}
+
+func (i *validationInterceptor) validate(msg any) *Error {
+	protoMsg, ok := msg.(proto.Message)
+	if !ok {
+		// Rules are defined on Protobuf schemas, so there's nothing to check.
+		return nil
+	}
+	violations, err := i.validator.Validate(protoMsg)
+	if err != nil {
+		return errorf(CodeInternal, "validate request: %w", err)
+	}
+	if len(violations) == 0 {
+		return nil
+	}
+	descriptions := make([]string, len(violations))
+	for j, violation := range violations {
+		descriptions[j] = violation.Field + ": " + violation.Description
+	}
+	validationErr := errorf(CodeInvalidArgument, "invalid request: %s", strings.Join(descriptions, "; "))
+	validationErr.AddDetail(newBadRequestDetail(violations))
+	return validationErr
+}
+
+// validationConn validates each message after it's received. A rejected
+// message is never returned to the handler.
+type validationConn struct {
+	StreamingHandlerConn
+
+	interceptor *validationInterceptor
+}
+
+func (c *validationConn) Receive(msg any) error {
+	if err := c.StreamingHandlerConn.Receive(msg); err != nil {
+		return err
+	}
+	if err := c.interceptor.validate(msg); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (c *validationConn) Unwrap() StreamingHandlerConn {
+	return c.StreamingHandlerConn
+}
+
+// newBadRequestDetail encodes violations as a google.rpc.BadRequest. Encoding
+// the message by hand spares connect a dependency on the generated error
+// detail types; clients that have them can decode the detail as usual.
+func newBadRequestDetail(violations []FieldViolation) *ErrorDetail {
+	var data []byte
+	for _, violation := range violations {
+		// google.rpc.BadRequest.FieldViolation: field = 1, description = 2.
+		var fieldViolation []byte
+		fieldViolation = protowire.AppendTag(fieldViolation, 1, protowire.BytesType)
+		fieldViolation = protowire.AppendString(fieldViolation, violation.Field)
+		fieldViolation = protowire.AppendTag(fieldViolation, 2, protowire.BytesType)
+		fieldViolation = protowire.AppendString(fieldViolation, violation.Description)
+		// google.rpc.BadRequest: repeated FieldViolation field_violations = 1.
+		data = protowire.AppendTag(data, 1, protowire.BytesType)
+		data = protowire.AppendBytes(data, fieldViolation)
+	}
+	return &ErrorDetail{pbAny: &anypb.Any{
+		TypeUrl: defaultAnyResolverPrefix + badRequestTypeName,
+		Value:   data,
+	}}
+}
@@ -0,0 +1,154 @@
+// Copyright 2021-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	connect "connectrpc.com/connect"
+	"connectrpc.com/connect/internal/assert"
+	pingv1 "connectrpc.com/connect/internal/gen/connect/ping/v1"
+	"connectrpc.com/connect/internal/gen/connect/ping/v1/pingv1connect"
+	"connectrpc.com/connect/internal/memhttp/memhttptest"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestWithValidation(t *testing.T) {
+	t.Parallel()
+	var pings atomic.Int32
+	server := &pluggablePingServer{
+		ping: func(_ context.Context, request *connect.Request[pingv1.PingRequest]) (*connect.Response[pingv1.PingResponse], error) {
+			pings.Add(1)
+			return connect.NewResponse(&pingv1.PingResponse{Number: request.Msg.GetNumber()}), nil
+		},
+		cumSum: func(_ context.Context, stream *connect.BidiStream[pingv1.CumSumRequest, pingv1.CumSumResponse]) error {
+			var sum int64
+			for {
+				msg, err := stream.Receive()
+				if errors.Is(err, io.EOF) {
+					return nil
+				} else if err != nil {
+					return err
+				}
+				sum += msg.GetNumber()
+				if err := stream.Send(&pingv1.CumSumResponse{Sum: sum}); err != nil {
+					return err
+				}
+			}
+		},
+	}
+	mux := http.NewServeMux()
+	mux.Handle(pingv1connect.NewPingServiceHandler(
+		server,
+		connect.WithValidation(nonNegativeValidator{}),
+	))
+	httpServer := memhttptest.NewServer(t, mux)
+	// assertViolation checks that the error carries exactly one violation, as a
+	// google.rpc.BadRequest detail.
+	assertViolation := func(t *testing.T, err error) {
+		t.Helper()
+		var connectErr *connect.Error
+		assert.True(t, errors.As(err, &connectErr))
+		assert.Equal(t, connectErr.Code(), connect.CodeInvalidArgument)
+		assert.Equal(t, connectErr.Message(), "invalid request: number: must not be negative")
+		details := connectErr.Details()
+		assert.Equal(t, len(details), 1)
+		assert.Equal(t, details[0].Type(), "google.rpc.BadRequest")
+		assert.Equal(t, decodeBadRequest(t, details[0].Bytes()), []connect.FieldViolation{
+			{Field: "number", Description: "must not be negative"},
+		})
+	}
+	for _, protocol := range []struct {
+		name string
+		opts []connect.ClientOption
+	}{
+		{name: "connect"},
+		{name: "grpc", opts: []connect.ClientOption{connect.WithGRPC()}},
+		{name: "grpcweb", opts: []connect.ClientOption{connect.WithGRPCWeb()}},
+	} {
+		client := pingv1connect.NewPingServiceClient(httpServer.Client(), httpServer.URL(), protocol.opts...)
+		t.Run(protocol.name+"/unary", func(t *testing.T) {
+			before := pings.Load()
+			response, err := client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Number: 1}))
+			assert.Nil(t, err)
+			assert.Equal(t, response.Msg.GetNumber(), 1)
+			_, err = client.Ping(context.Background(), connect.NewRequest(&pingv1.PingRequest{Number: -1}))
+			assertViolation(t, err)
+			// Only the valid request reached the handler.
+			assert.Equal(t, pings.Load(), before+1)
+		})
+		t.Run(protocol.name+"/bidi", func(t *testing.T) {
+			stream := client.CumSum(context.Background())
+			assert.Nil(t, stream.Send(&pingv1.CumSumRequest{Number: 2}))
+			msg, err := stream.Receive()
+			assert.Nil(t, err)
+			assert.Equal(t, msg.GetSum(), 2)
+			assert.Nil(t, stream.Send(&pingv1.CumSumRequest{Number: -3}))
+			_, err = stream.Receive()
+			assertViolation(t, err)
+			assert.Nil(t, stream.CloseRequest())
+			assert.Nil(t, stream.CloseResponse())
+		})
+	}
+}
+
+// nonNegativeValidator rejects messages with a negative number field.
+type nonNegativeValidator struct{}
+
+func (nonNegativeValidator) Validate(msg proto.Message) ([]connect.FieldViolation, error) {
+	field := msg.ProtoReflect().Descriptor().Fields().ByName("number")
+	if field == nil || msg.ProtoReflect().Get(field).Int() >= 0 {
+		return nil, nil
+	}
+	return []connect.FieldViolation{{Field: "number", Description: "must not be negative"}}, nil
+}
+
+// decodeBadRequest parses a serialized google.rpc.BadRequest without depending
+// on its generated type.
+func decodeBadRequest(t *testing.T, data []byte) []connect.FieldViolation {
+	t.Helper()
+	var violations []connect.FieldViolation
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		assert.True(t, n > 0 && num == 1 && typ == protowire.BytesType)
+		data = data[n:]
+		fieldViolation, n := protowire.ConsumeBytes(data)
+		assert.True(t, n > 0)
+		data = data[n:]
+		var violation connect.FieldViolation
+		for len(fieldViolation) > 0 {
+			num, typ, n := protowire.ConsumeTag(fieldViolation)
+			assert.True(t, n > 0 && typ == protowire.BytesType)
+			fieldViolation = fieldViolation[n:]
+			value, n := protowire.ConsumeString(fieldViolation)
+			assert.True(t, n > 0)
+			fieldViolation = fieldViolation[n:]
+			switch num {
+			case 1:
+				violation.Field = value
+			case 2:
+				violation.Description = value
+			}
+		}
+		violations = append(violations, violation)
+	}
+	return violations
+}
@@ -0,0 +1,137 @@
+// Copyright 2021-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// WireStats describes the message bytes a single RPC sent and received on the
+// wire. It's reported by the callback registered with [WithWireStats].
+//
+// Byte counts cover message payloads as they appear on the wire: they're
+// measured after compression and include the five-byte envelope prefix used
+// by streaming Connect, gRPC, and gRPC-Web. They don't include HTTP headers
+// or trailers sent outside the body. Connect GET requests carry their message
+// in the URL; their counts reflect the message before it's URL-encoded.
+type WireStats struct {
+	// Spec describes the RPC.
+	Spec Spec
+	// EnvelopesSent and EnvelopesReceived count the messages framed on the
+	// wire, including protocol-specific messages like the Connect end-of-stream
+	// message and gRPC-Web trailers. Unary Connect messages aren't enveloped,
+	// so each counts as a single envelope.
+	EnvelopesSent     int64
+	EnvelopesReceived int64
+	// BytesSent and BytesReceived count message bytes on the wire.
+	BytesSent     int64
+	BytesReceived int64
+	// UncompressedBytesSent and UncompressedBytesReceived count the same
+	// messages before compression and after decompression, excluding envelope
+	// prefixes.
+	UncompressedBytesSent     int64
+	UncompressedBytesReceived int64
+}
+
+// SendCompressionRatio returns the ratio of uncompressed to on-the-wire bytes
+// for sent messages. It returns zero if no bytes were sent.
+func (s WireStats) SendCompressionRatio() float64 {
+	return compressionRatio(s.UncompressedBytesSent, s.BytesSent)
+}
+
+// ReceiveCompressionRatio returns the ratio of uncompressed to on-the-wire
+// bytes for received messages. It returns zero if no bytes were received.
+func (s WireStats) ReceiveCompressionRatio() float64 {
+	return compressionRatio(s.UncompressedBytesReceived, s.BytesReceived)
+}
+
+func compressionRatio(uncompressed, wire int64) float64 {
+	if wire == 0 {
+		return 0
+	}
+	return float64(uncompressed) / float64(wire)
+}
+
+// wireStatsCounter accumulates WireStats for a single RPC. Sends and receives
+// may happen on different goroutines, so all counters are atomic. All methods
+// are safe to call on a nil counter, which is used when no callback is
+// registered.
+type wireStatsCounter struct {
+	envelopesSent             atomic.Int64
+	envelopesReceived         atomic.Int64
+	bytesSent                 atomic.Int64
+	bytesReceived             atomic.Int64
+	uncompressedBytesSent     atomic.Int64
+	uncompressedBytesReceived atomic.Int64
+
+	spec       Spec
+	report     func(WireStats)
+	reportOnce sync.Once
+}
+
+func newWireStatsCounter(spec Spec, report func(WireStats)) *wireStatsCounter {
+	if report == nil {
+		return nil
+	}
+	return &wireStatsCounter{spec: spec, report: report}
+}
+
+// sent records an envelope of wireBytes, which was uncompressedBytes before
+// compression.
+func (c *wireStatsCounter) sent(wireBytes, uncompressedBytes int) {
+	if c == nil {
+		return
+	}
+	c.envelopesSent.Add(1)
+	c.bytesSent.Add(int64(wireBytes))
+	c.uncompressedBytesSent.Add(int64(uncompressedBytes))
+}
+
+// received records an envelope of wireBytes. Because limits are enforced
+// before decompression, the uncompressed size is recorded separately.
+func (c *wireStatsCounter) received(wireBytes int64) {
+	if c == nil {
+		return
+	}
+	c.envelopesReceived.Add(1)
+	c.bytesReceived.Add(wireBytes)
+}
+
+// receivedUncompressed records the decompressed size of a received envelope.
+func (c *wireStatsCounter) receivedUncompressed(uncompressedBytes int) {
+	if c == nil {
+		return
+	}
+	c.uncompressedBytesReceived.Add(int64(uncompressedBytes))
+}
+
+// finish reports the accumulated stats. Only the first call has any effect.
+func (c *wireStatsCounter) finish() {
+	if c == nil {
+		return
+	}
+	c.reportOnce.Do(func() {
+		c.report(WireStats{
+			Spec:                      c.spec,
+			EnvelopesSent:             c.envelopesSent.Load(),
+			EnvelopesReceived:         c.envelopesReceived.Load(),
+			BytesSent:                 c.bytesSent.Load(),
+			BytesReceived:             c.bytesReceived.Load(),
+			UncompressedBytesSent:     c.uncompressedBytesSent.Load(),
+			UncompressedBytesReceived: c.uncompressedBytesReceived.Load(),
+		})
+	})
+}
@@ -0,0 +1,112 @@
+// Copyright 2021-2024 The Connect Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package connect
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"connectrpc.com/connect/internal/assert"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestWireStatsEnvelopes(t *testing.T) {
+	t.Parallel()
+	gzipPool := newCompressionPool(
+		func() Decompressor { return &gzip.Reader{} },
+		func() Compressor { return gzip.NewWriter(io.Discard) },
+	)
+	message := wrapperspb.String(strings.Repeat("a", 1024))
+	// 1024 bytes of text plus a 1-byte tag and a 2-byte length.
+	const messageSize = 1027
+	testCases := []struct {
+		name            string
+		compressionPool *compressionPool
+	}{
+		{name: "uncompressed"},
+		{name: "compressed", compressionPool: gzipPool},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+			var sentStats, receivedStats WireStats
+			wire := &bytes.Buffer{}
+			writer := envelopeWriter{
+				ctx:             context.Background(),
+				sender:          writeSender{writer: wire},
+				codec:           &protoBinaryCodec{},
+				compressionPool: testCase.compressionPool,
+				bufferPool:      newBufferPool(),
+				stats:           newWireStatsCounter(Spec{}, func(stats WireStats) { sentStats = stats }),
+			}
+			assert.Nil(t, writer.Marshal(message))
+			assert.Nil(t, writer.Marshal(message))
+			writer.stats.finish()
+			assert.Equal(t, sentStats.EnvelopesSent, 2)
+			assert.Equal(t, sentStats.BytesSent, int64(wire.Len()))
+			assert.Equal(t, sentStats.UncompressedBytesSent, 2*messageSize)
+			if testCase.compressionPool == nil {
+				assert.Equal(t, sentStats.BytesSent, 2*(messageSize+5))
+				assert.Equal(t, sentStats.SendCompressionRatio(), float64(messageSize)/float64(messageSize+5))
+			} else {
+				assert.True(t, sentStats.BytesSent < sentStats.UncompressedBytesSent)
+				assert.True(t, sentStats.SendCompressionRatio() > 1)
+			}
+
+			reader := envelopeReader{
+				ctx:             context.Background(),
+				reader:          wire,
+				codec:           &protoBinaryCodec{},
+				compressionPool: testCase.compressionPool,
+				bufferPool:      newBufferPool(),
+				stats:           newWireStatsCounter(Spec{}, func(stats WireStats) { receivedStats = stats }),
+			}
+			for range 2 {
+				got := &wrapperspb.StringValue{}
+				assert.Nil(t, reader.Unmarshal(got))
+				assert.Equal(t, got.GetValue(), message.GetValue())
+			}
+			reader.stats.finish()
+			assert.Equal(t, receivedStats.EnvelopesReceived, 2)
+			assert.Equal(t, receivedStats.BytesReceived, sentStats.BytesSent)
+			assert.Equal(t, receivedStats.UncompressedBytesReceived, sentStats.UncompressedBytesSent)
+			assert.Equal(t, receivedStats.ReceiveCompressionRatio(), sentStats.SendCompressionRatio())
+		})
+	}
+}
+
+func TestWireStatsCounterNil(t *testing.T) {
+	t.Parallel()
+	var counter *wireStatsCounter
+	assert.Nil(t, newWireStatsCounter(Spec{}, nil))
+	// None of these should panic.
+	counter.sent(1, 1)
+	counter.received(1)
+	counter.receivedUncompressed(1)
+	counter.finish()
+}
+
+func TestWireStatsFinishOnce(t *testing.T) {
+	t.Parallel()
+	var calls int
+	counter := newWireStatsCounter(Spec{}, func(WireStats) { calls++ })
+	counter.finish()
+	counter.finish()
+	assert.Equal(t, calls, 1)
+}